@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/stencil"
+)
+
+// ConvertOptions are the settings POST /convert takes as JSON in its
+// options field. Unset ones keep the CLI defaults; set ones must be
+// positive.
+type ConvertOptions struct {
+	Height        *float64 `json:"height"` // mm
+	WallHeight    *float64 `json:"wall_height"`
+	WallThickness *float64 `json:"wall_thickness"`
+	DPI           *float64 `json:"dpi"`
+	Shrink        string   `json:"shrink"` // As -shrink takes it
+	Mirror        string   `json:"mirror"` // x or y
+	Format        string   `json:"format"` // stl or 3mf
+}
+
+// config returns the conversion settings for o.
+func (o ConvertOptions) config() (stencil.Config, error) {
+	cfg := stencil.DefaultConfig()
+	cfg.PreviewHTML = true
+	if o.Format != "" {
+		cfg.Format = strings.ToLower(o.Format)
+	}
+	for _, f := range []struct {
+		name string
+		v    *float64
+		to   *float64
+	}{
+		{"height", o.Height, &cfg.StencilHeight},
+		{"wall_height", o.WallHeight, &cfg.WallHeight},
+		{"wall_thickness", o.WallThickness, &cfg.WallThickness},
+		{"dpi", o.DPI, &cfg.DPI},
+	} {
+		if f.v == nil {
+			continue
+		}
+		if !(*f.v > 0) || math.IsInf(*f.v, 0) {
+			return stencil.Config{}, fmt.Errorf("%s must be positive, not %g", f.name, *f.v)
+		}
+		*f.to = *f.v
+	}
+	if cfg.Format != "stl" && cfg.Format != "3mf" {
+		return stencil.Config{}, fmt.Errorf("unknown format %q, want stl or 3mf", o.Format)
+	}
+	switch m := strings.ToLower(o.Mirror); m {
+	case "", gerber.MirrorX, gerber.MirrorY:
+		cfg.Mirror = m
+	default:
+		return stencil.Config{}, fmt.Errorf("unknown mirror %q, want x or y", o.Mirror)
+	}
+	var err error
+	if cfg.ShrinkX, cfg.ShrinkY, err = stencil.ParseShrink(o.Shrink); err != nil {
+		return stencil.Config{}, err
+	}
+	return cfg, cfg.Check()
+}
+
+// convertHandler is POST /convert: it converts the multipart gerber file,
+// or zip archive, with the optional outline and drill files and the JSON
+// options, and responds with the mesh. The X-Stencil-Id header is the id
+// to get its 3D preview with from GET /preview, and its result with the
+// gRPC Report.
+func convertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var opts ConvertOptions
+	if s := r.FormValue("options"); s != "" {
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&opts); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid options: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	cfg, err := opts.config()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid options: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tempDir, ok := makeTempDir(w)
+	if !ok {
+		return
+	}
+	uuid := randomID()
+	gerberPath, gerberName, err := saveUpload(r, "gerber", tempDir, uuid, "paste")
+	if gerberPath != "" {
+		defer os.Remove(gerberPath)
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving gerber file", http.StatusBadRequest)
+		return
+	}
+	outlinePath, _, _ := saveUpload(r, "outline", tempDir, uuid, "outline")
+	drillPath, _, _ := saveUpload(r, "drill", tempDir, uuid, "drill")
+	for _, path := range []string{outlinePath, drillPath} {
+		if path != "" {
+			defer os.Remove(path)
+		}
+	}
+	in, zipDir, err := uploadInputs(stencil.Inputs{Paste: gerberPath, Outline: outlinePath, Drill: drillPath}, gerberName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading archive: %v", err), http.StatusBadRequest)
+		return
+	}
+	if zipDir != "" {
+		defer os.RemoveAll(zipDir)
+	}
+
+	res, err := convertUpload(in, cfg, nil)
+	defer removeOutputs(res)
+	if err != nil {
+		log.Printf("Error processing: %v", err)
+		http.Error(w, fmt.Sprintf("Error processing PCB: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	contentType := "model/stl"
+	if cfg.Format == "3mf" {
+		contentType = "model/3mf"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(res.Output))
+	w.Header().Set("X-Stencil-Id", stencilID(res.Output))
+	w.Header().Set("X-Triangles", strconv.Itoa(res.Triangles))
+	http.ServeFile(w, r, res.Output)
+}
+
+// convertUpload converts uploaded files with cfg, for POST /convert and the
+// gRPC Convert, passing each warning to warned, if set, as it's logged. The
+// result is kept for Report until it's older than tempTTL.
+func convertUpload(in stencil.Inputs, cfg stencil.Config, warned func(string)) (stencil.Result, error) {
+	if cfg.Log == nil {
+		cfg.Log = log.Default()
+	}
+	warnings := &warningLog{w: cfg.Log.Writer(), warned: warned}
+	cfg.Log = log.New(warnings, cfg.Log.Prefix(), cfg.Log.Flags())
+	res, err := stencil.Convert(in, cfg)
+	res.Warnings = warnings.take()
+	if err != nil {
+		return res, err
+	}
+	if err := saveResult(res); err != nil {
+		log.Printf("Warning: could not keep the result for Report: %v", err)
+	}
+	return res, nil
+}
+
+// removeOutputs removes what a conversion wrote but its preview page, kept
+// for GET /preview until it's older than tempTTL.
+func removeOutputs(res stencil.Result) {
+	for _, path := range res.Outputs {
+		if filepath.Ext(path) != ".html" {
+			os.Remove(path)
+		}
+	}
+}
+
+// saveResult keeps res in temp as the JSON file of its id.
+func saveResult(res stencil.Result) error {
+	f, err := os.Create(filepath.Join("temp", stencilID(res.Output)+".json"))
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, res); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// savedResult returns the result saveResult kept for id, if there is one.
+func savedResult(id string) (stencil.Result, bool) {
+	var res stencil.Result
+	path, ok := savedFile(id + ".json")
+	if !ok {
+		return res, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &res) != nil {
+		return res, false
+	}
+	return res, true
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"pcb-to-stencil/pkg/stencil"
+)
+
+// BatchResult is how converting one input of a batch went.
+type BatchResult struct {
+	stencil.Result
+	Err  error
+	Took time.Duration
+}
+
+// expandGlobs expands the arguments that are glob patterns, for shells that
+// pass them on as they are. A pattern matching nothing is an error.
+func expandGlobs(args []string) ([]string, error) {
+	var files []string
+	for _, a := range args {
+		if !strings.ContainsAny(a, "*?[") {
+			files = append(files, a)
+			continue
+		}
+		matches, err := filepath.Glob(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", a, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", a)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// isBatch reports whether files are separate inputs to convert each on its
+// own, rather than a paste layer and its outline: more than two, or a
+// second one that is a paste layer or a fab package itself.
+func isBatch(files []string) bool {
+	switch {
+	case len(files) > 2:
+		return true
+	case len(files) < 2:
+		return false
+	}
+	second := files[1]
+	if info, err := os.Stat(second); err == nil && info.IsDir() {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(second)) {
+	case ".zip", ".gbrjob":
+		return true
+	}
+	return stencil.DetectLayer(second).Role == stencil.RolePaste
+}
+
+// checkBatchOutputs returns an error if two of files would write their
+// meshes to the same path, named as convertInput names them: after the
+// paste layer, or the archive, in its directory or cfg.OutDir.
+func checkBatchOutputs(cfg stencil.Config, files []string) error {
+	ext := cfg.Format
+	if ext == "" {
+		ext = "stl"
+	}
+	sel := stencil.LayerSelection{Side: cfg.Side, Paste: cfg.PasteLayer, Outline: cfg.OutlineLayer}
+	seen := make(map[string]string)
+	for _, f := range files {
+		name := f
+		// Archives are named after themselves, and not worth extracting
+		// twice to find out
+		if !strings.EqualFold(filepath.Ext(f), ".zip") {
+			if picked, _, _, err := stencil.ResolveInputs(f, sel); err == nil && picked.Paste != "" {
+				name = picked.Paste
+			}
+		}
+		out := filepath.Clean(strings.TrimSuffix(name, filepath.Ext(name)) + "." + ext)
+		if cfg.OutDir != "" {
+			out = filepath.Join(cfg.OutDir, filepath.Base(out))
+		}
+		if prev, ok := seen[out]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s: rename one, or convert them in batches of their own", prev, f, out)
+		}
+		seen[out] = f
+	}
+	return nil
+}
+
+// runBatch converts each of files with cfg, jobs of them at once, and prints
+// how each went. With report set, for -json, it writes the results to it
+// as a JSON array too. It returns the process exit code: nonzero if any
+// failed.
+func runBatch(cfg stencil.Config, files []string, jobs int, report io.Writer) int {
+	if cfg.Output != "" {
+		fmt.Fprintln(cfg.Stdout, "Error: -o names a single output, use -out-dir for a batch")
+		return 2
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	jobs = min(jobs, len(files))
+	if jobs > 1 && cfg.Confirm {
+		fmt.Fprintln(cfg.Stdout, "Error: -confirm asks about each input in turn, it can't be used with -jobs")
+		return 2
+	}
+	if err := checkBatchOutputs(cfg, files); err != nil {
+		fmt.Fprintf(cfg.Stdout, "Error: %v\n", err)
+		return 2
+	}
+
+	results := make([]BatchResult, len(files))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				fmt.Fprintf(cfg.Stdout, "==> %s (%d/%d)\n", files[i], i+1, len(files))
+				start := time.Now()
+				res, err := convertInput(cfg, files[i:i+1])
+				if err != nil {
+					res.Error = err.Error()
+					fmt.Fprintf(cfg.Stdout, "Error: %s: %v\n", files[i], err)
+				}
+				results[i] = BatchResult{Result: res, Err: err, Took: time.Since(start)}
+			}
+		}()
+	}
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	fmt.Fprintln(cfg.Stdout, "\nBatch summary:")
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(cfg.Stdout, "  FAILED  %s: %v\n", r.Input, r.Err)
+			continue
+		}
+		fmt.Fprintf(cfg.Stdout, "  ok      %s -> %s (%.1fs)\n", r.Input, r.Output, r.Took.Seconds())
+	}
+	fmt.Fprintf(cfg.Stdout, "%d converted, %d failed\n", len(files)-failed, failed)
+	if report != nil {
+		all := make([]stencil.Result, len(results))
+		for i, r := range results {
+			all[i] = r.Result
+		}
+		writeJSON(report, all)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
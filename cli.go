@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/stencil"
+)
+
+// runCLI converts the inputs in args with cfg, each on its own for a batch,
+// jobs at once. asJSON prints the results as JSON on stdout.
+func runCLI(cfg stencil.Config, args []string, asJSON bool, jobs int) {
+	if len(args) < 1 {
+		fmt.Println("Usage: go run . [convert] [options] <path_to_gerber_file|gerbers.zip|gerber_dir|job.gbrjob> [path_to_outline_gerber_file | more inputs...]")
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		fmt.Println("Example: go run . -height=0.3 MyPCB.GTP MyPCB.GKO")
+		os.Exit(1)
+	}
+	files, err := expandGlobs(args)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var report io.Writer
+	if asJSON {
+		if cfg.Output == "-" {
+			log.Fatalf("Error: -json and -o - both write to stdout")
+		}
+		// The JSON goes to stdout, so everything else goes to stderr
+		report, cfg.Stdout = os.Stdout, os.Stderr
+	}
+	if isBatch(files) {
+		os.Exit(runBatch(cfg, files, jobs, report))
+	}
+
+	// Progress bars only make sense on a terminal
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		cfg.Progress = newProgressBar(os.Stderr).update
+	}
+	res, err := convertInput(cfg, files)
+	if asJSON {
+		if err != nil {
+			res.Error = err.Error()
+			log.Printf("Error: %v", err)
+		}
+		writeJSON(report, res)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Fprintln(cfg.Stdout, "Success! Happy printing.")
+}
+
+// convertInput converts the paste layer, archive, directory or job file at
+// args[0], with the outline at args[1] if given. The result has the
+// warnings logged on the way, for -json.
+func convertInput(cfg stencil.Config, args []string) (res stencil.Result, err error) {
+	warnings := &warningLog{w: cfg.Log.Writer()}
+	cfg.Log = log.New(warnings, cfg.Log.Prefix(), cfg.Log.Flags())
+	defer func() { res.Warnings = warnings.take() }()
+
+	res = stencil.Result{Input: args[0], Outputs: []string{}}
+	in := stencil.Inputs{Paste: args[0], Bottom: cfg.Bottom, Drill: cfg.Drill}
+	if len(args) > 1 {
+		in.Outline = args[1]
+	}
+
+	sel := stencil.LayerSelection{Side: cfg.Side, Paste: cfg.PasteLayer, Outline: cfg.OutlineLayer}
+	picked, chosen, tempDir, err := stencil.ResolveInputs(args[0], sel)
+	if err != nil {
+		return res, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	if picked.Paste != "" && cfg.Confirm {
+		picked, err = stencil.ConfirmLayers(picked, os.Stdin, cfg.Stdout)
+		if err != nil {
+			return res, err
+		}
+	} else if picked.Paste != "" {
+		stencil.ReportLayers(chosen, cfg.Stdout)
+	}
+	if picked.Paste != "" {
+		if in.Outline == "" {
+			in.Outline = picked.Outline
+		}
+		if in.Drill == "" {
+			in.Drill = picked.Drill
+		}
+		if in.Bottom == "" {
+			in.Bottom = picked.Bottom
+		}
+		in.Paste, in.Output, in.Job = picked.Paste, picked.Output, picked.Job
+	}
+	if cfg.Output != "" {
+		if cfg.OutDir != "" {
+			cfg.Log.Printf("Warning: -o is set, ignoring -out-dir")
+		}
+		in.Output = cfg.Output
+	} else if cfg.OutDir != "" {
+		out := in.Output
+		if out == "" {
+			out = strings.TrimSuffix(in.Paste, filepath.Ext(in.Paste)) + ".stl"
+		}
+		in.Output = filepath.Join(cfg.OutDir, filepath.Base(out))
+	}
+	res, err = stencil.Convert(in, cfg)
+	res.Input = args[0]
+	if res.Outputs == nil {
+		res.Outputs = []string{}
+	}
+	return res, err
+}
+
+// interleavedArgs parses the flags among args, which the flag package stops
+// at the first file for, and returns the rest.
+func interleavedArgs(args []string) []string {
+	var files []string
+	for len(args) > 0 {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) > 0 {
+			files = append(files, args[0])
+			args = args[1:]
+		}
+	}
+	return files
+}
+
+// runValidate parses each file and prints a pre-flight report. It returns
+// the process exit code: nonzero if any file has problems.
+func runValidate(args []string) int {
+	if len(args) < 1 {
+		fmt.Println("Usage: go run . validate <path_to_gerber_file> [more_gerber_files...]")
+		return 2
+	}
+
+	code := 0
+	for _, path := range args {
+		gf, err := gerber.Parse(path)
+		if err != nil {
+			log.Printf("Error parsing %s: %v", path, err)
+			code = 1
+			continue
+		}
+		report := stencil.ValidateGerber(path, gf)
+		report.Print(os.Stdout)
+		if !report.OK() {
+			code = 1
+		}
+	}
+	return code
+}
+
+// runCalibrate fits a profile to the measurements in the CSV at args[0] and
+// saves it as name. It returns the process exit code.
+func runCalibrate(name string, args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: go run . calibrate [-profile name | -printer name] <measurements.csv>")
+		return 2
+	}
+	if name == "" {
+		fmt.Println("Error: name the profile to save with -profile, or -printer to apply it to that printer's files")
+		return 2
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	drawn, measured, err := stencil.ReadMeasurements(f)
+	f.Close()
+	if err != nil {
+		fmt.Printf("Error: error reading %s: %v\n", args[0], err)
+		return 1
+	}
+	p, err := stencil.FitProfile(drawn, measured)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Fitted %d openings: %v, %.3f mm RMS error\n", p.Samples, p, p.RMS)
+	for _, size := range []float64{0.3, 0.5, 1.0} {
+		fmt.Printf("  %.1f mm openings will be drawn %.3f mm\n", size, p.Drawn(size))
+	}
+	path, err := stencil.SaveProfile(name, p)
+	if err != nil {
+		fmt.Printf("Error: error saving profile: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Saved profile %q to %s\n", name, path)
+	return 0
+}
+
+// runTestPattern writes the calibration pattern of t as a gerber, at
+// args[0] or testpattern.gbr, and converts it to a stencil with cfg.
+func runTestPattern(cfg stencil.Config, t stencil.TestPattern, args []string) {
+	path := "testpattern.gbr"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	in := stencil.Inputs{Output: cfg.Output}
+	if cfg.OutDir != "" {
+		if cfg.Output != "" {
+			cfg.Log.Printf("Warning: -o is set, ignoring -out-dir")
+		} else {
+			path = filepath.Join(cfg.OutDir, filepath.Base(path))
+		}
+	}
+	if cfg.ShrinkX != (stencil.Shrink{}) || cfg.ShrinkY != (stencil.Shrink{}) {
+		cfg.Log.Printf("Warning: -shrink shrinks every opening of the test pattern on top of its row's own shrink")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatalf("Error: error creating output directory: %v", err)
+	}
+	if err := stencil.WriteTestPattern(path, t); err != nil {
+		log.Fatalf("Error: error writing test pattern: %v", err)
+	}
+	fmt.Fprintf(cfg.Stdout, "Test pattern: %d sizes at %d shrinks, written to %s\n", len(t.Sizes), len(t.Shrinks), path)
+	in.Paste = path
+	if _, err := stencil.Convert(in, cfg); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Fprintln(cfg.Stdout, "Success! Print it and measure the openings: the row that comes out truest to size is the -shrink to use.")
+}
+
+// warningLog passes log output on to w, keeping the warnings for -json and
+// passing each to warned, if set.
+type warningLog struct {
+	w        io.Writer
+	warned   func(string)
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *warningLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	for _, line := range strings.Split(string(bytes.TrimRight(p, "\n")), "\n") {
+		if _, msg, ok := strings.Cut(line, "Warning: "); ok {
+			l.warnings = append(l.warnings, msg)
+			if l.warned != nil {
+				l.warned(msg)
+			}
+		}
+	}
+	l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// take returns the warnings logged since the last call.
+func (l *warningLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.warnings
+	l.warnings = nil
+	if w == nil {
+		w = []string{}
+	}
+	return w
+}
+
+// writeJSON writes v to w, indented.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
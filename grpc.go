@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/stencil"
+	"pcb-to-stencil/pkg/stencilpb"
+)
+
+// grpcMaxMessage is the largest request the gRPC service takes, room for a
+// zip archive of a big board's gerbers.
+const grpcMaxMessage = 128 << 20
+
+// meshChunkSize is how much of the mesh each of Convert's chunks carries.
+const meshChunkSize = 1 << 20
+
+// stencilService is the gRPC service of proto/stencil/v1/stencil.proto,
+// converting as POST /convert does.
+type stencilService struct {
+	stencilpb.UnimplementedStencilServer
+}
+
+// serveGRPC serves the gRPC service on port until the server stops.
+func serveGRPC(port string) {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	s := grpc.NewServer(grpc.MaxRecvMsgSize(grpcMaxMessage))
+	stencilpb.RegisterStencilServer(s, stencilService{})
+	fmt.Printf("Serving gRPC on 0.0.0.0:%s\n", port)
+	log.Fatal(s.Serve(lis))
+}
+
+// Convert converts the request's files as POST /convert does, streaming
+// progress and warnings, then the mesh, then the result.
+func (stencilService) Convert(req *stencilpb.ConvertRequest, stream grpc.ServerStreamingServer[stencilpb.ConvertEvent]) error {
+	o := req.GetOptions()
+	if o == nil {
+		o = &stencilpb.ConvertOptions{}
+	}
+	cfg, err := ConvertOptions{
+		Height:        o.Height,
+		WallHeight:    o.WallHeight,
+		WallThickness: o.WallThickness,
+		DPI:           o.Dpi,
+		Shrink:        o.Shrink,
+		Mirror:        o.Mirror,
+		Format:        o.Format,
+	}.config()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid options: %v", err)
+	}
+	if req.GetGerber() == nil {
+		return status.Error(codes.InvalidArgument, "No gerber file")
+	}
+
+	tempDir := filepath.Join(".", "temp")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("Error creating temp directory: %v", err)
+		return status.Error(codes.Internal, "Error creating temp directory")
+	}
+	uuid := randomID()
+	var in stencil.Inputs
+	for _, f := range []struct {
+		file *stencilpb.InputFile
+		role string
+		to   *string
+	}{
+		{req.Gerber, "paste", &in.Paste},
+		{req.Outline, "outline", &in.Outline},
+		{req.Drill, "drill", &in.Drill},
+	} {
+		if f.file == nil {
+			continue
+		}
+		path, err := saveFile(bytes.NewReader(f.file.Data), f.file.Name, tempDir, uuid, f.role)
+		if path != "" {
+			defer os.Remove(path)
+		}
+		if err != nil {
+			log.Printf("Error saving %s: %v", f.role, err)
+			return status.Errorf(codes.Internal, "Error saving the %s file", f.role)
+		}
+		*f.to = path
+	}
+	in, zipDir, err := uploadInputs(in, req.Gerber.Name)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Error reading archive: %v", err)
+	}
+	if zipDir != "" {
+		defer os.RemoveAll(zipDir)
+	}
+
+	events := &eventStream{stream: stream}
+	cfg.Progress = events.progress
+	res, err := convertUpload(in, cfg, events.warning)
+	defer removeOutputs(res)
+	if err != nil {
+		log.Printf("Error processing: %v", err)
+		return status.Errorf(codes.InvalidArgument, "Error processing PCB: %v", err)
+	}
+	if err := events.mesh(res.Output); err != nil {
+		return err
+	}
+	events.send(&stencilpb.ConvertEvent{Event: &stencilpb.ConvertEvent_Result{Result: resultProto(res)}})
+	return events.err
+}
+
+// Validate runs the checks of the validate subcommand on each file, sending
+// its report before parsing the next.
+func (stencilService) Validate(req *stencilpb.ValidateRequest, stream grpc.ServerStreamingServer[stencilpb.ValidationReport]) error {
+	tempDir := filepath.Join(".", "temp")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("Error creating temp directory: %v", err)
+		return status.Error(codes.Internal, "Error creating temp directory")
+	}
+	for _, f := range req.Gerbers {
+		report, err := validateFile(f, tempDir)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFile parses f from a copy in temp and reports on it.
+func validateFile(f *stencilpb.InputFile, tempDir string) (*stencilpb.ValidationReport, error) {
+	path, err := saveFile(bytes.NewReader(f.Data), f.Name, tempDir, randomID(), "validate")
+	if path != "" {
+		defer os.Remove(path)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", f.Name, err)
+		return nil, status.Errorf(codes.Internal, "Error saving %s", f.Name)
+	}
+	gf, err := gerber.Parse(path)
+	if err != nil {
+		return &stencilpb.ValidationReport{File: f.Name, Error: err.Error()}, nil
+	}
+	r := stencil.ValidateGerber(f.Name, gf)
+	report := &stencilpb.ValidationReport{
+		File:    r.File,
+		Units:   r.Units,
+		Draws:   int32(r.Draws),
+		Arcs:    int32(r.Arcs),
+		Flashes: int32(r.Flashes),
+		Regions: int32(r.Regions),
+		Issues:  r.Issues,
+	}
+	for _, u := range r.Apertures {
+		report.Apertures = append(report.Apertures, &stencilpb.ApertureUsage{
+			DCode:     int32(u.DCode),
+			Shape:     u.Aperture.Type,
+			Flashes:   int32(u.Flashes),
+			Draws:     int32(u.Draws),
+			Undefined: u.Undefined,
+		})
+	}
+	return report, nil
+}
+
+// Report returns the result of the conversion with the id, while it's kept.
+func (stencilService) Report(_ context.Context, req *stencilpb.ReportRequest) (*stencilpb.Result, error) {
+	res, ok := savedResult(req.Id)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "No conversion %q in the last hour", req.Id)
+	}
+	return resultProto(res), nil
+}
+
+// resultProto returns res as the service sends it.
+func resultProto(res stencil.Result) *stencilpb.Result {
+	return &stencilpb.Result{
+		Id:        stencilID(res.Output),
+		Input:     res.Input,
+		Output:    res.Output,
+		Outputs:   res.Outputs,
+		BboxMinMm: res.Min[:],
+		BboxMaxMm: res.Max[:],
+		Apertures: int32(res.Apertures),
+		Triangles: int32(res.Triangles),
+		Warnings:  res.Warnings,
+		Durations: &stencilpb.Durations{
+			RenderS: res.Durations.Render,
+			MeshS:   res.Durations.Mesh,
+			WriteS:  res.Durations.Write,
+			TotalS:  res.Durations.Total,
+		},
+	}
+}
+
+// eventStream sends a conversion's events on a Convert stream, which can't
+// be sent on from several goroutines at once. After a send fails it sends
+// nothing more, and err is why.
+type eventStream struct {
+	stream grpc.ServerStreamingServer[stencilpb.ConvertEvent]
+	mu     sync.Mutex
+	err    error
+	stage  string
+	last   time.Time
+}
+
+func (e *eventStream) send(ev *stencilpb.ConvertEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = e.stream.Send(ev)
+	}
+}
+
+// progress is the conversion's progress.Func. Like the progress bar, it
+// passes on the start and end of each stage but at most ten reports a
+// second in between.
+func (e *eventStream) progress(stage string, done, total int) {
+	e.mu.Lock()
+	now := time.Now()
+	if stage == e.stage && done < total && now.Sub(e.last) < 100*time.Millisecond {
+		e.mu.Unlock()
+		return
+	}
+	e.stage, e.last = stage, now
+	if done >= total {
+		e.stage = "" // The next stage starts afresh even if it has the same name
+	}
+	e.mu.Unlock()
+	e.send(&stencilpb.ConvertEvent{Event: &stencilpb.ConvertEvent_Progress{Progress: &stencilpb.Progress{
+		Stage: stage, Done: int64(done), Total: int64(total),
+	}}})
+}
+
+func (e *eventStream) warning(msg string) {
+	e.send(&stencilpb.ConvertEvent{Event: &stencilpb.ConvertEvent_Warning{Warning: msg}})
+}
+
+// mesh sends the mesh file at path in chunks.
+func (e *eventStream) mesh(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error reading %s: %v", path, err)
+		return status.Error(codes.Internal, "Error reading the mesh")
+	}
+	defer f.Close()
+	name := filepath.Base(path)
+	buf := make([]byte, meshChunkSize)
+	for offset := int64(0); ; {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			e.send(&stencilpb.ConvertEvent{Event: &stencilpb.ConvertEvent_Mesh{Mesh: &stencilpb.FileChunk{
+				Name: name, Offset: offset, Data: bytes.Clone(buf[:n]),
+			}}})
+			offset += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return e.err
+		}
+		if err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			return status.Error(codes.Internal, "Error reading the mesh")
+		}
+		if e.err != nil {
+			return e.err
+		}
+	}
+}
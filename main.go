@@ -1,744 +1,291 @@
 package main
 
 import (
-	"crypto/rand"
-	"embed"
-	"encoding/binary"
-	"encoding/hex"
 	"flag"
 	"fmt"
-	"html/template"
-	"image"
-	"image/png"
-	"io"
 	"log"
-	"math"
-	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
-)
-
-// --- Configuration ---
-
-type Config struct {
-	StencilHeight float64
-	WallHeight    float64
-	WallThickness float64
-	DPI           float64
-	KeepPNG       bool
-}
 
-// Default values
-const (
-	DefaultStencilHeight = 0.16
-	DefaultWallHeight    = 2.0
-	DefaultWallThickness = 1.0
-	DefaultDPI           = 1000.0
+	"pcb-to-stencil/pkg/stencil"
 )
 
-// --- STL Helpers ---
-
-type Point struct {
-	X, Y, Z float64
-}
-
-func WriteSTL(filename string, triangles [][3]Point) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	// Write Binary STL Header (80 bytes)
-	header := make([]byte, 80)
-	copy(header, "Generated by pcb-to-stencil")
-	if _, err := f.Write(header); err != nil {
-		return err
-	}
-
-	// Write Number of Triangles (4 bytes uint32)
-	count := uint32(len(triangles))
-	if err := binary.Write(f, binary.LittleEndian, count); err != nil {
-		return err
-	}
-
-	// Write Triangles
-	// Each triangle is 50 bytes:
-	// Normal (3 floats = 12 bytes)
-	// Vertex 1 (3 floats = 12 bytes)
-	// Vertex 2 (3 floats = 12 bytes)
-	// Vertex 3 (3 floats = 12 bytes)
-	// Attribute byte count (2 bytes uint16)
-
-	// Buffer for a single triangle to minimize syscalls
-	buf := make([]byte, 50)
-
-	for _, t := range triangles {
-		// Normal (0,0,0)
-		binary.LittleEndian.PutUint32(buf[0:4], math.Float32bits(0))
-		binary.LittleEndian.PutUint32(buf[4:8], math.Float32bits(0))
-		binary.LittleEndian.PutUint32(buf[8:12], math.Float32bits(0))
-
-		// Vertex 1
-		binary.LittleEndian.PutUint32(buf[12:16], math.Float32bits(float32(t[0].X)))
-		binary.LittleEndian.PutUint32(buf[16:20], math.Float32bits(float32(t[0].Y)))
-		binary.LittleEndian.PutUint32(buf[20:24], math.Float32bits(float32(t[0].Z)))
-
-		// Vertex 2
-		binary.LittleEndian.PutUint32(buf[24:28], math.Float32bits(float32(t[1].X)))
-		binary.LittleEndian.PutUint32(buf[28:32], math.Float32bits(float32(t[1].Y)))
-		binary.LittleEndian.PutUint32(buf[32:36], math.Float32bits(float32(t[1].Z)))
-
-		// Vertex 3
-		binary.LittleEndian.PutUint32(buf[36:40], math.Float32bits(float32(t[2].X)))
-		binary.LittleEndian.PutUint32(buf[40:44], math.Float32bits(float32(t[2].Y)))
-		binary.LittleEndian.PutUint32(buf[44:48], math.Float32bits(float32(t[2].Z)))
-
-		// Attribute byte count (0)
-		binary.LittleEndian.PutUint16(buf[48:50], 0)
-
-		if _, err := f.Write(buf); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func AddBox(triangles *[][3]Point, x, y, w, h, zHeight float64) {
-	x0, y0 := x, y
-	x1, y1 := x+w, y+h
-	z0, z1 := 0.0, zHeight
-
-	p000 := Point{x0, y0, z0}
-	p100 := Point{x1, y0, z0}
-	p110 := Point{x1, y1, z0}
-	p010 := Point{x0, y1, z0}
-	p001 := Point{x0, y0, z1}
-	p101 := Point{x1, y0, z1}
-	p111 := Point{x1, y1, z1}
-	p011 := Point{x0, y1, z1}
-
-	addQuad := func(a, b, c, d Point) {
-		*triangles = append(*triangles, [3]Point{a, b, c})
-		*triangles = append(*triangles, [3]Point{c, d, a})
-	}
-
-	addQuad(p000, p010, p110, p100) // Bottom
-	addQuad(p101, p111, p011, p001) // Top
-	addQuad(p000, p100, p101, p001) // Front
-	addQuad(p100, p110, p111, p101) // Right
-	addQuad(p110, p010, p011, p111) // Back
-	addQuad(p010, p000, p001, p011) // Left
+// options are the flags that don't go into the Config as they are: those
+// parsed into its settings, and those of the command line itself.
+type options struct {
+	regHoles, framePreset, magnets string
+	shrink, shrinkByArea           string
+	patSizes, patShrinks           string
+	profile                        string
+	exclude, onlyRefs, crop        string
+	mirror                         mirrorFlag
+	labelAt                        string
+	center                         bool
+	origin                         string
+	stlScale                       float64
+	units                          string
+	panel, bed, tiles              string
+	joint                          string
+	jointSize, jointGap, tilePins  float64
+	spacing, panelRails            float64
+	configFile                     string
+	jobs                           int
+	json, server                   bool
+	port, grpcPort                 string
 }
 
-// --- Meshing Logic (Optimized) ---
-
-// ComputeWallMask generates a mask for the wall based on the outline image.
-// It identifies the board area (inside the outline) and creates a wall of
-// specified thickness around it.
-func ComputeWallMask(img image.Image, thicknessMM float64, pixelToMM float64) ([]bool, []bool) {
-	bounds := img.Bounds()
-	w := bounds.Max.X
-	h := bounds.Max.Y
-	size := w * h
-
-	// Helper for neighbors
-	dx := []int{0, 0, 1, -1}
-	dy := []int{1, -1, 0, 0}
-
-	// 1. Identify Outline Pixels (White)
-	isOutline := make([]bool, size)
-	outlineQueue := []int{}
-	for i := 0; i < size; i++ {
-		cx := i % w
-		cy := i / w
-		c := img.At(cx, cy)
-		r, _, _, _ := c.RGBA()
-		if r > 10000 { // White-ish
-			isOutline[i] = true
-			outlineQueue = append(outlineQueue, i)
+func main() {
+	def := stencil.DefaultConfig()
+	cfg := def
+	cfg.Stdout, cfg.Log = os.Stdout, log.Default()
+	var o options
+	flag.Float64Var(&cfg.StencilHeight, "height", def.StencilHeight, "Stencil height in mm")
+	flag.Float64Var(&cfg.WallHeight, "wall-height", def.WallHeight, "Wall height in mm")
+	flag.Float64Var(&cfg.WallThickness, "wall-thickness", def.WallThickness, "Wall thickness in mm")
+	flag.StringVar(&o.magnets, "magnet-pockets", "", "Pockets in the underside of the frame for disc magnets, as d=diameter,h=height,count=n in mm, e.g. d=6,h=2,count=4")
+	flag.StringVar(&o.framePreset, "frame-preset", "", "Widen the frame and punch the hole pattern of a stencil frame or jig plate through it: pin-bar, tension or jig-plate")
+	flag.StringVar(&o.regHoles, "reg-holes", "", "Punch tooling holes through the frame, as diameter[,spacing[,offset]] in mm: one in each corner, or rows along the top and bottom edges spacing apart")
+	flag.Float64Var(&cfg.Clearance, "clearance", 0, "Gap in mm between the board edge and the wall around it, so the board drops into the ledge")
+	flag.Float64Var(&cfg.Locators, "corner-locators", 0, "Replace the wall around the board with L-shaped blocks this many mm long at its bottom left and top right corners")
+	flag.Float64Var(&cfg.DPI, "dpi", def.DPI, "DPI for rendering (lower = smaller file, rougher curves; 0 = auto from the smallest aperture)")
+	flag.Float64Var(&cfg.MinPixels, "min-pixels", def.MinPixels, "With -dpi 0, pixels across the smallest aperture")
+	flag.BoolVar(&cfg.KeepPNG, "keep-png", false, "Save the intermediate PNG file and an annotated preview")
+	flag.BoolVar(&cfg.SVG, "svg", false, "Also write the apertures and board outline as an SVG, for inspection or laser cutting")
+	flag.BoolVar(&cfg.DXF, "dxf", false, "Also write the apertures and board outline as closed polylines in a DXF, for CNC or drag knife cutting")
+	flag.Float64Var(&cfg.Kerf, "kerf", 0, "Width in mm of the laser or tool cut, to move -svg and -dxf cut lines into the openings and out of the outline by half of it")
+	flag.BoolVar(&cfg.GCode, "gcode", false, "Also write G-code for a GRBL laser cutting the apertures and outline, e.g. of a polyimide stencil")
+	flag.BoolVar(&cfg.Dispense, "dispense", false, "Write <name>_dispense.gcode for a paste dispenser on a printer's gantry instead of a stencil")
+	flag.Float64Var(&cfg.Dispenser.Rate, "dispense-rate", def.Dispenser.Rate, "With -dispense, paste the dispenser pushes out in mm³ per second")
+	flag.Float64Var(&cfg.Dispenser.Dot, "dispense-dot", def.Dispenser.Dot, "With -dispense, diameter of a dot of paste in mm")
+	flag.Float64Var(&cfg.Dispenser.Height, "dispense-height", def.Dispenser.Height, "With -dispense, nozzle height over the board in mm")
+	flag.Float64Var(&cfg.LaserPower, "laser-power", def.LaserPower, "With -gcode, laser power in percent")
+	flag.Float64Var(&cfg.LaserSpeed, "laser-speed", def.LaserSpeed, "With -gcode, cutting speed in mm/min")
+	flag.IntVar(&cfg.LaserPasses, "laser-passes", def.LaserPasses, "With -gcode, number of passes over each line")
+	flag.BoolVar(&cfg.SCAD, "scad", false, "Also write the stencil as an OpenSCAD model of extruded polygons, to add frames, text or fixtures to")
+	flag.BoolVar(&cfg.PDF, "pdf", false, "Also write a 1:1 PDF of the apertures and outline, to print on paper and check against the board")
+	flag.BoolVar(&cfg.DebugPNG, "debug-png", false, "Save a PNG of the paste layer with one color per aperture, and a legend")
+	flag.Float64Var(&cfg.PixelPitch, "pixel-pitch", 0, "Pixel pitch in mm/px for bitmap (PNG) input (default: derived from -dpi)")
+	flag.BoolVar(&cfg.Invert, "invert", false, "Bitmap input: treat dark pixels as openings")
+	flag.BoolVar(&cfg.Stream, "stream", false, "Render gerbers while parsing, for files too large to hold in memory")
+	flag.IntVar(&cfg.Supersample, "supersample", 0, "Render the paste layer at N times the DPI and downsample, for smoother small apertures (0 = auto, 1 = off)")
+	flag.BoolVar(&cfg.Vector, "vector", false, "Build the mesh directly from gerber geometry instead of a rendered image (the default for gerbers unless a raster-only option is set)")
+	flag.BoolVar(&cfg.Raster, "raster", false, "Always build the mesh from a rendered image, even for gerbers the vector mesher could handle")
+	flag.BoolVar(&cfg.MaxRects, "max-rects", false, "Cover the faces of the raster mesh with maximal rectangles instead of row strips, for fewer triangles around round pads")
+	flag.BoolVar(&cfg.Contour, "contour", false, "Mesh the rendered image from its traced contours, with smooth aperture walls instead of pixel steps")
+	flag.Float64Var(&cfg.Simplify, "simplify", 0, "With -contour, straighten contours to within this many microns, for smaller files (0 = 0.3 px)")
+	flag.Float64Var(&cfg.WallTaper, "wall-taper", 0, "Draft angle in degrees of the aperture walls, widening openings on the squeegee side for paste release (implies -contour for raster output)")
+	flag.Float64Var(&cfg.Chamfer, "chamfer", 0, "Chamfer the squeegee side rim of openings by this many mm so the squeegee doesn't catch (implies -contour for raster output)")
+	flag.Float64Var(&cfg.Fillet, "fillet", 0, "Round the squeegee side rim of openings with this radius in mm instead of a chamfer (implies -contour for raster output)")
+	flag.StringVar(&o.shrink, "shrink", "", "Shrink openings by this many mm per side, or percent of their size with a % suffix; x,y for separate axes, negative to enlarge")
+	flag.StringVar(&o.shrinkByArea, "shrink-by-area", "", "Shrink openings by the size of their area, as area:amount classes up to that many mm², e.g. 0.5:0,2:10%,20%")
+	flag.StringVar(&o.patSizes, "pattern-sizes", "0.2,0.3,0.4,0.5,0.6,0.8,1,1.2,1.5", "With testpattern, comma separated opening sizes in mm")
+	flag.StringVar(&o.profile, "profile", "", "Compensate openings by this printer profile, fitted by the calibrate subcommand (default: the one named after -printer, if any)")
+	flag.StringVar(&o.patShrinks, "pattern-shrinks", "0,0.025,0.05,0.075,0.1", "With testpattern, comma separated shrinks to try, each in mm or with a % suffix as with -shrink")
+	flag.Float64Var(&cfg.HomePlate, "home-plate", 0, "Point the inner end of rectangular pads at this pitch in mm or finer, home plate style, against bridging")
+	flag.Float64Var(&cfg.WindowPane, "window-pane", 0, "Split openings larger than this many mm², such as thermal pads, into a grid of windows")
+	flag.Float64Var(&cfg.PaneWeb, "pane-web", def.PaneWeb, "Width in mm of the webs between the windows of -window-pane")
+	flag.BoolVar(&cfg.HomePlateInverted, "inverted-home-plate", false, "With -home-plate, notch the inner end of the pads with a V instead")
+	flag.Func("step", "Give an area its own plate thickness, as thickness:x0,y0,x1,y1 in mm, thickness:ref,ref for components, or thickness:file.gbr (repeatable)", func(s string) error {
+		z, err := stencil.ParseStepZone(s)
+		if err == nil {
+			cfg.Steps = append(cfg.Steps, z)
 		}
-	}
+		return err
+	})
+	flag.StringVar(&cfg.Centroid, "centroid", "", "Pick and place file (.pos, .csv) to find the components of -exclude by, when the paste layer has no X2 component attributes")
+	flag.StringVar(&o.exclude, "exclude", "", "Comma separated references of components to leave without paste, such as parts soldered by hand later")
+	flag.StringVar(&o.onlyRefs, "only-refs", "", "Comma separated references of the only components to give paste, for a small stencil to rework them")
+	flag.StringVar(&o.crop, "crop", "", "Only give paste to the pads in this area of the board, x0,y0,x1,y1 in mm, for a small stencil to rework it")
+	flag.StringVar(&cfg.Fiducials, "fiducials", "", "Engrave marks half through the plate at the fiducials, from a centroid file (.pos, .csv) or a gerber with X2 FiducialPad attributes such as the copper layer")
+	flag.Float64Var(&cfg.ZOffset, "z-offset", 0, "Height in mm of the bottom of the stencil in the STL, e.g. to line it up with a frame model")
+	flag.BoolVar(&o.center, "center", false, "Center the stencil on the origin in X and Y, for importing into CAD (the same as -origin center)")
+	flag.StringVar(&o.origin, "origin", def.Origin, "Where the mesh's X and Y origin is: corner, center, or gerber for the origin of the gerber coordinates")
+	flag.BoolVar(&cfg.YUp, "y-up", false, "Write the STL, OBJ or PLY mesh with Y up instead of Z, for CAD packages that expect it")
+	flag.Float64Var(&o.stlScale, "stl-scale", def.Scale, "Scale the STL, OBJ or PLY mesh by this factor when writing it, for tools that don't take mm")
+	flag.StringVar(&o.units, "units", "", "Write the STL, OBJ or PLY mesh in these units instead of mm: cm, m, um, in or mil")
+	flag.StringVar(&cfg.Format, "format", def.Format, "Mesh file format: stl, 3mf for slicers that take units and metadata, obj for mesh editors, ply for MeshLab and Open3D, or glb for web viewers")
+	flag.StringVar(&cfg.Printer, "printer", "", "Also write a sliced file for this resin printer: photon, photon-mono-se, mars, mars2pro, saturn, sl1 or sl1s (renders at its pixel pitch)")
+	flag.Float64Var(&cfg.LayerHeight, "layer-height", def.LayerHeight, "With -printer, layer height in mm; also sets the resin print time estimate")
+	flag.Float64Var(&cfg.Exposure, "exposure", 0, "With -printer, layer exposure in seconds (0 = the printer's default)")
+	flag.Float64Var(&cfg.BottomExposure, "bottom-exposure", 0, "With -printer, exposure in seconds of the layers on the build plate (0 = the printer's default)")
+	flag.BoolVar(&cfg.Ratios, "ratios", false, "Print the area and aspect ratio of every opening, flagging those that won't release paste (colored red in the -keep-png preview)")
+	flag.Float64Var(&cfg.Nozzle, "nozzle", 0, "Warn about openings and webs narrower than this FDM nozzle diameter in mm")
+	flag.Float64Var(&cfg.ResinPitch, "resin-pitch", 0, "Warn about openings and webs narrower than two pixels of this size in mm on a resin printer (default: the -printer's)")
+	flag.Float64Var(&cfg.MinWeb, "min-web", 0, "List the webs of plate between openings narrower than this many mm, which tear (marked yellow in the -keep-png preview)")
+	flag.StringVar(&o.bed, "bed", "", "Turn the stencil to fit a print bed of width x depth in mm, such as 220x220, or fail if it can't")
+	flag.StringVar(&o.tiles, "tiles", "", "Split the stencil into tiles that join into one, as columns x rows such as 2x1, or auto for as few as fit the -bed")
+	flag.StringVar(&o.joint, "joint", def.Tiles.Joint, "With -tiles, the joints between tiles: dovetail or puzzle")
+	flag.Float64Var(&o.jointSize, "joint-size", def.Tiles.JointSize, "With -tiles, how far the joints' tabs reach across the cut in mm")
+	flag.Float64Var(&o.jointGap, "joint-gap", def.Tiles.JointGap, "With -tiles, clearance between neighbouring tiles in mm")
+	flag.Float64Var(&o.tilePins, "tile-pins", 0, "With -tiles, diameter in mm of alignment pin holes either side of the ends of each cut (0 = none)")
+	flag.StringVar(&o.panel, "panel", "", "Repeat the paste layer in a grid of boards, as columns x rows such as 2x3")
+	flag.Float64Var(&o.spacing, "spacing", 0, "With -panel, gap in mm between neighbouring boards")
+	flag.Float64Var(&o.panelRails, "panel-rails", 0, "With -panel, widen the frame by this many mm on every side to cover the panel's rails")
+	flag.BoolVar(&cfg.PasteVolume, "paste-volume", false, "Print the volume and weight of paste each component and the whole stencil deposits")
+	flag.Float64Var(&cfg.PasteDensity, "paste-density", def.PasteDensity, "Density of the solder paste in g/cm³ for -paste-volume, flux included")
+	flag.BoolVar(&cfg.Stats, "stats", false, "Also save the opening count and area, size, volume and material estimate as JSON")
+	flag.BoolVar(&cfg.PreviewHTML, "preview-html", false, "Also write a self-contained HTML page viewing the stencil in 3D, with the gerber apertures drawn over it")
+	flag.BoolVar(&cfg.Heightmap, "heightmap", false, "Also save the stencil's thickness as a 16 bit grayscale PNG, white where it is thickest, for CNC engraving")
+	flag.StringVar(&cfg.Drill, "drill", "", "Optional Excellon drill file (.drl, .txt, .xln)")
+	flag.StringVar(&cfg.PasteLayer, "paste-layer", "", "File name of the paste layer inside a zip archive or directory (auto-detected if empty)")
+	flag.StringVar(&cfg.OutlineLayer, "outline-layer", "", "File name of the outline layer inside a zip archive or directory (auto-detected if empty)")
+	flag.Var(&o.mirror, "mirror", "Mirror the gerbers left to right for a bottom side stencil, or -mirror=y to flip them top to bottom")
+	flag.StringVar(&cfg.Label, "label", "", "Text to engrave into the stencil, e.g. the board name and revision, so it can be told apart in a drawer")
+	flag.Float64Var(&cfg.LabelSize, "label-size", def.LabelSize, "Height in mm of the label's letters")
+	flag.BoolVar(&cfg.LabelRaised, "label-raised", false, "Stand the label 0.4 mm proud of the squeegee side instead of engraving it")
+	flag.StringVar(&o.labelAt, "label-at", "", "Bottom left corner of the label as x,y in gerber mm (default: centered in the frame below the paste layer)")
+	flag.BoolVar(&cfg.Jig, "jig", false, "Also write <name>_jig.stl, a holder with a pocket for the board and a groove that locates the stencil (needs the outline)")
+	flag.BoolVar(&cfg.AlignPins, "pins", false, "Also write <name>_pins.stl, pins for the non-plated holes of the -drill file, and punch holes for them through the stencil and the jig")
+	flag.Float64Var(&cfg.PinFit, "pin-fit", def.PinFit, "With -pins, how much narrower in mm the pins are than the board's holes")
+	flag.BoolVar(&cfg.Squeegee, "squeegee", false, "Also write <name>_squeegee.stl, a squeegee with a blade as long as the aperture field's narrow side and 10 mm over")
+	flag.Float64Var(&cfg.SqueegeeSize.Length, "squeegee-length", 0, "With -squeegee, blade length in mm (0 = from the aperture field)")
+	flag.Float64Var(&cfg.SqueegeeSize.Handle, "squeegee-handle", def.SqueegeeSize.Handle, "With -squeegee, width of the handle in mm")
+	flag.Float64Var(&cfg.SqueegeeSize.Angle, "squeegee-angle", def.SqueegeeSize.Angle, "With -squeegee, angle in degrees of the bevel at the blade's edge")
+	flag.Float64Var(&cfg.BoardThickness, "board-thickness", def.BoardThickness, "Thickness of the board in mm, for the depth of the jig's pocket")
+	flag.StringVar(&cfg.Bottom, "bottom", "", "Bottom paste layer to lay mirrored beside the top one, for a single stencil printing both sides")
+	flag.StringVar(&cfg.Side, "side", def.Side, "Paste side to pick from a zip archive or directory, and fiducials from a centroid file (top or bottom, or both for a combined stencil)")
+	flag.BoolVar(&cfg.Confirm, "confirm", false, "Interactively confirm the layers picked from a zip archive or directory")
+	flag.StringVar(&cfg.Output, "o", "", "Output mesh path (default: next to the input, named after it)")
+	flag.BoolVar(&o.json, "json", false, "Print a JSON summary of the result on stdout, with the other messages on stderr")
+	flag.IntVar(&o.jobs, "jobs", 1, "Inputs of a batch to convert at once; 0 for one per CPU")
+	flag.StringVar(&o.configFile, "config", "", "Settings file of options and input files, in YAML or TOML (default: stencil.yaml, stencil.yml or stencil.toml in the working directory, if there is one)")
+	flag.StringVar(&cfg.OutDir, "out-dir", "", "Directory to write the output files to, named after the input; created if missing")
+
+	flag.BoolVar(&o.server, "server", false, "Start in server mode, the same as the serve subcommand")
+	flag.StringVar(&o.port, "port", "8080", "Port to run the server on")
+	flag.StringVar(&o.grpcPort, "grpc-port", "", "Port to serve the gRPC service on as well, for factory systems; none if empty")
 
-	// 2. Dilate Outline to close gaps
-	// We dilate by a small amount (e.g. 0.5mm) to ensure the outline is closed.
-	gapClosingMM := 0.5
-	gapClosingPixels := int(gapClosingMM / pixelToMM)
-	if gapClosingPixels < 1 {
-		gapClosingPixels = 1
-	}
+	flag.Parse()
 
-	dist := make([]int, size)
-	for i := 0; i < size; i++ {
-		if isOutline[i] {
-			dist[i] = 0
-		} else {
-			dist[i] = -1
-		}
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(flag.Args()[1:]))
 	}
-
-	// BFS for Dilation
-	dilatedOutline := make([]bool, size)
-	copy(dilatedOutline, isOutline)
-
-	// Use a separate queue for dilation to avoid modifying the original outlineQueue if we needed it
-	dQueue := make([]int, len(outlineQueue))
-	copy(dQueue, outlineQueue)
-
-	for len(dQueue) > 0 {
-		idx := dQueue[0]
-		dQueue = dQueue[1:]
-
-		d := dist[idx]
-		if d >= gapClosingPixels {
-			continue
-		}
-
-		cx := idx % w
-		cy := idx / w
-
-		for i := 0; i < 4; i++ {
-			nx, ny := cx+dx[i], cy+dy[i]
-			if nx >= 0 && nx < w && ny >= 0 && ny < h {
-				nIdx := ny*w + nx
-				if dist[nIdx] == -1 {
-					dist[nIdx] = d + 1
-					dilatedOutline[nIdx] = true
-					dQueue = append(dQueue, nIdx)
-				}
-			}
+	if flag.Arg(0) == "calibrate" {
+		files := interleavedArgs(flag.Args()[1:])
+		name := o.profile
+		if name == "" {
+			name = cfg.Printer
 		}
+		os.Exit(runCalibrate(name, files))
 	}
-
-	// 3. Flood Fill "Outside" using Dilated Outline as barrier
-	isOutside := make([]bool, size)
-	// Start from (0,0) - assumed to be outside due to padding
-	if !dilatedOutline[0] {
-		isOutside[0] = true
-		fQueue := []int{0}
-
-		for len(fQueue) > 0 {
-			idx := fQueue[0]
-			fQueue = fQueue[1:]
-
-			cx := idx % w
-			cy := idx / w
-
-			for i := 0; i < 4; i++ {
-				nx, ny := cx+dx[i], cy+dy[i]
-				if nx >= 0 && nx < w && ny >= 0 && ny < h {
-					nIdx := ny*w + nx
-					if !isOutside[nIdx] && !dilatedOutline[nIdx] {
-						isOutside[nIdx] = true
-						fQueue = append(fQueue, nIdx)
-					}
-				}
-			}
-		}
+	args := flag.Args()
+	command := flag.Arg(0)
+	if command == "convert" || command == "testpattern" || command == "serve" {
+		args = interleavedArgs(args[1:])
 	}
-
-	// 4. Restore Board Shape (Erode "Outside" back to original boundary)
-	// We dilated the outline, so "Outside" stopped 'gapClosingPixels' away from the real board edge.
-	// We need to expand "Outside" inwards by 'gapClosingPixels' to touch the real board edge.
-	// Then "Board" = !Outside.
-
-	// Reset dist for Outside expansion
-	for i := 0; i < size; i++ {
-		if isOutside[i] {
-			dist[i] = 0
-		} else {
-			dist[i] = -1
-		}
+	if command == "serve" {
+		o.server = true
 	}
-
-	oQueue := []int{}
-	for i := 0; i < size; i++ {
-		if isOutside[i] {
-			oQueue = append(oQueue, i)
+	if path := findProjectFile(o.configFile); path != "" {
+		inputs, err := applyProjectFile(path)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
 		}
-	}
-
-	isOutsideExpanded := make([]bool, size)
-	copy(isOutsideExpanded, isOutside)
-
-	for len(oQueue) > 0 {
-		idx := oQueue[0]
-		oQueue = oQueue[1:]
-
-		d := dist[idx]
-		if d >= gapClosingPixels {
-			continue
+		if len(args) == 0 {
+			args = inputs
 		}
-
-		cx := idx % w
-		cy := idx / w
-
-		for i := 0; i < 4; i++ {
-			nx, ny := cx+dx[i], cy+dy[i]
-			if nx >= 0 && nx < w && ny >= 0 && ny < h {
-				nIdx := ny*w + nx
-				if dist[nIdx] == -1 {
-					dist[nIdx] = d + 1
-					isOutsideExpanded[nIdx] = true
-					oQueue = append(oQueue, nIdx)
-				}
-			}
+		if !o.json {
+			cfg.Log.Printf("Using settings from %s", path)
 		}
 	}
 
-	// 5. Define Board
-	isBoard := make([]bool, size)
-	for i := 0; i < size; i++ {
-		isBoard[i] = !isOutsideExpanded[i]
+	if o.server {
+		runServer(o.port, o.grpcPort)
+		return
 	}
-
-	// 6. Generate Wall
-	// Wall is generated by expanding Board outwards.
-	// We want the wall to be strictly OUTSIDE the board (or centered on outline? User said "starts at outline").
-	// If we expand Board, we get pixels outside.
-
-	thicknessPixels := int(thicknessMM / pixelToMM)
-	if thicknessPixels < 1 {
-		thicknessPixels = 1
+	cfg, err := o.config(cfg, command)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-
-	// Reset dist for Wall generation
-	for i := 0; i < size; i++ {
-		if isBoard[i] {
-			dist[i] = 0
-		} else {
-			dist[i] = -1
-		}
+	if cfg.Output == "-" {
+		// The mesh goes to stdout, so everything else goes to stderr
+		cfg.Stdout = os.Stderr
 	}
-
-	wQueue := []int{}
-	for i := 0; i < size; i++ {
-		if isBoard[i] {
-			wQueue = append(wQueue, i)
-		}
+	if command != "testpattern" {
+		runCLI(cfg, args, o.json, o.jobs)
+		return
 	}
-
-	isWall := make([]bool, size)
-
-	for len(wQueue) > 0 {
-		idx := wQueue[0]
-		wQueue = wQueue[1:]
-
-		d := dist[idx]
-		if d >= thicknessPixels {
-			continue
-		}
-
-		cx := idx % w
-		cy := idx / w
-
-		for i := 0; i < 4; i++ {
-			nx, ny := cx+dx[i], cy+dy[i]
-			if nx >= 0 && nx < w && ny >= 0 && ny < h {
-				nIdx := ny*w + nx
-				if dist[nIdx] == -1 {
-					dist[nIdx] = d + 1
-					isWall[nIdx] = true
-					wQueue = append(wQueue, nIdx)
-				}
-			}
-		}
+	pattern, err := stencil.ParseTestPattern(o.patSizes, o.patShrinks)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-
-	return isWall, isBoard
+	runTestPattern(cfg, pattern, args)
 }
 
-func GenerateMeshFromImages(stencilImg, outlineImg image.Image, cfg Config) [][3]Point {
-	pixelToMM := 25.4 / cfg.DPI
-	bounds := stencilImg.Bounds()
-	width := bounds.Max.X
-	height := bounds.Max.Y
-	var triangles [][3]Point
-
-	var wallMask []bool
-	var boardMask []bool
-	if outlineImg != nil {
-		fmt.Println("Computing wall mask...")
-		wallMask, boardMask = ComputeWallMask(outlineImg, cfg.WallThickness, pixelToMM)
+// config returns cfg with the settings o parses, for command.
+func (o *options) config(cfg stencil.Config, command string) (stencil.Config, error) {
+	var err error
+	if cfg.ShrinkX, cfg.ShrinkY, err = stencil.ParseShrink(o.shrink); err != nil {
+		return cfg, err
 	}
-
-	// Optimization: Run-Length Encoding
-	for y := 0; y < height; y++ {
-		var startX = -1
-		var currentHeight = 0.0
-
-		for x := 0; x < width; x++ {
-			// Check stencil (black = solid)
-			sc := stencilImg.At(x, y)
-			sr, sg, sb, _ := sc.RGBA()
-			isStencilSolid := sr < 10000 && sg < 10000 && sb < 10000
-
-			// Check wall
-			isWall := false
-			isInsideBoard := true
-			if wallMask != nil {
-				idx := y*width + x
-				isWall = wallMask[idx]
-				if boardMask != nil {
-					isInsideBoard = boardMask[idx]
-				}
-			}
-
-			// Determine height at this pixel
-			h := 0.0
-			if isWall {
-				h = cfg.WallHeight
-			} else if isStencilSolid {
-				if isInsideBoard {
-					h = cfg.StencilHeight
-				}
-			}
-
-			if h > 0 {
-				if startX == -1 {
-					startX = x
-					currentHeight = h
-				} else if h != currentHeight {
-					// Height changed, end current strip and start new one
-					stripLen := x - startX
-					AddBox(
-						&triangles,
-						float64(startX)*pixelToMM,
-						float64(y)*pixelToMM,
-						float64(stripLen)*pixelToMM,
-						pixelToMM,
-						currentHeight,
-					)
-					startX = x
-					currentHeight = h
-				}
-			} else {
-				if startX != -1 {
-					// End of strip, generate box
-					stripLen := x - startX
-					AddBox(
-						&triangles,
-						float64(startX)*pixelToMM,
-						float64(y)*pixelToMM,
-						float64(stripLen)*pixelToMM,
-						pixelToMM,
-						currentHeight,
-					)
-					startX = -1
-					currentHeight = 0.0
-				}
-			}
-		}
-		if startX != -1 {
-			stripLen := width - startX
-			AddBox(
-				&triangles,
-				float64(startX)*pixelToMM,
-				float64(y)*pixelToMM,
-				float64(stripLen)*pixelToMM,
-				pixelToMM,
-				currentHeight,
-			)
-		}
+	if cfg.ShrinkByArea, err = stencil.ParseAreaShrinks(o.shrinkByArea); err != nil {
+		return cfg, err
 	}
-	return triangles
-}
-
-// --- Logic ---
-
-func processPCB(gerberPath, outlinePath string, cfg Config) (string, error) {
-	outputPath := strings.TrimSuffix(gerberPath, filepath.Ext(gerberPath)) + ".stl"
-
-	// 1. Parse Gerber(s)
-	fmt.Printf("Parsing %s...\n", gerberPath)
-	gf, err := ParseGerber(gerberPath)
-	if err != nil {
-		return "", fmt.Errorf("error parsing gerber: %v", err)
+	if cfg.Scale, err = stencil.ParseMeshScale(o.stlScale, o.units); err != nil {
+		return cfg, err
 	}
-
-	var outlineGf *GerberFile
-	if outlinePath != "" {
-		fmt.Printf("Parsing outline %s...\n", outlinePath)
-		outlineGf, err = ParseGerber(outlinePath)
-		if err != nil {
-			return "", fmt.Errorf("error parsing outline gerber: %v", err)
-		}
+	if cfg.RegHoles, err = stencil.ParseRegHoles(o.regHoles); err != nil {
+		return cfg, err
 	}
-
-	// 2. Calculate Union Bounds
-	bounds := gf.CalculateBounds()
-	if outlineGf != nil {
-		outlineBounds := outlineGf.CalculateBounds()
-		if outlineBounds.MinX < bounds.MinX {
-			bounds.MinX = outlineBounds.MinX
-		}
-		if outlineBounds.MinY < bounds.MinY {
-			bounds.MinY = outlineBounds.MinY
-		}
-		if outlineBounds.MaxX > bounds.MaxX {
-			bounds.MaxX = outlineBounds.MaxX
+	if o.framePreset != "" {
+		if o.regHoles != "" {
+			return cfg, fmt.Errorf("give -reg-holes or -frame-preset, not both")
 		}
-		if outlineBounds.MaxY > bounds.MaxY {
-			bounds.MaxY = outlineBounds.MaxY
+		if cfg.RegHoles, err = stencil.FindFramePreset(o.framePreset); err != nil {
+			return cfg, err
 		}
 	}
-
-	// Expand bounds to accommodate wall thickness and prevent clipping
-	margin := cfg.WallThickness + 5.0 // mm
-	bounds.MinX -= margin
-	bounds.MinY -= margin
-	bounds.MaxX += margin
-	bounds.MaxY += margin
-
-	// 3. Render to Image(s)
-	fmt.Println("Rendering to internal image...")
-	img := gf.Render(cfg.DPI, &bounds)
-
-	var outlineImg image.Image
-	if outlineGf != nil {
-		fmt.Println("Rendering outline to internal image...")
-		outlineImg = outlineGf.Render(cfg.DPI, &bounds)
-	}
-
-	if cfg.KeepPNG {
-		pngPath := strings.TrimSuffix(gerberPath, filepath.Ext(gerberPath)) + ".png"
-		fmt.Printf("Saving intermediate PNG to %s...\n", pngPath)
-		f, err := os.Create(pngPath)
-		if err != nil {
-			log.Printf("Warning: Could not create PNG file: %v", err)
-		} else {
-			if err := png.Encode(f, img); err != nil {
-				log.Printf("Warning: Could not encode PNG: %v", err)
-			}
-			f.Close()
-		}
-	}
-
-	// 4. Generate Mesh
-	fmt.Println("Generating mesh...")
-	triangles := GenerateMeshFromImages(img, outlineImg, cfg)
-
-	// 5. Save STL
-	fmt.Printf("Saving to %s (%d triangles)...\n", outputPath, len(triangles))
-	err = WriteSTL(outputPath, triangles)
-	if err != nil {
-		return "", fmt.Errorf("error writing STL: %v", err)
-	}
-
-	return outputPath, nil
-}
-
-// --- CLI ---
-
-func runCLI(cfg Config, args []string) {
-	if len(args) < 1 {
-		fmt.Println("Usage: go run main.go [options] <path_to_gerber_file> [path_to_outline_gerber_file]")
-		fmt.Println("Options:")
-		flag.PrintDefaults()
-		fmt.Println("Example: go run main.go -height=0.3 MyPCB.GTP MyPCB.GKO")
-		os.Exit(1)
-	}
-
-	gerberPath := args[0]
-	var outlinePath string
-	if len(args) > 1 {
-		outlinePath = args[1]
-	}
-
-	_, err := processPCB(gerberPath, outlinePath, cfg)
-	if err != nil {
-		log.Fatalf("Error: %v", err)
+	if cfg.Magnets, err = stencil.ParseMagnetPockets(o.magnets); err != nil {
+		return cfg, err
 	}
-	fmt.Println("Success! Happy printing.")
-}
-
-// --- Server ---
-
-//go:embed static/*
-var staticFiles embed.FS
-
-func randomID() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return hex.EncodeToString(b)
-}
-
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-	// Read index.html from embedded FS
-	content, err := staticFiles.ReadFile("static/index.html")
-	if err != nil {
-		http.Error(w, "Could not load index page", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(content)
-}
-
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if cfg.Crop, err = stencil.ParseCrop(o.crop); err != nil {
+		return cfg, err
 	}
-
-	// Create temp dir
-	tempDir := filepath.Join(".", "temp")
-	os.MkdirAll(tempDir, 0755)
-
-	uuid := randomID()
-
-	// Parse params
-	height, _ := strconv.ParseFloat(r.FormValue("height"), 64)
-	dpi, _ := strconv.ParseFloat(r.FormValue("dpi"), 64)
-	wallHeight, _ := strconv.ParseFloat(r.FormValue("wallHeight"), 64)
-	wallThickness, _ := strconv.ParseFloat(r.FormValue("wallThickness"), 64)
-
-	if height == 0 {
-		height = DefaultStencilHeight
+	if cfg.Panel, err = stencil.ParsePanel(o.panel); err != nil {
+		return cfg, err
 	}
-	if dpi == 0 {
-		dpi = DefaultDPI
+	cfg.Panel.Spacing, cfg.Panel.Rails = o.spacing, o.panelRails
+	if cfg.Bed, err = stencil.ParseBed(o.bed); err != nil {
+		return cfg, err
 	}
-	if wallHeight == 0 {
-		wallHeight = DefaultWallHeight
+	s := cfg.SqueegeeSize
+	if cfg.Squeegee && (s.Length < 0 || s.Handle <= 0 || s.Angle < 10 || s.Angle > 90) {
+		return cfg, fmt.Errorf("the squeegee needs a positive handle and an edge angle from 10 to 90 degrees")
 	}
-	if wallThickness == 0 {
-		wallThickness = DefaultWallThickness
+	if cfg.Dispense && (cfg.Dispenser.Rate <= 0 || cfg.Dispenser.Dot <= 0) {
+		return cfg, fmt.Errorf("-dispense needs a positive -dispense-rate and -dispense-dot")
 	}
-
-	cfg := Config{
-		StencilHeight: height,
-		WallHeight:    wallHeight,
-		WallThickness: wallThickness,
-		DPI:           dpi,
-		KeepPNG:       false,
+	if cfg.Tiles, err = stencil.ParseTiles(o.tiles); err != nil {
+		return cfg, err
 	}
-
-	// Handle Gerber File
-	file, header, err := r.FormFile("gerber")
-	if err != nil {
-		http.Error(w, "Error retrieving gerber file", http.StatusBadRequest)
-		return
+	if cfg.Tiles.Auto && cfg.Bed == (stencil.Bed{}) {
+		return cfg, fmt.Errorf("-tiles auto needs the -bed size")
 	}
-	defer file.Close()
-
-	gerberPath := filepath.Join(tempDir, uuid+"_paste"+filepath.Ext(header.Filename))
-	outFile, err := os.Create(gerberPath)
-	if err != nil {
-		http.Error(w, "Server error saving file", http.StatusInternalServerError)
-		return
+	cfg.Tiles.Joint = strings.ToLower(o.joint)
+	if cfg.Tiles.Joint != "dovetail" && cfg.Tiles.Joint != "puzzle" {
+		return cfg, fmt.Errorf("unknown joint %q, want dovetail or puzzle", o.joint)
 	}
-	defer outFile.Close()
-	io.Copy(outFile, file)
-
-	// Handle Outline File (Optional)
-	outlineFile, outlineHeader, err := r.FormFile("outline")
-	var outlinePath string
-	if err == nil {
-		defer outlineFile.Close()
-		outlinePath = filepath.Join(tempDir, uuid+"_outline"+filepath.Ext(outlineHeader.Filename))
-		outOutline, err := os.Create(outlinePath)
-		if err == nil {
-			defer outOutline.Close()
-			io.Copy(outOutline, outlineFile)
-		}
+	cfg.Tiles.JointSize, cfg.Tiles.JointGap, cfg.Tiles.Pins = o.jointSize, o.jointGap, o.tilePins
+	if cfg.LabelAt, err = stencil.ParseLabelAt(o.labelAt); err != nil {
+		return cfg, err
 	}
-
-	// Process
-	outSTL, err := processPCB(gerberPath, outlinePath, cfg)
-	if err != nil {
-		log.Printf("Error processing: %v", err)
-		http.Error(w, fmt.Sprintf("Error processing PCB: %v", err), http.StatusInternalServerError)
-		return
+	if o.profile != "" {
+		cfg.Profile, err = stencil.FindProfile(o.profile, true)
+	} else if cfg.Printer != "" && command != "testpattern" {
+		cfg.Profile, err = stencil.FindProfile(cfg.Printer, false)
 	}
-
-	// Render Success
-	tmpl, err := template.ParseFS(staticFiles, "static/result.html")
 	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-	data := struct{ Filename string }{Filename: filepath.Base(outSTL)}
-	tmpl.Execute(w, data)
-}
-
-func downloadHandler(w http.ResponseWriter, r *http.Request) {
-	vars := strings.Split(r.URL.Path, "/")
-	if len(vars) < 3 {
-		http.NotFound(w, r)
-		return
-	}
-	filename := vars[2]
-
-	// Security check: ensure no path traversal
-	if strings.Contains(filename, "/") || strings.Contains(filename, "\\") || strings.Contains(filename, "..") {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
-		return
+		return cfg, err
 	}
-
-	path := filepath.Join("temp", filename)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		http.NotFound(w, r)
-		return
+	cfg.Origin = strings.ToLower(o.origin)
+	if o.center {
+		cfg.Origin = "center"
 	}
-
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
-	w.Header().Set("Content-Type", "application/octet-stream")
-	http.ServeFile(w, r, path)
-}
-
-func runServer(port string) {
-	// Serve static files (CSS, etc.)
-	// This will serve files under /static/ from the embedded fs
-	http.Handle("/static/", http.FileServer(http.FS(staticFiles)))
-
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/upload", uploadHandler)
-	http.HandleFunc("/download/", downloadHandler)
-
-	fmt.Printf("Starting server on http://0.0.0.0:%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
-
-// --- Main ---
-
-var (
-	flagStencilHeight float64
-	flagWallHeight    float64
-	flagWallThickness float64
-	flagDPI           float64
-	flagKeepPNG       bool
-	flagServer        bool
-	flagPort          string
-)
-
-func main() {
-	flag.Float64Var(&flagStencilHeight, "height", DefaultStencilHeight, "Stencil height in mm")
-	flag.Float64Var(&flagWallHeight, "wall-height", DefaultWallHeight, "Wall height in mm")
-	flag.Float64Var(&flagWallThickness, "wall-thickness", DefaultWallThickness, "Wall thickness in mm")
-	flag.Float64Var(&flagDPI, "dpi", DefaultDPI, "DPI for rendering (lower = smaller file, rougher curves)")
-	flag.BoolVar(&flagKeepPNG, "keep-png", false, "Save intermediate PNG file")
-
-	flag.BoolVar(&flagServer, "server", false, "Start in server mode")
-	flag.StringVar(&flagPort, "port", "8080", "Port to run the server on")
-
-	flag.Parse()
-
-	if flagServer {
-		runServer(flagPort)
-	} else {
-		cfg := Config{
-			StencilHeight: flagStencilHeight,
-			WallHeight:    flagWallHeight,
-			WallThickness: flagWallThickness,
-			DPI:           flagDPI,
-			KeepPNG:       flagKeepPNG,
-		}
-		runCLI(cfg, flag.Args())
+	if cfg.Origin != "corner" && cfg.Origin != "center" && cfg.Origin != "gerber" {
+		return cfg, fmt.Errorf("unknown origin %q, want corner, center or gerber", o.origin)
 	}
+	cfg.Exclude, cfg.OnlyRefs = stencil.SplitRefs(o.exclude), stencil.SplitRefs(o.onlyRefs)
+	cfg.Mirror = string(o.mirror)
+	cfg.Format = strings.ToLower(cfg.Format)
+	return cfg, cfg.Check()
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// mirrorFlag is the -mirror option: -mirror alone mirrors in X, and
+// -mirror=x or -mirror=y picks the axis.
+type mirrorFlag string
+
+func (m *mirrorFlag) String() string { return string(*m) }
+
+func (m *mirrorFlag) IsBoolFlag() bool { return true }
+
+func (m *mirrorFlag) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "true", gerber.MirrorX:
+		*m = gerber.MirrorX
+	case gerber.MirrorY:
+		*m = gerber.MirrorY
+	case "false", "":
+		*m = ""
+	default:
+		return fmt.Errorf("mirror axis must be x or y, not %q", s)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package gerber
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// mm writes v mm as a 4.6 format coordinate.
+func mm(v float64) string {
+	return fmt.Sprintf("%d", int64(v*1e6))
+}
+
+func TestCalculateBounds(t *testing.T) {
+	const header = "%FSLAX46Y46*%\n%MOMM*%\n"
+	tests := []struct {
+		name string
+		body string
+		want Bounds // Without the padding
+	}{
+		{
+			name: "circle flash",
+			body: "%ADD10C,1.0*%\nD10*\nX0Y0D03*\n",
+			want: Bounds{MinX: -0.5, MinY: -0.5, MaxX: 0.5, MaxY: 0.5},
+		},
+		{
+			name: "rectangle flash",
+			body: "%ADD10R,2.0X1.0*%\nD10*\nX" + mm(10) + "Y" + mm(5) + "D03*\n",
+			want: Bounds{MinX: 9, MinY: 4.5, MaxX: 11, MaxY: 5.5},
+		},
+		{
+			name: "obround flash",
+			body: "%ADD10O,1.0X3.0*%\nD10*\nX0Y0D03*\n",
+			want: Bounds{MinX: -0.5, MinY: -1.5, MaxX: 0.5, MaxY: 1.5},
+		},
+		{
+			// The pads hug the board edge: they reach 0.75 mm past the
+			// outermost pad centers, which a center-only bounds would clip
+			name: "pads at the board edge",
+			body: "%ADD10R,1.5X1.5*%\n%ADD11C,0.1*%\nD11*\nX0Y0D02*\nX" + mm(20) + "Y0D01*\nX" + mm(20) + "Y" + mm(10) + "D01*\nX0Y" + mm(10) + "D01*\nX0Y0D01*\n" +
+				"D10*\nX" + mm(0.75) + "Y" + mm(0.75) + "D03*\nX" + mm(20) + "Y" + mm(10) + "D03*\n",
+			want: Bounds{MinX: -0.05, MinY: -0.05, MaxX: 20.75, MaxY: 10.75},
+		},
+		{
+			name: "draw with a round aperture",
+			body: "%ADD10C,0.2*%\nD10*\nX0Y0D02*\nX" + mm(10) + "Y0D01*\n",
+			want: Bounds{MinX: -0.1, MinY: -0.1, MaxX: 10.1, MaxY: 0.1},
+		},
+		{
+			// Counterclockwise from (10, 0) to (-10, 0) about the origin
+			// bulges up to Y 10, past both end points
+			name: "counterclockwise arc",
+			body: "%ADD10C,0.2*%\nD10*\nG75*\nX" + mm(10) + "Y0D02*\nG03*\nX-" + mm(10) + "Y0I-" + mm(10) + "J0D01*\n",
+			want: Bounds{MinX: -10.1, MinY: -0.1, MaxX: 10.1, MaxY: 10.1},
+		},
+		{
+			name: "clockwise arc",
+			body: "%ADD10C,0.2*%\nD10*\nG75*\nX" + mm(10) + "Y0D02*\nG02*\nX-" + mm(10) + "Y0I-" + mm(10) + "J0D01*\n",
+			want: Bounds{MinX: -10.1, MinY: -10.1, MaxX: 10.1, MaxY: 0.1},
+		},
+		{
+			name: "region contour",
+			body: "%ADD10C,1.0*%\nD10*\nG36*\nX0Y0D02*\nX" + mm(4) + "Y0D01*\nX" + mm(4) + "Y" + mm(3) + "D01*\nX0Y0D01*\nG37*\n",
+			want: Bounds{MinX: 0, MinY: 0, MaxX: 4, MaxY: 3},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gf := parseString(t, header+tc.body+"M02*\n")
+			b := gf.CalculateBounds()
+			const pad = 2.0
+			got := Bounds{MinX: b.MinX + pad, MinY: b.MinY + pad, MaxX: b.MaxX - pad, MaxY: b.MaxY - pad}
+			const tol = 1e-6
+			for _, c := range [][2]float64{{got.MinX, tc.want.MinX}, {got.MinY, tc.want.MinY}, {got.MaxX, tc.want.MaxX}, {got.MaxY, tc.want.MaxY}} {
+				if d := c[0] - c[1]; d > tol || d < -tol {
+					t.Fatalf("bounds = %+v, want %+v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+// Rotated apertures reach as far as their corners in any direction.
+func TestCalculateBoundsRotated(t *testing.T) {
+	src := strings.Join([]string{"%FSLAX46Y46*%", "%MOMM*%", "%ADD10R,2.0X1.0*%", "%LR45*%", "D10*", "X0Y0D03*", "M02*", ""}, "\n")
+	b := parseString(t, src).CalculateBounds()
+	if b.MaxX-2 < 1 || b.MaxY-2 < 1 {
+		t.Errorf("bounds %+v don't cover the rotated rectangle's reach", b)
+	}
+}
@@ -0,0 +1,824 @@
+// Package gerber parses RS-274X gerber files into commands in mm, and
+// turns their flashes, draws and regions into polygons.
+package gerber
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/progress"
+)
+
+// Aperture types
+const (
+	ApertureCircle  = "C"
+	ApertureRect    = "R"
+	ApertureObround = "O"
+	AperturePolygon = "P"
+	// Any other type names a macro
+)
+
+// Aperture is a shape defined with %AD, with its dimensions in mm.
+type Aperture struct {
+	Type      string
+	Modifiers []float64
+	Function  string // X2 .AperFunction attribute, e.g. "SMDPad,CuDef"
+}
+
+// Describe returns the type and modifiers, e.g. "R 1.2x0.6".
+func (ap Aperture) Describe() string {
+	var mods []string
+	for _, m := range ap.Modifiers {
+		mods = append(mods, fmt.Sprintf("%g", m))
+	}
+	if len(mods) == 0 {
+		return ap.Type
+	}
+	return ap.Type + " " + strings.Join(mods, "x")
+}
+
+// MacroPrimitive is one primitive of an aperture macro.
+type MacroPrimitive struct {
+	Code      int
+	Modifiers []float64
+}
+
+// Macro is an aperture template defined with %AM.
+type Macro struct {
+	Name       string
+	Primitives []MacroPrimitive
+}
+
+// State is what the parser has read so far: the apertures and macros,
+// the coordinate format and the units.
+type State struct {
+	Apertures        map[int]Aperture
+	Macros           map[string]Macro
+	CurrentAperture  int
+	X, Y             float64 // Current coordinates in mm
+	FormatX, FormatY struct {
+		Integer, Decimal int
+	}
+	Units string // "MM" or "IN" as declared by the file; parsed geometry is always mm
+	// Current .AperFunction attribute, attached to apertures as they are defined
+	AperFunction string
+}
+
+// Command is one operation of a file, with its coordinates in mm.
+type Command struct {
+	Type string // "D01", "D02", "D03", "AD", "FS", etc.
+	X, Y *float64
+	I, J *float64
+	D    *int
+	R    *float64 // Aperture rotation in degrees for "LR"
+	Name string   // Component reference for "COMPONENT", empty when it ends
+}
+
+// File is a parsed gerber file.
+type File struct {
+	Commands []Command
+	State    State
+
+	// Constructs the parser or renderer can't reproduce faithfully,
+	// with the number of times each was seen
+	Unsupported map[string]int
+
+	Mirror   string        // MirrorX or MirrorY to mirror the geometry as it's parsed
+	Progress progress.Func // Told how far Scan has read the file and the renderer drawn it; nil for no reports
+}
+
+// New returns an empty file, ready to Scan into.
+func New() *File {
+	return &File{
+		State: State{
+			Apertures: make(map[int]Aperture),
+			Macros:    make(map[string]Macro),
+			Units:     "MM", // Default, usually set by MO
+		},
+		Unsupported: make(map[string]int),
+	}
+}
+
+func (gf *File) unsupported(what string) {
+	gf.Unsupported[what]++
+}
+
+// Parse parses a simple RS-274X file
+func Parse(filename string) (*File, error) {
+	return ParseMirrored(filename, "")
+}
+
+// ParseMirrored parses a gerber file mirrored across the axis, or as
+// it is when the axis is empty.
+func ParseMirrored(filename, mirror string) (*File, error) {
+	gf := New()
+	gf.Mirror = mirror
+	if err := gf.Parse(filename); err != nil {
+		return nil, err
+	}
+	return gf, nil
+}
+
+// Parse reads the commands of a gerber file into gf, as Scan passes them
+// on.
+func (gf *File) Parse(filename string) error {
+	return gf.Scan(filename, func(cmd Command) {
+		gf.Commands = append(gf.Commands, cmd)
+	})
+}
+
+// Scan reads a gerber file, updating gf.State as parameters are
+// encountered and passing each command to emit in file order. The commands are
+// not retained, which lets callers stream huge files.
+func (gf *File) Scan(filename string, emit func(Command)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if gf.Mirror != "" {
+		parsed := emit
+		emit = func(cmd Command) { parsed(mirrorCommand(cmd, gf.Mirror)) }
+	}
+
+	var size int
+	if fi, err := file.Stat(); err == nil {
+		size = int(fi.Size())
+	}
+	scanner := bufio.NewScanner(progress.NewReader(file, gf.Progress, "Parsing", size))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// X2 attributes written as comments (e.g. KiCad without X2 enabled)
+		if strings.HasPrefix(line, "G04 #@! ") {
+			line = "%" + strings.TrimPrefix(line, "G04 #@! ") + "%"
+		}
+
+		// Handle Parameters
+		if strings.HasPrefix(line, "%") {
+			if strings.HasPrefix(line, "%FS") {
+				if xi, xd, yi, yd, ok := lexFormatSpec(line); ok {
+					gf.State.FormatX.Integer = xi
+					gf.State.FormatX.Decimal = xd
+					gf.State.FormatY.Integer = yi
+					gf.State.FormatY.Decimal = yd
+				}
+			} else if strings.HasPrefix(line, "%AD") {
+				if dCode, apType, modStr, ok := lexApertureDef(line); ok {
+					var mods []float64
+					if modStr != "" {
+						parts := strings.Split(modStr, "X")
+						for _, p := range parts {
+							val, _ := strconv.ParseFloat(p, 64)
+							mods = append(mods, val)
+						}
+					}
+					ap := Aperture{Type: apType, Modifiers: gf.scaleApertureModifiers(apType, mods), Function: gf.State.AperFunction}
+					if gf.Mirror != "" {
+						ap = mirrorAperture(ap, gf.Mirror)
+					}
+					gf.State.Apertures[dCode] = ap
+					switch apType {
+					case ApertureCircle, ApertureRect, ApertureObround, AperturePolygon:
+					default:
+						if _, ok := gf.State.Macros[apType]; !ok {
+							gf.unsupported("aperture type " + apType)
+						}
+					}
+				} else {
+					gf.unsupported("malformed aperture definition")
+				}
+			} else if strings.HasPrefix(line, "%AM") {
+				// Parse Macro
+				name := strings.TrimPrefix(line, "%AM")
+				name = strings.TrimSuffix(name, "*")
+
+				var primitives []MacroPrimitive
+
+				for scanner.Scan() {
+					mLine := strings.TrimSpace(scanner.Text())
+					if mLine == "%" {
+						break
+					}
+					mLine = strings.TrimSuffix(mLine, "*")
+					if strings.HasPrefix(mLine, "0 ") {
+						// Macro comment
+						continue
+					}
+					if strings.Contains(mLine, "$") {
+						gf.unsupported("macro variables")
+					}
+					parts := strings.Split(mLine, ",")
+					if len(parts) > 0 {
+						code, _ := strconv.Atoi(parts[0])
+						switch code {
+						case 1, 4, 5, 21:
+						default:
+							gf.unsupported(fmt.Sprintf("macro primitive %d", code))
+						}
+						var mods []float64
+						for _, p := range parts[1:] {
+							val, _ := strconv.ParseFloat(p, 64)
+							mods = append(mods, val)
+						}
+						primitives = append(primitives, MacroPrimitive{Code: code, Modifiers: gf.scaleMacroModifiers(code, mods)})
+					}
+				}
+				gf.State.Macros[name] = Macro{Name: name, Primitives: primitives}
+				if gf.Mirror != "" {
+					gf.State.Macros[name] = mirrorMacro(gf.State.Macros[name], gf.Mirror)
+				}
+			} else if strings.HasPrefix(line, "%MO") {
+				if strings.Contains(line, "IN") {
+					gf.State.Units = "IN"
+				} else {
+					gf.State.Units = "MM"
+				}
+			} else if strings.HasPrefix(line, "%LPC") {
+				gf.unsupported("clear polarity (%LPC)")
+			} else if strings.HasPrefix(line, "%SR") && line != "%SR*%" && !strings.HasPrefix(line, "%SRX1Y1") {
+				gf.unsupported("step and repeat (%SR)")
+			} else if strings.HasPrefix(line, "%LR") {
+				rot, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(line, "%LR"), "*%"), 64)
+				if err != nil {
+					gf.unsupported("malformed rotation (%LR)")
+				} else {
+					emit(Command{Type: "LR", R: &rot})
+				}
+			} else if strings.HasPrefix(line, "%TA.AperFunction,") {
+				gf.State.AperFunction = strings.TrimSuffix(strings.TrimPrefix(line, "%TA.AperFunction,"), "*%")
+			} else if strings.HasPrefix(line, "%TO.C,") {
+				emit(Command{Type: "COMPONENT", Name: strings.TrimSuffix(strings.TrimPrefix(line, "%TO.C,"), "*%")})
+			} else if line == "%TD*%" {
+				gf.State.AperFunction = ""
+				emit(Command{Type: "COMPONENT"})
+			} else if line == "%TD.AperFunction*%" {
+				gf.State.AperFunction = ""
+			} else if line == "%TD.C*%" {
+				emit(Command{Type: "COMPONENT"})
+			} else if strings.HasPrefix(line, "%AB") {
+				gf.unsupported("block aperture (%AB)")
+			}
+			continue
+		}
+
+		// Handle Standard Commands
+		// Split by *
+		parts := strings.Split(line, "*")
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			// Check for G-codes
+			if strings.HasPrefix(part, "G") {
+				if part == "G70" {
+					// Deprecated inch mode
+					gf.State.Units = "IN"
+				} else if part == "G71" {
+					// Deprecated mm mode
+					gf.State.Units = "MM"
+				} else if part == "G01" {
+					// Linear interpolation (default)
+					emit(Command{Type: "G01"})
+				} else if part == "G02" {
+					// Clockwise circular interpolation
+					emit(Command{Type: "G02"})
+				} else if part == "G03" {
+					// Counter-clockwise circular interpolation
+					emit(Command{Type: "G03"})
+				} else if part == "G36" || part == "G37" {
+					// Region start/end
+					emit(Command{Type: part})
+				} else if part == "G74" {
+					gf.unsupported("single quadrant arcs (G74)")
+				} else if !strings.HasPrefix(part, "G04") && part != "G75" && part != "G90" && part != "G54" {
+					gf.unsupported("G-code " + part)
+				}
+				continue
+			}
+
+			// Handle Aperture Selection (e.g., D10*)
+			if strings.HasPrefix(part, "D") && len(part) >= 2 {
+				// Likely D10, D11 etc.
+				dCode, err := strconv.Atoi(part[1:])
+				if err == nil && dCode >= 10 {
+					emit(Command{Type: "APERTURE", D: &dCode})
+					continue
+				}
+			}
+
+			// Handle Coordinates and Draw/Flash commands
+			// X...Y...D01*
+			words := lexWords(part)
+			if len(words) > 0 {
+				cmd := Command{Type: "MOVE"}
+				for _, w := range words {
+					valStr := w.value
+
+					switch w.letter {
+					case 'X':
+						v := gf.parseCoordinate(valStr, gf.State.FormatX)
+						cmd.X = &v
+					case 'Y':
+						v := gf.parseCoordinate(valStr, gf.State.FormatY)
+						cmd.Y = &v
+					case 'I':
+						v := gf.parseCoordinate(valStr, gf.State.FormatX)
+						cmd.I = &v
+					case 'J':
+						v := gf.parseCoordinate(valStr, gf.State.FormatY)
+						cmd.J = &v
+					case 'D':
+						val, _ := strconv.ParseFloat(valStr, 64)
+						d := int(val)
+						cmd.D = &d
+						if d == 1 {
+							cmd.Type = "DRAW"
+						} else if d == 2 {
+							cmd.Type = "MOVE"
+						} else if d == 3 {
+							cmd.Type = "FLASH"
+						}
+					}
+				}
+				emit(cmd)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// The lexers below replace regular expressions on the parse hot path. They
+// scan bytes directly and accept the same inputs the expressions used to.
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// coordWord is one letter/value pair of a data block, e.g. X123 or D01.
+type coordWord struct {
+	letter byte
+	value  string
+}
+
+// lexWords finds every X, Y, I, J or D word in a block, skipping anything
+// else, like the former ([XYDIJ])([\d\.\-]+) expression.
+func lexWords(part string) []coordWord {
+	var words []coordWord
+	for i := 0; i < len(part); {
+		switch part[i] {
+		case 'X', 'Y', 'D', 'I', 'J':
+			j := i + 1
+			for j < len(part) && (isDigit(part[j]) || part[j] == '.' || part[j] == '-') {
+				j++
+			}
+			if j > i+1 {
+				words = append(words, coordWord{part[i], part[i+1 : j]})
+				i = j
+				continue
+			}
+		}
+		i++
+	}
+	return words
+}
+
+// lexFormatSpec parses %FSLAX24Y24*%.
+func lexFormatSpec(line string) (xi, xd, yi, yd int, ok bool) {
+	const prefix = "%FSLAX"
+	if len(line) < len(prefix)+7 || line[:len(prefix)] != prefix {
+		return 0, 0, 0, 0, false
+	}
+	f := line[len(prefix):]
+	if !isDigit(f[0]) || !isDigit(f[1]) || f[2] != 'Y' || !isDigit(f[3]) || !isDigit(f[4]) || f[5:7] != "*%" {
+		return 0, 0, 0, 0, false
+	}
+	return int(f[0] - '0'), int(f[1] - '0'), int(f[3] - '0'), int(f[4] - '0'), true
+}
+
+// lexApertureDef parses %ADD10C,0.5X0.3*% into the D-code, the template
+// name and the raw X separated modifier list.
+func lexApertureDef(line string) (dCode int, name, mods string, ok bool) {
+	const prefix = "%ADD"
+	if !strings.HasPrefix(line, prefix) {
+		return 0, "", "", false
+	}
+	i := len(prefix)
+	start := i
+	for i < len(line) && isDigit(line[i]) {
+		i++
+	}
+	if i == start {
+		return 0, "", "", false
+	}
+	dCode, _ = strconv.Atoi(line[start:i])
+
+	start = i
+	for i < len(line) {
+		c := line[i]
+		if !(isDigit(c) || c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')) {
+			break
+		}
+		i++
+	}
+	if i == start {
+		return 0, "", "", false
+	}
+	name = line[start:i]
+
+	if i < len(line) && line[i] == ',' {
+		i++
+	}
+	start = i
+	for i < len(line) && (isDigit(line[i]) || line[i] == '.' || line[i] == 'X') {
+		i++
+	}
+	mods = line[start:i]
+
+	if !strings.HasPrefix(line[i:], "*%") {
+		return 0, "", "", false
+	}
+	return dCode, name, mods, true
+}
+
+// unitScale returns the factor that converts file units to mm.
+func (gf *File) unitScale() float64 {
+	if gf.State.Units == "IN" {
+		return 25.4
+	}
+	return 1.0
+}
+
+func (gf *File) parseCoordinate(valStr string, fmtSpec struct{ Integer, Decimal int }) float64 {
+	if strings.Contains(valStr, ".") {
+		val, _ := strconv.ParseFloat(valStr, 64)
+		return val * gf.unitScale()
+	}
+	val, _ := strconv.ParseFloat(valStr, 64)
+	divisor := math.Pow(10, float64(fmtSpec.Decimal))
+	return val / divisor * gf.unitScale()
+}
+
+// scaleApertureModifiers converts the dimensional modifiers of a standard
+// aperture to mm. Vertex counts and rotations are left as they are.
+func (gf *File) scaleApertureModifiers(apType string, mods []float64) []float64 {
+	scale := gf.unitScale()
+	if scale == 1.0 {
+		return mods
+	}
+	var dims []int
+	switch apType {
+	case ApertureCircle, ApertureRect, ApertureObround:
+		// Diameter or width/height, optional hole diameter
+		for i := range mods {
+			dims = append(dims, i)
+		}
+	case AperturePolygon:
+		// Outer diameter, vertices, rotation, hole diameter
+		dims = []int{0, 3}
+	}
+	for _, i := range dims {
+		if i < len(mods) {
+			mods[i] *= scale
+		}
+	}
+	return mods
+}
+
+// scaleMacroModifiers converts the dimensional modifiers of a macro
+// primitive to mm. Exposure, vertex counts and rotations are left as they are.
+func (gf *File) scaleMacroModifiers(code int, mods []float64) []float64 {
+	scale := gf.unitScale()
+	if scale == 1.0 {
+		return mods
+	}
+	var dims []int
+	switch code {
+	case 1: // Circle: exposure, diameter, center x, center y, rotation
+		dims = []int{1, 2, 3}
+	case 20: // Vector line: exposure, width, start x, start y, end x, end y, rotation
+		dims = []int{1, 2, 3, 4, 5}
+	case 21: // Center line: exposure, width, height, center x, center y, rotation
+		dims = []int{1, 2, 3, 4}
+	case 4: // Outline: exposure, vertex count, x0, y0, ... xn, yn, rotation
+		for i := 2; i < len(mods)-1; i++ {
+			dims = append(dims, i)
+		}
+	case 5: // Polygon: exposure, vertices, center x, center y, diameter, rotation
+		dims = []int{2, 3, 4}
+	case 7: // Thermal: center x, center y, outer, inner, gap, rotation
+		dims = []int{0, 1, 2, 3, 4}
+	}
+	for _, i := range dims {
+		if i < len(mods) {
+			mods[i] *= scale
+		}
+	}
+	return mods
+}
+
+// Bounds is a rectangle in mm.
+type Bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// Union returns the smallest bounds containing both b and o.
+func (b Bounds) Union(o Bounds) Bounds {
+	return Bounds{
+		MinX: math.Min(b.MinX, o.MinX),
+		MinY: math.Min(b.MinY, o.MinY),
+		MaxX: math.Max(b.MaxX, o.MaxX),
+		MaxY: math.Max(b.MaxY, o.MaxY),
+	}
+}
+
+// boundsTracker accumulates the extent of flashes and draws one command at
+// a time, including the size of the aperture and the sweep of arcs.
+type boundsTracker struct {
+	gf                     *File
+	minX, minY, maxX, maxY float64
+	graphics
+	inRegion bool
+}
+
+// graphics is the part of the graphics state the extent of a flash or draw
+// depends on.
+type graphics struct {
+	curX, curY        float64
+	curDCode          int
+	interpolationMode string
+	rotation          float64 // From %LR
+}
+
+func newBoundsTracker(gf *File) *boundsTracker {
+	return &boundsTracker{
+		gf:   gf,
+		minX: 1e9, minY: 1e9, maxX: -1e9, maxY: -1e9,
+		graphics: graphics{interpolationMode: "G01"},
+	}
+}
+
+func (bt *boundsTracker) update(x, y float64) {
+	if x < bt.minX {
+		bt.minX = x
+	}
+	if y < bt.minY {
+		bt.minY = y
+	}
+	if x > bt.maxX {
+		bt.maxX = x
+	}
+	if y > bt.maxY {
+		bt.maxY = y
+	}
+}
+
+// halfSize returns how far the current aperture reaches from its center
+// along X and Y. Rotated apertures use their radial extent.
+func (bt *boundsTracker) halfSize() (float64, float64) {
+	if bt.inRegion {
+		return 0, 0 // Region contours are the boundary itself
+	}
+	ap := bt.gf.State.Apertures[bt.curDCode]
+	if (ap.Type == ApertureRect || ap.Type == ApertureObround) && len(ap.Modifiers) >= 2 && bt.rotation == 0 {
+		return ap.Modifiers[0] / 2, ap.Modifiers[1] / 2
+	}
+	e := bt.gf.ApertureExtent(ap)
+	return e, e
+}
+
+// add grows the bounds by an aperture of half size (hx, hy) at (x, y).
+func (bt *boundsTracker) add(x, y, hx, hy float64) {
+	bt.update(x-hx, y-hy)
+	bt.update(x+hx, y+hy)
+}
+
+func (bt *boundsTracker) handle(cmd Command) {
+	switch cmd.Type {
+	case "APERTURE":
+		bt.curDCode = *cmd.D
+		return
+	case "G01", "G02", "G03":
+		bt.interpolationMode = cmd.Type
+		return
+	case "LR":
+		bt.rotation = *cmd.R
+		return
+	case "G36":
+		bt.inRegion = true
+		return
+	case "G37":
+		bt.inRegion = false
+		return
+	}
+
+	prevX, prevY := bt.curX, bt.curY
+	if cmd.X != nil {
+		bt.curX = *cmd.X
+	}
+	if cmd.Y != nil {
+		bt.curY = *cmd.Y
+	}
+
+	if cmd.Type == "FLASH" {
+		hx, hy := bt.halfSize()
+		bt.add(bt.curX, bt.curY, hx, hy)
+	} else if cmd.Type == "DRAW" {
+		hx, hy := bt.halfSize()
+		if bt.interpolationMode == "G01" {
+			bt.add(prevX, prevY, hx, hy)
+			bt.add(bt.curX, bt.curY, hx, hy)
+			return
+		}
+		var i, j float64
+		if cmd.I != nil {
+			i = *cmd.I
+		}
+		if cmd.J != nil {
+			j = *cmd.J
+		}
+		// An arc can bulge past both of its end points
+		for _, p := range ArcPath(prevX, prevY, bt.curX, bt.curY, i, j, bt.interpolationMode) {
+			bt.add(p.X, p.Y, hx, hy)
+		}
+	}
+}
+
+func (bt *boundsTracker) bounds() Bounds {
+	minX, minY, maxX, maxY := bt.minX, bt.minY, bt.maxX, bt.maxY
+	if minX == 1e9 {
+		// No drawing commands found, default to 0,0
+		minX, minY = 0, 0
+		maxX, maxY = 10, 10 // Arbitrary small size
+	}
+
+	// Add some padding
+	padding := 2.0 // mm
+	minX -= padding
+	minY -= padding
+	maxX += padding
+	maxY += padding
+
+	return Bounds{MinX: minX, MinY: minY, MaxX: maxX, MaxY: maxY}
+}
+
+// CalculateBounds returns the extent of the file's flashes and draws, with
+// 2 mm of padding.
+func (gf *File) CalculateBounds() Bounds {
+	bt := newBoundsTracker(gf)
+	for _, cmd := range gf.Commands {
+		bt.handle(cmd)
+	}
+	return bt.bounds()
+}
+
+// ComponentBounds returns the extent of each component's flashes and draws,
+// from the X2 component attributes (%TO.C) they are tagged with.
+func (gf *File) ComponentBounds() map[string]Bounds {
+	out := make(map[string]Bounds)
+	bt := newBoundsTracker(gf)
+	ref := ""
+	for _, cmd := range gf.Commands {
+		if cmd.Type == "COMPONENT" {
+			ref = cmd.Name
+			continue
+		}
+		bt.minX, bt.minY, bt.maxX, bt.maxY = 1e9, 1e9, -1e9, -1e9
+		bt.handle(cmd)
+		if ref == "" || bt.minX > bt.maxX {
+			continue
+		}
+		b := Bounds{MinX: bt.minX, MinY: bt.minY, MaxX: bt.maxX, MaxY: bt.maxY}
+		if have, ok := out[ref]; ok {
+			b = b.Union(have)
+		}
+		out[ref] = b
+	}
+	return out
+}
+
+// SmallestAperture returns the smallest feature size in mm among the standard
+// apertures: the diameter of circles, the short side of rects and obrounds.
+// It returns 0 if there are none.
+func (gf *File) SmallestAperture() float64 {
+	smallest := 0.0
+	for _, ap := range gf.State.Apertures {
+		size := 0.0
+		switch ap.Type {
+		case ApertureCircle:
+			if len(ap.Modifiers) > 0 {
+				size = ap.Modifiers[0]
+			}
+		case ApertureRect, ApertureObround:
+			if len(ap.Modifiers) > 1 {
+				size = math.Min(ap.Modifiers[0], ap.Modifiers[1])
+			}
+		}
+		if size > 0 && (smallest == 0 || size < smallest) {
+			smallest = size
+		}
+	}
+	return smallest
+}
+
+// RegularPoly returns the vertices of a regular polygon with n vertices on a
+// circle of diameter dia, the first at rot degrees.
+func RegularPoly(cx, cy, dia float64, n int, rot float64) []Vec2 {
+	if n < 3 {
+		return nil
+	}
+	pts := make([]Vec2, n)
+	for i := range pts {
+		a := (rot + 360*float64(i)/float64(n)) * math.Pi / 180
+		pts[i] = Vec2{cx + dia/2*math.Cos(a), cy + dia/2*math.Sin(a)}
+	}
+	return pts
+}
+
+// MacroOutline returns the rotated polygon of an outline primitive:
+// exposure, vertex count, x0, y0 ... xn, yn, rotation. The last point
+// repeats the first.
+func MacroOutline(m []float64) []Vec2 {
+	if len(m) < 2 {
+		return nil
+	}
+	n := int(m[1])
+	if n < 3 || len(m) < 2+2*(n+1)+1 {
+		return nil
+	}
+	pts := make([]Vec2, n)
+	for i := range pts {
+		pts[i] = Vec2{m[2+2*i], m[3+2*i]}
+	}
+	return RotatePoly(pts, m[2+2*(n+1)])
+}
+
+// ApertureExtent returns the largest distance in mm from an aperture's
+// origin that it covers.
+func (gf *File) ApertureExtent(ap Aperture) float64 {
+	m := ap.Modifiers
+	switch ap.Type {
+	case ApertureCircle:
+		if len(m) > 0 {
+			return m[0] / 2
+		}
+	case ApertureRect, ApertureObround:
+		if len(m) >= 2 {
+			return math.Hypot(m[0], m[1]) / 2
+		}
+	case AperturePolygon:
+		if len(m) > 0 {
+			return m[0] / 2
+		}
+	default:
+		extent := 0.0
+		for _, prim := range gf.State.Macros[ap.Type].Primitives {
+			pm := prim.Modifiers
+			switch prim.Code {
+			case 1:
+				if len(pm) >= 4 {
+					extent = math.Max(extent, math.Hypot(pm[2], pm[3])+pm[1]/2)
+				}
+			case 21:
+				if len(pm) >= 6 {
+					extent = math.Max(extent, math.Hypot(pm[3], pm[4])+math.Hypot(pm[1], pm[2])/2)
+				}
+			case 4:
+				for _, p := range MacroOutline(pm) {
+					extent = math.Max(extent, math.Hypot(p.X, p.Y))
+				}
+			case 5:
+				if len(pm) >= 6 {
+					extent = math.Max(extent, math.Hypot(pm[2], pm[3])+pm[4]/2)
+				}
+			}
+		}
+		return extent
+	}
+	return 0
+}
+
+// StreamBounds computes the bounds of a gerber file without keeping
+// its commands in memory. The returned file holds the parsed state (units,
+// apertures, macros) but no commands. Like ParseMirrored, mirror
+// mirrors the geometry. Reading the file is reported to report.
+func StreamBounds(filename, mirror string, report progress.Func) (*File, Bounds, error) {
+	gf := New()
+	gf.Mirror, gf.Progress = mirror, report
+	bt := newBoundsTracker(gf)
+	if err := gf.Scan(filename, bt.handle); err != nil {
+		return nil, Bounds{}, err
+	}
+	return gf, bt.bounds(), nil
+}
@@ -0,0 +1,113 @@
+package gerber
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parseString parses src as a gerber file.
+func parseString(t *testing.T, src string) *File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.gbr")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gf, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return gf
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+const inchFile = `%FSLAX24Y24*%
+%MOIN*%
+%AMBOX*
+21,1,0.1,0.05,0.2,0.3,0*
+%
+%ADD10C,0.01*%
+%ADD11R,0.05X0.02*%
+%ADD12P,0.1X6*%
+%ADD13BOX*%
+D10*
+X0Y0D02*
+X10000Y5000D01*
+D11*
+X20000Y-2500D03*
+G03*
+X30000Y0I5000J0D01*
+G01*
+M02*
+`
+
+func TestInchUnits(t *testing.T) {
+	gf := parseString(t, inchFile)
+	if gf.State.Units != "IN" {
+		t.Errorf("units = %q, want IN", gf.State.Units)
+	}
+
+	apertures := []struct {
+		code int
+		mods []float64
+	}{
+		{10, []float64{0.254}},
+		{11, []float64{1.27, 0.508}},
+		{12, []float64{2.54, 6}}, // The vertex count isn't a length
+	}
+	for _, tc := range apertures {
+		ap := gf.State.Apertures[tc.code]
+		if len(ap.Modifiers) != len(tc.mods) {
+			t.Errorf("D%d modifiers = %v, want %v", tc.code, ap.Modifiers, tc.mods)
+			continue
+		}
+		for i, m := range tc.mods {
+			if !near(ap.Modifiers[i], m) {
+				t.Errorf("D%d modifier %d = %g mm, want %g", tc.code, i, ap.Modifiers[i], m)
+			}
+		}
+	}
+	// Center line primitive: exposure, width, height, center x, center y, rotation
+	box := gf.State.Macros["BOX"].Primitives[0].Modifiers
+	for i, m := range []float64{1, 2.54, 1.27, 5.08, 7.62, 0} {
+		if !near(box[i], m) {
+			t.Errorf("macro modifier %d = %g, want %g", i, box[i], m)
+		}
+	}
+
+	var got [][2]float64
+	var arc [2]float64
+	for _, cmd := range gf.Commands {
+		if cmd.X != nil && cmd.Y != nil {
+			got = append(got, [2]float64{*cmd.X, *cmd.Y})
+		}
+		if cmd.I != nil {
+			arc = [2]float64{*cmd.I, *cmd.J}
+		}
+	}
+	want := [][2]float64{{0, 0}, {25.4, 12.7}, {50.8, -6.35}, {76.2, 0}}
+	if len(got) != len(want) {
+		t.Fatalf("coordinates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !near(got[i][0], want[i][0]) || !near(got[i][1], want[i][1]) {
+			t.Errorf("coordinate %d = %v mm, want %v", i, got[i], want[i])
+		}
+	}
+	if !near(arc[0], 12.7) || !near(arc[1], 0) {
+		t.Errorf("arc offset = %v mm, want [12.7 0]", arc)
+	}
+}
+
+// The same board in inches and in mm comes out the same.
+func TestInchMatchesMM(t *testing.T) {
+	in := parseString(t, "%FSLAX24Y24*%\n%MOIN*%\n%ADD10R,0.1X0.05*%\nD10*\nX10000Y10000D03*\nM02*\n")
+	mm := parseString(t, "%FSLAX46Y46*%\n%MOMM*%\n%ADD10R,2.54X1.27*%\nD10*\nX25400000Y25400000D03*\nM02*\n")
+	if a, b := in.CalculateBounds(), mm.CalculateBounds(); !near(a.MinX, b.MinX) || !near(a.MaxX, b.MaxX) || !near(a.MinY, b.MinY) || !near(a.MaxY, b.MaxY) {
+		t.Errorf("inch bounds %+v, mm bounds %+v", a, b)
+	}
+}
@@ -0,0 +1,196 @@
+package gerber
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// dump writes the parsed apertures and commands of gf as text, in the form
+// of the testdata golden files. Those were written by the regexp parser the
+// lexers replaced, so only the fields it had are in them.
+func dump(gf *File) string {
+	ptr := func(p *float64) string {
+		if p == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.6f", *p)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "units %s\n", gf.State.Units)
+	var codes []int
+	for c := range gf.State.Apertures {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		ap := gf.State.Apertures[c]
+		fmt.Fprintf(&b, "aperture D%d %s", c, ap.Type)
+		for _, m := range ap.Modifiers {
+			fmt.Fprintf(&b, " %.6f", m)
+		}
+		b.WriteString("\n")
+	}
+	for _, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "LR", "COMPONENT":
+			continue // Added after the regexp parser
+		}
+		d := "-"
+		if cmd.D != nil {
+			d = fmt.Sprint(*cmd.D)
+		}
+		fmt.Fprintf(&b, "%s %s %s %s %s %s\n", cmd.Type, ptr(cmd.X), ptr(cmd.Y), ptr(cmd.I), ptr(cmd.J), d)
+	}
+	return b.String()
+}
+
+func testFiles(t testing.TB) []string {
+	files, err := filepath.Glob("testdata/*.g[bk]?")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+	return files
+}
+
+func TestParseGolden(t *testing.T) {
+	for _, path := range testFiles(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			want, err := os.ReadFile(path + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gf, err := Parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := dump(gf)
+			if got == string(want) {
+				return
+			}
+			gl, wl := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+			for i := 0; i < len(gl) && i < len(wl); i++ {
+				if gl[i] != wl[i] {
+					t.Fatalf("line %d: got %q, want %q", i+1, gl[i], wl[i])
+				}
+			}
+			t.Fatalf("got %d lines, want %d", len(gl), len(wl))
+		})
+	}
+}
+
+// The expressions the lexers replaced, to check them against.
+var (
+	reCoord = regexp.MustCompile(`([XYDIJ])([\d\.\-]+)`)
+	reAD    = regexp.MustCompile(`%ADD(\d+)([A-Za-z0-9_]+),?([\d\.X]+)?\*%`)
+	reFS    = regexp.MustCompile(`%FSLAX(\d)(\d)Y(\d)(\d)\*%`)
+)
+
+// lexLines returns the lines of the test files, with some the files don't
+// have.
+func lexLines(t *testing.T) []string {
+	lines := []string{
+		"X+5I-3J4D02", "X1.5Y-.5D01", "Y7", "D03", "M02", "X-Y-D01", "G01X100Y200D01",
+		"%ADD20RoundRect,0.1X0.5X0.5*%", "%ADD12BOX*%", "%ADD13C,*%", "%ADDC,0.5*%", "%ADD14C,0.5",
+		"%FSLAX24Y24*%", "%FSLAX2Y4*%", "%FSTAX46Y46*%",
+	}
+	for _, path := range testFiles(t) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			lines = append(lines, strings.Split(strings.TrimSpace(line), "*")...)
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
+
+func TestLexWordsMatchesRegexp(t *testing.T) {
+	for _, part := range lexLines(t) {
+		var want, got []string
+		for _, m := range reCoord.FindAllStringSubmatch(part, -1) {
+			want = append(want, m[1]+m[2])
+		}
+		for _, w := range lexWords(part) {
+			got = append(got, string(w.letter)+w.value)
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("lexWords(%q) = %q, the expression found %q", part, got, want)
+		}
+	}
+}
+
+func TestLexApertureDefMatchesRegexp(t *testing.T) {
+	for _, line := range lexLines(t) {
+		if !strings.HasPrefix(line, "%AD") {
+			continue
+		}
+		code, name, mods, ok := lexApertureDef(line)
+		m := reAD.FindStringSubmatch(line)
+		if ok != (m != nil) {
+			t.Errorf("lexApertureDef(%q) ok = %v, the expression matched: %v", line, ok, m != nil)
+			continue
+		}
+		if ok && (strconv.Itoa(code) != m[1] || name != m[2] || mods != m[3]) {
+			t.Errorf("lexApertureDef(%q) = %d, %q, %q, the expression found %q", line, code, name, mods, m[1:])
+		}
+	}
+}
+
+func TestLexFormatSpecMatchesRegexp(t *testing.T) {
+	for _, line := range lexLines(t) {
+		if !strings.HasPrefix(line, "%FS") {
+			continue
+		}
+		xi, xd, yi, yd, ok := lexFormatSpec(line)
+		m := reFS.FindStringSubmatch(line)
+		if ok != (m != nil) {
+			t.Errorf("lexFormatSpec(%q) ok = %v, the expression matched: %v", line, ok, m != nil)
+			continue
+		}
+		if ok && fmt.Sprint(xi, xd, yi, yd) != strings.Join(m[1:], " ") {
+			t.Errorf("lexFormatSpec(%q) = %d %d %d %d, the expression found %q", line, xi, xd, yi, yd, m[1:])
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	files := testFiles(b)
+	var size int64
+	for _, path := range files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		for _, path := range files {
+			if _, err := Parse(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkLexWords and BenchmarkRegexpWords compare the data block lexer
+// with the expression it replaced.
+func BenchmarkLexWords(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		lexWords("X12345678Y-2345678I100000J-200000D01")
+	}
+}
+
+func BenchmarkRegexpWords(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		reCoord.FindAllStringSubmatch("X12345678Y-2345678I100000J-200000D01", -1)
+	}
+}
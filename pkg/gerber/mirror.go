@@ -0,0 +1,127 @@
+package gerber
+
+// Mirror axes. MirrorX flips the board left to right, negating X, as when
+// it's turned over to print its bottom side; MirrorY flips it top to bottom.
+const (
+	MirrorX = "x"
+	MirrorY = "y"
+)
+
+// MirrorPoint mirrors gerber coordinates across the axis.
+func MirrorPoint(x, y float64, axis string) (float64, float64) {
+	switch axis {
+	case MirrorX:
+		return -x, y
+	case MirrorY:
+		return x, -y
+	}
+	return x, y
+}
+
+// MirrorBounds mirrors a rectangle across the axis.
+func MirrorBounds(b Bounds, axis string) Bounds {
+	x0, y0 := MirrorPoint(b.MinX, b.MinY, axis)
+	x1, y1 := MirrorPoint(b.MaxX, b.MaxY, axis)
+	return Bounds{MinX: min(x0, x1), MinY: min(y0, y1), MaxX: max(x0, x1), MaxY: max(y0, y1)}
+}
+
+// mirrorCommand mirrors the coordinates of a command. Arcs change direction,
+// and rotations turn the other way.
+func mirrorCommand(cmd Command, axis string) Command {
+	neg := func(v *float64) *float64 {
+		if v == nil {
+			return nil
+		}
+		n := -*v
+		return &n
+	}
+	if axis == MirrorX {
+		cmd.X, cmd.I = neg(cmd.X), neg(cmd.I)
+	} else {
+		cmd.Y, cmd.J = neg(cmd.Y), neg(cmd.J)
+	}
+	switch cmd.Type {
+	case "G02":
+		cmd.Type = "G03"
+	case "G03":
+		cmd.Type = "G02"
+	case "LR":
+		cmd.R = neg(cmd.R)
+	}
+	return cmd
+}
+
+// mirrorPolygonRotation returns the rotation of a regular polygon with its
+// first vertex rotated by deg, after mirroring. In X the first vertex ends up
+// on the other side, 180° round.
+func mirrorPolygonRotation(deg float64, axis string) float64 {
+	if axis == MirrorX {
+		return 180 - deg
+	}
+	return -deg
+}
+
+// mirrorAperture mirrors the shape of a standard aperture. Circles,
+// rectangles and obrounds are symmetric about both axes; polygons are not.
+func mirrorAperture(ap Aperture, axis string) Aperture {
+	if ap.Type == AperturePolygon && len(ap.Modifiers) >= 2 {
+		mods := append([]float64(nil), ap.Modifiers...)
+		if len(mods) < 3 {
+			mods = append(mods, 0)
+		}
+		mods[2] = mirrorPolygonRotation(mods[2], axis)
+		ap.Modifiers = mods
+	}
+	return ap
+}
+
+// mirrorMacro mirrors the primitives of an aperture macro about the
+// aperture's origin: their positions are mirrored, and their rotations,
+// which are about that origin, turn the other way.
+func mirrorMacro(m Macro, axis string) Macro {
+	c := 2 // Index of the mirrored coordinate in an x, y pair
+	if axis == MirrorY {
+		c = 3
+	}
+	prims := make([]MacroPrimitive, len(m.Primitives))
+	for i, p := range m.Primitives {
+		mods := append([]float64(nil), p.Modifiers...)
+		negate := func(j int) {
+			if j < len(mods) {
+				mods[j] = -mods[j]
+			}
+		}
+		switch p.Code {
+		case 1: // Circle: exposure, diameter, center x, center y, rotation
+			negate(c)
+			negate(4)
+		case 20: // Vector line: exposure, width, start x, start y, end x, end y, rotation
+			negate(c)
+			negate(c + 2)
+			negate(6)
+		case 21: // Center line: exposure, width, height, center x, center y, rotation
+			negate(c + 1)
+			negate(5)
+		case 4: // Outline: exposure, vertex count, x0, y0, ... xn, yn, rotation
+			for j := c; j < len(mods)-1; j += 2 {
+				negate(j)
+			}
+			negate(len(mods) - 1)
+		case 5: // Polygon: exposure, vertices, center x, center y, diameter, rotation
+			// Mirrored in X, the polygon turned 180° about the origin is
+			// the same polygon with its center mirrored in Y
+			negate(3)
+			if len(mods) == 5 {
+				mods = append(mods, 0)
+			}
+			if len(mods) > 5 {
+				mods[5] = mirrorPolygonRotation(mods[5], axis)
+			}
+		case 7: // Thermal: center x, center y, outer, inner, gap, rotation
+			negate(c - 2)
+			negate(5)
+		}
+		prims[i] = MacroPrimitive{Code: p.Code, Modifiers: mods}
+	}
+	return Macro{Name: m.Name, Primitives: prims}
+}
@@ -0,0 +1,328 @@
+package gerber
+
+import (
+	"math"
+	"sort"
+)
+
+// Vec2 is a point in the plane, in mm unless said otherwise.
+type Vec2 struct {
+	X, Y float64
+}
+
+// Polygons are flattened to within Tolerance mm of circles and arcs, and
+// ones with an area under Epsilon are dropped.
+const (
+	Tolerance = 0.005
+	Epsilon   = 1e-9
+)
+
+// CircleSteps returns the number of segments for a circle of radius r.
+func CircleSteps(r float64) int {
+	n := 8
+	if r > Tolerance {
+		n = int(math.Ceil(math.Pi / math.Acos(1-Tolerance/r)))
+	}
+	if n < 8 {
+		n = 8
+	}
+	return n
+}
+
+// CirclePoly returns a circle flattened to within Tolerance.
+func CirclePoly(cx, cy, r float64) []Vec2 {
+	n := CircleSteps(r)
+	pts := make([]Vec2, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = Vec2{cx + r*math.Cos(a), cy + r*math.Sin(a)}
+	}
+	return pts
+}
+
+// RectPoly returns a w x h rectangle centered on (cx, cy).
+func RectPoly(cx, cy, w, h float64) []Vec2 {
+	return []Vec2{{cx - w/2, cy - h/2}, {cx + w/2, cy - h/2}, {cx + w/2, cy + h/2}, {cx - w/2, cy + h/2}}
+}
+
+// RotatePoly rotates points counter-clockwise about the origin.
+func RotatePoly(pts []Vec2, deg float64) []Vec2 {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	out := make([]Vec2, len(pts))
+	for i, p := range pts {
+		out[i] = Vec2{p.X*cos - p.Y*sin, p.X*sin + p.Y*cos}
+	}
+	return out
+}
+
+// TranslatePoly moves points by (dx, dy).
+func TranslatePoly(pts []Vec2, dx, dy float64) []Vec2 {
+	out := make([]Vec2, len(pts))
+	for i, p := range pts {
+		out[i] = Vec2{p.X + dx, p.Y + dy}
+	}
+	return out
+}
+
+// SignedArea returns the area of a polygon, negative when it runs clockwise.
+func SignedArea(pts []Vec2) float64 {
+	a := 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%len(pts)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a / 2
+}
+
+// ApertureShapes returns an aperture as polygons around its origin. All are
+// convex except macro outlines, which are only valid in flashes.
+func (gf *File) ApertureShapes(ap Aperture, rotation float64) [][]Vec2 {
+	var shapes [][]Vec2
+	switch ap.Type {
+	case ApertureCircle:
+		if len(ap.Modifiers) > 0 {
+			shapes = append(shapes, CirclePoly(0, 0, ap.Modifiers[0]/2))
+		}
+	case ApertureRect:
+		if len(ap.Modifiers) >= 2 {
+			shapes = append(shapes, RectPoly(0, 0, ap.Modifiers[0], ap.Modifiers[1]))
+		}
+	case ApertureObround:
+		if len(ap.Modifiers) >= 2 {
+			w, h := ap.Modifiers[0], ap.Modifiers[1]
+			r := math.Min(w, h) / 2
+			dx, dy := (w-h)/2, 0.0
+			if h > w {
+				dx, dy = 0, (h-w)/2
+			}
+			caps := append(CirclePoly(-dx, -dy, r), CirclePoly(dx, dy, r)...)
+			shapes = append(shapes, ConvexHull(caps))
+		}
+	case AperturePolygon:
+		if len(ap.Modifiers) >= 2 {
+			rot := 0.0
+			if len(ap.Modifiers) >= 3 {
+				rot = ap.Modifiers[2]
+			}
+			if pts := RegularPoly(0, 0, ap.Modifiers[0], int(ap.Modifiers[1]), rot); pts != nil {
+				shapes = append(shapes, pts)
+			}
+		}
+	default:
+		macro, ok := gf.State.Macros[ap.Type]
+		if !ok {
+			break
+		}
+		for _, prim := range macro.Primitives {
+			m := prim.Modifiers
+			switch prim.Code {
+			case 1: // Circle: exposure, diameter, center x, center y
+				if len(m) >= 4 {
+					shapes = append(shapes, CirclePoly(m[2], m[3], m[1]/2))
+				}
+			case 21: // Center line: exposure, width, height, center x, center y, rotation
+				if len(m) >= 6 {
+					shapes = append(shapes, RotatePoly(RectPoly(m[3], m[4], m[1], m[2]), m[5]))
+				}
+			case 4: // Outline, not necessarily convex
+				if pts := MacroOutline(m); pts != nil {
+					shapes = append(shapes, pts)
+				}
+			case 5: // Polygon: exposure, vertices, center x, center y, diameter, rotation
+				if len(m) >= 6 {
+					if pts := RegularPoly(m[2], m[3], m[4], int(m[1]), 0); pts != nil {
+						shapes = append(shapes, RotatePoly(pts, m[5]))
+					}
+				}
+			}
+		}
+	}
+	if rotation != 0 {
+		for i := range shapes {
+			shapes[i] = RotatePoly(shapes[i], rotation)
+		}
+	}
+	return shapes
+}
+
+// ArcPath flattens a circular interpolation from (x0, y0) to (x1, y1) with
+// center offset (i, j), following the renderer's angle conventions.
+func ArcPath(x0, y0, x1, y1, i, j float64, mode string) []Vec2 {
+	cx, cy := x0+i, y0+j
+	radius := math.Hypot(i, j)
+	start := math.Atan2(y0-cy, x0-cx)
+	end := math.Atan2(y1-cy, x1-cx)
+	if mode == "G03" { // CCW
+		if end <= start {
+			end += 2 * math.Pi
+		}
+	} else if start <= end { // G02 CW
+		start += 2 * math.Pi
+	}
+	steps := int(math.Ceil(math.Abs(end-start) / (2 * math.Pi) * float64(CircleSteps(radius))))
+	if steps < 1 {
+		steps = 1
+	}
+	pts := make([]Vec2, 0, steps+1)
+	for s := 0; s <= steps; s++ {
+		a := start + (end-start)*float64(s)/float64(steps)
+		pts = append(pts, Vec2{cx + radius*math.Cos(a), cy + radius*math.Sin(a)})
+	}
+	return pts
+}
+
+// VectorPolygons converts the file's flashes, draws and regions into
+// counter-clockwise polygons in mm. Overlapping polygons are not merged.
+func (gf *File) VectorPolygons() [][]Vec2 {
+	var polys [][]Vec2
+	add := func(p []Vec2) {
+		a := SignedArea(p)
+		if math.Abs(a) < Epsilon {
+			return
+		}
+		if a < 0 {
+			for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+				p[i], p[j] = p[j], p[i]
+			}
+		}
+		polys = append(polys, p)
+	}
+
+	var curX, curY float64
+	curDCode := 0
+	mode := "G01"
+	rotation := 0.0
+	inRegion := false
+	var contour []Vec2
+	closeContour := func() {
+		if len(contour) >= 3 {
+			add(contour)
+		}
+		contour = nil
+	}
+
+	for _, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "APERTURE":
+			curDCode = *cmd.D
+			continue
+		case "G01", "G02", "G03":
+			mode = cmd.Type
+			continue
+		case "LR":
+			rotation = *cmd.R
+			continue
+		case "G36":
+			inRegion = true
+			continue
+		case "G37":
+			closeContour()
+			inRegion = false
+			continue
+		}
+
+		prevX, prevY := curX, curY
+		if cmd.X != nil {
+			curX = *cmd.X
+		}
+		if cmd.Y != nil {
+			curY = *cmd.Y
+		}
+
+		var path []Vec2
+		if cmd.Type == "DRAW" {
+			if mode == "G01" {
+				path = []Vec2{{prevX, prevY}, {curX, curY}}
+			} else {
+				var i, j float64
+				if cmd.I != nil {
+					i = *cmd.I
+				}
+				if cmd.J != nil {
+					j = *cmd.J
+				}
+				path = ArcPath(prevX, prevY, curX, curY, i, j, mode)
+			}
+		}
+
+		if inRegion {
+			switch cmd.Type {
+			case "MOVE":
+				closeContour()
+			case "DRAW":
+				if len(contour) == 0 {
+					contour = append(contour, path[0])
+				}
+				contour = append(contour, path[1:]...)
+			}
+			continue
+		}
+
+		ap, ok := gf.State.Apertures[curDCode]
+		if !ok {
+			continue
+		}
+		switch cmd.Type {
+		case "FLASH":
+			for _, s := range gf.ApertureShapes(ap, rotation) {
+				add(TranslatePoly(s, curX, curY))
+			}
+		case "DRAW":
+			// Sweeping a convex shape along a segment gives the hull of
+			// the shape at both ends
+			shapes := gf.ApertureShapes(ap, 0)
+			for k := 0; k+1 < len(path); k++ {
+				a, b := path[k], path[k+1]
+				for _, s := range shapes {
+					add(ConvexHull(append(TranslatePoly(s, a.X, a.Y), TranslatePoly(s, b.X, b.Y)...)))
+				}
+			}
+		}
+	}
+	closeContour() // Unterminated region
+	return polys
+}
+
+// PolyBounds returns the extent of a polygon.
+func PolyBounds(pts []Vec2) Bounds {
+	b := Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, p := range pts {
+		b = b.Union(Bounds{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+	}
+	return b
+}
+
+// Overlaps reports whether b and o share more than an edge.
+func (b Bounds) Overlaps(o Bounds) bool {
+	return b.MinX < o.MaxX && o.MinX < b.MaxX && b.MinY < o.MaxY && o.MinY < b.MaxY
+}
+
+// ConvexHull returns the convex hull of a point set in order (Andrew's
+// monotone chain).
+func ConvexHull(pts []Vec2) []Vec2 {
+	pts = append([]Vec2(nil), pts...)
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i].X != pts[j].X {
+			return pts[i].X < pts[j].X
+		}
+		return pts[i].Y < pts[j].Y
+	})
+	cross := func(o, a, b Vec2) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	var hull []Vec2
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, p := range pts {
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, p)
+		}
+		hull = hull[:len(hull)-1] // Last point starts the other chain
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	return hull
+}
@@ -0,0 +1,176 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// checkExamples is how many locations Check reports per kind of
+// problem.
+const checkExamples = 3
+
+// Vertex is a vertex as written to the STL, so that the check sees the
+// same coincident points a slicer does. It holds the bits of each float32,
+// which hash faster than the floats, with -0 made +0.
+type Vertex [3]uint32
+
+func (v Vertex) String() string {
+	f := math.Float32frombits
+	return fmt.Sprintf("(%.3f, %.3f, %.3f)", f(v[0]), f(v[1]), f(v[2]))
+}
+
+// VertexOf rounds p to the float32 vertex written to the STL.
+func VertexOf(p stl.Point) Vertex {
+	f := func(c float64) uint32 { return math.Float32bits(float32(c) + 0) }
+	return Vertex{f(p.X), f(p.Y), f(p.Z)}
+}
+
+// Check looks for the problems slicers trip over: NaN or infinite
+// vertices, triangles with two corners in the same place, and edges that
+// aren't shared by as many triangles running each way, which leave holes (an
+// odd number of triangles) or faces wound against their neighbours. Flat
+// triangles with three distinct corners are fine: earcut adds them to close
+// T-junctions. It returns one line per kind of problem, with the locations of
+// the first few, and reports how far it got to report.
+func Check(triangles [][3]stl.Point, report progress.Func) []string {
+	var issues []string
+	add := func(what string, where []string, n int) {
+		if n == 0 {
+			return
+		}
+		s := fmt.Sprintf("%d %s", n, what)
+		for i, w := range where {
+			if i == 0 {
+				s += " at "
+			} else {
+				s += ", "
+			}
+			s += w
+		}
+		if n > len(where) {
+			s += ", ..."
+		}
+		issues = append(issues, s)
+	}
+
+	// Each directed edge as the indices of its ends, lower first, and whether
+	// it runs the other way in the lowest bit, so that sorting groups the
+	// triangles along each edge
+	index := make(map[Vertex]uint32, len(triangles)/2)
+	var vertices []Vertex
+	edges := make([]uint64, 0, len(triangles)*3)
+	var nan, degenerate []string
+	nans, degenerates := 0, 0
+	for i, t := range triangles {
+		if i%65536 == 0 {
+			report.Report("Checking mesh", i, len(triangles))
+		}
+		finite := true
+		for _, p := range t {
+			for _, c := range []float64{p.X, p.Y, p.Z} {
+				finite = finite && !math.IsNaN(c) && !math.IsInf(c, 0)
+			}
+		}
+		if !finite {
+			if nans++; nans <= checkExamples {
+				nan = append(nan, fmt.Sprintf("(%g, %g, %g)", t[0].X, t[0].Y, t[0].Z))
+			}
+			continue
+		}
+
+		v := [3]Vertex{VertexOf(t[0]), VertexOf(t[1]), VertexOf(t[2])}
+		if v[0] == v[1] || v[1] == v[2] || v[2] == v[0] {
+			if degenerates++; degenerates <= checkExamples {
+				degenerate = append(degenerate, v[0].String())
+			}
+			continue
+		}
+		var id [3]uint64
+		for j, p := range v {
+			n, ok := index[p]
+			if !ok {
+				n = uint32(len(vertices))
+				index[p] = n
+				vertices = append(vertices, p)
+			}
+			id[j] = uint64(n)
+		}
+		for j := range id {
+			a, b := id[j], id[(j+1)%3]
+			if a < b {
+				edges = append(edges, a<<33|b<<1)
+			} else {
+				edges = append(edges, b<<33|a<<1|1)
+			}
+		}
+	}
+	report.Report("Checking mesh", 1, 1)
+	slices.Sort(edges)
+
+	var open, flipped []string
+	nOpen, nFlipped := 0, 0
+	for i := 0; i < len(edges); {
+		var n [2]int
+		j := i
+		for ; j < len(edges) && edges[j]>>1 == edges[i]>>1; j++ {
+			n[edges[j]&1]++
+		}
+		where := func() string {
+			return vertices[edges[i]>>33].String() + "-" + vertices[edges[i]>>1&(1<<32-1)].String()
+		}
+		switch {
+		case (n[0]+n[1])%2 == 1:
+			if nOpen++; nOpen <= checkExamples {
+				open = append(open, where())
+			}
+		case n[0] != n[1]:
+			if nFlipped++; nFlipped <= checkExamples {
+				flipped = append(flipped, where())
+			}
+		}
+		i = j
+	}
+
+	add("triangles with NaN or infinite vertices", nan, nans)
+	add("degenerate triangles", degenerate, degenerates)
+	add("open edges", open, nOpen)
+	add("edges between triangles wound opposite ways", flipped, nFlipped)
+	return issues
+}
+
+// Index shares the vertices of triangles, as written to an STL, and
+// returns them with each triangle's vertex indices. Triangles come out wound
+// counter-clockwise seen from outside, flipped like stl.Write does when the
+// mesh is inside out, and those with two corners in the same place, which
+// indexed formats don't allow, are dropped.
+func Index(triangles [][3]stl.Point) ([]Vertex, [][3]uint32) {
+	index := make(map[Vertex]uint32, len(triangles)/2)
+	var vertices []Vertex
+	faces := make([][3]uint32, 0, len(triangles))
+	flip := stl.SignedVolume(triangles) < 0
+	for _, t := range triangles {
+		var f [3]uint32
+		for j, p := range t {
+			v := VertexOf(p)
+			n, ok := index[v]
+			if !ok {
+				n = uint32(len(vertices))
+				index[v] = n
+				vertices = append(vertices, v)
+			}
+			f[j] = n
+		}
+		if f[0] == f[1] || f[1] == f[2] || f[2] == f[0] {
+			continue
+		}
+		if flip {
+			f[1], f[2] = f[2], f[1]
+		}
+		faces = append(faces, f)
+	}
+	return vertices, faces
+}
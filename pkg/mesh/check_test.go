@@ -0,0 +1,116 @@
+package mesh
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"pcb-to-stencil/pkg/stl"
+)
+
+// cube returns the 12 triangles of a unit cube, wound counter-clockwise
+// seen from outside.
+func cube() [][3]stl.Point {
+	p := func(x, y, z float64) stl.Point { return stl.Point{X: x, Y: y, Z: z} }
+	quad := func(a, b, c, d stl.Point) [][3]stl.Point {
+		return [][3]stl.Point{{a, b, c}, {a, c, d}}
+	}
+	var t [][3]stl.Point
+	t = append(t, quad(p(0, 0, 0), p(0, 1, 0), p(1, 1, 0), p(1, 0, 0))...) // Bottom
+	t = append(t, quad(p(0, 0, 1), p(1, 0, 1), p(1, 1, 1), p(0, 1, 1))...) // Top
+	t = append(t, quad(p(0, 0, 0), p(1, 0, 0), p(1, 0, 1), p(0, 0, 1))...) // Front
+	t = append(t, quad(p(0, 1, 0), p(0, 1, 1), p(1, 1, 1), p(1, 1, 0))...) // Back
+	t = append(t, quad(p(0, 0, 0), p(0, 0, 1), p(0, 1, 1), p(0, 1, 0))...) // Left
+	t = append(t, quad(p(1, 0, 0), p(1, 1, 0), p(1, 1, 1), p(1, 0, 1))...) // Right
+	return t
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func([][3]stl.Point) [][3]stl.Point
+		wants []string // Prefixes of the issues, in order
+	}{
+		{"closed", func(t [][3]stl.Point) [][3]stl.Point { return t }, nil},
+		{"hole", func(t [][3]stl.Point) [][3]stl.Point { return t[1:] }, []string{"3 open edges at "}},
+		{"flipped face", func(t [][3]stl.Point) [][3]stl.Point {
+			t[0][1], t[0][2] = t[0][2], t[0][1]
+			return t
+		}, []string{"3 edges between triangles wound opposite ways at "}},
+		{"degenerate", func(t [][3]stl.Point) [][3]stl.Point {
+			return append(t, [3]stl.Point{t[0][0], t[0][0], t[0][1]})
+		}, []string{"1 degenerate triangles at (0.000, 0.000, 0.000)"}},
+		{"NaN vertex", func(t [][3]stl.Point) [][3]stl.Point {
+			t[0][0].X = math.NaN()
+			return t
+		}, []string{"1 triangles with NaN or infinite vertices at (NaN, 0, 0)", "3 open edges at "}},
+		{"infinite vertex", func(t [][3]stl.Point) [][3]stl.Point {
+			return append(t, [3]stl.Point{{Z: math.Inf(1)}, {X: 1}, {Y: 1}})
+		}, []string{"1 triangles with NaN or infinite vertices at (0, 0, +Inf)"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := Check(tc.edit(cube()), nil)
+			if len(issues) != len(tc.wants) {
+				t.Fatalf("Check = %q, want %d issues", issues, len(tc.wants))
+			}
+			for i, want := range tc.wants {
+				if !strings.HasPrefix(issues[i], want) {
+					t.Errorf("issue %d = %q, want %q...", i, issues[i], want)
+				}
+			}
+		})
+	}
+}
+
+// Check lists only the first few locations of each kind of problem.
+func TestCheckExamples(t *testing.T) {
+	var tris [][3]stl.Point
+	for i := range 5 {
+		x := float64(i)
+		tris = append(tris, [3]stl.Point{{X: x}, {X: x}, {X: x, Y: 1}})
+	}
+	issues := Check(tris, nil)
+	if len(issues) != 1 || !strings.HasPrefix(issues[0], "5 degenerate triangles") || !strings.HasSuffix(issues[0], ", ...") || strings.Count(issues[0], "(") != checkExamples {
+		t.Errorf("Check = %q, want 5 degenerate triangles with %d locations", issues, checkExamples)
+	}
+}
+
+// The meshes Mesher makes pass the check whichever way the faces are
+// covered.
+func TestMesherClosed(t *testing.T) {
+	// A plate with two openings and a raised wall around the edge
+	const w, h = 12, 9
+	l := NewLevels(w, h, func(x, y int) (float64, float64) {
+		switch {
+		case x == 0 || y == 0 || x == w-1 || y == h-1:
+			return 0, 2
+		case (x >= 2 && x <= 4 && y >= 2 && y <= 5) || (x == 8 && y == 4):
+			return 0, 0
+		}
+		return 0, 0.12
+	})
+	for _, maxRects := range []bool{false, true} {
+		tris := Mesher{PixelSize: 0.1, MaxRects: maxRects}.Mesh(l)
+		if len(tris) == 0 {
+			t.Fatalf("MaxRects %v: no triangles", maxRects)
+		}
+		if issues := Check(tris, nil); len(issues) != 0 {
+			t.Errorf("MaxRects %v: %q", maxRects, issues)
+		}
+		if seq := slices.Collect(Mesher{PixelSize: 0.1, MaxRects: maxRects}.Seq(l)); !slices.Equal(seq, tris) {
+			t.Errorf("MaxRects %v: Seq gave %d triangles, not the %d of Mesh", maxRects, len(seq), len(tris))
+		}
+	}
+}
+
+// Index drops degenerate triangles and shares the vertices of the rest.
+func TestIndex(t *testing.T) {
+	tris := cube()
+	tris = append(tris, [3]stl.Point{tris[0][0], tris[0][0], tris[0][1]})
+	vertices, faces := Index(tris)
+	if len(vertices) != 8 || len(faces) != 12 {
+		t.Errorf("Index = %d vertices, %d faces, want 8 and 12", len(vertices), len(faces))
+	}
+}
@@ -0,0 +1,522 @@
+// Package mesh turns a stencil rasterized into columns of solid into a
+// closed triangle mesh, and checks meshes for the problems slicers trip over.
+package mesh
+
+import (
+	"iter"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// Levels describes a stencil as columns of solid standing on its pixels,
+// with the distinct heights the solid starts and ends at, from 0 up, and the
+// distinct columns between them. Column[i] is 0 in the openings, or c+1
+// for pixel i spanning from Heights[Columns[c][0]] to Heights[Columns[c][1]].
+type Levels struct {
+	Width, Height int
+	Column        []uint8
+	Columns       [][2]int
+	Heights       []float64
+}
+
+// NewLevels finds the levels of a width x height image whose pixel (x, y)
+// is solid from floor to top mm, or open when top isn't above floor.
+func NewLevels(width, height int, heightAt func(x, y int) (floor, top float64)) Levels {
+	var spans [][2]float64
+	column := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			floor, top := heightAt(x, y)
+			if top <= floor {
+				continue
+			}
+			c := slices.Index(spans, [2]float64{floor, top})
+			if c < 0 {
+				c = len(spans)
+				spans = append(spans, [2]float64{floor, top})
+			}
+			column[y*width+x] = uint8(c + 1)
+		}
+	}
+
+	heights := []float64{0}
+	for _, s := range spans {
+		heights = append(heights, s[0], s[1])
+	}
+	sort.Float64s(heights)
+	heights = slices.Compact(heights)
+	var columns [][2]int
+	for _, s := range spans {
+		f, _ := slices.BinarySearch(heights, s[0])
+		t, _ := slices.BinarySearch(heights, s[1])
+		columns = append(columns, [2]int{f, t})
+	}
+	return Levels{Width: width, Height: height, Column: column, Columns: columns, Heights: heights}
+}
+
+// meshRect is a rectangle of pixels [x0, x1) x [y0, y1).
+type meshRect struct {
+	x0, y0, x1, y1 int
+}
+
+// greedyRects covers the pixels with a key above 0 with rectangles of equal
+// keys: it run-length encodes each row, then merges runs with the same extent
+// and key on consecutive rows into one rectangle (greedy meshing).
+func greedyRects(width, height int, key func(x, y int) int, emit func(r meshRect, key int)) {
+	type strip struct {
+		x0, x1, y0, key int
+	}
+	flush := func(s strip, y int) {
+		emit(meshRect{s.x0, s.y0, s.x1, y}, s.key)
+	}
+	var open, runs []strip
+	for y := 0; y < height; y++ {
+		runs = runs[:0]
+		for x := 0; x < width; {
+			k := key(x, y)
+			start := x
+			for x < width && key(x, y) == k {
+				x++
+			}
+			if k > 0 {
+				runs = append(runs, strip{start, x, y, k})
+			}
+		}
+
+		// Both rows are sorted by x: extend the rectangles a run continues
+		// and close the rest
+		next := make([]strip, 0, len(runs))
+		i := 0
+		for _, r := range runs {
+			for i < len(open) && open[i].x0 < r.x0 {
+				flush(open[i], y)
+				i++
+			}
+			if i < len(open) && open[i].x0 == r.x0 {
+				if open[i].x1 == r.x1 && open[i].key == r.key {
+					r.y0 = open[i].y0
+				} else {
+					flush(open[i], y)
+				}
+				i++
+			}
+			next = append(next, r)
+		}
+		for ; i < len(open); i++ {
+			flush(open[i], y)
+		}
+		open = next
+	}
+	for _, s := range open {
+		flush(s, height)
+	}
+}
+
+// maximalRects covers the pixels with a key above 0 with rectangles of equal
+// keys, like greedyRects, but grows each one from its top left pixel as far
+// right as the row allows and then down as far as the whole width stays
+// uncovered. Rectangles aren't cut where the rows beside them change, so
+// shapes with uneven sides, such as the plate between round pads, take fewer
+// of them.
+func maximalRects(width, height int, key func(x, y int) int, emit func(r meshRect, key int)) {
+	used := make([]bool, width*height)
+	free := func(x, y, k int) bool { return key(x, y) == k && !used[y*width+x] }
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			k := key(x, y)
+			if k <= 0 || used[y*width+x] {
+				continue
+			}
+			x1 := x + 1
+			for x1 < width && free(x1, y, k) {
+				x1++
+			}
+			y1 := y + 1
+		grow:
+			for ; y1 < height; y1++ {
+				for i := x; i < x1; i++ {
+					if !free(i, y1, k) {
+						break grow
+					}
+				}
+			}
+			for j := y; j < y1; j++ {
+				for i := x; i < x1; i++ {
+					used[j*width+i] = true
+				}
+			}
+			emit(meshRect{x, y, x1, y1}, k)
+			x = x1 - 1
+		}
+	}
+}
+
+// planeVertices holds the pixel corners used as mesh vertices in one
+// horizontal plane, so that faces and walls meeting along an edge can be
+// split at the same points and no vertex sits on another triangle's edge.
+type planeVertices struct {
+	rows map[int][]int // y -> x
+	cols map[int][]int // x -> y
+}
+
+func newPlaneVertices() *planeVertices {
+	return &planeVertices{rows: make(map[int][]int), cols: make(map[int][]int)}
+}
+
+func (p *planeVertices) add(x, y int) {
+	p.rows[y] = append(p.rows[y], x)
+	p.cols[x] = append(p.cols[x], y)
+}
+
+func (p *planeVertices) sort() {
+	for _, m := range []map[int][]int{p.rows, p.cols} {
+		for k, vs := range m {
+			sort.Ints(vs)
+			m[k] = slices.Compact(vs)
+		}
+	}
+}
+
+// between returns the vertices strictly inside the horizontal or vertical
+// segment from (x0, y0) to (x1, y1), in order from the first end.
+func (p *planeVertices) between(x0, y0, x1, y1 int) [][2]int {
+	line, a, b := p.rows[y0], x0, x1
+	if x0 == x1 {
+		line, a, b = p.cols[x0], y0, y1
+	}
+	lo, hi := min(a, b), max(a, b)
+	i, _ := slices.BinarySearch(line, lo+1)
+	var out [][2]int
+	for ; i < len(line) && line[i] < hi; i++ {
+		if x0 == x1 {
+			out = append(out, [2]int{x0, line[i]})
+		} else {
+			out = append(out, [2]int{line[i], y0})
+		}
+	}
+	if a > b {
+		slices.Reverse(out)
+	}
+	return out
+}
+
+// meshBands splits [0, n) into up to bands ranges and runs work on each, on
+// at most workers goroutines at a time.
+func meshBands(n, bands, workers int, work func(band, lo, hi int)) {
+	size := (n + bands - 1) / bands
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for k := 0; k < bands; k++ {
+		lo, hi := k*size, min(n, (k+1)*size)
+		if lo >= hi {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			work(k, lo, hi)
+			<-sem
+		}()
+	}
+	wg.Wait()
+}
+
+// Mesher meshes the surface of a stencil as stepped pixel columns:
+// rectangles of equal height for the top and bottom faces, and one wall
+// along each straight run of pixel edges between heights. Edges are
+// split wherever another face has a corner on them, so the mesh is a closed
+// shell without the internal faces that separate boxes would leave.
+type Mesher struct {
+	PixelSize float64 // mm
+	MaxRects  bool    // Cover the faces with maximal rectangles instead of row strips
+
+	Progress progress.Func // Told how far meshing has got; nil for no reports
+}
+
+// meshFace is a rectangle of a top or bottom face in one plane.
+type meshFace struct {
+	r     meshRect
+	plane int
+	down  bool // Bottom faces face down
+}
+
+// meshWall runs along pixel edges from a to b with the solid between planes
+// level-1 and level on its left.
+type meshWall struct {
+	ax, ay, bx, by, level int
+}
+
+// meshPlan is what the triangles of a mesh are made from: its faces and
+// walls, and the vertices of each plane that split their edges. It is a
+// fraction of the size of the triangles.
+type meshPlan struct {
+	faces     []meshFace
+	walls     []meshWall
+	planes    []*planeVertices
+	z         []float64
+	pixelToMM float64
+	bands     int // Bands of faces and walls to triangulate concurrently
+	workers   int
+}
+
+// Mesh returns the triangles of the surface of l, in mm with the origin at
+// the top left corner of the image.
+func (m Mesher) Mesh(l Levels) [][3]stl.Point {
+	p := m.plan(l)
+	bandTris := make([][][3]stl.Point, 2*p.bands)
+	meshBands(len(p.faces), p.bands, p.workers, func(k, lo, hi int) {
+		for _, f := range p.faces[lo:hi] {
+			bandTris[k] = p.faceTriangles(bandTris[k], f)
+		}
+	})
+	meshBands(len(p.walls), p.bands, p.workers, func(k, lo, hi int) {
+		for _, w := range p.walls[lo:hi] {
+			bandTris[p.bands+k] = p.wallTriangles(bandTris[p.bands+k], w)
+		}
+	})
+	triangles := slices.Concat(bandTris...)
+	m.Progress.Report("Meshing", 3, 3)
+	return triangles
+}
+
+// Seq returns the triangles of Mesh as a sequence, each made as it is
+// yielded, so they can be written without holding them all. Every pass over
+// it yields them again in the same order as Mesh.
+func (m Mesher) Seq(l Levels) iter.Seq[[3]stl.Point] {
+	p := m.plan(l)
+	m.Progress.Report("Meshing", 3, 3)
+	return func(yield func([3]stl.Point) bool) {
+		var buf [][3]stl.Point
+		each := func(tris [][3]stl.Point) bool {
+			for _, t := range tris {
+				if !yield(t) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, f := range p.faces {
+			if buf = p.faceTriangles(buf[:0], f); !each(buf) {
+				return
+			}
+		}
+		for _, w := range p.walls {
+			if buf = p.wallTriangles(buf[:0], w); !each(buf) {
+				return
+			}
+		}
+	}
+}
+
+// plan finds the faces and walls of the surface of l.
+func (m Mesher) plan(l Levels) *meshPlan {
+	width, height := l.Width, l.Height
+	column, columns, z := l.Column, l.Columns, l.Heights
+
+	// One plane per height, with the solid of each column between two
+	planes := make([]*planeVertices, len(z))
+	for i := range planes {
+		planes[i] = newPlaneVertices()
+	}
+	span := func(x, y int) (floor, top int) {
+		if x < 0 || y < 0 || x >= width || y >= height || column[y*width+x] == 0 {
+			return 0, 0
+		}
+		c := columns[column[y*width+x]-1]
+		return c[0], c[1]
+	}
+	// The plane of the top of the solid, and one more than its bottom's, or
+	// 0 for none
+	at := func(x, y int) int {
+		_, top := span(x, y)
+		return top
+	}
+	under := func(x, y int) int {
+		floor, top := span(x, y)
+		if top == 0 {
+			return 0
+		}
+		return floor + 1
+	}
+	// in reports solid at the pixel between planes k-1 and k
+	in := func(x, y, k int) bool {
+		floor, top := span(x, y)
+		return floor < k && top >= k
+	}
+
+	// Bands of rows, and of columns for vertical edges, are meshed
+	// concurrently and joined in order
+	workers := runtime.GOMAXPROCS(0)
+	bands := workers * 4
+	if workers < 2 || height < 2*bands {
+		bands = 1
+	}
+
+	rects, rectBands := greedyRects, bands
+	if m.MaxRects {
+		// Cutting maximal rectangles at band edges loses most of their gain
+		rects, rectBands = maximalRects, 1
+	}
+	bandFaces := make([][]meshFace, rectBands)
+	meshBands(height, rectBands, workers, func(k, y0, y1 int) {
+		band := func(key func(x, y int) int) func(x, y int) int {
+			return func(x, y int) int { return key(x, y0+y) }
+		}
+		add := func(r meshRect, plane int, down bool) {
+			r.y0 += y0
+			r.y1 += y0
+			bandFaces[k] = append(bandFaces[k], meshFace{r, plane, down})
+		}
+		rects(width, y1-y0, band(at), func(r meshRect, k int) { add(r, k, false) })
+		rects(width, y1-y0, band(under), func(r meshRect, k int) { add(r, k-1, true) })
+	})
+	// Rejoin rectangles cut at band edges, which gives the same faces as
+	// one band for greedyRects
+	var faces []meshFace
+	open := make(map[meshFace]int)
+	for _, band := range bandFaces {
+		next := make(map[meshFace]int)
+		for _, f := range band {
+			edge := meshFace{meshRect{f.r.x0, f.r.y0, f.r.x1, f.r.y0}, f.plane, f.down}
+			if i, ok := open[edge]; ok {
+				faces[i].r.y1 = f.r.y1
+				next[meshFace{meshRect{f.r.x0, f.r.y1, f.r.x1, f.r.y1}, f.plane, f.down}] = i
+				continue
+			}
+			next[meshFace{meshRect{f.r.x0, f.r.y1, f.r.x1, f.r.y1}, f.plane, f.down}] = len(faces)
+			faces = append(faces, f)
+		}
+		open = next
+	}
+	for _, f := range faces {
+		r, p := f.r, planes[f.plane]
+		p.add(r.x0, r.y0)
+		p.add(r.x1, r.y0)
+		p.add(r.x1, r.y1)
+		p.add(r.x0, r.y1)
+	}
+	m.Progress.Report("Meshing", 1, 3)
+
+	// Walls run along pixel edges with the solid between planes k-1 and k on
+	// their left
+	var walls []meshWall
+	for k := 1; k < len(z); k++ {
+		// dir is 1 when the solid is after the line, -1 before it, 0 for
+		// no edge
+		edgeRuns := func(lines, length int, dir func(line, i int) int, add func(line, i0, i1, d int) meshWall) []meshWall {
+			bandWalls := make([][]meshWall, bands)
+			meshBands(lines+1, bands, workers, func(b, lo, hi int) {
+				for line := lo; line < hi; line++ {
+					for i := 0; i < length; {
+						d := dir(line, i)
+						start := i
+						for i < length && dir(line, i) == d {
+							i++
+						}
+						if d != 0 {
+							bandWalls[b] = append(bandWalls[b], add(line, start, i, d))
+						}
+					}
+				}
+			})
+			return slices.Concat(bandWalls...)
+		}
+		side := func(a, b bool) int {
+			switch {
+			case !a && b:
+				return 1
+			case a && !b:
+				return -1
+			}
+			return 0
+		}
+		// Horizontal edges: solid above runs +x, solid below runs -x
+		walls = append(walls, edgeRuns(height, width, func(y, x int) int { return side(in(x, y-1, k), in(x, y, k)) }, func(y, x0, x1, d int) meshWall {
+			if d > 0 {
+				return meshWall{x0, y, x1, y, k}
+			}
+			return meshWall{x1, y, x0, y, k}
+		})...)
+		// Vertical edges: solid to the right runs -y, to the left +y
+		walls = append(walls, edgeRuns(width, height, func(x, y int) int { return side(in(x-1, y, k), in(x, y, k)) }, func(x, y0, y1, d int) meshWall {
+			if d > 0 {
+				return meshWall{x, y1, x, y0, k}
+			}
+			return meshWall{x, y0, x, y1, k}
+		})...)
+	}
+	for _, w := range walls {
+		for _, p := range []*planeVertices{planes[w.level-1], planes[w.level]} {
+			p.add(w.ax, w.ay)
+			p.add(w.bx, w.by)
+		}
+	}
+	m.Progress.Report("Meshing", 2, 3)
+	meshBands(len(planes), len(planes), workers, func(i, _, _ int) { planes[i].sort() })
+
+	return &meshPlan{faces: faces, walls: walls, planes: planes, z: z, pixelToMM: m.PixelSize, bands: bands, workers: workers}
+}
+
+// pt is vertex v of plane in mm.
+func (p *meshPlan) pt(v [2]int, plane int) stl.Point {
+	return stl.Point{X: float64(v[0]) * p.pixelToMM, Y: float64(v[1]) * p.pixelToMM, Z: p.z[plane]}
+}
+
+// faceTriangles appends the triangles of f to triangles.
+func (p *meshPlan) faceTriangles(triangles [][3]stl.Point, f meshFace) [][3]stl.Point {
+	// Perimeter counter-clockwise, with every vertex on it
+	r, pv := f.r, p.planes[f.plane]
+	corners := [][2]int{{r.x0, r.y0}, {r.x1, r.y0}, {r.x1, r.y1}, {r.x0, r.y1}}
+	var ring [][2]int
+	for i, c := range corners {
+		d := corners[(i+1)%4]
+		ring = append(ring, c)
+		ring = append(ring, pv.between(c[0], c[1], d[0], d[1])...)
+	}
+	tri := func(a, b, c stl.Point) {
+		if f.down {
+			b, c = c, b // Bottom faces face down
+		}
+		triangles = append(triangles, [3]stl.Point{a, b, c})
+	}
+	if len(ring) == 4 {
+		tri(p.pt(ring[0], f.plane), p.pt(ring[1], f.plane), p.pt(ring[2], f.plane))
+		tri(p.pt(ring[2], f.plane), p.pt(ring[3], f.plane), p.pt(ring[0], f.plane))
+		return triangles
+	}
+	center := stl.Point{X: float64(r.x0+r.x1) * p.pixelToMM / 2, Y: float64(r.y0+r.y1) * p.pixelToMM / 2, Z: p.z[f.plane]}
+	for i, v := range ring {
+		tri(center, p.pt(v, f.plane), p.pt(ring[(i+1)%len(ring)], f.plane))
+	}
+	return triangles
+}
+
+// wallTriangles appends the triangles of w to triangles.
+func (p *meshPlan) wallTriangles(triangles [][3]stl.Point, w meshWall) [][3]stl.Point {
+	// A strip between the bottom and top edges, each split at its own
+	// plane's vertices, facing right of a->b
+	a, b := [2]int{w.ax, w.ay}, [2]int{w.bx, w.by}
+	chain := func(plane int) [][2]int {
+		c := append([][2]int{a}, p.planes[plane].between(w.ax, w.ay, w.bx, w.by)...)
+		return append(c, b)
+	}
+	lo, hi := chain(w.level-1), chain(w.level)
+	dist := func(v [2]int) int { return max(v[0]-a[0], a[0]-v[0]) + max(v[1]-a[1], a[1]-v[1]) }
+	i, j := 0, 0
+	for i < len(lo)-1 || j < len(hi)-1 {
+		if j == len(hi)-1 || (i < len(lo)-1 && dist(lo[i+1]) <= dist(hi[j+1])) {
+			triangles = append(triangles, [3]stl.Point{p.pt(lo[i], w.level-1), p.pt(lo[i+1], w.level-1), p.pt(hi[j], w.level)})
+			i++
+		} else {
+			triangles = append(triangles, [3]stl.Point{p.pt(lo[i], w.level-1), p.pt(hi[j+1], w.level), p.pt(hi[j], w.level)})
+			j++
+		}
+	}
+	return triangles
+}
@@ -0,0 +1,40 @@
+// Package progress carries reports of how far the long running stages of
+// the other packages have got to whoever wants to show them.
+package progress
+
+import "io"
+
+// Func is told how far a long running stage has got: done out of total
+// units (bytes parsed, rows rendered or meshed, triangles written). Every
+// stage ends with done == total. It may be called from several goroutines
+// at once.
+type Func func(stage string, done, total int)
+
+// Report passes a report to f, if it's set.
+func (f Func) Report(stage string, done, total int) {
+	if f != nil {
+		f(stage, done, total)
+	}
+}
+
+// Reader reports how much of a file of known size has been read.
+type Reader struct {
+	r           io.Reader
+	report      Func
+	stage       string
+	done, total int
+}
+
+// NewReader reports reads from r, total bytes long, to report as stage.
+func NewReader(r io.Reader, report Func, stage string, total int) *Reader {
+	return &Reader{r: r, report: report, stage: stage, total: total}
+}
+
+func (pr *Reader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.done += n
+	if pr.total > 0 {
+		pr.report.Report(pr.stage, min(pr.done, pr.total), pr.total)
+	}
+	return n, err
+}
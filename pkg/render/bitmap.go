@@ -0,0 +1,151 @@
+// Package render rasterizes parsed gerber files, and the polygons of the
+// other inputs, into one bit per pixel bitmaps of the stencil's openings.
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// Bitmap is a 1 bit per pixel image: a set bit is an opening (white), a clear
+// bit is stencil material (black). It is 32 times smaller than an RGBA buffer
+// of the same size and implements draw.Image so it can be encoded as a PNG.
+type Bitmap struct {
+	Width, Height int
+	Stride        int // Words per row
+	Bits          []uint64
+}
+
+// MaxPixels is the most pixels CheckSize lets an image have: 128 MiB of
+// bits, and a GiB or so for the meshers working on it.
+const MaxPixels = 1 << 30
+
+// CheckSize returns an error if an image width by height pixels, as
+// rendering some extent at some DPI would make, is too large to allocate.
+func CheckSize(width, height float64) error {
+	if w, h := max(width, 0), max(height, 0); !(w*h <= MaxPixels) {
+		return fmt.Errorf("the image would be %.0f x %.0f pixels, more than %d: check the coordinates and the DPI", width, height, int64(MaxPixels))
+	}
+	return nil
+}
+
+// NewBitmap returns an all-material bitmap.
+func NewBitmap(width, height int) *Bitmap {
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+	stride := (width + 63) / 64
+	return &Bitmap{Width: width, Height: height, Stride: stride, Bits: make([]uint64, stride*height)}
+}
+
+func (b *Bitmap) ColorModel() color.Model {
+	return color.GrayModel
+}
+
+func (b *Bitmap) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.Width, b.Height)
+}
+
+func (b *Bitmap) At(x, y int) color.Color {
+	if b.Get(x, y) {
+		return color.Gray{Y: 255}
+	}
+	return color.Gray{Y: 0}
+}
+
+// Set opens the pixel for light colors and closes it for dark ones.
+func (b *Bitmap) Set(x, y int, c color.Color) {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return
+	}
+	i := y*b.Stride + x/64
+	if color.GrayModel.Convert(c).(color.Gray).Y >= 128 {
+		b.Bits[i] |= 1 << uint(x%64)
+	} else {
+		b.Bits[i] &^= 1 << uint(x%64)
+	}
+}
+
+// Get reports whether the pixel is open. Pixels outside the bitmap are not.
+func (b *Bitmap) Get(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return false
+	}
+	return b.Bits[y*b.Stride+x/64]&(1<<uint(x%64)) != 0
+}
+
+// SetBit opens a single pixel.
+func (b *Bitmap) SetBit(x, y int) {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return
+	}
+	b.Bits[y*b.Stride+x/64] |= 1 << uint(x%64)
+}
+
+// FillSpan opens pixels x0 (inclusive) to x1 (exclusive) of row y.
+func (b *Bitmap) FillSpan(y, x0, x1 int) {
+	if y < 0 || y >= b.Height {
+		return
+	}
+	if x0 < 0 {
+		x0 = 0
+	}
+	if x1 > b.Width {
+		x1 = b.Width
+	}
+	if x0 >= x1 {
+		return
+	}
+	row := b.Bits[y*b.Stride : (y+1)*b.Stride]
+	w0, w1 := x0/64, (x1-1)/64
+	first := ^uint64(0) << uint(x0%64)
+	last := ^uint64(0) >> uint(63-(x1-1)%64)
+	if w0 == w1 {
+		row[w0] |= first & last
+		return
+	}
+	row[w0] |= first
+	for w := w0 + 1; w < w1; w++ {
+		row[w] = ^uint64(0)
+	}
+	row[w1] |= last
+}
+
+// FillRect opens every pixel of r.
+func (b *Bitmap) FillRect(r image.Rectangle) {
+	r = r.Intersect(b.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		b.FillSpan(y, r.Min.X, r.Max.X)
+	}
+}
+
+// CountSpan returns the number of open pixels from x0 to x1 of row y.
+func (b *Bitmap) CountSpan(y, x0, x1 int) int {
+	n := 0
+	for x := x0; x < x1; {
+		if x%64 == 0 && x+64 <= x1 {
+			n += bits.OnesCount64(b.Bits[y*b.Stride+x/64])
+			x += 64
+			continue
+		}
+		if b.Get(x, y) {
+			n++
+		}
+		x++
+	}
+	return n
+}
+
+// IsOpen reports whether a pixel of any image is an opening (not black).
+func IsOpen(img image.Image, x, y int) bool {
+	if bm, ok := img.(*Bitmap); ok {
+		return bm.Get(x, y)
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	return !(r < 10000 && g < 10000 && b < 10000)
+}
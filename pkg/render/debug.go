@@ -0,0 +1,176 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/bits"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/progress"
+)
+
+// regionKey is the debug legend key of G36/G37 region fills, which don't
+// belong to an aperture.
+const regionKey = -1
+
+type debugEntry struct {
+	key   int // D-code or regionKey
+	color color.RGBA
+	count int
+}
+
+// debugRenderer renders a gerber into a color image where every aperture gets
+// its own color, so stray pads can be traced back to their D-code.
+type debugRenderer struct {
+	*Renderer
+	out     *image.RGBA
+	entries map[int]*debugEntry
+}
+
+func newDebugRenderer(gf *gerber.File, dpi float64, b gerber.Bounds) *debugRenderer {
+	r := NewRenderer(gf, dpi, b)
+	return &debugRenderer{
+		Renderer: r,
+		out:      image.NewRGBA(r.img.Bounds()),
+		entries:  make(map[int]*debugEntry),
+	}
+}
+
+// handle draws each operation into the (otherwise empty) bitmap, then moves
+// its pixels into the color image in its aperture's color.
+func (d *debugRenderer) handle(cmd gerber.Command) {
+	op, ok := d.advance(cmd)
+	if !ok {
+		return
+	}
+	key := regionKey
+	if op.contour == nil {
+		key = op.state.curDCode
+	}
+	e, ok := d.entries[key]
+	if !ok {
+		e = &debugEntry{key: key, color: debugColor(len(d.entries))}
+		d.entries[key] = e
+	}
+	e.count++
+
+	d.draw(op)
+	img := d.img
+	y0, y1 := d.opRows(op)
+	for y := max(0, y0); y <= min(img.Height-1, y1); y++ {
+		row := img.Bits[y*img.Stride : (y+1)*img.Stride]
+		for w, word := range row {
+			for word != 0 {
+				d.out.SetRGBA(w*64+bits.TrailingZeros64(word), y, e.color)
+				word &= word - 1
+			}
+			row[w] = 0
+		}
+	}
+}
+
+// debugColor returns the i-th legend color, stepping the hue by the golden
+// angle so neighbouring entries are easy to tell apart.
+func debugColor(i int) color.RGBA {
+	h := math.Mod(float64(i)*137.508, 360) / 60
+	c := 0.75
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := 0.25
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
+
+// compose returns the colored render with a legend to its right listing every
+// aperture used: D-code, shape, X2 function and number of operations.
+func (d *debugRenderer) compose() *image.RGBA {
+	var list []*debugEntry
+	for _, e := range d.entries {
+		list = append(list, e)
+	}
+	// Apertures by D-code, regions last
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].key == regionKey) != (list[j].key == regionKey) {
+			return list[j].key == regionKey
+		}
+		return list[i].key < list[j].key
+	})
+
+	labels := make([]string, len(list))
+	for i, e := range list {
+		if e.key == regionKey {
+			labels[i] = fmt.Sprintf("Regions (%d)", e.count)
+			continue
+		}
+		desc := "undefined"
+		if ap, ok := d.gf.State.Apertures[e.key]; ok {
+			desc = ap.Describe()
+			if ap.Function != "" {
+				desc += " " + ap.Function
+			}
+		}
+		labels[i] = fmt.Sprintf("D%d %s (%d)", e.key, desc, e.count)
+	}
+
+	bounds := d.out.Bounds()
+	scale := max(1, bounds.Dy()/400)
+	line := GlyphLine * scale
+	pad := line
+	swatch := 7 * scale
+	legendW := 0
+	for _, l := range labels {
+		legendW = max(legendW, TextWidth(l, scale))
+	}
+	legendW += 3*pad + swatch
+
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx()+legendW, max(bounds.Dy(), 2*pad+len(list)*line)))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.RGBA{40, 40, 40, 255}), image.Point{}, draw.Src)
+	draw.Draw(canvas, bounds, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(canvas, bounds, d.out, image.Point{}, draw.Over) // Unpainted pixels stay black
+
+	x := bounds.Dx() + pad
+	for i, e := range list {
+		y := pad + i*line
+		draw.Draw(canvas, image.Rect(x, y, x+swatch, y+swatch), image.NewUniform(e.color), image.Point{}, draw.Src)
+		DrawText(canvas, x+swatch+pad, y, labels[i], scale, color.White)
+	}
+	return canvas
+}
+
+// Debug renders a parsed gerber with one color per aperture.
+func Debug(gf *gerber.File, dpi float64, b gerber.Bounds) *image.RGBA {
+	d := newDebugRenderer(gf, dpi, b)
+	for _, cmd := range gf.Commands {
+		d.handle(cmd)
+	}
+	return d.compose()
+}
+
+// StreamDebug is Debug for a file that is parsed while rendering, reporting
+// reading it to report.
+func StreamDebug(filename string, dpi float64, b gerber.Bounds, report progress.Func) (*image.RGBA, error) {
+	gf := gerber.New()
+	gf.Progress = report
+	d := newDebugRenderer(gf, dpi, b)
+	if err := gf.Scan(filename, d.handle); err != nil {
+		return nil, err
+	}
+	return d.compose(), nil
+}
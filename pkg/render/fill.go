@@ -0,0 +1,145 @@
+package render
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Downsample reduces a bitmap rendered at n times the resolution to width x
+// height. An output pixel is open when more than half of its n x n block is.
+func Downsample(src *Bitmap, n, width, height int) *Bitmap {
+	dst := NewBitmap(width, height)
+	half := n * n / 2
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := 0
+			for sy := y * n; sy < y*n+n; sy++ {
+				sum += src.CountSpan(sy, x*n, x*n+n)
+			}
+			if sum > half {
+				dst.SetBit(x, y)
+			}
+		}
+	}
+	return dst
+}
+
+// ResolveSupersampled brings an image rendered at n times dpi back to the
+// frame that rendering b at dpi would produce.
+func ResolveSupersampled(img image.Image, n int, dpi float64, b gerber.Bounds) image.Image {
+	if n <= 1 {
+		return img
+	}
+	scale := dpi / 25.4
+	width := int((b.MaxX - b.MinX) * scale)
+	height := int((b.MaxY - b.MinY) * scale)
+	return Downsample(img.(*Bitmap), n, width, height)
+}
+
+// capsuleQuad returns the body of a capsule between two points in pixels:
+// the rectangle of half width hw around the segment. The caps are drawn
+// separately.
+func capsuleQuad(ax, ay, bx, by, hw float64) []gerber.Vec2 {
+	l := math.Hypot(bx-ax, by-ay)
+	nx, ny := -(by-ay)/l*hw, (bx-ax)/l*hw
+	return []gerber.Vec2{{X: ax + nx, Y: ay + ny}, {X: bx + nx, Y: by + ny}, {X: bx - nx, Y: by - ny}, {X: ax - nx, Y: ay - ny}}
+}
+
+// pixelEdge returns the first pixel whose center is at or past v.
+func pixelEdge(v float64) int {
+	return int(math.Ceil(v - 0.5))
+}
+
+// FillBox opens the pixels whose centers are inside an axis-aligned box
+// given in pixels, so boxes of the same size have the same pixel size
+// wherever they are centered, give or take the one pixel the edges can round.
+func FillBox(img *Bitmap, x0, y0, x1, y1 float64) {
+	img.FillRect(image.Rect(pixelEdge(x0), pixelEdge(y0), pixelEdge(x1), pixelEdge(y1)))
+}
+
+// FillRotatedRect fills a w x h rectangle centered on (cx, cy), rotated
+// counter-clockwise by angle degrees in board space. Coordinates are in
+// pixels; since image Y points down the rotation is applied clockwise.
+func FillRotatedRect(img *Bitmap, cx, cy, w, h, angle float64) {
+	sin, cos := math.Sincos(-angle * math.Pi / 180)
+	corners := make([]gerber.Vec2, 0, 4)
+	for _, c := range [][2]float64{{-w / 2, -h / 2}, {w / 2, -h / 2}, {w / 2, h / 2}, {-w / 2, h / 2}} {
+		corners = append(corners, gerber.Vec2{X: cx + c[0]*cos - c[1]*sin, Y: cy + c[0]*sin + c[1]*cos})
+	}
+	FillPolygons(img, [][]gerber.Vec2{corners}, false)
+}
+
+// FillPolygons is the shared scanline filler: it opens the pixels whose
+// centers are inside a set of closed polygons, using the even-odd or nonzero
+// winding rule, and writes each covered run of a row as one span. Gerber
+// regions, polygon and outline apertures, rotated rects, strokes and the SVG
+// and DXF inputs all go through it. Coordinates are in pixels.
+func FillPolygons(img *Bitmap, polys [][]gerber.Vec2, evenOdd bool) {
+	type edge struct {
+		x0, y0, x1, y1 float64
+		dir            int
+	}
+	var edges []edge
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, poly := range polys {
+		for i := range poly {
+			a, b := poly[i], poly[(i+1)%len(poly)]
+			if a.Y == b.Y {
+				continue
+			}
+			dir := 1
+			if a.Y > b.Y {
+				a, b = b, a
+				dir = -1
+			}
+			edges = append(edges, edge{a.X, a.Y, b.X, b.Y, dir})
+			minY, maxY = math.Min(minY, a.Y), math.Max(maxY, b.Y)
+		}
+	}
+
+	bounds := img.Bounds()
+	y0 := int(math.Max(math.Floor(minY), float64(bounds.Min.Y)))
+	y1 := int(math.Min(math.Ceil(maxY), float64(bounds.Max.Y)))
+
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	var xs []crossing
+	for py := y0; py < y1; py++ {
+		sy := float64(py) + 0.5
+		xs = xs[:0]
+		for _, e := range edges {
+			if sy >= e.y0 && sy < e.y1 {
+				t := (sy - e.y0) / (e.y1 - e.y0)
+				xs = append(xs, crossing{e.x0 + t*(e.x1-e.x0), e.dir})
+			}
+		}
+		sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+		winding := 0
+		for i := 0; i+1 < len(xs); i++ {
+			winding += xs[i].dir
+			inside := winding != 0
+			if evenOdd {
+				inside = (i+1)%2 == 1
+			}
+			if !inside {
+				continue
+			}
+			// Fill pixels whose centers are inside the span
+			img.FillSpan(py, pixelEdge(xs[i].x), pixelEdge(xs[i+1].x))
+		}
+	}
+}
+
+// fillShape fills a polygon given in mm relative to a flash at pixel (x, y).
+func fillShape(img *Bitmap, x, y, scale float64, pts []gerber.Vec2) {
+	px := make([]gerber.Vec2, len(pts))
+	for i, p := range pts {
+		px[i] = gerber.Vec2{X: x + p.X*scale, Y: y - p.Y*scale} // Flip Y for image coords
+	}
+	FillPolygons(img, [][]gerber.Vec2{px}, true)
+}
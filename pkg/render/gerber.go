@@ -0,0 +1,643 @@
+package render
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/progress"
+)
+
+// Gerber renders the commands of a parsed file over bounds, or the file's
+// own bounds when nil, opening the pixels its flashes, draws and regions
+// cover. It reports how far it got to gf.Progress.
+func Gerber(gf *gerber.File, dpi float64, bounds *gerber.Bounds) image.Image {
+	var b gerber.Bounds
+	if bounds != nil {
+		b = *bounds
+	} else {
+		b = gf.CalculateBounds()
+	}
+
+	r := NewRenderer(gf, dpi, b)
+	workers := runtime.GOMAXPROCS(0)
+	if workers < 2 || r.img.Height < 2*workers {
+		for i, cmd := range gf.Commands {
+			r.Handle(cmd)
+			if i%4096 == 0 {
+				gf.Progress.Report("Rendering", i, len(gf.Commands))
+			}
+		}
+		gf.Progress.Report("Rendering", len(gf.Commands), len(gf.Commands))
+		return r.img
+	}
+
+	// Resolve every flash, draw and region with the state it is rendered
+	// with, and the rows it can touch
+	var ops []renderOp
+	var rows [][2]int
+	for _, cmd := range gf.Commands {
+		if op, ok := r.advance(cmd); ok {
+			y0, y1 := r.opRows(op)
+			ops = append(ops, op)
+			rows = append(rows, [2]int{y0, y1})
+		}
+	}
+
+	// Render horizontal bands concurrently. Bands share no rows, and so no
+	// words of the bitmap.
+	bands := workers * 4
+	bandHeight := (r.img.Height + bands - 1) / bands
+	perBand := make([][]int, bands)
+	for i, rr := range rows {
+		first := max(0, rr[0]/bandHeight)
+		last := min(bands-1, rr[1]/bandHeight)
+		for k := first; k <= last; k++ {
+			perBand[k] = append(perBand[k], i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var rowsDone atomic.Int64
+	sem := make(chan struct{}, workers)
+	for k, list := range perBand {
+		y0 := k * bandHeight
+		y1 := min(r.img.Height, y0+bandHeight)
+		if y0 >= y1 {
+			continue
+		}
+		if len(list) == 0 {
+			rowsDone.Add(int64(y1 - y0))
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(br *Renderer, list []int) {
+			defer wg.Done()
+			for _, i := range list {
+				br.draw(ops[i])
+			}
+			gf.Progress.Report("Rendering", int(rowsDone.Add(int64(br.img.Height))), r.img.Height)
+			<-sem
+		}(r.band(y0, y1), list)
+	}
+	wg.Wait()
+	gf.Progress.Report("Rendering", r.img.Height, r.img.Height)
+	return r.img
+}
+
+// rendererState is the part of the graphics state a flash or draw depends on.
+type rendererState struct {
+	curX, curY        float64
+	curDCode          int
+	interpolationMode string
+	rotation          float64 // From %LR, applied to rect flashes
+}
+
+// renderOp is a flash or draw with the state before it, or a closed region
+// contour in mm.
+type renderOp struct {
+	cmd     gerber.Command
+	state   rendererState
+	contour []gerber.Vec2
+}
+
+// Renderer draws commands into an image one at a time, so the same code
+// serves parsed files and streamed ones.
+type Renderer struct {
+	gf       *gerber.File
+	img      *Bitmap
+	b        gerber.Bounds
+	scale    float64
+	heightMM float64
+	originY  int // First image row of img, for band renderers
+
+	rendererState
+	inRegion bool
+	contour  []gerber.Vec2 // Region contour being collected
+
+	stamps map[stampKey]*stamp // Rasterized apertures, per renderer so bands don't share it
+}
+
+// NewRenderer returns a renderer drawing the commands of gf over b at dpi
+// into an image that starts all stencil material.
+func NewRenderer(gf *gerber.File, dpi float64, b gerber.Bounds) *Renderer {
+	widthMM := b.MaxX - b.MinX
+	heightMM := b.MaxY - b.MinY
+
+	// All geometry is in mm after parsing
+	scale := dpi / 25.4
+
+	imgWidth := int(widthMM * scale)
+	imgHeight := int(heightMM * scale)
+
+	// Starts all black (stencil material)
+	img := NewBitmap(imgWidth, imgHeight)
+
+	return &Renderer{
+		gf:            gf,
+		img:           img,
+		b:             b,
+		scale:         scale,
+		heightMM:      heightMM,
+		rendererState: rendererState{interpolationMode: "G01"}, // Default linear
+	}
+}
+
+// Image returns the image rendered so far.
+func (r *Renderer) Image() *Bitmap {
+	return r.img
+}
+
+// band returns a renderer drawing only into rows y0 to y1 of r's image.
+func (r *Renderer) band(y0, y1 int) *Renderer {
+	br := *r
+	br.img = &Bitmap{
+		Width:  r.img.Width,
+		Height: y1 - y0,
+		Stride: r.img.Stride,
+		Bits:   r.img.Bits[y0*r.img.Stride : y1*r.img.Stride],
+	}
+	br.originY = y0
+	br.stamps = nil
+	return &br
+}
+
+// toPix converts mm to pixel coordinates. The subpixel fraction is kept so
+// shapes are centered where the gerber puts them: pixel (i, j) covers
+// [i, i+1) x [j, j+1) and is opened when its center is inside a shape.
+func (r *Renderer) toPix(x, y float64) (float64, float64) {
+	px := (x - r.b.MinX) * r.scale
+	py := (r.heightMM - (y - r.b.MinY)) * r.scale // Flip Y for image coords
+	return px, py - float64(r.originY)
+}
+
+// Handle renders a command, for commands fed one at a time as a file is
+// scanned.
+func (r *Renderer) Handle(cmd gerber.Command) {
+	if op, ok := r.advance(cmd); ok {
+		r.draw(op)
+	}
+}
+
+// advance applies a command to the state and returns what it renders, if
+// anything: a flash, a draw, or a region contour it closes.
+func (r *Renderer) advance(cmd gerber.Command) (renderOp, bool) {
+	switch cmd.Type {
+	case "APERTURE":
+		r.curDCode = *cmd.D
+		return renderOp{}, false
+	case "G01", "G02", "G03":
+		r.interpolationMode = cmd.Type
+		return renderOp{}, false
+	case "LR":
+		r.rotation = *cmd.R
+		return renderOp{}, false
+	case "G36":
+		r.inRegion = true
+		r.contour = nil
+		return renderOp{}, false
+	case "G37":
+		r.inRegion = false
+		return r.closeContour(cmd)
+	}
+
+	op := renderOp{cmd: cmd, state: r.rendererState}
+	if cmd.X != nil {
+		r.curX = *cmd.X
+	}
+	if cmd.Y != nil {
+		r.curY = *cmd.Y
+	}
+
+	if r.inRegion {
+		switch cmd.Type {
+		case "MOVE":
+			// D02 ends the contour; the next one starts here
+			return r.closeContour(cmd)
+		case "DRAW":
+			if len(r.contour) == 0 {
+				r.contour = append(r.contour, gerber.Vec2{X: op.state.curX, Y: op.state.curY})
+			}
+			if r.interpolationMode == "G01" {
+				r.contour = append(r.contour, gerber.Vec2{X: r.curX, Y: r.curY})
+			} else {
+				var i, j float64
+				if cmd.I != nil {
+					i = *cmd.I
+				}
+				if cmd.J != nil {
+					j = *cmd.J
+				}
+				arc := gerber.ArcPath(op.state.curX, op.state.curY, r.curX, r.curY, i, j, r.interpolationMode)
+				r.contour = append(r.contour, arc[1:]...)
+			}
+		}
+		return renderOp{}, false
+	}
+	return op, cmd.Type == "FLASH" || cmd.Type == "DRAW"
+}
+
+func (r *Renderer) closeContour(cmd gerber.Command) (renderOp, bool) {
+	contour := r.contour
+	r.contour = nil
+	if len(contour) < 3 {
+		return renderOp{}, false
+	}
+	return renderOp{cmd: cmd, contour: contour}, true
+}
+
+// opRows returns the range of image rows an operation can touch.
+func (r *Renderer) opRows(op renderOp) (int, int) {
+	if op.contour != nil {
+		b := gerber.PolyBounds(op.contour)
+		_, top := r.toPix(b.MinX, b.MaxY)
+		_, bottom := r.toPix(b.MinX, b.MinY)
+		return int(math.Floor(top)) - 2, int(math.Ceil(bottom)) + 2
+	}
+
+	cmd, st := op.cmd, op.state
+	curX, curY := st.curX, st.curY
+	if cmd.X != nil {
+		curX = *cmd.X
+	}
+	if cmd.Y != nil {
+		curY = *cmd.Y
+	}
+	minY, maxY := curY, curY
+	if cmd.Type == "DRAW" {
+		minY, maxY = math.Min(minY, st.curY), math.Max(maxY, st.curY)
+		if st.interpolationMode != "G01" {
+			// The whole circle bounds any arc on it
+			var i, j float64
+			if cmd.I != nil {
+				i = *cmd.I
+			}
+			if cmd.J != nil {
+				j = *cmd.J
+			}
+			radius := math.Hypot(i, j)
+			minY, maxY = math.Min(minY, st.curY+j-radius), math.Max(maxY, st.curY+j+radius)
+		}
+	}
+	extent := r.gf.ApertureExtent(r.gf.State.Apertures[st.curDCode])
+	_, top := r.toPix(curX, maxY+extent)
+	_, bottom := r.toPix(curX, minY-extent)
+	return int(math.Floor(top)) - 2, int(math.Ceil(bottom)) + 2
+}
+
+// draw renders an operation returned by advance.
+func (r *Renderer) draw(op renderOp) {
+	gf, img, scale := r.gf, r.img, r.scale
+
+	if op.contour != nil {
+		// Regions are filled even-odd, so cut-ins make holes
+		pts := make([]gerber.Vec2, len(op.contour))
+		for i, p := range op.contour {
+			x, y := r.toPix(p.X, p.Y)
+			pts[i] = gerber.Vec2{X: x, Y: y}
+		}
+		FillPolygons(img, [][]gerber.Vec2{pts}, true)
+		return
+	}
+
+	cmd, st := op.cmd, op.state
+	prevX, prevY := st.curX, st.curY
+	curX, curY := prevX, prevY
+	if cmd.X != nil {
+		curX = *cmd.X
+	}
+	if cmd.Y != nil {
+		curY = *cmd.Y
+	}
+
+	if cmd.Type == "FLASH" {
+		// Draw Aperture at curX, curY
+		ap, ok := gf.State.Apertures[st.curDCode]
+		if ok {
+			cx, cy := r.toPix(curX, curY)
+			r.stamp(cx, cy, st.curDCode, ap, st.rotation)
+		}
+	} else if cmd.Type == "DRAW" {
+		ap, ok := gf.State.Apertures[st.curDCode]
+		if ok {
+			if st.interpolationMode == "G01" {
+				// Linear
+				x1, y1 := r.toPix(prevX, prevY)
+				x2, y2 := r.toPix(curX, curY)
+				r.drawLine(x1, y1, x2, y2, st.curDCode, ap)
+			} else {
+				// Circular Interpolation (G02/G03)
+				// I and J are offsets from start point (prevX, prevY) to center
+				iVal := 0.0
+				jVal := 0.0
+				if cmd.I != nil {
+					iVal = *cmd.I
+				}
+				if cmd.J != nil {
+					jVal = *cmd.J
+				}
+
+				centerX := prevX + iVal
+				centerY := prevY + jVal
+
+				radius := math.Sqrt(iVal*iVal + jVal*jVal)
+				startAngle := math.Atan2(prevY-centerY, prevX-centerX)
+				endAngle := math.Atan2(curY-centerY, curX-centerX)
+
+				// Adjust angles for G02 (CW) vs G03 (CCW)
+				if st.interpolationMode == "G03" { // CCW
+					if endAngle <= startAngle {
+						endAngle += 2 * math.Pi
+					}
+				} else { // G02 CW
+					if startAngle <= endAngle {
+						startAngle += 2 * math.Pi
+					}
+				}
+
+				// Arc length approximation
+				arcLen := math.Abs(endAngle-startAngle) * radius
+				steps := int(arcLen * scale * 2) // 2x pixel density for smoothness
+				if steps < 10 {
+					steps = 10
+				}
+
+				for s := 0; s <= steps; s++ {
+					t := float64(s) / float64(steps)
+					angle := startAngle + t*(endAngle-startAngle)
+					px := centerX + radius*math.Cos(angle)
+					py := centerY + radius*math.Sin(angle)
+
+					ix, iy := r.toPix(px, py)
+					r.stamp(ix, iy, st.curDCode, ap, 0)
+				}
+			}
+		}
+	}
+}
+
+// StreamGerber parses a gerber file and feeds every command straight to
+// the rasterizer, so memory use is bounded by the image rather than by the
+// number of commands. Reading the file is reported to report.
+func StreamGerber(filename, mirror string, dpi float64, b gerber.Bounds, report progress.Func) (image.Image, error) {
+	gf := gerber.New()
+	gf.Mirror, gf.Progress = mirror, report
+	r := NewRenderer(gf, dpi, b)
+	if err := gf.Scan(filename, r.Handle); err != nil {
+		return nil, err
+	}
+	return r.img, nil
+}
+
+// drawAperture flashes an aperture centered on pixel coordinates (x, y).
+func drawAperture(gf *gerber.File, img *Bitmap, x, y float64, ap gerber.Aperture, scale float64) {
+	switch ap.Type {
+	case gerber.ApertureCircle: // C
+		// Modifiers[0] is diameter
+		if len(ap.Modifiers) > 0 {
+			DrawCircle(img, x, y, ap.Modifiers[0]*scale/2)
+		}
+		return
+	case gerber.ApertureRect: // R
+		// Modifiers[0] is width, [1] is height
+		if len(ap.Modifiers) >= 2 {
+			w := ap.Modifiers[0] * scale
+			h := ap.Modifiers[1] * scale
+			FillBox(img, x-w/2, y-h/2, x+w/2, y+h/2)
+		}
+		return
+	case gerber.ApertureObround: // O
+		// Modifiers[0] is width, [1] is height. The shorter side becomes the
+		// diameter of two semicircular end caps joined by a rectangle.
+		if len(ap.Modifiers) >= 2 {
+			w := ap.Modifiers[0] * scale
+			h := ap.Modifiers[1] * scale
+			if w > h {
+				radius := h / 2
+				offset := (w - h) / 2
+				FillBox(img, x-offset, y-h/2, x+offset, y+h/2)
+				DrawCircle(img, x-offset, y, radius)
+				DrawCircle(img, x+offset, y, radius)
+			} else {
+				radius := w / 2
+				offset := (h - w) / 2
+				FillBox(img, x-w/2, y-offset, x+w/2, y+offset)
+				DrawCircle(img, x, y-offset, radius)
+				DrawCircle(img, x, y+offset, radius)
+			}
+		}
+		return
+	case gerber.AperturePolygon: // P
+		// Modifiers[0] is the outer diameter, [1] the vertex count, [2] rotation
+		if len(ap.Modifiers) >= 2 {
+			rot := 0.0
+			if len(ap.Modifiers) >= 3 {
+				rot = ap.Modifiers[2]
+			}
+			fillShape(img, x, y, scale, gerber.RegularPoly(0, 0, ap.Modifiers[0], int(ap.Modifiers[1]), rot))
+		}
+		return
+	}
+
+	// Check for Macros
+	if macro, ok := gf.State.Macros[ap.Type]; ok {
+		for _, prim := range macro.Primitives {
+			switch prim.Code {
+			case 4: // Outline
+				if pts := gerber.MacroOutline(prim.Modifiers); pts != nil {
+					fillShape(img, x, y, scale, pts)
+				}
+			case 5: // Polygon
+				// Mods: Exposure, Vertices, CenterX, CenterY, Diameter, Rotation
+				if len(prim.Modifiers) >= 6 {
+					m := prim.Modifiers
+					pts := gerber.RotatePoly(gerber.RegularPoly(m[2], m[3], m[4], int(m[1]), 0), m[5])
+					fillShape(img, x, y, scale, pts)
+				}
+			case 1: // Circle
+				// Mods: Exposure, Diameter, CenterX, CenterY
+				if len(prim.Modifiers) >= 4 {
+					// exposure := prim.Modifiers[0] // 1=on, 0=off (assuming 1 for now)
+					dia := prim.Modifiers[1]
+					cx := prim.Modifiers[2]
+					cy := prim.Modifiers[3]
+
+					DrawCircle(img, x+cx*scale, y-cy*scale, dia*scale/2)
+				}
+			case 21: // Center Line (Rect)
+				// Mods: Exposure, Width, Height, CenterX, CenterY, Rotation
+				if len(prim.Modifiers) >= 6 {
+					width := prim.Modifiers[1]
+					height := prim.Modifiers[2]
+					cx := prim.Modifiers[3]
+					cy := prim.Modifiers[4]
+					rot := prim.Modifiers[5]
+
+					if rot == 0 {
+						w, h := width*scale, height*scale
+						rx, ry := x+cx*scale, y-cy*scale
+						FillBox(img, rx-w/2, ry-h/2, rx+w/2, ry+h/2)
+						continue
+					}
+
+					// The rotation turns the center about the aperture origin too
+					sin, cos := math.Sincos(rot * math.Pi / 180)
+					rcx := cx*cos - cy*sin
+					rcy := cx*sin + cy*cos
+					FillRotatedRect(img, x+rcx*scale, y-rcy*scale, width*scale, height*scale, rot)
+				}
+			}
+		}
+	}
+}
+
+// DrawCircle opens the pixels whose centers lie within r of (cx, cy). Each
+// row is written as a single span.
+func DrawCircle(img *Bitmap, cx, cy, r float64) {
+	for y := pixelEdge(cy - r); y < pixelEdge(cy+r); y++ {
+		dy := float64(y) + 0.5 - cy
+		hw := r*r - dy*dy
+		if hw < 0 {
+			continue
+		}
+		hw = math.Sqrt(hw)
+		img.FillSpan(y, pixelEdge(cx-hw), pixelEdge(cx+hw))
+	}
+}
+
+// drawLine strokes a linear draw. Circle apertures sweep a capsule and rect
+// apertures the hexagon spanned by the rect at both ends; both are filled as
+// a single polygon. Other apertures are stamped along the line.
+func (r *Renderer) drawLine(x1, y1, x2, y2 float64, dcode int, ap gerber.Aperture) {
+	img, scale := r.img, r.scale
+	switch ap.Type {
+	case gerber.ApertureCircle:
+		if len(ap.Modifiers) > 0 {
+			radius := ap.Modifiers[0] * scale / 2
+			DrawCircle(img, x1, y1, radius)
+			DrawCircle(img, x2, y2, radius)
+			if x1 != x2 || y1 != y2 {
+				FillPolygons(img, [][]gerber.Vec2{capsuleQuad(x1, y1, x2, y2, radius)}, false)
+			}
+		}
+		return
+	case gerber.ApertureRect:
+		if len(ap.Modifiers) >= 2 {
+			w := ap.Modifiers[0] * scale
+			h := ap.Modifiers[1] * scale
+			var corners []gerber.Vec2
+			for _, p := range []gerber.Vec2{{X: x1, Y: y1}, {X: x2, Y: y2}} {
+				left, top := p.X-w/2, p.Y-h/2
+				right, bottom := p.X+w/2, p.Y+h/2
+				corners = append(corners, gerber.Vec2{X: left, Y: top}, gerber.Vec2{X: right, Y: top}, gerber.Vec2{X: right, Y: bottom}, gerber.Vec2{X: left, Y: bottom})
+			}
+			FillPolygons(img, [][]gerber.Vec2{gerber.ConvexHull(corners)}, false)
+		}
+		return
+	}
+
+	dx := x2 - x1
+	dy := y2 - y1
+	dist := math.Sqrt(dx*dx + dy*dy)
+	steps := int(dist) // 1 pixel steps
+
+	if steps == 0 {
+		r.stamp(x1, y1, dcode, ap, 0)
+		return
+	}
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		r.stamp(x1+t*dx, y1+t*dy, dcode, ap, 0)
+	}
+}
+
+// Stamps are cached per 1/stampPhases of a pixel of subpixel offset, so a
+// stamp is at most 1/(2*stampPhases) pixel from where it belongs.
+const stampPhases = 8
+
+// stampKey identifies a rasterized aperture: its D-code, rotation and the
+// subpixel phase of its center.
+type stampKey struct {
+	dcode    int
+	rotation float64
+	fx, fy   int
+}
+
+// stamp is an aperture rasterized once, as the open spans of its rows
+// relative to the pixel holding its center.
+type stamp struct {
+	spans []stampSpan
+}
+
+type stampSpan struct {
+	y, x0, x1 int
+}
+
+// stamp flashes an aperture centered on pixel coordinates (x, y). Each
+// aperture is rasterized once per subpixel phase and then copied span by
+// span, which is much cheaper than redoing the shape math for thousands of
+// identical pads or the many stamps along an arc.
+func (r *Renderer) stamp(x, y float64, dcode int, ap gerber.Aperture, rotation float64) {
+	ix, iy := int(math.Floor(x)), int(math.Floor(y))
+	fx := int(math.Round((x - math.Floor(x)) * stampPhases))
+	fy := int(math.Round((y - math.Floor(y)) * stampPhases))
+	if fx == stampPhases {
+		ix, fx = ix+1, 0
+	}
+	if fy == stampPhases {
+		iy, fy = iy+1, 0
+	}
+
+	key := stampKey{dcode, rotation, fx, fy}
+	st, ok := r.stamps[key]
+	if !ok {
+		st = rasterizeStamp(r.gf, ap, rotation, float64(fx)/stampPhases, float64(fy)/stampPhases, r.scale)
+		if r.stamps == nil {
+			r.stamps = make(map[stampKey]*stamp)
+		}
+		r.stamps[key] = st
+	}
+	for _, sp := range st.spans {
+		r.img.FillSpan(iy+sp.y, ix+sp.x0, ix+sp.x1)
+	}
+}
+
+// rasterizeStamp draws an aperture offset (fx, fy) pixels from a pixel
+// corner into a scratch bitmap and collects its spans.
+func rasterizeStamp(gf *gerber.File, ap gerber.Aperture, rotation, fx, fy, scale float64) *stamp {
+	pad := int(math.Ceil(gf.ApertureExtent(ap)*scale)) + 2
+	size := 2*pad + 1
+	img := NewBitmap(size, size)
+	drawFlash(gf, img, float64(pad)+fx, float64(pad)+fy, ap, rotation, scale)
+
+	st := &stamp{}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; {
+			if !img.Get(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < size && img.Get(x, y) {
+				x++
+			}
+			st.spans = append(st.spans, stampSpan{y - pad, start - pad, x - pad})
+		}
+	}
+	return st
+}
+
+// drawFlash draws an aperture at pixel coordinates (x, y), applying a %LR
+// rotation to rectangles.
+func drawFlash(gf *gerber.File, img *Bitmap, x, y float64, ap gerber.Aperture, rotation, scale float64) {
+	if ap.Type == gerber.ApertureRect && rotation != 0 && len(ap.Modifiers) >= 2 {
+		FillRotatedRect(img, x, y, ap.Modifiers[0]*scale, ap.Modifiers[1]*scale, rotation)
+		return
+	}
+	drawAperture(gf, img, x, y, ap, scale)
+}
@@ -0,0 +1,135 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// bedAngleStep is how finely, in degrees, a vector mesh's turn to fit the
+// bed is searched.
+const bedAngleStep = 0.25
+
+// Bed is the print bed the stencil must fit on, mm; zero for any size.
+type Bed struct {
+	Width, Depth float64
+}
+
+// ParseBed reads a -bed value, "widthxdepth" in mm such as 220x220.
+func ParseBed(s string) (Bed, error) {
+	if s == "" {
+		return Bed{}, nil
+	}
+	w, d, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return Bed{}, fmt.Errorf("invalid bed %q: want width x depth in mm, such as 220x220", s)
+	}
+	width, err1 := strconv.ParseFloat(strings.TrimSpace(w), 64)
+	depth, err2 := strconv.ParseFloat(strings.TrimSpace(d), 64)
+	if err1 != nil || err2 != nil || width <= 0 || depth <= 0 {
+		return Bed{}, fmt.Errorf("invalid bed %q: want width x depth in mm, such as 220x220", s)
+	}
+	return Bed{Width: width, Depth: depth}, nil
+}
+
+// bedFit turns a placed mesh so it fits the bed: by angle degrees counter
+// clockwise about (cx, cy), then by (dx, dy).
+type bedFit struct {
+	angle    float64
+	cx, cy   float64
+	dx, dy   float64
+	sin, cos float64
+}
+
+// apply turns p as the fit does.
+func (f bedFit) apply(p Point) Point {
+	x, y := p.X-f.cx, p.Y-f.cy
+	return Point{X: x*f.cos - y*f.sin + f.cx + f.dx, Y: x*f.sin + y*f.cos + f.cy + f.dy, Z: p.Z}
+}
+
+// extent returns how wide and deep hull is turned by angle degrees, and the
+// middle of its box.
+func extent(hull []vec2, angle float64) (w, h float64, mid vec2) {
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	lo := vec2{X: math.Inf(1), Y: math.Inf(1)}
+	hi := vec2{X: math.Inf(-1), Y: math.Inf(-1)}
+	for _, p := range hull {
+		x, y := p.X*cos-p.Y*sin, p.X*sin+p.Y*cos
+		lo = vec2{X: math.Min(lo.X, x), Y: math.Min(lo.Y, y)}
+		hi = vec2{X: math.Max(hi.X, x), Y: math.Max(hi.Y, y)}
+	}
+	return hi.X - lo.X, hi.Y - lo.Y, vec2{X: (lo.X + hi.X) / 2, Y: (lo.Y + hi.Y) / 2}
+}
+
+// fitBed finds how to turn the placed mesh of triangles to fit bed: not at
+// all if it fits as it is, a quarter turn, or with any angle, the angle that
+// leaves it the most room. It keeps the mesh where cfg.Origin puts it: its
+// corner or middle where they were, or the gerber origin at 0. It returns
+// an error suggesting how to tile the stencil when it fits at no angle.
+func fitBed(triangles [][3]Point, bed Bed, anyAngle bool, cfg Config) (bedFit, error) {
+	var pts []vec2
+	for _, t := range triangles {
+		for _, p := range t {
+			pts = append(pts, vec2{X: p.X, Y: p.Y})
+		}
+	}
+	hull := gerber.ConvexHull(pts)
+	fits := func(angle float64) (float64, bool) {
+		w, h, _ := extent(hull, angle)
+		room := math.Min(bed.Width-w, bed.Depth-h)
+		return room, room >= 0
+	}
+	angle, ok := 0.0, false
+	if _, ok = fits(0); !ok {
+		if _, ok = fits(90); ok {
+			angle = 90
+		}
+	}
+	if !ok && anyAngle {
+		best := math.Inf(-1)
+		for a := bedAngleStep; a < 180; a += bedAngleStep {
+			if room, fit := fits(a); fit && room > best {
+				angle, best, ok = a, room, true
+			}
+		}
+	}
+	w, h, mid := extent(hull, 0)
+	if !ok {
+		cols, rows := math.Ceil(w/bed.Width), math.Ceil(h/bed.Depth)
+		if c, r := math.Ceil(h/bed.Width), math.Ceil(w/bed.Depth); c*r < cols*rows {
+			cols, rows = r, c
+		}
+		turns := "turned a quarter"
+		if anyAngle {
+			turns = "at any angle"
+		}
+		return bedFit{}, fmt.Errorf("the stencil is %.1f x %.1f mm and doesn't fit the %g x %g mm bed, even %s; split it into tiles of at most %.1f x %.1f mm with -tiles %gx%g, or -tiles auto to leave room for the joints", w, h, bed.Width, bed.Depth, turns, w/cols, h/rows, cols, rows)
+	}
+
+	f := bedFit{angle: angle, cx: mid.X, cy: mid.Y}
+	f.sin, f.cos = math.Sincos(angle * math.Pi / 180)
+	if angle == 90 {
+		f.sin, f.cos = 1, 0
+	}
+	if cfg.Origin == "gerber" {
+		f.cx, f.cy = 0, 0
+	}
+	lo := vec2{X: math.Inf(1), Y: math.Inf(1)}
+	for _, p := range hull {
+		q := f.apply(Point{X: p.X, Y: p.Y})
+		lo = vec2{X: math.Min(lo.X, q.X), Y: math.Min(lo.Y, q.Y)}
+	}
+	tw, th, _ := extent(hull, angle)
+	switch cfg.Origin {
+	case "center":
+		f.dx, f.dy = mid.X-(lo.X+tw/2), mid.Y-(lo.Y+th/2)
+	case "gerber":
+	default:
+		// Keep the corner where it was
+		f.dx, f.dy = mid.X-w/2-lo.X, mid.Y-h/2-lo.Y
+	}
+	return f, nil
+}
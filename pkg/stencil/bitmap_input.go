@@ -0,0 +1,55 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"os"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// isBitmapInput reports whether a file extension selects bitmap input.
+func isBitmapInput(ext string) bool {
+	switch ext {
+	case ".png", ".bmp", ".gif", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// LoadBitmap reads an image and thresholds it to the pipeline's convention:
+// white for openings, black for stencil material. Transparent pixels count
+// as material. With invert, dark pixels become the openings instead.
+func LoadBitmap(filename string, invert bool) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	// Re-base to (0, 0), the mesher indexes pixels from the origin
+	b := src.Bounds()
+	img := render.NewBitmap(b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			// Rec. 601 luma, premultiplied by alpha
+			luma := (299*r + 587*g + 114*bl) / 1000
+			open := luma > 0x7fff && a > 0x7fff
+			if invert {
+				open = !open && a > 0x7fff
+			}
+			if open {
+				img.SetBit(x-b.Min.X, y-b.Min.Y)
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,182 @@
+package stencil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Placement is a component's position from a pick-and-place (centroid)
+// file.
+type Placement struct {
+	Ref      string
+	X, Y     float64 // mm
+	Rotation float64 // Degrees
+	Side     string  // SideTop, SideBottom, or empty when the file doesn't say
+}
+
+// centroidColumns maps header names, lower case without spaces, symbols or
+// units, to the fields of Placement, for KiCad, Altium, Eagle and JLCPCB
+// style files.
+var centroidColumns = map[string]string{
+	"ref": "ref", "designator": "ref", "refdes": "ref", "reference": "ref", "part": "ref",
+	"posx": "x", "midx": "x", "centerx": "x", "x": "x", "refx": "x", "locationx": "x",
+	"posy": "y", "midy": "y", "centery": "y", "y": "y", "refy": "y", "locationy": "y",
+	"rot": "rot", "rotation": "rot", "angle": "rot",
+	"side": "side", "layer": "side", "tb": "side",
+}
+
+// centroidHeader normalizes a column name for centroidColumns, and returns
+// the unit it names, if any.
+func centroidHeader(name string) (string, float64) {
+	name = strings.ToLower(name)
+	scale := 0.0
+	switch {
+	case strings.Contains(name, "(mm)"):
+		scale = 1
+	case strings.Contains(name, "(mil)"):
+		scale = 0.0254
+	case strings.Contains(name, "(in)"):
+		scale = 25.4
+	}
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, name)
+	return name, scale
+}
+
+// centroidValue reads a coordinate, in the file's units unless it has a
+// unit suffix.
+func centroidValue(s string, scale float64) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, u := range []struct {
+		suffix string
+		scale  float64
+	}{{"mm", 1}, {"mil", 0.0254}, {"in", 25.4}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, scale = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * scale, err
+}
+
+// centroidSide reads the side of the board a component is on.
+func centroidSide(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "top", "t", "front", "f", "f.cu", "toplayer":
+		return SideTop
+	case "bottom", "bot", "b", "back", "b.cu", "bottomlayer":
+		return SideBottom
+	}
+	return ""
+}
+
+// ParseCentroid reads a pick-and-place file: a KiCad .pos file, with its
+// columns separated by spaces and a commented header, or a CSV with a header
+// row naming the reference, X and Y columns. Coordinates are in mm unless
+// the file says otherwise.
+func ParseCentroid(path string) ([]Placement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var places []Placement
+	var columns map[string]int
+	scale := 1.0
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		comment := strings.HasPrefix(line, "#")
+		line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		lower := strings.ToLower(line)
+		if comment && strings.Contains(lower, "unit") {
+			// ## Unit = mm, Angle = deg.
+			if strings.Contains(lower, "inch") {
+				scale = 25.4
+			}
+			continue
+		}
+
+		var fields []string
+		if strings.Contains(line, ",") || strings.Contains(line, "\t") {
+			r := csv.NewReader(strings.NewReader(line))
+			if strings.Contains(line, "\t") && !strings.Contains(line, ",") {
+				r.Comma = '\t'
+			}
+			r.LazyQuotes = true
+			if fields, err = r.Read(); err != nil {
+				return nil, fmt.Errorf("%s line %d: %v", path, n, err)
+			}
+		} else {
+			fields = strings.Fields(line)
+		}
+
+		if columns == nil {
+			// The first line naming the reference and both coordinates
+			found := map[string]int{}
+			for i, name := range fields {
+				key, unit := centroidHeader(name)
+				if field, ok := centroidColumns[key]; ok {
+					if _, dup := found[field]; !dup {
+						found[field] = i
+					}
+					if unit != 0 && (field == "x" || field == "y") {
+						scale = unit
+					}
+				}
+			}
+			_, ref := found["ref"]
+			_, x := found["x"]
+			_, y := found["y"]
+			if ref && x && y {
+				columns = found
+			}
+			continue
+		}
+		if comment {
+			continue
+		}
+
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		p := Placement{Ref: strings.TrimSpace(get("ref")), Side: centroidSide(get("side"))}
+		if p.X, err = centroidValue(get("x"), scale); err != nil {
+			return nil, fmt.Errorf("%s line %d: bad X %q", path, n, get("x"))
+		}
+		if p.Y, err = centroidValue(get("y"), scale); err != nil {
+			return nil, fmt.Errorf("%s line %d: bad Y %q", path, n, get("y"))
+		}
+		if rot := get("rot"); rot != "" {
+			p.Rotation, _ = strconv.ParseFloat(strings.TrimSpace(rot), 64)
+		}
+		places = append(places, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		return nil, fmt.Errorf("%s has no header naming the reference, X and Y columns", path)
+	}
+	return places, nil
+}
@@ -0,0 +1,96 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Layout of a combined top and bottom stencil, mm
+const (
+	combineGap     = 10.0 // Between the two aperture fields
+	combineDivider = 0.5  // Width of the line engraved down the middle of the gap
+	combineLabel   = 2.5  // Height of the side labels above each field
+)
+
+// appendShifted appends the commands of src to gf, moved by (dx, dy). Its
+// apertures and macros are renumbered and renamed so they don't clash with
+// gf's, and its modal state starts over as at the top of a file.
+func appendShifted(gf, src *gerber.File, dx, dy float64, prefix string) {
+	offset := 0
+	for d := range gf.State.Apertures {
+		offset = max(offset, d)
+	}
+	for name, m := range src.State.Macros {
+		m.Name = prefix + name
+		gf.State.Macros[m.Name] = m
+	}
+	for d, ap := range src.State.Apertures {
+		if _, ok := src.State.Macros[ap.Type]; ok {
+			ap.Type = prefix + ap.Type
+		}
+		gf.State.Apertures[d+offset] = ap
+	}
+	for what, n := range src.Unsupported {
+		gf.Unsupported[what] += n
+	}
+
+	var rot float64
+	gf.Commands = append(gf.Commands, gerber.Command{Type: "G01"}, gerber.Command{Type: "LR", R: &rot}, gerber.Command{Type: "COMPONENT"})
+	var x, y float64
+	for _, cmd := range src.Commands {
+		switch cmd.Type {
+		case "APERTURE":
+			d := *cmd.D + offset
+			cmd.D = &d
+		case "MOVE", "DRAW", "FLASH":
+			// Coordinates are modal, and the last ones are gf's
+			if cmd.X != nil {
+				x = *cmd.X
+			}
+			if cmd.Y != nil {
+				y = *cmd.Y
+			}
+			sx, sy := x+dx, y+dy
+			cmd.X, cmd.Y = &sx, &sy
+		}
+		gf.Commands = append(gf.Commands, cmd)
+	}
+}
+
+// combineOffset returns how far the mirrored bottom paste layer moves to lie
+// beside the top one, combineGap to its right with their bottom edges lined
+// up.
+func combineOffset(top, bottom gerber.Bounds) (float64, float64) {
+	return top.MaxX + combineGap - bottom.MinX, top.MinY - bottom.MinY
+}
+
+// addBottom adds the bottom paste layer, cfg.Bottom, to the top one in gf,
+// mirrored and with home plate openings as cfg asks, beside it so both
+// sides of the board come out of one stencil. It returns a step zone
+// engraving the divider between the two fields and the side labels above
+// them half as deep as the plate.
+func addBottom(gf *gerber.File, cfg Config) (StepZone, error) {
+	bottom, err := gerber.ParseMirrored(cfg.Bottom, gerber.MirrorX)
+	if err != nil {
+		return StepZone{}, fmt.Errorf("error parsing bottom paste: %v", err)
+	}
+	if cfg.HomePlate > 0 {
+		homePlates(bottom, cfg.HomePlate, cfg.HomePlateInverted)
+	}
+	tb, bb := gf.CalculateBounds(), bottom.CalculateBounds()
+	dx, dy := combineOffset(tb, bb)
+	appendShifted(gf, bottom, dx, dy, "BOTTOM_")
+	bb = gerber.Bounds{MinX: bb.MinX + dx, MinY: bb.MinY + dy, MaxX: bb.MaxX + dx, MaxY: bb.MaxY + dy}
+
+	mid := tb.MaxX + combineGap/2
+	shapes := rectRegion([]gerber.Bounds{{MinX: mid - combineDivider/2, MinY: tb.MinY, MaxX: mid + combineDivider/2, MaxY: math.Max(tb.MaxY, bb.MaxY)}})
+	label := func(s string, field gerber.Bounds) {
+		x := (field.MinX + field.MaxX - strokeTextWidth(s, combineLabel)) / 2
+		appendShifted(shapes, strokeText(s, x, field.MaxY+1, combineLabel), 0, 0, "")
+	}
+	label("Top", tb)
+	label("Bottom", bb)
+	return StepZone{Thickness: cfg.StencilHeight / 2, Shapes: shapes, Name: "the divider and side labels"}, nil
+}
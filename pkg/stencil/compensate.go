@@ -0,0 +1,336 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// Shrink is how much smaller to make openings along one axis: Amount mm
+// off each side, or Amount percent of each opening's size when Percent is
+// set. Negative amounts enlarge them.
+type Shrink struct {
+	Amount  float64
+	Percent bool
+}
+
+func (s Shrink) String() string {
+	if s.Percent {
+		return fmt.Sprintf("%g%%", s.Amount)
+	}
+	return fmt.Sprintf("%g mm", s.Amount)
+}
+
+// ParseShrink reads a -shrink value: one amount for both axes or "x,y",
+// each in mm or with a % suffix.
+func ParseShrink(s string) (x, y Shrink, err error) {
+	if s == "" {
+		return Shrink{}, Shrink{}, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > 2 {
+		return Shrink{}, Shrink{}, fmt.Errorf("invalid shrink %q: want one value or x,y", s)
+	}
+	var axes [2]Shrink
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		axes[i].Percent = strings.HasSuffix(p, "%")
+		axes[i].Amount, err = strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+		if err != nil {
+			return Shrink{}, Shrink{}, fmt.Errorf("invalid shrink %q: %v", s, err)
+		}
+		if axes[i].Percent && axes[i].Amount >= 100 {
+			return Shrink{}, Shrink{}, fmt.Errorf("invalid shrink %q: can't shrink by 100%% or more", s)
+		}
+	}
+	if len(parts) == 1 {
+		axes[1] = axes[0]
+	}
+	return axes[0], axes[1], nil
+}
+
+// AreaShrink shrinks openings up to MaxArea mm² by Shrink. The last class of
+// a list may have no MaxArea, and takes every opening larger than the rest.
+type AreaShrink struct {
+	MaxArea float64
+	Shrink  Shrink
+}
+
+func (c AreaShrink) String() string {
+	if c.MaxArea == 0 {
+		return fmt.Sprintf("%v above", c.Shrink)
+	}
+	return fmt.Sprintf("%v up to %g mm²", c.Shrink, c.MaxArea)
+}
+
+// areaShrinksString describes a list of area classes.
+func areaShrinksString(classes []AreaShrink) string {
+	parts := make([]string, len(classes))
+	for i, c := range classes {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseAreaShrinks reads a -shrink-by-area value: comma separated
+// "area:amount" classes in increasing order of area, with an amount alone
+// last for openings larger than all of them. Amounts are in mm or percent,
+// as with -shrink.
+func ParseAreaShrinks(s string) ([]AreaShrink, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	classes := make([]AreaShrink, len(parts))
+	for i, p := range parts {
+		area, amount, ok := strings.Cut(strings.TrimSpace(p), ":")
+		if !ok {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("invalid area class %q: only the last class may leave out its area", p)
+			}
+			area, amount = "", area
+		}
+		if area != "" {
+			v, err := strconv.ParseFloat(area, 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("invalid area class %q: bad area %q", p, area)
+			}
+			if i > 0 && v <= classes[i-1].MaxArea {
+				return nil, fmt.Errorf("invalid area class %q: areas must increase", p)
+			}
+			classes[i].MaxArea = v
+		}
+		x, _, err := ParseShrink(strings.TrimSpace(amount))
+		if err != nil {
+			return nil, fmt.Errorf("invalid area class %q: %v", p, err)
+		}
+		if x.Amount < 0 {
+			return nil, fmt.Errorf("invalid area class %q: area classes only shrink openings, use -shrink to enlarge them", p)
+		}
+		classes[i].Shrink = x
+	}
+	return classes, nil
+}
+
+// openingRun is a stretch of open pixels x0 to x1 (exclusive) of row y.
+type openingRun struct{ y, x0, x1 int }
+
+// findOpenings returns the 4-connected openings of b as lists of runs, with
+// their bounding boxes.
+func findOpenings(b *render.Bitmap) ([][]openingRun, []image.Rectangle) {
+	left := &render.Bitmap{Width: b.Width, Height: b.Height, Stride: b.Stride, Bits: append([]uint64(nil), b.Bits...)}
+	take := func(y, x int) { left.Bits[y*left.Stride+x/64] &^= 1 << uint(x%64) }
+
+	var openings [][]openingRun
+	var boxes []image.Rectangle
+	type seed struct{ x, y int }
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if !left.Get(x, y) {
+				continue
+			}
+			var runs []openingRun
+			box := image.Rect(x, y, x+1, y+1)
+			stack := []seed{{x, y}}
+			for len(stack) > 0 {
+				s := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if !left.Get(s.x, s.y) {
+					continue
+				}
+				x0, x1 := s.x, s.x+1
+				for left.Get(x0-1, s.y) {
+					x0--
+				}
+				for left.Get(x1, s.y) {
+					x1++
+				}
+				for i := x0; i < x1; i++ {
+					take(s.y, i)
+				}
+				runs = append(runs, openingRun{s.y, x0, x1})
+				box = box.Union(image.Rect(x0, s.y, x1, s.y+1))
+				for _, ny := range [2]int{s.y - 1, s.y + 1} {
+					for i := x0; i < x1; i++ {
+						if left.Get(i, ny) && (i == x0 || !left.Get(i-1, ny)) {
+							stack = append(stack, seed{i, ny})
+						}
+					}
+				}
+			}
+			openings = append(openings, runs)
+			boxes = append(boxes, box)
+		}
+	}
+	return openings, boxes
+}
+
+// distanceField returns the squared distance from each pixel of a w x h
+// grid to the nearest site, with x distances divided by rx and y distances by
+// ry. Grids without sites get huge distances.
+func distanceField(w, h int, site func(x, y int) bool, rx, ry float64) []float64 {
+	const far = 1e18
+	d := make([]float64, w*h)
+	for i := range d {
+		if !site(i%w, i/w) {
+			d[i] = far
+		}
+	}
+	n := max(w, h)
+	f, out := make([]float64, n), make([]float64, n)
+	v, z := make([]int, n), make([]float64, n+1)
+	// Lower envelope of parabolas, after Felzenszwalb and Huttenlocher
+	pass := func(f, out []float64, wt float64) {
+		k := 0
+		v[0], z[0], z[1] = 0, math.Inf(-1), math.Inf(1)
+		for q := 1; q < len(f); q++ {
+			meet := func(p int) float64 {
+				return ((f[q] + wt*float64(q*q)) - (f[p] + wt*float64(p*p))) / (2 * wt * float64(q-p))
+			}
+			s := meet(v[k])
+			for s <= z[k] {
+				k--
+				s = meet(v[k])
+			}
+			k++
+			v[k], z[k], z[k+1] = q, s, math.Inf(1)
+		}
+		k = 0
+		for q := range f {
+			for z[k+1] < float64(q) {
+				k++
+			}
+			dq := float64(q - v[k])
+			out[q] = f[v[k]] + wt*dq*dq
+		}
+	}
+	for y := 0; y < h; y++ {
+		copy(f[:w], d[y*w:(y+1)*w])
+		pass(f[:w], out[:w], 1/(rx*rx))
+		copy(d[y*w:(y+1)*w], out[:w])
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			f[y] = d[y*w+x]
+		}
+		pass(f[:h], out[:h], 1/(ry*ry))
+		for y := 0; y < h; y++ {
+			d[y*w+x] = out[y]
+		}
+	}
+	return d
+}
+
+// morphOpenings erodes (grow false) or dilates each opening of b by an
+// ellipse with the radii in pixels radius returns for its bounding box and
+// its area in pixels.
+func morphOpenings(b *render.Bitmap, radius func(box image.Rectangle, area int) (rx, ry float64), grow bool) *render.Bitmap {
+	out := &render.Bitmap{Width: b.Width, Height: b.Height, Stride: b.Stride, Bits: append([]uint64(nil), b.Bits...)}
+	openings, boxes := findOpenings(b)
+	for i, runs := range openings {
+		area := 0
+		for _, r := range runs {
+			area += r.x1 - r.x0
+		}
+		rx, ry := radius(boxes[i], area)
+		if rx <= 0 && ry <= 0 {
+			continue
+		}
+		// Pixel centers sit half a pixel inside the edge they're measured from
+		rx, ry = math.Max(rx, 0)+0.5, math.Max(ry, 0)+0.5
+		margin := image.Pt(1, 1)
+		if grow {
+			margin = image.Pt(int(math.Ceil(rx))+1, int(math.Ceil(ry))+1)
+		}
+		crop := image.Rectangle{boxes[i].Min.Sub(margin), boxes[i].Max.Add(margin)}
+		w, h := crop.Dx(), crop.Dy()
+		in := make([]bool, w*h)
+		for _, r := range runs {
+			for x := r.x0; x < r.x1; x++ {
+				in[(r.y-crop.Min.Y)*w+x-crop.Min.X] = true
+			}
+		}
+
+		// Eroding keeps the pixels of the opening further than the radius
+		// from any pixel outside it; dilating opens every pixel closer
+		// than that to the opening
+		dist := distanceField(w, h, func(x, y int) bool { return in[y*w+x] == grow }, rx, ry)
+		for j, d := range dist {
+			x, y := crop.Min.X+j%w, crop.Min.Y+j/w
+			switch {
+			case grow && d <= 1:
+				out.SetBit(x, y)
+			case !grow && in[j] && d <= 1:
+				out.Bits[y*out.Stride+x/64] &^= 1 << uint(x%64)
+			}
+		}
+	}
+	return out
+}
+
+// CompensateOpenings shrinks the openings of a rendered stencil by sx along
+// X and sy along Y, or enlarges them for negative amounts, to make up for
+// over or under extrusion and resin bleed. Each opening is eroded or
+// dilated by an ellipse with those radii, so round pads stay round.
+func CompensateOpenings(img image.Image, sx, sy Shrink, pixelToMM float64) *render.Bitmap {
+	b := openingBitmap(img)
+	radii := func(sign float64) func(image.Rectangle, int) (float64, float64) {
+		return func(box image.Rectangle, _ int) (float64, float64) {
+			return sign * shrinkRadius(sx, box.Dx(), pixelToMM), sign * shrinkRadius(sy, box.Dy(), pixelToMM)
+		}
+	}
+	// Shrinking along one axis and growing along the other takes both passes
+	if sx.Amount > 0 || sy.Amount > 0 {
+		b = morphOpenings(b, radii(1), false)
+	}
+	if sx.Amount < 0 || sy.Amount < 0 {
+		b = morphOpenings(b, radii(-1), true)
+	}
+	return b
+}
+
+// ShrinkByArea shrinks each opening of a rendered stencil by the first of
+// the classes its drawn area fits in, so large pads, which take more paste
+// than they need from a thick stencil, can be cut back harder than fine
+// pitch ones. Openings larger than every class are left alone.
+func ShrinkByArea(img image.Image, classes []AreaShrink, pixelToMM float64) *render.Bitmap {
+	return morphOpenings(openingBitmap(img), func(box image.Rectangle, area int) (float64, float64) {
+		mm2 := float64(area) * pixelToMM * pixelToMM
+		for _, c := range classes {
+			if c.MaxArea == 0 || mm2 <= c.MaxArea {
+				return shrinkRadius(c.Shrink, box.Dx(), pixelToMM), shrinkRadius(c.Shrink, box.Dy(), pixelToMM)
+			}
+		}
+		return 0, 0
+	}, false)
+}
+
+// shrinkRadius returns how many pixels s takes off each side of an opening
+// size pixels across.
+func shrinkRadius(s Shrink, size int, pixelToMM float64) float64 {
+	if s.Percent {
+		return s.Amount / 100 * float64(size) / 2
+	}
+	return s.Amount / pixelToMM
+}
+
+// openingBitmap returns img as a bitmap of its openings.
+func openingBitmap(img image.Image) *render.Bitmap {
+	if b, ok := img.(*render.Bitmap); ok {
+		return b
+	}
+	bounds := img.Bounds()
+	b := render.NewBitmap(bounds.Max.X, bounds.Max.Y)
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if render.IsOpen(img, x, y) {
+				b.SetBit(x, y)
+			}
+		}
+	}
+	return b
+}
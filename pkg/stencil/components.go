@@ -0,0 +1,187 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// loadPlacements reads the components of the given side from a centroid
+// file, mirrored across the axis like the paste layer. Components the file
+// gives no side for are on every side.
+func loadPlacements(path, side, mirror string) ([]Placement, error) {
+	places, err := ParseCentroid(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading centroid file: %v", err)
+	}
+	var out []Placement
+	for _, p := range places {
+		if p.Side != "" && side != "" && p.Side != side {
+			continue
+		}
+		p.X, p.Y = gerber.MirrorPoint(p.X, p.Y, mirror)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// pastePad is a flash or region of a paste layer: the commands that draw it,
+// its middle, and the component it belongs to.
+type pastePad struct {
+	cmds []int
+	x, y float64
+	ref  string
+	n    int // Points of a region's contour
+}
+
+// pastePads returns the flashes and regions of gf. Each belongs to the
+// component its X2 attributes name, or without them to the one in places
+// whose position is nearest.
+func pastePads(gf *gerber.File, places []Placement) []pastePad {
+	var pads []pastePad
+	var x, y float64
+	ref := ""
+	var region *pastePad
+	for i, cmd := range gf.Commands {
+		if cmd.X != nil {
+			x = *cmd.X
+		}
+		if cmd.Y != nil {
+			y = *cmd.Y
+		}
+		switch {
+		case cmd.Type == "COMPONENT":
+			ref = cmd.Name
+		case cmd.Type == "G36":
+			region = &pastePad{cmds: []int{i}, ref: ref}
+		case region != nil:
+			region.cmds = append(region.cmds, i)
+			switch cmd.Type {
+			case "G37":
+				if region.n > 0 {
+					region.x, region.y = region.x/float64(region.n), region.y/float64(region.n)
+				}
+				pads = append(pads, *region)
+				region = nil
+			case "MOVE", "DRAW":
+				region.x += x
+				region.y += y
+				region.n++
+			}
+		case cmd.Type == "FLASH":
+			pads = append(pads, pastePad{cmds: []int{i}, x: x, y: y, ref: ref})
+		}
+	}
+	for i, p := range pads {
+		if p.ref != "" {
+			continue
+		}
+		best := math.Inf(1)
+		for _, pl := range places {
+			if d := math.Hypot(pl.X-p.x, pl.Y-p.y); d < best {
+				best, pads[i].ref = d, pl.Ref
+			}
+		}
+	}
+	return pads
+}
+
+// dropPads removes the pads of gf for which drop is true, leaving the pen
+// where they would have left it, and returns how many it removed.
+func dropPads(gf *gerber.File, places []Placement, drop func(p pastePad) bool) int {
+	n := 0
+	removed := make(map[int]bool)
+	for _, p := range pastePads(gf, places) {
+		if !drop(p) {
+			continue
+		}
+		for _, i := range p.cmds {
+			switch gf.Commands[i].Type {
+			case "FLASH", "DRAW":
+				gf.Commands[i].Type = "MOVE"
+			case "G36", "G37":
+				removed[i] = true
+			}
+		}
+		n++
+	}
+	if len(removed) > 0 {
+		kept := gf.Commands[:0]
+		for i, cmd := range gf.Commands {
+			if !removed[i] {
+				kept = append(kept, cmd)
+			}
+		}
+		gf.Commands = kept
+	}
+	return n
+}
+
+// SplitRefs splits a comma separated list of component references.
+func SplitRefs(s string) []string {
+	var refs []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			refs = append(refs, p)
+		}
+	}
+	return refs
+}
+
+// hasRef reports whether ref is one of refs, ignoring case.
+func hasRef(refs []string, ref string) bool {
+	for _, r := range refs {
+		if strings.EqualFold(r, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCrop reads a -crop area, x0,y0,x1,y1 in mm.
+func ParseCrop(s string) (*gerber.Bounds, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid crop %q: want x0,y0,x1,y1 in mm", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		var err error
+		if v[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+			return nil, fmt.Errorf("invalid crop %q: %v", s, err)
+		}
+	}
+	b := &gerber.Bounds{MinX: min(v[0], v[2]), MinY: min(v[1], v[3]), MaxX: max(v[0], v[2]), MaxY: max(v[1], v[3])}
+	if b.MinX == b.MaxX || b.MinY == b.MaxY {
+		return nil, fmt.Errorf("invalid crop %q: empty rectangle", s)
+	}
+	return b, nil
+}
+
+// selectPads removes the pads of gf cfg doesn't give paste: those of the
+// components in cfg.Exclude and, for a partial stencil, those of components
+// not in cfg.OnlyRefs or with their middle outside cfg.Crop. It returns how
+// many it removed.
+func selectPads(gf *gerber.File, cfg Config) int {
+	var crop gerber.Bounds
+	if cfg.Crop != nil {
+		crop = gerber.MirrorBounds(*cfg.Crop, cfg.Mirror)
+	}
+	return dropPads(gf, cfg.placements, func(p pastePad) bool {
+		switch {
+		case hasRef(cfg.Exclude, p.ref):
+			return true
+		case len(cfg.OnlyRefs) > 0 && !hasRef(cfg.OnlyRefs, p.ref):
+			return true
+		case cfg.Crop != nil:
+			return p.x < crop.MinX || p.x > crop.MaxX || p.y < crop.MinY || p.y > crop.MaxY
+		}
+		return false
+	})
+}
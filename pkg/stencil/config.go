@@ -0,0 +1,238 @@
+package stencil
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/render"
+)
+
+// Config holds the settings of a conversion, a field for each option of the
+// CLI. The zero Config isn't one Convert takes: start from DefaultConfig.
+type Config struct {
+	Stdout            io.Writer      // Where the conversion tells what it's doing; nil for os.Stdout
+	Log               *log.Logger    // Where it logs warnings; nil for the standard logger
+	Progress          progress.Func  // Told how far the long stages have got; nil for no reports
+	MeshOut           io.Writer      // Where a mesh written to - goes; nil for os.Stdout
+	Output            string         // Mesh file to write, - for stdout; empty for next to the input
+	OutDir            string         // Directory to write the outputs to instead of next to the input
+	Confirm           bool           // Ask before converting the layers picked from an archive, directory or job file
+	Drill             string         // Excellon drill file, for the alignment pins
+	PasteLayer        string         // Paste layer to pick from an archive, directory or job file instead of guessing
+	OutlineLayer      string         // Outline layer to pick from one, or none to use no outline
+	StencilHeight     float64        // Thickness of the plate, mm
+	WallHeight        float64        // Height of the wall around the board, mm
+	WallThickness     float64        // Thickness of the wall, mm
+	Clearance         float64        // Gap between the board edge and the wall around it, mm
+	Locators          float64        // Arm length of the L-shaped blocks at two corners that replace the wall, mm; 0 for the whole wall
+	RegHoles          RegHoles       // Tooling holes through the frame around the stencil
+	Magnets           MagnetPockets  // Pockets for magnets in the underside of the frame
+	DPI               float64        // Render resolution; 0 picks one from the smallest aperture
+	KeepPNG           bool           // Also save the rendered PNG and an annotated preview
+	DebugPNG          bool           // Also save the paste render colored by aperture
+	SVG               bool           // Also write the openings and outline as vector cut lines
+	DXF               bool           // The same as a DXF, for CNC and drag knife cutters
+	Kerf              float64        // Width of the cut the vector cut lines make up for, mm
+	GCode             bool           // Also write laser G-code cutting the same lines
+	Dispense          bool           // Write dispenser G-code laying each opening's paste instead of a stencil
+	Dispenser         Dispenser      // The dispenser it is for
+	SCAD              bool           // Also write the stencil as an OpenSCAD model
+	PDF               bool           // Also write a 1:1 PDF of the openings and outline for a paper check print
+	LaserPower        float64        // Laser power for the G-code, percent
+	LaserSpeed        float64        // Laser cutting speed, mm/min
+	LaserPasses       int            // Times the laser goes over each line
+	PixelPitch        float64        // mm per pixel for bitmap input; derived from DPI when 0
+	Invert            bool           // Bitmap input: dark pixels are openings
+	Stream            bool           // Render gerbers while parsing instead of keeping all commands
+	Supersample       int            // Paste render supersampling factor; 0 picks one from the smallest aperture
+	MinPixels         float64        // Pixels across the smallest aperture when DPI is 0 (auto)
+	Vector            bool           // Mesh gerbers from their geometry instead of a rendered image
+	Raster            bool           // Always mesh a rendered image, even where Vector could be used
+	Contour           bool           // Mesh the rendered image from its traced contours instead of boxes
+	MaxRects          bool           // Cover the faces of the box mesh with maximal rectangles instead of row strips
+	Simplify          float64        // Contour simplification tolerance in µm; 0 for the default
+	WallTaper         float64        // Draft angle of aperture walls in degrees, wider on the squeegee side
+	Chamfer           float64        // 45° chamfer on the squeegee side rim of openings, mm
+	Fillet            float64        // Radius of a round on that rim instead, mm
+	ShrinkX           Shrink         // Aperture compensation along X
+	ShrinkY           Shrink         // Aperture compensation along Y
+	ShrinkByArea      []AreaShrink   // Paste reduction by opening area, before the compensation
+	Profile           *Profile       // Printer's fitted compensation, after -shrink; nil for none
+	HomePlate         float64        // Pitch in mm at or below which rectangular pads get home plate openings, 0 for none
+	WindowPane        float64        // Openings larger than this many mm² are split into windows, 0 for none
+	PaneWeb           float64        // Width in mm of the webs between windows
+	HomePlateInverted bool           // Notch the inner end of home plate openings instead of pointing it
+	Steps             []StepZone     // Areas of the plate with their own thickness
+	Fiducials         string         // Centroid file or gerber of fiducials to engrave half deep into the squeegee side
+	Side              string         // Board side the paste is on, for picking fiducials from a centroid file
+	Centroid          string         // Pick and place file placing the components for Exclude
+	Exclude           []string       // References of the components to leave without paste
+	OnlyRefs          []string       // References of the only components to give paste, for a partial stencil
+	Crop              *gerber.Bounds // The only part of the board, mm, to give paste, for a partial stencil
+	Mirror            string         // MirrorX or MirrorY to mirror the gerbers, for bottom side paste
+	Bottom            string         // Bottom paste layer to lay mirrored beside the paste layer, on one stencil
+	Label             string         // Text to put on the stencil
+	LabelSize         float64        // Height of the label's letters, mm
+	LabelRaised       bool           // Stand the label proud of the squeegee side instead of engraving it
+	LabelAt           *Point         // Bottom left of the label in gerber coordinates; nil for below the paste layer
+	Jig               bool           // Also write a holder for the board, <name>_jig.stl
+	BoardThickness    float64        // Depth of the jig's board pocket, mm
+	AlignPins         bool           // Also write pins for the board's tooling holes, <name>_pins.stl, with holes for them through the stencil and jig
+	PinFit            float64        // How much narrower the pins are than the holes, mm
+	Squeegee          bool           // Also write a squeegee for the stencil, <name>_squeegee.stl
+	SqueegeeSize      Squeegee       // Its blade length, handle and edge
+	ZOffset           float64        // Height of the bottom of the mesh, mm
+	Origin            string         // Where X and Y are 0: corner (the default), center, or gerber for the gerber's origin
+	Bed               Bed            // Print bed to turn the mesh to fit on, zero for none
+	Tiles             Tiling         // Split the stencil into tiles with joints, for a bed smaller than it
+	YUp               bool           // Write STL, OBJ and PLY meshes with Y up instead of Z
+	Scale             float64        // Mesh file units per mm, for STL, OBJ and PLY; 0 is 1
+	Stats             bool           // Also save the stencil statistics as JSON
+	Ratios            bool           // Print the area and aspect ratio of every opening
+	Nozzle            float64        // FDM nozzle diameter in mm to check the openings and webs against, 0 for none
+	ResinPitch        float64        // Resin printer pixel size in mm to check them against, 0 for none
+	Panel             Panel          // Copies of the paste layer in a grid, for a panel of boards
+	MinWeb            float64        // Report the webs of plate between openings narrower than this, mm
+	PasteVolume       bool           // Print the paste volume of each component and in total
+	PasteDensity      float64        // Density of the solder paste for its weight, g/cm³
+	PreviewHTML       bool           // Also write a web page viewing the mesh in 3D
+	Heightmap         bool           // Also save the stencil's thickness at each pixel as a 16 bit PNG
+	Format            string         // Mesh file format: stl (the default when empty), 3mf, obj, ply or glb
+	Printer           string         // Resin printer profile to also write a sliced file for
+	LayerHeight       float64        // Layer height of the sliced file, mm
+	Exposure          float64        // Layer exposure of the sliced file, s; 0 for the printer's
+	BottomExposure    float64        // Bottom layer exposure, s; 0 for the printer's
+
+	// Found on the way by Convert, for the stages after
+	placements []Placement    // The components of Centroid on Side, mirrored like the paste
+	pins       []DrillHole    // The tooling holes from the drill file, mirrored like the paste
+	tile       *render.Bitmap // The pixels of the one tile being meshed; nil for the whole stencil
+}
+
+// DefaultConfig returns the settings the CLI converts with when given no
+// options. Stdout and Log are left nil, for os.Stdout and the standard
+// logger.
+func DefaultConfig() Config {
+	return Config{
+		StencilHeight:  DefaultStencilHeight,
+		WallHeight:     DefaultWallHeight,
+		WallThickness:  DefaultWallThickness,
+		DPI:            DefaultDPI,
+		MinPixels:      DefaultMinPixels,
+		Dispenser:      Dispenser{Rate: 0.5, Dot: 0.5, Height: 0.3},
+		LaserPower:     100,
+		LaserSpeed:     300,
+		LaserPasses:    1,
+		PaneWeb:        0.3,
+		Side:           SideTop,
+		LabelSize:      3,
+		BoardThickness: 1.6,
+		PinFit:         0.1,
+		SqueegeeSize:   Squeegee{Handle: 25, Angle: 45},
+		Origin:         "corner",
+		Tiles:          Tiling{Joint: "dovetail", JointSize: 4, JointGap: 0.1},
+		Scale:          1,
+		PasteDensity:   DefaultPasteDensity,
+		Format:         "stl",
+		LayerHeight:    0.05,
+	}
+}
+
+// withWriters returns cfg with os.Stdout and the standard logger in place of
+// the writers it leaves nil.
+func (cfg Config) withWriters() Config {
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Log == nil {
+		cfg.Log = log.Default()
+	}
+	if cfg.MeshOut == nil {
+		cfg.MeshOut = os.Stdout
+	}
+	return cfg
+}
+
+// Check reports the first setting that can't make a stencil: a plate or
+// wall that isn't positive, a negative DPI, or a size or count that is
+// negative or not a number.
+func (cfg Config) Check() error {
+	positive := []struct {
+		name string
+		v    float64
+	}{
+		{"height", cfg.StencilHeight},
+		{"wall height", cfg.WallHeight},
+		{"wall thickness", cfg.WallThickness},
+	}
+	for _, p := range positive {
+		if !(p.v > 0) || math.IsInf(p.v, 0) {
+			return fmt.Errorf("the %s must be a positive number of mm, not %g", p.name, p.v)
+		}
+	}
+	if !(cfg.DPI >= 0) || math.IsInf(cfg.DPI, 0) {
+		return fmt.Errorf("the DPI must be positive, or 0 to pick it from the smallest aperture, not %g", cfg.DPI)
+	}
+	if cfg.DPI == 0 && !(cfg.MinPixels > 0) {
+		return fmt.Errorf("with DPI 0 the pixels across the smallest aperture must be positive, not %g", cfg.MinPixels)
+	}
+	sizes := []struct {
+		name string
+		v    float64
+	}{
+		{"clearance", cfg.Clearance},
+		{"kerf", cfg.Kerf},
+		{"pixel pitch", cfg.PixelPitch},
+		{"home plate pitch", cfg.HomePlate},
+		{"window pane area", cfg.WindowPane},
+		{"nozzle", cfg.Nozzle},
+		{"resin pitch", cfg.ResinPitch},
+		{"minimum web", cfg.MinWeb},
+		{"chamfer", cfg.Chamfer},
+		{"fillet", cfg.Fillet},
+	}
+	for _, s := range sizes {
+		if !(s.v >= 0) || math.IsInf(s.v, 0) {
+			return fmt.Errorf("the %s can't be %g", s.name, s.v)
+		}
+	}
+	if math.IsNaN(cfg.ZOffset) || math.IsInf(cfg.ZOffset, 0) {
+		return fmt.Errorf("the Z offset can't be %g", cfg.ZOffset)
+	}
+	if cfg.Supersample < 0 {
+		return fmt.Errorf("the supersampling factor can't be %d", cfg.Supersample)
+	}
+	if cfg.WindowPane > 0 && !(cfg.PaneWeb > 0) {
+		return fmt.Errorf("window panes need a positive web width, not %g", cfg.PaneWeb)
+	}
+	if cfg.Label != "" && !(cfg.LabelSize > 0) {
+		return fmt.Errorf("the label size must be positive, not %g", cfg.LabelSize)
+	}
+	if cfg.PasteVolume && !(cfg.PasteDensity > 0) {
+		return fmt.Errorf("the paste density must be positive, not %g", cfg.PasteDensity)
+	}
+	if cfg.GCode && (!(cfg.LaserSpeed > 0) || cfg.LaserPasses < 1) {
+		return fmt.Errorf("the laser G-code needs a positive speed and at least one pass")
+	}
+	if cfg.Printer != "" && !(cfg.LayerHeight > 0) {
+		return fmt.Errorf("the layer height must be positive, not %g", cfg.LayerHeight)
+	}
+	if cfg.AlignPins && !(cfg.PinFit >= 0) {
+		return fmt.Errorf("the pin fit can't be %g", cfg.PinFit)
+	}
+	return nil
+}
+
+// Default values
+const (
+	DefaultStencilHeight = 0.16
+	DefaultWallHeight    = 2.0
+	DefaultWallThickness = 1.0
+	DefaultDPI           = 1000.0
+	DefaultMinPixels     = 10.0
+)
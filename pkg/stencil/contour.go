@@ -0,0 +1,734 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// The contour mesher traces the boundaries of the solid regions of the
+// rendered image, straightens their pixel steps, triangulates the top and
+// bottom faces and extrudes smooth side walls along the boundaries, instead
+// of stacking one box per run of pixels.
+
+// contourTolerance is how far in pixels a simplified contour may stray from
+// the traced one by default. Contours of diagonally touching regions are
+// 0.7 px apart, so staying under half of that keeps neighbouring contours
+// from crossing.
+const contourTolerance = 0.3
+
+// traceContours returns the boundaries of the solid pixels of a w x h mask
+// in pixel units, as closed loops through the midpoints of the pixel edges
+// (the contours marching squares finds). Loops run counter-clockwise around
+// solid regions and clockwise around holes. Diagonally touching solid pixels
+// belong to the same region.
+func traceContours(w, h int, solid func(x, y int) bool, onRow func(y int)) [][]vec2 {
+	at := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < w && y < h && solid(x, y)
+	}
+
+	// Boundary edges leaving each pixel corner, one bit per direction, with
+	// the solid side on the left
+	dirs := [4][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	vw := w + 1
+	out := make([]uint8, vw*(h+1))
+	for y := 0; y < h; y++ {
+		onRow(y)
+		for x := 0; x < w; x++ {
+			if !solid(x, y) {
+				continue
+			}
+			if !at(x, y-1) {
+				out[y*vw+x] |= 1 << 0
+			}
+			if !at(x+1, y) {
+				out[y*vw+x+1] |= 1 << 1
+			}
+			if !at(x, y+1) {
+				out[(y+1)*vw+x+1] |= 1 << 2
+			}
+			if !at(x-1, y) {
+				out[(y+1)*vw+x] |= 1 << 3
+			}
+		}
+	}
+
+	var loops [][]vec2
+	for start := range out {
+		for out[start] != 0 {
+			d0 := bits.TrailingZeros8(out[start])
+			v, d := start, d0
+			var loop []vec2
+			for {
+				out[v] &^= 1 << d
+				x, y := v%vw, v/vw
+				loop = append(loop, vec2{X: float64(x) + 0.5*float64(dirs[d][0]), Y: float64(y) + 0.5*float64(dirs[d][1])})
+				v = (y+dirs[d][1])*vw + x + dirs[d][0]
+
+				// Corners where two regions touch diagonally have two ways
+				// out; turning right keeps going around the same region
+				next := -1
+				for _, c := range [3]int{(d + 3) % 4, d, (d + 1) % 4} {
+					if v == start && c == d0 {
+						break
+					}
+					if out[v]&(1<<c) != 0 {
+						next = c
+						break
+					}
+				}
+				if next < 0 {
+					break
+				}
+				d = next
+			}
+			loops = append(loops, loop)
+		}
+	}
+	return loops
+}
+
+// segmentDist returns the distance from p to the segment a-b.
+func segmentDist(p, a, b vec2) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/l))
+	}
+	return math.Hypot(p.X-a.X-t*dx, p.Y-a.Y-t*dy)
+}
+
+// simplifyLoop drops the points of a closed loop that a straight line
+// between the remaining ones passes within tol of (Douglas-Peucker).
+func simplifyLoop(pts []vec2, tol float64) []vec2 {
+	n := len(pts)
+	if n <= 4 {
+		return pts
+	}
+	// Split the loop at the point farthest from the first one
+	far, best := 0, 0.0
+	for i, p := range pts {
+		if d := math.Hypot(p.X-pts[0].X, p.Y-pts[0].Y); d > best {
+			far, best = i, d
+		}
+	}
+	keep := make([]bool, n)
+	keep[0], keep[far] = true, true
+
+	type span struct{ i, j int } // Indices mod n, j > i
+	stack := []span{{0, far}, {far, n}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := pts[s.i], pts[s.j%n]
+		idx, dmax := -1, tol
+		for k := s.i + 1; k < s.j; k++ {
+			if d := segmentDist(pts[k], a, b); d > dmax {
+				idx, dmax = k, d
+			}
+		}
+		if idx >= 0 {
+			keep[idx] = true
+			stack = append(stack, span{s.i, idx}, span{idx, s.j})
+		}
+	}
+
+	var out []vec2
+	for i, p := range pts {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// pointInPolygon reports whether p is inside pts by the even-odd rule.
+func pointInPolygon(p vec2, pts []vec2) bool {
+	in := false
+	for i, a := range pts {
+		b := pts[(i+1)%len(pts)]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < a.X+(p.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// contourPolygon is an outer contour with the holes directly inside it.
+type contourPolygon struct {
+	outer []vec2
+	holes [][]vec2
+	box   gerber.Bounds
+	area  float64
+}
+
+// nestContours groups counter-clockwise outer loops with the clockwise holes
+// they directly contain.
+func nestContours(loops [][]vec2) []*contourPolygon {
+	var polys []*contourPolygon
+	var holes [][]vec2
+	for _, l := range loops {
+		if a := gerber.SignedArea(l); a > 0 {
+			polys = append(polys, &contourPolygon{outer: l, box: gerber.PolyBounds(l), area: a})
+		} else {
+			holes = append(holes, l)
+		}
+	}
+	// The smallest outer loop around a hole is the one it belongs to
+	sort.Slice(polys, func(i, j int) bool { return polys[i].area < polys[j].area })
+	for _, h := range holes {
+		hb := gerber.PolyBounds(h)
+		for _, p := range polys {
+			if p.box.MinX <= hb.MinX && hb.MaxX <= p.box.MaxX && p.box.MinY <= hb.MinY && hb.MaxY <= p.box.MaxY &&
+				pointInPolygon(h[0], p.outer) {
+				p.holes = append(p.holes, h)
+				break
+			}
+		}
+	}
+	return polys
+}
+
+// contourLoop is a closed loop of points, with the boundary edge each edge
+// (from each point to the next) lies on, or -1 for edges that run along a
+// tile cut instead of a region's boundary.
+type contourLoop struct {
+	pts  []vec2
+	edge []int
+}
+
+// splitLoops cuts loops along the vertical line x = c into the parts left
+// and right of it, closing each part along the line. Both sides share the
+// points where loops cross the line.
+func splitLoops(loops []contourLoop, c float64) (left, right []contourLoop) {
+	// A chain is the part of a loop between two crossings, on one side
+	type chain struct {
+		pts        []vec2
+		edge       []int
+		start, end int
+	}
+	type crossing struct {
+		p     vec2
+		chain [2]int // Chain starting here on each side
+	}
+	var xs []crossing
+	var chains [2][]chain
+
+	for _, l := range loops {
+		n := len(l.pts)
+		side := func(i int) int {
+			if l.pts[i%n].X >= c {
+				return 1
+			}
+			return 0
+		}
+		first := -1
+		for i := 0; i < n && first < 0; i++ {
+			if side(i) != side(i+1) {
+				first = i
+			}
+		}
+		if first < 0 {
+			if side(0) == 0 {
+				left = append(left, l)
+			} else {
+				right = append(right, l)
+			}
+			continue
+		}
+
+		end := func(ch chain, id, s int) {
+			ch.pts = append(ch.pts, xs[id].p)
+			ch.end = id
+			xs[ch.start].chain[s] = len(chains[s])
+			chains[s] = append(chains[s], ch)
+		}
+		var cur chain
+		first0 := len(xs)
+		for k := 0; k < n; k++ {
+			i := (first + k) % n
+			a, b := l.pts[i], l.pts[(i+1)%n]
+			if side(i) == side(i+1) {
+				cur.pts = append(cur.pts, b)
+				cur.edge = append(cur.edge, l.edge[i])
+				continue
+			}
+			// Interpolate from the left end so both directions agree
+			if a.X > b.X {
+				a, b = b, a
+			}
+			id := len(xs)
+			xs = append(xs, crossing{p: vec2{X: c, Y: a.Y + (c-a.X)*(b.Y-a.Y)/(b.X-a.X)}, chain: [2]int{-1, -1}})
+			if k > 0 {
+				cur.edge = append(cur.edge, l.edge[i])
+				end(cur, id, side(i))
+			}
+			cur = chain{pts: []vec2{xs[id].p, l.pts[(i+1)%n]}, edge: []int{l.edge[i]}, start: id}
+		}
+		cur.edge = append(cur.edge, l.edge[first])
+		end(cur, first0, side(first))
+	}
+
+	// Crossings sorted along the line alternate between the bottom and top
+	// of a stretch of the line inside a region. Left parts run up the line
+	// from a bottom to the next top, right parts down from a top.
+	order := make([]int, len(xs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return xs[order[i]].p.Y < xs[order[j]].p.Y })
+	rank := make([]int, len(xs))
+	for r, id := range order {
+		rank[id] = r
+	}
+	for s, step := range [2]int{1, -1} {
+		used := make([]bool, len(chains[s]))
+		for j := range chains[s] {
+			var out contourLoop
+			for !used[j] {
+				used[j] = true
+				ch := chains[s][j]
+				out.pts = append(out.pts, ch.pts...)
+				out.edge = append(out.edge, ch.edge...)
+				out.edge = append(out.edge, -1)
+				r := rank[ch.end] + step
+				if r < 0 || r >= len(order) || xs[order[r]].chain[s] < 0 {
+					break // Only when crossings coincide; drops the piece
+				}
+				j = xs[order[r]].chain[s]
+			}
+			if len(out.pts) >= 3 {
+				if s == 0 {
+					left = append(left, out)
+				} else {
+					right = append(right, out)
+				}
+			}
+		}
+	}
+	return left, right
+}
+
+// rotateLoops turns loops a quarter turn clockwise (ccw false) or
+// counter-clockwise, which keeps their orientation.
+func rotateLoops(loops []contourLoop, ccw bool) {
+	for _, l := range loops {
+		for i, p := range l.pts {
+			if ccw {
+				l.pts[i] = vec2{X: -p.Y, Y: p.X}
+			} else {
+				l.pts[i] = vec2{X: p.Y, Y: -p.X}
+			}
+		}
+	}
+}
+
+// contourTileVertices is roughly how many contour points go in a tile. Holes
+// are bridged into one ring per polygon and ear clipping slows down with the
+// ring's length, so boards with thousands of pads are cut into tiles along a
+// grid of lines that every tile next to a line is cut by, keeping the faces
+// of neighbouring tiles joined at the same points.
+const contourTileVertices = 2000
+
+// tileContours cuts loops in a w x h pixel frame into tiles of about
+// contourTileVertices points.
+func tileContours(loops []contourLoop, w, h int) [][]contourLoop {
+	n := 0
+	for _, l := range loops {
+		n += len(l.pts)
+	}
+	if n <= contourTileVertices {
+		return [][]contourLoop{loops}
+	}
+	// Cut lines sit off the half pixel grid the traced points lie on
+	size := math.Max(64, math.Sqrt(float64(w)*float64(h)*contourTileVertices/float64(n)))
+	cuts := func(extent int) []float64 {
+		var cs []float64
+		for c := size + 0.3; c < float64(extent); c += size {
+			cs = append(cs, c)
+		}
+		return cs
+	}
+	strip := func(loops []contourLoop, cs []float64) [][]contourLoop {
+		var parts [][]contourLoop
+		rest := loops
+		for _, c := range cs {
+			var part []contourLoop
+			part, rest = splitLoops(rest, c)
+			parts = append(parts, part)
+		}
+		return append(parts, rest)
+	}
+
+	var tiles [][]contourLoop
+	for _, col := range strip(loops, cuts(w)) {
+		// Horizontal lines become vertical after a clockwise turn
+		rotateLoops(col, false)
+		for _, t := range strip(col, cuts(h)) {
+			rotateLoops(t, true)
+			tiles = append(tiles, t)
+		}
+	}
+	return tiles
+}
+
+// offsetLoop moves each edge of a loop d to its left, keeping it parallel to
+// the original. Edges that would turn around, as short edges across convex
+// corners do when moved inwards, shrink to a point where the moved edges on
+// either side meet, so the result has a point for every point of the loop.
+// Miters at sharp corners are held to three times d. It returns nil when too
+// little of the loop is left.
+func offsetLoop(pts []vec2, d float64) []vec2 {
+	n := len(pts)
+	type line struct{ p, t vec2 } // Moved start and unit direction
+	lines := make([]line, n)
+	for i, a := range pts {
+		b := pts[(i+1)%n]
+		l := math.Hypot(b.X-a.X, b.Y-a.Y)
+		t := vec2{X: (b.X - a.X) / l, Y: (b.Y - a.Y) / l}
+		lines[i] = line{vec2{X: a.X - t.Y*d, Y: a.Y + t.X*d}, t}
+	}
+	// join is where moved edge i meets the next remaining edge j, which
+	// starts at point j of the loop
+	join := func(i, j int) vec2 {
+		li, lj := lines[i], lines[j]
+		q := lj.p
+		if cross := li.t.X*lj.t.Y - li.t.Y*lj.t.X; math.Abs(cross) > 1e-9 {
+			s := ((lj.p.X-li.p.X)*lj.t.Y - (lj.p.Y-li.p.Y)*lj.t.X) / cross
+			q = vec2{X: li.p.X + li.t.X*s, Y: li.p.Y + li.t.Y*s}
+		}
+		v := pts[j]
+		if l := math.Hypot(q.X-v.X, q.Y-v.Y); l > 3*d {
+			q = vec2{X: v.X + (q.X-v.X)*3*d/l, Y: v.Y + (q.Y-v.Y)*3*d/l}
+		}
+		return q
+	}
+
+	live := make([]int, n)
+	for i := range live {
+		live[i] = i
+	}
+	for {
+		// Neighbours of a dropped edge are checked again next round
+		m := len(live)
+		dead := make([]bool, m)
+		var kept []int
+		for k, i := range live {
+			a, b := join(live[(k+m-1)%m], i), join(i, live[(k+1)%m])
+			if (b.X-a.X)*lines[i].t.X+(b.Y-a.Y)*lines[i].t.Y <= 0 && !(k > 0 && dead[k-1]) && !(k == m-1 && dead[0]) {
+				dead[k] = true
+				continue
+			}
+			kept = append(kept, i)
+		}
+		if len(kept) == m {
+			break
+		}
+		if live = kept; len(live) < 3 {
+			return nil
+		}
+	}
+
+	out := make([]vec2, n)
+	m := len(live)
+	for k, i := range live {
+		prev := live[(k+m-1)%m]
+		q := join(prev, i)
+		// Points of edges that shrank away, between prev and i, all go here
+		for j := (prev + 1) % n; ; j = (j + 1) % n {
+			out[j] = q
+			if j == i {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// setBackLoops returns copies of loops with their edges moved d pixels into
+// the solid, which widens the openings. The loops around the plate itself
+// (outer loops not inside an opening) keep their place, as do islands too
+// small to shrink by d.
+func setBackLoops(loops []contourLoop, d float64) []contourLoop {
+	boxes := make([]gerber.Bounds, len(loops))
+	var holes []int
+	for i, l := range loops {
+		boxes[i] = gerber.PolyBounds(l.pts)
+		if gerber.SignedArea(l.pts) < 0 {
+			holes = append(holes, i)
+		}
+	}
+	inOpening := func(i int) bool {
+		b := boxes[i]
+		for _, h := range holes {
+			hb := boxes[h]
+			if hb.MinX <= b.MinX && b.MaxX <= hb.MaxX && hb.MinY <= b.MinY && b.MaxY <= hb.MaxY &&
+				pointInPolygon(loops[i].pts[0], loops[h].pts) {
+				return true
+			}
+		}
+		return false
+	}
+
+	out := make([]contourLoop, len(loops))
+	for i, l := range loops {
+		out[i] = contourLoop{pts: slices.Clone(l.pts), edge: l.edge}
+		area := gerber.SignedArea(l.pts)
+		if area > 0 && !inOpening(i) {
+			continue
+		}
+		if moved := offsetLoop(l.pts, d); moved != nil && gerber.SignedArea(moved)*area > 0 {
+			out[i].pts = moved
+		}
+	}
+	return out
+}
+
+// edgeChain orders the ends of an edge and the points tiles split it at by
+// how far along the edge they lie, dropping repeats.
+func edgeChain(a, b vec2, mid []vec2) ([]vec2, []float64) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	along := func(p vec2) float64 { return ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / (dx*dx + dy*dy) }
+	sort.Slice(mid, func(i, j int) bool { return along(mid[i]) < along(mid[j]) })
+	pts, ts := []vec2{a}, []float64{0}
+	for _, p := range mid {
+		if p != pts[len(pts)-1] {
+			pts, ts = append(pts, p), append(ts, along(p))
+		}
+	}
+	return append(pts, b), append(ts, 1)
+}
+
+// wallStrip joins the chain of points along an edge at z0 to the one along
+// the same edge at z1 with triangles facing right of the edge.
+func wallStrip(triangles [][3]Point, lo, hi []vec2, tlo, thi []float64, z0, z1 float64) [][3]Point {
+	i, j := 0, 0
+	for i < len(lo)-1 || j < len(hi)-1 {
+		a0, a1 := Point{X: lo[i].X, Y: lo[i].Y, Z: z0}, Point{X: hi[j].X, Y: hi[j].Y, Z: z1}
+		if j == len(hi)-1 || (i < len(lo)-1 && tlo[i+1] <= thi[j+1]) {
+			// Edges shrunk to a point by a setback leave out their triangle
+			if i++; lo[i] != lo[i-1] {
+				triangles = append(triangles, [3]Point{a0, {X: lo[i].X, Y: lo[i].Y, Z: z0}, a1})
+			}
+		} else if j++; hi[j] != hi[j-1] {
+			triangles = append(triangles, [3]Point{a0, {X: hi[j].X, Y: hi[j].Y, Z: z1}, a1})
+		}
+	}
+	return triangles
+}
+
+// extrudeLoops adds a layer of solid from z0 up to the last of steps,
+// bounded by loops (in pixels of pixelToMM mm, solid on their left, within a
+// width x height frame). The walls of openings and islands pass through each
+// step, set back into the solid by its distance; loops around everything
+// else go straight up. Faces of the bottom and top are tiled separately when
+// they differ, and the walls pick up the points either one splits an edge
+// at, so the layer is closed.
+func extrudeLoops(triangles [][3]Point, traced [][]vec2, steps []wallStep, z0 float64, width, height int, pixelToMM float64) [][3]Point {
+	var loops []contourLoop
+	edges := 0
+	for _, l := range traced {
+		ids := make([]int, len(l))
+		for i := range ids {
+			ids[i] = edges + i
+		}
+		edges += len(l)
+		loops = append(loops, contourLoop{pts: slices.Clone(l), edge: ids})
+	}
+	zBottom, zTop := z0+steps[0].z, z0+steps[len(steps)-1].z
+
+	// Each edge's ends in mm, taken before tiling scales the loops
+	ends := func(loops []contourLoop) [][2]vec2 {
+		out := make([][2]vec2, edges)
+		for _, l := range loops {
+			for i, e := range l.edge {
+				a, b := l.pts[i], l.pts[(i+1)%len(l.pts)]
+				out[e] = [2]vec2{{X: a.X * pixelToMM, Y: a.Y * pixelToMM}, {X: b.X * pixelToMM, Y: b.Y * pixelToMM}}
+			}
+		}
+		return out
+	}
+	// faces triangulates the tiles of loops at the top, the bottom or both,
+	// and returns the points the tiles split each edge at
+	faces := func(loops []contourLoop, top, bottom bool) [][]vec2 {
+		splits := make([][]vec2, edges)
+		for _, tile := range tileContours(loops, width, height) {
+			rings := make([][]vec2, len(tile))
+			for i, l := range tile {
+				for j, p := range l.pts {
+					l.pts[j] = vec2{X: p.X * pixelToMM, Y: p.Y * pixelToMM}
+				}
+				rings[i] = l.pts
+			}
+			for _, p := range nestContours(rings) {
+				for _, t := range earcut(p.outer, p.holes) {
+					a, b, c := t[0], t[1], t[2]
+					if top {
+						triangles = append(triangles, [3]Point{{X: a.X, Y: a.Y, Z: zTop}, {X: b.X, Y: b.Y, Z: zTop}, {X: c.X, Y: c.Y, Z: zTop}})
+					}
+					if bottom {
+						triangles = append(triangles, [3]Point{{X: a.X, Y: a.Y, Z: zBottom}, {X: c.X, Y: c.Y, Z: zBottom}, {X: b.X, Y: b.Y, Z: zBottom}})
+					}
+				}
+			}
+			for _, l := range tile {
+				n := len(l.pts)
+				for i, e := range l.edge {
+					if e >= 0 && l.edge[(i+1)%n] < 0 {
+						splits[e] = append(splits[e], l.pts[(i+1)%n])
+					}
+					if e >= 0 && l.edge[(i+n-1)%n] < 0 {
+						splits[e] = append(splits[e], l.pts[i])
+					}
+				}
+			}
+		}
+		return splits
+	}
+
+	// Rings of loops up the layer; only the bottom and top ones get faces
+	rings := make([][]contourLoop, len(steps))
+	ringEnds := make([][][2]vec2, len(steps))
+	for i, s := range steps {
+		rings[i] = loops
+		if s.d > 0 {
+			rings[i] = setBackLoops(loops, s.d/pixelToMM)
+		}
+		ringEnds[i] = ends(rings[i])
+	}
+	last := len(steps) - 1
+	splits := make([][][]vec2, len(steps))
+	if last == 1 && steps[0].d == 0 {
+		splits[0] = faces(loops, true, true)
+		splits[1] = splits[0]
+	} else {
+		splits[0] = faces(rings[0], false, true)
+		splits[last] = faces(rings[last], true, false)
+	}
+	chain := func(i, e int) ([]vec2, []float64) {
+		var mid []vec2
+		if splits[i] != nil {
+			mid = splits[i][e]
+		}
+		return edgeChain(ringEnds[i][e][0], ringEnds[i][e][1], mid)
+	}
+
+	// Side walls face right of each loop, away from the solid
+	for i := 0; i < last; i++ {
+		for e := 0; e < edges; e++ {
+			lo, tlo := chain(i, e)
+			hi, thi := chain(i+1, e)
+			triangles = wallStrip(triangles, lo, hi, tlo, thi, z0+steps[i].z, z0+steps[i+1].z)
+		}
+	}
+	return triangles
+}
+
+// filletSteps is how many wall bands go round a fillet's quarter circle.
+const filletSteps = 4
+
+// wallStep is a height above the squeegee side of the plate, in mm, and
+// how far the walls of openings are set back into the solid there.
+type wallStep struct{ z, d float64 }
+
+// openingProfile returns the steps up the walls of openings through a plate
+// thick mm thick for the taper, chamfer and fillet options, ending at the
+// board side with no setback. It is nil for straight walls.
+func openingProfile(cfg Config, thick float64) []wallStep {
+	taper := math.Tan(cfg.WallTaper * math.Pi / 180)
+	rim := math.Max(cfg.Chamfer, cfg.Fillet)
+	if taper == 0 && rim == 0 {
+		return nil
+	}
+	if rim > thick/2 {
+		cfg.Log.Printf("Warning: a %.3f mm rim is more than half the plate, using %.3f mm", rim, thick/2)
+		rim = thick / 2
+	}
+
+	zs := []float64{0}
+	setback := func(z float64) float64 { return 0 }
+	switch {
+	case cfg.Chamfer > 0:
+		zs = append(zs, rim)
+		setback = func(z float64) float64 { return math.Max(rim-z, 0) }
+	case cfg.Fillet > 0:
+		for i := 1; i <= filletSteps; i++ {
+			zs = append(zs, rim*(1-math.Cos(float64(i)*math.Pi/2/filletSteps)))
+		}
+		setback = func(z float64) float64 {
+			if z >= rim {
+				return 0
+			}
+			return rim - math.Sqrt(rim*rim-(rim-z)*(rim-z))
+		}
+	}
+	var steps []wallStep
+	for _, z := range append(zs, thick) {
+		steps = append(steps, wallStep{z, taper*(thick-z) + setback(z)})
+	}
+	return steps
+}
+
+// GenerateContourMesh meshes the stencil from the contours of the rendered
+// image, with the same heights, wall and frame as GenerateMeshFromImages.
+// Each pair of neighbouring heights bounds a layer, extruded over the pixels
+// whose solid spans it. A wall taper, chamfer or fillet
+// shapes the walls of the openings through the plate towards the bottom,
+// which is the squeegee side once the stencil is turned over onto the board.
+func GenerateContourMesh(stencilImg, outlineImg image.Image, cfg Config) [][3]Point {
+	pixelToMM := 25.4 / cfg.DPI
+	bounds := stencilImg.Bounds()
+	width := bounds.Max.X
+	height := bounds.Max.Y
+	l := heightLevels(stencilImg, outlineImg, cfg)
+	column, columns, z := l.Column, l.Columns, l.Heights
+
+	tolerance := contourTolerance
+	if cfg.Simplify > 0 {
+		tolerance = cfg.Simplify / 1000 / pixelToMM
+		fmt.Fprintf(cfg.Stdout, "Simplifying contours to %.1f µm (%.2f px)\n", cfg.Simplify, tolerance)
+		if tolerance > 0.35 {
+			cfg.Log.Printf("Warning: at more than %.1f µm, walls of openings closer than twice the tolerance may cross", 0.35*pixelToMM*1000)
+		}
+	}
+	var profile []wallStep
+	if len(z) > 1 {
+		profile = openingProfile(cfg, z[1])
+	}
+	if profile != nil {
+		fmt.Fprintf(cfg.Stdout, "Shaping aperture walls, %.1f µm wider on the squeegee side\n", profile[0].d*1000)
+	}
+
+	var triangles [][3]Point
+	contours := 0
+	for k := 0; k+1 < len(z); k++ {
+		z0, z1 := z[k], z[k+1]
+		solid := func(x, y int) bool {
+			c := column[y*width+x]
+			return c > 0 && columns[c-1][0] <= k && columns[c-1][1] > k
+		}
+		onRow := func(y int) { cfg.Progress.Report("Meshing", k*height+y, (len(z)-1)*height) }
+
+		var loops [][]vec2
+		for _, l := range traceContours(width, height, solid, onRow) {
+			if l = dropCollinear(simplifyLoop(l, tolerance)); len(l) >= 3 {
+				loops = append(loops, l)
+			}
+		}
+		contours += len(loops)
+
+		steps := []wallStep{{0, 0}, {z1 - z0, 0}}
+		if k == 0 && profile != nil {
+			steps = profile
+		}
+		triangles = extrudeLoops(triangles, loops, steps, z0, width, height, pixelToMM)
+	}
+	cfg.Progress.Report("Meshing", 1, 1)
+	fmt.Fprintf(cfg.Stdout, "Traced %d contours\n", contours)
+	return triangles
+}
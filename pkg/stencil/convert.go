@@ -0,0 +1,1816 @@
+// Package stencil converts solder paste layers into meshes of printable
+// stencils, with the jigs, cut files and reports that go with them.
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"iter"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/mesh"
+	"pcb-to-stencil/pkg/render"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// --- STL Helpers ---
+
+// Point and vec2 are short for the mesh and polygon points, which most of
+// the files here go through.
+type (
+	Point = stl.Point
+	vec2  = gerber.Vec2
+)
+
+// placeMesh moves the mesh so that its bottom is at cfg.ZOffset and, with
+// cfg.Origin center, the middle of its extent in X and Y is at the origin,
+// or with gerber, the point origin. It returns how far it moved it.
+func placeMesh(triangles [][3]Point, cfg Config, origin Point) Point {
+	if len(triangles) == 0 {
+		return Point{}
+	}
+	d := meshShift(measureMesh(slices.Values(triangles)), cfg, origin)
+	if d == (Point{}) {
+		return d
+	}
+	for i := range triangles {
+		for j := range triangles[i] {
+			p := &triangles[i][j]
+			p.X, p.Y, p.Z = p.X+d.X, p.Y+d.Y, p.Z+d.Z
+		}
+	}
+	return d
+}
+
+// meshShift is how far placeMesh moves a mesh of extent e.
+func meshShift(e meshExtent, cfg Config, origin Point) Point {
+	d := Point{Z: cfg.ZOffset - e.lo.Z}
+	switch cfg.Origin {
+	case "center":
+		d.X, d.Y = -(e.lo.X+e.hi.X)/2, -(e.lo.Y+e.hi.Y)/2
+	case "gerber":
+		d.X, d.Y = -origin.X, -origin.Y
+	}
+	return d
+}
+
+// meshUnits are the -units presets, in units per mm.
+var meshUnits = map[string]float64{
+	"mm":  1,
+	"cm":  0.1,
+	"m":   0.001,
+	"um":  1000,
+	"in":  1 / 25.4,
+	"mil": 1000 / 25.4,
+}
+
+// ParseMeshScale returns the mesh file's units per mm from -stl-scale and
+// -units, of which only one may be set.
+func ParseMeshScale(scale float64, units string) (float64, error) {
+	if units == "" {
+		if scale <= 0 {
+			return 0, fmt.Errorf("invalid -stl-scale %g: must be positive", scale)
+		}
+		return scale, nil
+	}
+	if scale != 1 {
+		return 0, fmt.Errorf("give -stl-scale or -units, not both")
+	}
+	s, ok := meshUnits[strings.ToLower(units)]
+	if !ok {
+		return 0, fmt.Errorf("unknown units %q, want mm, cm, m, um, in or mil", units)
+	}
+	return s, nil
+}
+
+// gerberOrigin returns where the origin of the gerber coordinates is in the
+// mesh of the paste layer gf and outlinePath, before placeMesh moves it. The
+// mesh's Y runs the other way, since it lies squeegee side down.
+func gerberOrigin(gf *gerber.File, outlinePath string, cfg Config) (Point, error) {
+	frame := gf.CalculateBounds()
+	if outlinePath != "" {
+		outlineGf, err := gerber.ParseMirrored(outlinePath, cfg.Mirror)
+		if err != nil {
+			return Point{}, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+		frame = frame.Union(outlineGf.CalculateBounds())
+	}
+	margin := frameMargin(cfg)
+	return Point{X: margin - frame.MinX, Y: frame.MaxY + margin}, nil
+}
+
+// imageCoords returns a function turning pixel positions in the rendered
+// image of the paste layer gf into board coordinates in mm, unmirrored, or
+// with a nil gf, for inputs without them, into mm from the image's top left
+// corner.
+func imageCoords(gf *gerber.File, outlinePath string, cfg Config) (func(px, py float64) (float64, float64), error) {
+	pixelToMM := 25.4 / cfg.DPI
+	if gf == nil {
+		return func(px, py float64) (float64, float64) { return px * pixelToMM, py * pixelToMM }, nil
+	}
+	origin, err := gerberOrigin(gf, outlinePath, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(px, py float64) (float64, float64) {
+		return gerber.MirrorPoint(px*pixelToMM-origin.X, origin.Y-py*pixelToMM, cfg.Mirror)
+	}, nil
+}
+
+// fileMesh returns triangles in the units and axes of the mesh file: a copy
+// scaled by cfg.Scale about the origin and, with cfg.YUp, turned so that Z
+// is Y, or triangles itself when neither applies.
+func fileMesh(triangles [][3]Point, cfg Config) [][3]Point {
+	s := cfg.Scale
+	if s == 0 {
+		s = 1
+	}
+	if s == 1 && !cfg.YUp {
+		return triangles
+	}
+	out := make([][3]Point, len(triangles))
+	for i, t := range triangles {
+		out[i] = fileTriangle(t, s, cfg.YUp)
+	}
+	return out
+}
+
+// fileTriangle is t in the mesh file, scaled by s and turned with yUp.
+func fileTriangle(t [3]Point, s float64, yUp bool) [3]Point {
+	for j, p := range t {
+		if yUp {
+			// A quarter turn about X keeps the winding
+			p = Point{X: p.X, Y: p.Z, Z: -p.Y}
+		}
+		t[j] = Point{X: p.X * s, Y: p.Y * s, Z: p.Z * s}
+	}
+	return t
+}
+
+// --- Meshing Logic (Optimized) ---
+
+// ComputeWallMask generates a mask for the wall based on the outline image.
+// It identifies the board area (inside the outline, without the cutouts
+// drawn inside it), grows it by clearanceMM so the board drops in, and
+// creates a wall of specified thickness around it.
+func ComputeWallMask(img image.Image, thicknessMM, clearanceMM float64, pixelToMM float64) ([]bool, []bool) {
+	bounds := img.Bounds()
+	w := bounds.Max.X
+	h := bounds.Max.Y
+	size := w * h
+
+	// Helper for neighbors
+	dx := []int{0, 0, 1, -1}
+	dy := []int{1, -1, 0, 0}
+
+	// 1. Identify Outline Pixels (White)
+	isOutline := make([]bool, size)
+	outlineQueue := []int{}
+	for i := 0; i < size; i++ {
+		cx := i % w
+		cy := i / w
+		if render.IsOpen(img, cx, cy) { // White-ish
+			isOutline[i] = true
+			outlineQueue = append(outlineQueue, i)
+		}
+	}
+
+	// 2. Dilate Outline to close gaps
+	// We dilate by a small amount (e.g. 0.5mm) to ensure the outline is closed.
+	gapClosingMM := 0.5
+	gapClosingPixels := int(gapClosingMM / pixelToMM)
+	if gapClosingPixels < 1 {
+		gapClosingPixels = 1
+	}
+
+	dist := make([]int, size)
+	for i := 0; i < size; i++ {
+		if isOutline[i] {
+			dist[i] = 0
+		} else {
+			dist[i] = -1
+		}
+	}
+
+	// BFS for Dilation
+	dilatedOutline := make([]bool, size)
+	copy(dilatedOutline, isOutline)
+
+	// Use a separate queue for dilation to avoid modifying the original outlineQueue if we needed it
+	dQueue := make([]int, len(outlineQueue))
+	copy(dQueue, outlineQueue)
+
+	for len(dQueue) > 0 {
+		idx := dQueue[0]
+		dQueue = dQueue[1:]
+
+		d := dist[idx]
+		if d >= gapClosingPixels {
+			continue
+		}
+
+		cx := idx % w
+		cy := idx / w
+
+		for i := 0; i < 4; i++ {
+			nx, ny := cx+dx[i], cy+dy[i]
+			if nx >= 0 && nx < w && ny >= 0 && ny < h {
+				nIdx := ny*w + nx
+				if dist[nIdx] == -1 {
+					dist[nIdx] = d + 1
+					dilatedOutline[nIdx] = true
+					dQueue = append(dQueue, nIdx)
+				}
+			}
+		}
+	}
+
+	// 3. Flood Fill "Outside" using Dilated Outline as barrier
+	isOutside := make([]bool, size)
+	// Start from (0,0) - assumed to be outside due to padding
+	if !dilatedOutline[0] {
+		isOutside[0] = true
+		fQueue := []int{0}
+
+		for len(fQueue) > 0 {
+			idx := fQueue[0]
+			fQueue = fQueue[1:]
+
+			cx := idx % w
+			cy := idx / w
+
+			for i := 0; i < 4; i++ {
+				nx, ny := cx+dx[i], cy+dy[i]
+				if nx >= 0 && nx < w && ny >= 0 && ny < h {
+					nIdx := ny*w + nx
+					if !isOutside[nIdx] && !dilatedOutline[nIdx] {
+						isOutside[nIdx] = true
+						fQueue = append(fQueue, nIdx)
+					}
+				}
+			}
+		}
+	}
+
+	// 3b. Find Cutouts
+	// Count the outlines crossed to reach each pixel from the outside: the
+	// board is inside one, a cutout in it inside two, and so on. Pixels are
+	// visited a number of crossings at a time.
+	crossings := make([]int, size)
+	for i := range crossings {
+		crossings[i] = -1
+	}
+	isCutout := make([]bool, size)
+	if !dilatedOutline[0] {
+		crossings[0] = 0
+		level := []int{0}
+		for k := 0; len(level) > 0; k++ {
+			var next []int
+			for len(level) > 0 {
+				idx := level[0]
+				level = level[1:]
+				if crossings[idx] != k {
+					continue // Reached without crossing as many outlines
+				}
+
+				cx := idx % w
+				cy := idx / w
+
+				for i := 0; i < 4; i++ {
+					nx, ny := cx+dx[i], cy+dy[i]
+					if nx >= 0 && nx < w && ny >= 0 && ny < h {
+						nIdx := ny*w + nx
+						c := k
+						if dilatedOutline[idx] && !dilatedOutline[nIdx] {
+							c = k + 1
+						}
+						if crossings[nIdx] == -1 || crossings[nIdx] > c {
+							crossings[nIdx] = c
+							if c == k {
+								level = append(level, nIdx)
+							} else {
+								next = append(next, nIdx)
+							}
+						}
+					}
+				}
+			}
+			level = next
+		}
+		for i := 0; i < size; i++ {
+			isCutout[i] = !dilatedOutline[i] && crossings[i] >= 2 && crossings[i]%2 == 0
+		}
+	}
+
+	// 4. Restore Board Shape (Erode "Outside" back to original boundary)
+	// We dilated the outline, so "Outside" stopped 'gapClosingPixels' away from the real board edge.
+	// We need to expand "Outside" inwards by 'gapClosingPixels' to touch the real board edge.
+	// Cutouts are expanded the same way, and marked as holes so the wall
+	// and clearance don't grow into them.
+	// Then "Board" = !Outside.
+
+	// Reset dist for Outside expansion
+	for i := 0; i < size; i++ {
+		if isOutside[i] || isCutout[i] {
+			dist[i] = 0
+		} else {
+			dist[i] = -1
+		}
+	}
+
+	oQueue := []int{}
+	for i := 0; i < size; i++ {
+		if isOutside[i] || isCutout[i] {
+			oQueue = append(oQueue, i)
+		}
+	}
+
+	isOutsideExpanded := make([]bool, size)
+	isHole := make([]bool, size)
+	for i := 0; i < size; i++ {
+		isOutsideExpanded[i] = isOutside[i] || isCutout[i]
+		isHole[i] = isCutout[i]
+	}
+
+	for len(oQueue) > 0 {
+		idx := oQueue[0]
+		oQueue = oQueue[1:]
+
+		d := dist[idx]
+		if d >= gapClosingPixels {
+			continue
+		}
+
+		cx := idx % w
+		cy := idx / w
+
+		for i := 0; i < 4; i++ {
+			nx, ny := cx+dx[i], cy+dy[i]
+			if nx >= 0 && nx < w && ny >= 0 && ny < h {
+				nIdx := ny*w + nx
+				if dist[nIdx] == -1 {
+					dist[nIdx] = d + 1
+					isOutsideExpanded[nIdx] = true
+					isHole[nIdx] = isHole[idx]
+					oQueue = append(oQueue, nIdx)
+				}
+			}
+		}
+	}
+
+	// 5. Define Board
+	isBoard := make([]bool, size)
+	for i := 0; i < size; i++ {
+		isBoard[i] = !isOutsideExpanded[i]
+	}
+
+	// 5b. Leave room around the board for it to drop in
+	clearancePixels := int(math.Round(clearanceMM / pixelToMM))
+	if clearancePixels > 0 {
+		for i := 0; i < size; i++ {
+			if isBoard[i] {
+				dist[i] = 0
+			} else {
+				dist[i] = -1
+			}
+		}
+		cQueue := []int{}
+		for i := 0; i < size; i++ {
+			if isBoard[i] {
+				cQueue = append(cQueue, i)
+			}
+		}
+		for len(cQueue) > 0 {
+			idx := cQueue[0]
+			cQueue = cQueue[1:]
+
+			d := dist[idx]
+			if d >= clearancePixels {
+				continue
+			}
+
+			cx := idx % w
+			cy := idx / w
+
+			for i := 0; i < 4; i++ {
+				nx, ny := cx+dx[i], cy+dy[i]
+				if nx >= 0 && nx < w && ny >= 0 && ny < h {
+					nIdx := ny*w + nx
+					if dist[nIdx] == -1 && !isHole[nIdx] {
+						dist[nIdx] = d + 1
+						isBoard[nIdx] = true
+						cQueue = append(cQueue, nIdx)
+					}
+				}
+			}
+		}
+	}
+
+	// 6. Generate Wall
+	// Wall is generated by expanding Board outwards.
+	// We want the wall to be strictly OUTSIDE the board (or centered on outline? User said "starts at outline").
+	// If we expand Board, we get pixels outside.
+
+	thicknessPixels := int(thicknessMM / pixelToMM)
+	if thicknessPixels < 1 {
+		thicknessPixels = 1
+	}
+
+	// Reset dist for Wall generation
+	for i := 0; i < size; i++ {
+		if isBoard[i] {
+			dist[i] = 0
+		} else {
+			dist[i] = -1
+		}
+	}
+
+	wQueue := []int{}
+	for i := 0; i < size; i++ {
+		if isBoard[i] {
+			wQueue = append(wQueue, i)
+		}
+	}
+
+	isWall := make([]bool, size)
+
+	for len(wQueue) > 0 {
+		idx := wQueue[0]
+		wQueue = wQueue[1:]
+
+		d := dist[idx]
+		if d >= thicknessPixels {
+			continue
+		}
+
+		cx := idx % w
+		cy := idx / w
+
+		for i := 0; i < 4; i++ {
+			nx, ny := cx+dx[i], cy+dy[i]
+			if nx >= 0 && nx < w && ny >= 0 && ny < h {
+				nIdx := ny*w + nx
+				if dist[nIdx] == -1 && !isHole[nIdx] {
+					dist[nIdx] = d + 1
+					isWall[nIdx] = true
+					wQueue = append(wQueue, nIdx)
+				}
+			}
+		}
+	}
+
+	return isWall, isBoard
+}
+
+// pixelHeights returns where the solid at each pixel starts and ends: the
+// wall around the board outline, the plate inside it (or everywhere when
+// there is no outline) and nothing in the openings. Step zones thinner than
+// the plate start above 0, leaving the board side flat; thicker ones lower
+// the rest of the plate off 0 instead.
+func pixelHeights(stencilImg, outlineImg image.Image, cfg Config) func(x, y int) (floor, top float64) {
+	pixelToMM := 25.4 / cfg.DPI
+	width := stencilImg.Bounds().Max.X
+
+	var wallMask []bool
+	var boardMask []bool
+	if outlineImg != nil {
+		fmt.Fprintln(cfg.Stdout, "Computing wall mask...")
+		wallMask, boardMask = ComputeWallMask(outlineImg, cfg.WallThickness, cfg.Clearance, pixelToMM)
+		if cfg.Locators > 0 {
+			keepCornerLocators(wallMask, boardMask, width, int(math.Round(cfg.Locators/pixelToMM)))
+		}
+	}
+	// The board side of the plate, above the thickest zone
+	board := cfg.StencilHeight
+	for _, z := range cfg.Steps {
+		board = math.Max(board, z.Thickness)
+	}
+	var magnetAt func(x, y int) (float64, float64, bool)
+	if cfg.Magnets.Diameter > 0 {
+		size := stencilImg.Bounds().Size()
+		magnetAt = magnetHeights(cfg.Magnets, size.X, size.Y, pixelToMM, board)
+	}
+
+	return func(x, y int) (float64, float64) {
+		// Check stencil (black = solid)
+		isStencilSolid := !render.IsOpen(stencilImg, x, y)
+
+		// Check wall
+		isWall := false
+		isInsideBoard := true
+		if wallMask != nil {
+			idx := y*width + x
+			isWall = wallMask[idx]
+			if boardMask != nil {
+				isInsideBoard = boardMask[idx]
+			}
+		}
+
+		if cfg.tile != nil && !cfg.tile.Get(x, y) {
+			return 0, 0
+		}
+		if isWall {
+			return 0, board - cfg.StencilHeight + cfg.WallHeight
+		}
+		if magnetAt != nil {
+			if floor, top, ok := magnetAt(x, y); ok {
+				return floor, top
+			}
+		}
+		if isStencilSolid && isInsideBoard {
+			thick := cfg.StencilHeight
+			for _, z := range cfg.Steps {
+				if z.Mask.Get(x, y) {
+					thick = z.Thickness
+				}
+			}
+			return board - thick, board
+		}
+		return 0, 0
+	}
+}
+
+// heightLevels finds the levels of the solid of pixelHeights.
+func heightLevels(stencilImg, outlineImg image.Image, cfg Config) mesh.Levels {
+	size := stencilImg.Bounds().Size()
+	return mesh.NewLevels(size.X, size.Y, pixelHeights(stencilImg, outlineImg, cfg))
+}
+
+// GenerateMeshFromImages meshes the stencil as stepped pixel columns, a
+// closed shell of the top and bottom faces and the walls between heights.
+func GenerateMeshFromImages(stencilImg, outlineImg image.Image, cfg Config) [][3]Point {
+	m := mesh.Mesher{PixelSize: 25.4 / cfg.DPI, MaxRects: cfg.MaxRects}
+	return m.Mesh(heightLevels(stencilImg, outlineImg, cfg))
+}
+
+// --- Logic ---
+
+// Inputs lists the files that make up a single stencil conversion.
+// Only Paste is required.
+type Inputs struct {
+	Paste   string // Solder paste layer
+	Bottom  string // Bottom paste layer for a combined stencil, beside Paste
+	Outline string // Board outline layer
+	Drill   string // Excellon drill file
+	Output  string // Mesh path, with the extension of the format; derived from Paste when empty, stdout when "-"
+
+	Job        *GerberJob  // Board metadata from a Gerber job file, if any
+	Candidates []LayerInfo // Every file considered when picking layers
+}
+
+// renderGerberInputs renders the paste layer gf and the optional outline
+// gerber into images sharing the same frame. When debugPath is set the
+// paste layer is also saved there with one color per aperture.
+func renderGerberInputs(gf *gerber.File, outlinePath, debugPath string, cfg *Config) (image.Image, image.Image, error) {
+	// 1. Parse the outline
+	var outlineGf *gerber.File
+	var err error
+	if outlinePath != "" {
+		fmt.Fprintf(cfg.Stdout, "Parsing outline %s...\n", outlinePath)
+		outlineGf, err = gerber.ParseMirrored(outlinePath, cfg.Mirror)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+	}
+
+	resolveDPI(gf, cfg)
+
+	// 2. Calculate Union Bounds
+	// Both layers are rendered into the same frame so that pixel (x, y) of
+	// the paste image lines up with pixel (x, y) of the outline image.
+	bounds := gf.CalculateBounds()
+	if outlineGf != nil {
+		bounds = bounds.Union(outlineGf.CalculateBounds())
+	}
+
+	// Expand bounds to accommodate wall thickness and prevent clipping
+	margin := frameMargin(*cfg)
+	bounds.MinX -= margin
+	bounds.MinY -= margin
+	bounds.MaxX += margin
+	bounds.MaxY += margin
+
+	// 3. Render to Image(s)
+	n := supersampleFactor(gf, cfg)
+	if err := checkFrame(bounds, cfg.DPI, n); err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintln(cfg.Stdout, "Rendering to internal image...")
+	img := render.ResolveSupersampled(render.Gerber(gf, cfg.DPI*float64(n), &bounds), n, cfg.DPI, bounds)
+	if cfg.RegHoles.Diameter > 0 {
+		punchRegHoles(img, bounds, cfg.DPI, cfg.RegHoles, cfg.Stdout)
+	}
+	if len(cfg.pins) > 0 {
+		punchPinHoles(img, bounds, cfg.DPI, cfg.pins, cfg.Stdout)
+	}
+	if debugPath != "" {
+		fmt.Fprintf(cfg.Stdout, "Saving debug PNG to %s...\n", debugPath)
+		savePNG(debugPath, render.Debug(gf, cfg.DPI, bounds), cfg.Log)
+	}
+
+	var outlineImg image.Image
+	if outlineGf != nil {
+		fmt.Fprintln(cfg.Stdout, "Rendering outline to internal image...")
+		outlineImg = render.Gerber(outlineGf, cfg.DPI, &bounds)
+	}
+	if err := renderStepZones(gf, bounds, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	return img, outlineImg, nil
+}
+
+// rasterOnlyFlag returns the first option set in cfg that only the raster
+// path supports, or "" if gerbers can be meshed from their geometry.
+func rasterOnlyFlag(cfg Config) string {
+	switch {
+	case cfg.Contour:
+		return "-contour"
+	case cfg.MaxRects:
+		return "-max-rects"
+	case cfg.ShrinkX != Shrink{} || cfg.ShrinkY != Shrink{}:
+		return "-shrink"
+	case len(cfg.ShrinkByArea) > 0:
+		return "-shrink-by-area"
+	case cfg.Profile != nil:
+		return "-profile"
+	case cfg.WindowPane > 0:
+		return "-window-pane"
+	case cfg.Ratios:
+		return "-ratios"
+	case cfg.Nozzle > 0:
+		return "-nozzle"
+	case cfg.ResinPitch > 0:
+		return "-resin-pitch"
+	case cfg.MinWeb > 0:
+		return "-min-web"
+	case cfg.PasteVolume:
+		return "-paste-volume"
+	case cfg.KeepPNG:
+		return "-keep-png"
+	case cfg.Heightmap:
+		return "-heightmap"
+	case cfg.Stream:
+		return "-stream"
+	case cfg.Supersample > 1:
+		return "-supersample"
+	case cfg.Fiducials != "":
+		return "-fiducials"
+	case cfg.Label != "":
+		return "-label"
+	case cfg.Magnets.Diameter > 0:
+		return "-magnet-pockets"
+	case len(cfg.Steps) > 0:
+		return "-step"
+	case cfg.Printer != "":
+		return "-printer"
+	case cfg.Tiles.enabled():
+		return "-tiles"
+	case cfg.Dispense:
+		return "-dispense"
+	}
+	return ""
+}
+
+// vectorGerberMesh builds the stencil mesh with the vector backend, and
+// measures its openings, from the paste layer gf. It returns nil triangles
+// when the inputs need the raster path instead.
+func vectorGerberMesh(gf *gerber.File, outlinePath, debugPath string, cfg Config) ([][3]Point, openingStats, error) {
+	bounds := gf.CalculateBounds()
+
+	var board *gerber.Bounds
+	if outlinePath != "" {
+		fmt.Fprintf(cfg.Stdout, "Parsing outline %s...\n", outlinePath)
+		outlineGf, err := gerber.ParseMirrored(outlinePath, cfg.Mirror)
+		if err != nil {
+			return nil, openingStats{}, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+		rect, ok := rectangularOutline(outlineGf)
+		if !ok {
+			fmt.Fprintln(cfg.Stdout, "Vector output only supports rectangular outlines, using the raster mesher")
+			return nil, openingStats{}, nil
+		}
+		board = &rect
+		bounds = bounds.Union(outlineGf.CalculateBounds())
+	}
+
+	margin := frameMargin(cfg)
+	bounds.MinX -= margin
+	bounds.MinY -= margin
+	bounds.MaxX += margin
+	bounds.MaxY += margin
+
+	if debugPath != "" {
+		resolveDPI(gf, &cfg)
+		fmt.Fprintf(cfg.Stdout, "Saving debug PNG to %s...\n", debugPath)
+		savePNG(debugPath, render.Debug(gf, cfg.DPI, bounds), cfg.Log)
+	}
+
+	fmt.Fprintln(cfg.Stdout, "Generating vector mesh...")
+	triangles, openings := generateVectorMesh(gf, bounds, board, cfg)
+	return triangles, openings, nil
+}
+
+// exportCutLines writes the openings of the paste layer gf, parsed from
+// gerberPath, and the board outline as vector cut lines, independently of
+// how the mesh is built: an SVG, a DXF or laser G-code, by the extension of
+// path, compensated for cfg.Kerf.
+func exportCutLines(gf *gerber.File, gerberPath, outlinePath, path string, cfg Config) error {
+	frame := gf.CalculateBounds()
+	var outlineGf *gerber.File
+	var err error
+	if outlinePath != "" {
+		outlineGf, err = gerber.ParseMirrored(outlinePath, cfg.Mirror)
+		if err != nil {
+			return fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+		frame = frame.Union(outlineGf.CalculateBounds())
+	}
+	write, kind := WriteStencilSVG, "SVG"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dxf":
+		write, kind = WriteStencilDXF, "DXF"
+	case ".gcode":
+		write, kind = WriteStencilGCode, "G-code"
+	case ".scad":
+		write, kind = WriteStencilSCAD, "OpenSCAD model"
+	case ".pdf":
+		write = func(path string, paste, outline *gerber.File, frame gerber.Bounds, cfg Config) error {
+			return WriteStencilPDF(path, paste, outline, frame, filepath.Base(gerberPath), cfg)
+		}
+		kind = "PDF"
+	}
+	fmt.Fprintf(cfg.Stdout, "Saving %s to %s...\n", kind, path)
+	if err := write(path, gf, outlineGf, frame, cfg); err != nil {
+		return fmt.Errorf("error writing %s: %v", kind, err)
+	}
+	return nil
+}
+
+// resolveDPI picks the rendering resolution from the paste layer's smallest
+// aperture when cfg.DPI is 0 (auto).
+func resolveDPI(gf *gerber.File, cfg *Config) {
+	if cfg.DPI != 0 {
+		return
+	}
+	smallest := gf.SmallestAperture()
+	cfg.DPI = autoDPI(smallest, cfg.MinPixels)
+	fmt.Fprintf(cfg.Stdout, "Auto DPI: %.0f (smallest aperture %.3f mm)\n", cfg.DPI, smallest)
+}
+
+// checkFrame returns an error if rendering the frame b at dpi, supersampled
+// n times, makes an image too large to allocate, as huge coordinates in a
+// small file can.
+func checkFrame(b gerber.Bounds, dpi float64, n int) error {
+	scale := dpi / 25.4
+	w, h := (b.MaxX-b.MinX)*scale, (b.MaxY-b.MinY)*scale
+	if err := render.CheckSize(w, h); err != nil {
+		return err
+	}
+	// The supersampled render is only bits, up to MaxSupersample² as many
+	f := float64(n) / MaxSupersample
+	return render.CheckSize(w*f, h*f)
+}
+
+// supersampleFactor returns the paste layer's supersampling factor, picking
+// one from its smallest aperture unless the config fixes it. The outline is
+// always rendered at the plain DPI: it only feeds the wall mask.
+func supersampleFactor(gf *gerber.File, cfg *Config) int {
+	n := cfg.Supersample
+	if n == 0 {
+		n = autoSupersample(gf.SmallestAperture(), cfg.DPI)
+	}
+	if n > 1 {
+		fmt.Fprintf(cfg.Stdout, "Supersampling %dx\n", n)
+	}
+	return n
+}
+
+// streamGerberInputs does the same as renderGerberInputs in two passes over
+// each file, one for the bounds and one for rendering, without building the
+// command list. It returns how many apertures the paste layer has too.
+func streamGerberInputs(gerberPath, outlinePath, debugPath string, cfg *Config) (image.Image, image.Image, int, error) {
+	fmt.Fprintf(cfg.Stdout, "Scanning %s...\n", gerberPath)
+	gf, bounds, err := gerber.StreamBounds(gerberPath, cfg.Mirror, cfg.Progress)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("error parsing gerber: %v", err)
+	}
+	if outlinePath != "" {
+		fmt.Fprintf(cfg.Stdout, "Scanning outline %s...\n", outlinePath)
+		_, outlineBounds, err := gerber.StreamBounds(outlinePath, cfg.Mirror, cfg.Progress)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+		bounds = bounds.Union(outlineBounds)
+	}
+	resolveDPI(gf, cfg)
+
+	margin := frameMargin(*cfg)
+	bounds.MinX -= margin
+	bounds.MinY -= margin
+	bounds.MaxX += margin
+	bounds.MaxY += margin
+
+	n := supersampleFactor(gf, cfg)
+	if err := checkFrame(bounds, cfg.DPI, n); err != nil {
+		return nil, nil, 0, err
+	}
+	fmt.Fprintln(cfg.Stdout, "Rendering to internal image...")
+	img, err := render.StreamGerber(gerberPath, cfg.Mirror, cfg.DPI*float64(n), bounds, cfg.Progress)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("error parsing gerber: %v", err)
+	}
+	img = render.ResolveSupersampled(img, n, cfg.DPI, bounds)
+	if cfg.RegHoles.Diameter > 0 {
+		punchRegHoles(img, bounds, cfg.DPI, cfg.RegHoles, cfg.Stdout)
+	}
+	if len(cfg.pins) > 0 {
+		punchPinHoles(img, bounds, cfg.DPI, cfg.pins, cfg.Stdout)
+	}
+	if debugPath != "" {
+		fmt.Fprintf(cfg.Stdout, "Saving debug PNG to %s...\n", debugPath)
+		dbg, err := render.StreamDebug(gerberPath, cfg.DPI, bounds, cfg.Progress)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("error parsing gerber: %v", err)
+		}
+		savePNG(debugPath, dbg, cfg.Log)
+	}
+
+	var outlineImg image.Image
+	if outlinePath != "" {
+		fmt.Fprintln(cfg.Stdout, "Rendering outline to internal image...")
+		outlineImg, err = render.StreamGerber(outlinePath, cfg.Mirror, cfg.DPI, bounds, cfg.Progress)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+	}
+	if err := renderStepZones(gf, bounds, cfg); err != nil {
+		return nil, nil, 0, err
+	}
+
+	return img, outlineImg, len(gf.State.Apertures), nil
+}
+
+// savePNG writes an image for inspection. Failures only warn, to logger,
+// since the STL is still usable.
+func savePNG(path string, img image.Image, logger *log.Logger) {
+	f, err := os.Create(path)
+	if err != nil {
+		logger.Printf("Warning: Could not create PNG file: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		logger.Printf("Warning: Could not encode PNG: %v", err)
+	}
+}
+
+// Convert makes the stencil of in with cfg, writing the mesh and every other
+// file cfg asks for, and returns what it wrote.
+// conversion is the state of one Convert, passed from each of its stages to
+// the next.
+type conversion struct {
+	cfg   Config
+	res   Result
+	start time.Time
+
+	gerberPath, outlinePath string
+	outputPath              string // Mesh path, or where the files beside it go with toStdout
+	toStdout                bool
+	debugPath               string // Debug PNG path; empty for none
+	ext                     string // The paste layer's extension, lowercase
+	nonGerber               bool   // SVG, DXF and bitmap inputs are rendered already, without apertures
+	pasteGf                 *gerber.File
+	printer                 ResinPrinter
+
+	// Made by render: the image, or for the vector mesher the triangles
+	img, outlineImg image.Image
+	triangles       [][3]Point
+	openings        openingStats
+	paste           pasteVolume
+
+	// Made by generateMesh
+	vectorMesh bool
+	tiles      [][][3]Point
+	meshSeq    iter.Seq[[3]Point] // The triangles, when written as they're made
+}
+
+// Convert makes the stencil of in with cfg, writing the mesh and every other
+// file cfg asks for, and returns what it wrote.
+func Convert(in Inputs, cfg Config) (Result, error) {
+	c := &conversion{start: time.Now(), gerberPath: in.Paste, outlinePath: in.Outline}
+	c.res = Result{Input: in.Paste}
+	cfg = cfg.withWriters()
+	if err := cfg.Check(); err != nil {
+		return c.res, err
+	}
+	// Conversions may run at once on the same cfg, in a batch or the server,
+	// so the steps appended to below must not share its array
+	cfg.Steps = slices.Clip(cfg.Steps)
+	cfg.Bottom = in.Bottom
+	c.outputPath = in.Output
+	c.toStdout = c.outputPath == "-"
+	if c.outputPath == "" || c.toStdout {
+		// Files written alongside a mesh on stdout go next to the input
+		c.outputPath = strings.TrimSuffix(c.gerberPath, filepath.Ext(c.gerberPath)) + ".stl"
+	}
+	switch cfg.Format {
+	case "", "stl":
+	case "3mf", "obj", "ply", "glb":
+		if c.toStdout {
+			return c.res, fmt.Errorf("only STL can be written to stdout, not %s", cfg.Format)
+		}
+		c.outputPath = strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "." + cfg.Format
+	default:
+		return c.res, fmt.Errorf("unknown output format %q, want stl, 3mf, obj, ply or glb", cfg.Format)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.outputPath), 0755); err != nil {
+		return c.res, fmt.Errorf("error creating output directory: %v", err)
+	}
+	if cfg.DebugPNG {
+		c.debugPath = strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_debug.png"
+	}
+	c.cfg = cfg
+
+	if err := c.parse(in); err != nil {
+		return c.res, err
+	}
+	if err := c.render(); err != nil {
+		return c.res, err
+	}
+	if c.cfg.Dispense {
+		err := c.dispense()
+		return c.res, err
+	}
+	if err := c.generateMesh(); err != nil {
+		return c.res, err
+	}
+	err := c.write()
+	return c.res, err
+}
+
+// pasteLayer returns the parsed paste layer. It is parsed once, by the first
+// step that needs its commands, and the steps picking and reshaping pads
+// change it for the ones after them. -stream renders without it unless
+// something else needs it. It's nil for inputs that aren't gerbers.
+func (c *conversion) pasteLayer() (*gerber.File, error) {
+	if c.pasteGf == nil && !c.nonGerber {
+		fmt.Fprintf(c.cfg.Stdout, "Parsing %s...\n", c.gerberPath)
+		gf, err := gerber.ParseMirrored(c.gerberPath, c.cfg.Mirror)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing gerber: %v", err)
+		}
+		c.pasteGf = gf
+		c.res.Apertures = len(gf.State.Apertures)
+	}
+	return c.pasteGf, nil
+}
+
+// parse reads the drill file and printer of in, and settles the options
+// against each other and the input, changing the paste layer for those that
+// pick and reshape its pads.
+func (c *conversion) parse(in Inputs) error {
+	if in.Job != nil {
+		fmt.Fprintf(c.cfg.Stdout, "Board: %s\n", in.Job.Summary())
+	}
+
+	if c.cfg.Chamfer > 0 && c.cfg.Fillet > 0 {
+		return fmt.Errorf("-chamfer and -fillet can't be used together")
+	}
+	if c.cfg.Vector && c.cfg.Raster {
+		return fmt.Errorf("-vector and -raster can't be used together")
+	}
+
+	var drill *DrillFile
+	var err error
+	if in.Drill != "" {
+		fmt.Fprintf(c.cfg.Stdout, "Parsing drill file %s...\n", in.Drill)
+		drill, err = ParseExcellon(in.Drill)
+		if err != nil {
+			return fmt.Errorf("error parsing drill file: %v", err)
+		}
+		fmt.Fprintf(c.cfg.Stdout, "Found %d drill holes (%d plated, %d non-plated)\n",
+			len(drill.Holes), len(drill.PlatedHoles()), len(drill.MountingHoles()))
+	}
+
+	c.ext = strings.ToLower(filepath.Ext(c.gerberPath))
+	c.nonGerber = c.ext == ".svg" || c.ext == ".dxf" || isBitmapInput(c.ext)
+	if c.cfg.Printer != "" {
+		c.printer, err = findResinPrinter(c.cfg.Printer)
+		if err != nil {
+			return err
+		}
+		if !isBitmapInput(c.ext) {
+			// Render on the printer's pixel grid
+			c.cfg.DPI = 25.4 / c.printer.Pitch
+			fmt.Fprintf(c.cfg.Stdout, "Rendering at the %s's %g mm pixel pitch\n", c.printer.Model, c.printer.Pitch)
+		}
+		if c.cfg.ResinPitch == 0 {
+			c.cfg.ResinPitch = c.printer.Pitch
+		}
+	}
+	if c.cfg.DPI == 0 && c.nonGerber {
+		// Auto DPI needs gerber apertures
+		c.cfg.DPI = DefaultDPI
+	}
+	if c.cfg.Bottom != "" && c.nonGerber {
+		c.cfg.Log.Printf("Warning: a combined stencil needs gerber input, ignoring the bottom paste for %s input", c.ext)
+		c.cfg.Bottom = ""
+	} else if c.cfg.Bottom != "" {
+		fmt.Fprintf(c.cfg.Stdout, "Placing the bottom paste %s mirrored beside the top\n", c.cfg.Bottom)
+		if c.outlinePath != "" {
+			c.cfg.Log.Printf("Warning: the outline only fits one side of a combined stencil, ignoring it")
+			c.outlinePath = ""
+		}
+		if c.cfg.Stream {
+			c.cfg.Log.Printf("Warning: -stream can't combine two paste layers, rendering in memory")
+			c.cfg.Stream = false
+		}
+	}
+	if c.cfg.Panel.boards() > 0 && c.nonGerber {
+		c.cfg.Log.Printf("Warning: panels need gerber input, ignoring -panel for %s input", c.ext)
+		c.cfg.Panel = Panel{}
+	} else if c.cfg.Panel.boards() > 0 {
+		if c.cfg.Bottom != "" {
+			return fmt.Errorf("-panel and -bottom can't be used together")
+		}
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		if err := c.cfg.Panel.setStep(gf, c.outlinePath, c.cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.cfg.Stdout, "Panel: %d x %d boards, %.2f mm apart in X and %.2f mm in Y\n", c.cfg.Panel.Cols, c.cfg.Panel.Rows, c.cfg.Panel.StepX, c.cfg.Panel.StepY)
+		if c.outlinePath != "" {
+			c.cfg.Log.Printf("Warning: the outline only fits one board of the panel, using it for the board's size only")
+			c.outlinePath = ""
+		}
+		if c.cfg.Stream {
+			c.cfg.Log.Printf("Warning: -stream can't repeat the paste layer, rendering in memory")
+			c.cfg.Stream = false
+		}
+	}
+	partial := c.cfg.Crop != nil || len(c.cfg.OnlyRefs) > 0
+	if (len(c.cfg.Exclude) > 0 || partial) && c.nonGerber {
+		c.cfg.Log.Printf("Warning: picking pads needs gerber input, ignoring -exclude, -only-refs and -crop for %s input", c.ext)
+		c.cfg.Exclude, c.cfg.OnlyRefs, c.cfg.Crop = nil, nil, nil
+	} else if len(c.cfg.Exclude) > 0 || partial {
+		if c.cfg.Centroid != "" {
+			side := c.cfg.Side
+			if side == SideBoth {
+				side = SideTop
+			}
+			if c.cfg.placements, err = loadPlacements(c.cfg.Centroid, side, c.cfg.Mirror); err != nil {
+				return err
+			}
+		}
+		if partial && c.outlinePath != "" {
+			c.cfg.Log.Printf("Warning: a partial stencil doesn't fit the board's outline, ignoring it")
+			c.outlinePath = ""
+		}
+		if c.cfg.Stream {
+			c.cfg.Log.Printf("Warning: -stream can't pick pads, rendering in memory")
+			c.cfg.Stream = false
+		}
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		pads := pastePads(gf, c.cfg.placements)
+		found := make(map[string]bool)
+		for _, p := range pads {
+			found[strings.ToUpper(p.ref)] = true
+		}
+		refs := append(append([]string(nil), c.cfg.Exclude...), c.cfg.OnlyRefs...)
+		if len(refs) > 0 && len(found) == 1 && found[""] {
+			c.cfg.Log.Printf("Warning: the paste layer has no component attributes, give a centroid file with -centroid to find the components")
+		}
+		for _, ref := range refs {
+			if !found[strings.ToUpper(ref)] {
+				c.cfg.Log.Printf("Warning: no pads of %s on the paste layer", ref)
+			}
+		}
+		n := selectPads(gf, c.cfg)
+		fmt.Fprintf(c.cfg.Stdout, "Picking pads: %d of %d left without paste\n", n, len(pads))
+		if n == len(pads) {
+			return fmt.Errorf("no pads left on the stencil")
+		}
+	}
+	if c.cfg.HomePlate > 0 && c.nonGerber {
+		c.cfg.Log.Printf("Warning: home plate openings need gerber pads, ignoring -home-plate for %s input", c.ext)
+		c.cfg.HomePlate = 0
+	} else if c.cfg.HomePlate > 0 {
+		if c.cfg.Stream {
+			c.cfg.Log.Printf("Warning: -stream can't reshape pads, rendering in memory")
+			c.cfg.Stream = false
+		}
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		shape := "home plate"
+		if c.cfg.HomePlateInverted {
+			shape = "inverted home plate"
+		}
+		n, unknown := homePlates(gf, c.cfg.HomePlate, c.cfg.HomePlateInverted)
+		fmt.Fprintf(c.cfg.Stdout, "Home plate openings: %d rectangular pads at %g mm pitch or finer shaped as %ss\n", n, c.cfg.HomePlate, shape)
+		switch {
+		case unknown > 0:
+			c.cfg.Log.Printf("Warning: %d rectangular pads at %g mm pitch or finer left as they are, no component attributes or opposite row of pads to tell which side the body is on", unknown, c.cfg.HomePlate)
+		case n == 0:
+			c.cfg.Log.Printf("Warning: no rectangular pads at %g mm pitch or finer", c.cfg.HomePlate)
+		}
+	}
+	if c.cfg.Panel.boards() > 1 {
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		panelize(gf, c.cfg.Panel)
+	}
+	if c.cfg.Bottom != "" {
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		z, err := addBottom(gf, c.cfg)
+		if err != nil {
+			return err
+		}
+		c.cfg.Steps = append(c.cfg.Steps, z)
+	}
+	if c.cfg.RegHoles.Diameter > 0 && c.nonGerber {
+		c.cfg.Log.Printf("Warning: registration holes need gerber input, ignoring them for %s input", c.ext)
+		c.cfg.RegHoles = RegHoles{}
+	}
+	if c.cfg.RegHoles.Diameter > 0 && c.outlinePath != "" {
+		return fmt.Errorf("the outline clips away the frame the registration holes go through: leave out the outline (-outline-layer none for an archive or directory) or the holes")
+	}
+	if c.cfg.Magnets.Diameter > 0 && c.nonGerber {
+		c.cfg.Log.Printf("Warning: magnet pockets need gerber input, ignoring them for %s input", c.ext)
+		c.cfg.Magnets = MagnetPockets{}
+	} else if c.cfg.Magnets.Diameter > 0 && c.outlinePath != "" {
+		return fmt.Errorf("the outline clips away the frame the magnet pockets go in: leave out the outline (-outline-layer none for an archive or directory) or the pockets")
+	} else if c.cfg.Magnets.Diameter > 0 {
+		fmt.Fprintf(c.cfg.Stdout, "Magnet pockets: %v, in bosses %.1f mm across\n", c.cfg.Magnets, 2*c.cfg.Magnets.bossRadius())
+		if c.cfg.RegHoles.Diameter > 0 {
+			c.cfg.Log.Printf("Warning: the magnet pockets' bosses may cover registration holes in the corners of the frame")
+		}
+	}
+	if c.cfg.Mirror != "" && c.nonGerber {
+		c.cfg.Log.Printf("Warning: mirroring needs gerber input, ignoring -mirror for %s input", c.ext)
+		c.cfg.Mirror = ""
+	} else if c.cfg.Mirror != "" {
+		fmt.Fprintf(c.cfg.Stdout, "Mirroring the gerbers in %s\n", strings.ToUpper(c.cfg.Mirror))
+		// Zone rectangles are in the unmirrored coordinates
+		steps := make([]StepZone, len(c.cfg.Steps))
+		for i, z := range c.cfg.Steps {
+			if z.Rect != nil {
+				b := gerber.MirrorBounds(*z.Rect, c.cfg.Mirror)
+				z.Rect = &b
+			}
+			steps[i] = z
+		}
+		c.cfg.Steps = steps
+		if drill != nil {
+			for i, h := range drill.Holes {
+				drill.Holes[i].X, drill.Holes[i].Y = gerber.MirrorPoint(h.X, h.Y, c.cfg.Mirror)
+			}
+		}
+	}
+	if c.cfg.AlignPins && (drill == nil || c.nonGerber) {
+		c.cfg.Log.Printf("Warning: alignment pins need gerber input and a -drill file, skipping them")
+		c.cfg.AlignPins = false
+	} else if c.cfg.AlignPins {
+		for _, h := range drill.MountingHoles() {
+			if pinDiameter(h, c.cfg.PinFit) > 0 {
+				c.cfg.pins = append(c.cfg.pins, h)
+			}
+		}
+		if len(c.cfg.pins) == 0 {
+			c.cfg.Log.Printf("Warning: the drill file has no non-plated tooling holes for alignment pins")
+			c.cfg.AlignPins = false
+		}
+	}
+	if c.cfg.Label != "" && c.nonGerber {
+		c.cfg.Log.Printf("Warning: labels need gerber input, ignoring the label for %s input", c.ext)
+	} else if c.cfg.Label != "" && c.outlinePath != "" && c.cfg.LabelAt == nil {
+		c.cfg.Log.Printf("Warning: the outline clips away the frame the label goes in, place it on the board with -label-at")
+	} else if c.cfg.Label != "" {
+		var gf *gerber.File
+		if c.cfg.LabelAt == nil {
+			if gf, err = c.pasteLayer(); err != nil {
+				return err
+			}
+		}
+		z, err := labelZone(gf, c.cfg)
+		if err != nil {
+			return err
+		}
+		c.cfg.Steps = append(c.cfg.Steps, z)
+	}
+	if c.cfg.Fiducials != "" && c.nonGerber {
+		c.cfg.Log.Printf("Warning: fiducial marks need gerber input, ignoring them for %s input", c.ext)
+	} else if c.cfg.Fiducials != "" {
+		side := c.cfg.Side
+		if side == SideBoth {
+			side = SideTop // The bottom side's aren't placed on a combined stencil
+		}
+		fids, err := loadFiducials(c.cfg.Fiducials, side, c.cfg.Mirror)
+		if err != nil {
+			return err
+		}
+		if len(fids) == 0 {
+			c.cfg.Log.Printf("Warning: no fiducials found in %s", c.cfg.Fiducials)
+		} else {
+			fmt.Fprintf(c.cfg.Stdout, "Fiducial marks: %d, %g mm deep\n", len(fids), c.cfg.StencilHeight/2)
+			c.cfg.Steps = append(c.cfg.Steps, fiducialZone(fids, c.cfg))
+		}
+	}
+	return nil
+}
+
+// render renders the paste and outline layers to images, or meshes gerbers
+// from their geometry, and writes the files made from them.
+func (c *conversion) render() error {
+	var err error
+	switch c.ext {
+	case ".svg":
+		fmt.Fprintf(c.cfg.Stdout, "Rendering SVG %s...\n", c.gerberPath)
+		c.img, err = RenderSVG(c.gerberPath, c.cfg.DPI, frameMargin(c.cfg))
+		if err != nil {
+			return fmt.Errorf("error rendering SVG: %v", err)
+		}
+		if c.outlinePath != "" {
+			c.cfg.Log.Printf("Warning: outline layers are not supported with SVG input, ignoring %s", c.outlinePath)
+		}
+	case ".dxf":
+		fmt.Fprintf(c.cfg.Stdout, "Rendering DXF %s...\n", c.gerberPath)
+		c.img, c.outlineImg, err = RenderDXF(c.gerberPath, c.cfg.DPI, frameMargin(c.cfg), c.cfg.Stdout)
+		if err != nil {
+			return fmt.Errorf("error rendering DXF: %v", err)
+		}
+		if c.outlinePath != "" {
+			c.cfg.Log.Printf("Warning: put the outline on an OUTLINE layer of the DXF instead, ignoring %s", c.outlinePath)
+		}
+	case ".png", ".bmp", ".gif", ".jpg", ".jpeg":
+		fmt.Fprintf(c.cfg.Stdout, "Loading bitmap %s...\n", c.gerberPath)
+		if c.cfg.PixelPitch > 0 {
+			c.cfg.DPI = 25.4 / c.cfg.PixelPitch
+		}
+		c.img, err = LoadBitmap(c.gerberPath, c.cfg.Invert)
+		if err != nil {
+			return fmt.Errorf("error loading bitmap: %v", err)
+		}
+		if c.outlinePath != "" {
+			if !isBitmapInput(strings.ToLower(filepath.Ext(c.outlinePath))) {
+				return fmt.Errorf("outline for bitmap input must be a bitmap of the same size")
+			}
+			c.outlineImg, err = LoadBitmap(c.outlinePath, c.cfg.Invert)
+			if err != nil {
+				return fmt.Errorf("error loading outline bitmap: %v", err)
+			}
+			if c.outlineImg.Bounds() != c.img.Bounds() {
+				return fmt.Errorf("outline bitmap is %v, paste bitmap is %v", c.outlineImg.Bounds().Size(), c.img.Bounds().Size())
+			}
+		}
+		fmt.Fprintf(c.cfg.Stdout, "Bitmap is %dx%d px at %.4f mm/px\n", c.img.Bounds().Dx(), c.img.Bounds().Dy(), 25.4/c.cfg.DPI)
+	default:
+		// Gerbers are meshed from their geometry unless something needs the image
+		rasterFlag := rasterOnlyFlag(c.cfg)
+		if c.cfg.Vector && rasterFlag != "" {
+			fmt.Fprintf(c.cfg.Stdout, "%s needs the rendered image, using the raster mesher\n", rasterFlag)
+		}
+		if !c.cfg.Raster && rasterFlag == "" {
+			gf, err := c.pasteLayer()
+			if err != nil {
+				return err
+			}
+			if c.triangles, c.openings, err = vectorGerberMesh(gf, c.outlinePath, c.debugPath, c.cfg); err != nil {
+				return err
+			}
+		}
+		if c.triangles == nil && c.cfg.Stream {
+			c.img, c.outlineImg, c.res.Apertures, err = streamGerberInputs(c.gerberPath, c.outlinePath, c.debugPath, &c.cfg)
+			if err != nil {
+				return err
+			}
+		} else if c.triangles == nil {
+			gf, err := c.pasteLayer()
+			if err != nil {
+				return err
+			}
+			if c.img, c.outlineImg, err = renderGerberInputs(gf, c.outlinePath, c.debugPath, &c.cfg); err != nil {
+				return err
+			}
+		}
+		if c.debugPath != "" {
+			c.res.wrote(c.debugPath)
+		}
+		var gf *gerber.File
+		if c.cfg.SVG || c.cfg.DXF || c.cfg.GCode || c.cfg.SCAD || c.cfg.PDF {
+			if gf, err = c.pasteLayer(); err != nil {
+				return err
+			}
+		}
+		if c.cfg.SVG {
+			svgPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".svg"
+			if err := exportCutLines(gf, c.gerberPath, c.outlinePath, svgPath, c.cfg); err != nil {
+				return err
+			}
+			c.res.wrote(svgPath)
+		}
+		if c.cfg.DXF {
+			dxfPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".dxf"
+			if err := exportCutLines(gf, c.gerberPath, c.outlinePath, dxfPath, c.cfg); err != nil {
+				return err
+			}
+			c.res.wrote(dxfPath)
+		}
+		if c.cfg.GCode {
+			gcodePath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".gcode"
+			if err := exportCutLines(gf, c.gerberPath, c.outlinePath, gcodePath, c.cfg); err != nil {
+				return err
+			}
+			c.res.wrote(gcodePath)
+		}
+		if c.cfg.SCAD {
+			scadPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".scad"
+			if err := exportCutLines(gf, c.gerberPath, c.outlinePath, scadPath, c.cfg); err != nil {
+				return err
+			}
+			c.res.wrote(scadPath)
+		}
+		if c.cfg.PDF {
+			pdfPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".pdf"
+			if err := exportCutLines(gf, c.gerberPath, c.outlinePath, pdfPath, c.cfg); err != nil {
+				return err
+			}
+			c.res.wrote(pdfPath)
+		}
+	}
+	if c.cfg.Vector && c.img != nil && c.triangles == nil && c.nonGerber {
+		fmt.Fprintln(c.cfg.Stdout, "Vector output only supports gerber input, using the raster mesher")
+	}
+	if c.img != nil && len(c.cfg.ShrinkByArea) > 0 {
+		fmt.Fprintf(c.cfg.Stdout, "Shrinking openings by area: %s...\n", areaShrinksString(c.cfg.ShrinkByArea))
+		c.img = ShrinkByArea(c.img, c.cfg.ShrinkByArea, 25.4/c.cfg.DPI)
+	}
+	if c.img != nil && c.cfg.WindowPane > 0 {
+		var n int
+		c.img, n = WindowPanes(c.img, c.cfg.WindowPane, c.cfg.PaneWeb, 25.4/c.cfg.DPI)
+		fmt.Fprintf(c.cfg.Stdout, "Window panes: %d openings over %g mm² split with %g mm webs\n", n, c.cfg.WindowPane, c.cfg.PaneWeb)
+	}
+	if c.img != nil && (c.cfg.ShrinkX != Shrink{} || c.cfg.ShrinkY != Shrink{}) {
+		fmt.Fprintf(c.cfg.Stdout, "Compensating openings by %v along X and %v along Y...\n", c.cfg.ShrinkX, c.cfg.ShrinkY)
+		c.img = CompensateOpenings(c.img, c.cfg.ShrinkX, c.cfg.ShrinkY, 25.4/c.cfg.DPI)
+	}
+	if c.img != nil && c.cfg.Profile != nil {
+		fmt.Fprintf(c.cfg.Stdout, "Compensating openings by the printer profile, %v...\n", *c.cfg.Profile)
+		c.img = ApplyProfile(c.img, *c.cfg.Profile, 25.4/c.cfg.DPI)
+	}
+	if len(c.cfg.Steps) > 0 && (c.cfg.WallTaper > 0 || c.cfg.Chamfer > 0 || c.cfg.Fillet > 0) {
+		c.cfg.Log.Printf("Warning: shaped aperture walls don't work with step zones, ignoring them")
+		c.cfg.WallTaper, c.cfg.Chamfer, c.cfg.Fillet = 0, 0, 0
+	}
+	if shaped := c.cfg.WallTaper > 0 || c.cfg.Chamfer > 0 || c.cfg.Fillet > 0; shaped && c.triangles == nil && !c.cfg.Contour {
+		fmt.Fprintln(c.cfg.Stdout, "Shaped aperture walls need the contour mesher, using -contour")
+		c.cfg.Contour = true
+	}
+	if c.cfg.MaxRects && c.cfg.Contour {
+		c.cfg.Log.Printf("Warning: -max-rects only applies to the box mesher, ignoring it with -contour")
+	}
+	if c.cfg.Simplify > 0 && (c.triangles != nil || !c.cfg.Contour) {
+		c.cfg.Log.Printf("Warning: -simplify only applies to the -contour mesher, ignoring it")
+	}
+	if c.cfg.DebugPNG && c.nonGerber {
+		c.cfg.Log.Printf("Warning: the debug PNG colors gerber apertures, skipping it for %s input", c.ext)
+	}
+	if c.cfg.SVG && c.nonGerber {
+		c.cfg.Log.Printf("Warning: SVG export needs gerber input, skipping it for %s input", c.ext)
+	}
+	if c.cfg.DXF && c.nonGerber {
+		c.cfg.Log.Printf("Warning: DXF export needs gerber input, skipping it for %s input", c.ext)
+	}
+	if c.cfg.GCode && c.nonGerber {
+		c.cfg.Log.Printf("Warning: G-code export needs gerber input, skipping it for %s input", c.ext)
+	}
+	if c.cfg.Printer != "" && (c.cfg.WallTaper > 0 || c.cfg.Chamfer > 0 || c.cfg.Fillet > 0) {
+		c.cfg.Log.Printf("Warning: the sliced file has straight aperture walls, shaped walls only apply to the mesh")
+	}
+	if c.cfg.SCAD && c.nonGerber {
+		c.cfg.Log.Printf("Warning: OpenSCAD export needs gerber input, skipping it for %s input", c.ext)
+	}
+	if c.cfg.PDF && c.nonGerber {
+		c.cfg.Log.Printf("Warning: PDF export needs gerber input, skipping it for %s input", c.ext)
+	}
+	if c.cfg.Jig && (c.outlinePath == "" || c.nonGerber) {
+		c.cfg.Log.Printf("Warning: the jig needs a gerber board outline, skipping it")
+		c.cfg.Jig = false
+	}
+	if c.cfg.Locators > 0 && c.outlinePath == "" {
+		c.cfg.Log.Printf("Warning: corner locators need a board outline, ignoring them")
+		c.cfg.Locators = 0
+	}
+	if c.cfg.SCAD && len(c.cfg.Steps) > 0 {
+		c.cfg.Log.Printf("Warning: the OpenSCAD model has no step zones, only the %g mm plate", c.cfg.StencilHeight)
+	}
+	if len(c.cfg.Steps) > 0 && c.nonGerber {
+		c.cfg.Log.Printf("Warning: step zones need gerber input, ignoring them for %s input", c.ext)
+		c.cfg.Steps = nil
+	}
+
+	var poor, webs *render.Bitmap
+	if (c.cfg.Ratios || minFeature(c.cfg) > 0 || c.cfg.MinWeb > 0 || c.cfg.PasteVolume) && c.img != nil {
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		at, err := imageCoords(gf, c.outlinePath, c.cfg)
+		if err != nil {
+			return err
+		}
+		if minFeature(c.cfg) > 0 {
+			checkPrintability(c.img, c.cfg, at)
+		}
+		if c.cfg.MinWeb > 0 {
+			thin := thinWebs(openingBitmap(c.img), c.cfg.MinWeb, 25.4/c.cfg.DPI)
+			printWebs(thin, at, c.cfg)
+			if len(thin) > 0 {
+				b := c.img.Bounds()
+				webs = featureMask(thin, b.Dx(), b.Dy())
+			}
+		}
+		if c.cfg.PasteVolume {
+			var comps map[string]gerber.Bounds
+			if gf != nil {
+				comps = gf.ComponentBounds()
+				for ref, b := range comps {
+					comps[ref] = gerber.MirrorBounds(b, c.cfg.Mirror)
+				}
+			}
+			var groups []pasteVolume
+			groups, c.paste = pasteVolumes(c.img, c.cfg, comps, at)
+			printPasteVolumes(groups, c.paste, c.cfg.PasteDensity, c.cfg.Stdout)
+		}
+		if c.cfg.Ratios {
+			ratios := apertureRatios(c.img, c.cfg.StencilHeight, 25.4/c.cfg.DPI, at)
+			if printRatios(ratios, c.cfg.StencilHeight, c.cfg.Stdout) > 0 {
+				b := c.img.Bounds()
+				poor = poorMask(ratios, b.Dx(), b.Dy())
+			}
+		}
+	}
+
+	if c.cfg.KeepPNG && c.img != nil {
+		pngPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".png"
+		if pngPath == c.gerberPath {
+			// Don't overwrite bitmap input
+			pngPath = strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_stencil.png"
+		}
+		fmt.Fprintf(c.cfg.Stdout, "Saving intermediate PNG to %s...\n", pngPath)
+		savePNG(pngPath, c.img, c.cfg.Log)
+		previewPath := strings.TrimSuffix(pngPath, ".png") + "_preview.png"
+		fmt.Fprintf(c.cfg.Stdout, "Saving annotated preview to %s...\n", previewPath)
+		savePNG(previewPath, renderPreview(c.img, c.outlineImg, poor, webs, c.cfg), c.cfg.Log)
+		c.res.wrote(pngPath, previewPath)
+	}
+
+	if c.cfg.Heightmap && c.img != nil {
+		heightPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_height.png"
+		fmt.Fprintf(c.cfg.Stdout, "Saving heightmap to %s...\n", heightPath)
+		heightmap, full := renderHeightmap(c.img, c.outlineImg, c.cfg)
+		savePNG(heightPath, heightmap, c.cfg.Log)
+		c.res.wrote(heightPath)
+		fmt.Fprintf(c.cfg.Stdout, "Heightmap: white is %g mm, %.4f mm per pixel\n", full, 25.4/c.cfg.DPI)
+	}
+	return nil
+}
+
+// dispense writes the dispenser G-code made instead of a stencil.
+func (c *conversion) dispense() error {
+	gf, err := c.pasteLayer()
+	if err != nil {
+		return err
+	}
+	at, err := imageCoords(gf, c.outlinePath, c.cfg)
+	if err != nil {
+		return err
+	}
+	gcodePath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_dispense.gcode"
+	fmt.Fprintf(c.cfg.Stdout, "Saving dispensing G-code to %s...\n", gcodePath)
+	if err := writeDispenseGCode(gcodePath, dispenseShots(c.img, c.cfg, c.cfg.Dispenser, at), c.cfg.Dispenser, c.cfg.Stdout); err != nil {
+		return fmt.Errorf("error writing G-code: %v", err)
+	}
+	c.res.Output = gcodePath
+	c.res.wrote(gcodePath)
+	c.res.Durations.Total = time.Since(c.start).Seconds()
+	return nil
+}
+
+// generateMesh meshes the image render made, whole or in tiles, unless the
+// vector mesher has already.
+func (c *conversion) generateMesh() error {
+	c.res.Durations.Render = time.Since(c.start).Seconds()
+	c.vectorMesh = c.triangles != nil
+	if c.triangles == nil && c.cfg.Tiles.enabled() {
+		pixelToMM := 25.4 / c.cfg.DPI
+		size := c.img.Bounds().Size()
+		if c.cfg.Tiles.Auto {
+			if err := c.cfg.Tiles.fitTiles(float64(size.X)*pixelToMM, float64(size.Y)*pixelToMM, c.cfg.Bed); err != nil {
+				return err
+			}
+		}
+		if n := c.cfg.Tiles.Cols * c.cfg.Tiles.Rows; n == 1 {
+			fmt.Fprintln(c.cfg.Stdout, "Tiling: the stencil fits the bed whole")
+		} else {
+			fmt.Fprintf(c.cfg.Stdout, "Tiling: %d x %d tiles with %g mm %s joints\n", c.cfg.Tiles.Cols, c.cfg.Tiles.Rows, c.cfg.Tiles.JointSize, c.cfg.Tiles.Joint)
+			tl := newTiler(c.cfg.Tiles, size.X, size.Y, pixelToMM, frameMargin(c.cfg))
+			for k := 0; k < n; k++ {
+				fmt.Fprintf(c.cfg.Stdout, "Generating mesh of tile %d...\n", k+1)
+				tileCfg := c.cfg
+				tileCfg.tile = tl.mask(k)
+				var t [][3]Point
+				if c.cfg.Contour {
+					t = GenerateContourMesh(c.img, c.outlineImg, tileCfg)
+				} else {
+					t = GenerateMeshFromImages(c.img, c.outlineImg, tileCfg)
+				}
+				c.tiles = append(c.tiles, t)
+				c.triangles = append(c.triangles, t...)
+			}
+			c.openings = imageOpenings(c.img, pixelToMM)
+		}
+	}
+	// A raster STL file with nothing else made from the triangles is
+	// written as they're made, never holding them all
+	if c.triangles == nil {
+		fmt.Fprintln(c.cfg.Stdout, "Generating mesh...")
+		switch {
+		case c.cfg.Contour:
+			c.triangles = GenerateContourMesh(c.img, c.outlineImg, c.cfg)
+		case !c.toStdout && (c.cfg.Format == "" || c.cfg.Format == "stl") && c.cfg.Bed == (Bed{}) && !c.cfg.PreviewHTML:
+			c.meshSeq = mesh.Mesher{PixelSize: 25.4 / c.cfg.DPI, MaxRects: c.cfg.MaxRects}.Seq(heightLevels(c.img, c.outlineImg, c.cfg))
+		default:
+			c.triangles = GenerateMeshFromImages(c.img, c.outlineImg, c.cfg)
+		}
+		c.openings = imageOpenings(c.img, 25.4/c.cfg.DPI)
+	}
+
+	c.res.Durations.Mesh = time.Since(c.start).Seconds() - c.res.Durations.Render
+	return nil
+}
+
+// write places and writes the mesh, the files made from it, and the
+// statistics.
+func (c *conversion) write() error {
+	var err error
+	var origin Point
+	if c.cfg.Origin == "gerber" {
+		if c.nonGerber {
+			c.cfg.Log.Printf("Warning: -origin gerber needs gerber input, leaving the origin at the corner")
+		} else {
+			gf, err := c.pasteLayer()
+			if err != nil {
+				return err
+			}
+			if origin, err = gerberOrigin(gf, c.outlinePath, c.cfg); err != nil {
+				return err
+			}
+		}
+	}
+	var shift Point
+	var fit bedFit
+	var extent meshExtent
+	if c.meshSeq != nil {
+		// The raster mesher's shells are closed by construction, so only
+		// the extent is needed before writing
+		extent = measureMesh(c.meshSeq)
+		shift = meshShift(extent, c.cfg, origin)
+		extent = extent.moved(shift)
+	} else {
+		shift = placeMesh(c.triangles, c.cfg, origin)
+		if c.cfg.Bed != (Bed{}) && c.tiles == nil {
+			if fit, err = fitBed(c.triangles, c.cfg.Bed, c.vectorMesh, c.cfg); err != nil {
+				return err
+			}
+			if fit.angle != 0 {
+				fmt.Fprintf(c.cfg.Stdout, "Turning the stencil %g° to fit the %g x %g mm bed\n", fit.angle, c.cfg.Bed.Width, c.cfg.Bed.Depth)
+				for i := range c.triangles {
+					for j := range c.triangles[i] {
+						c.triangles[i][j] = fit.apply(c.triangles[i][j])
+					}
+				}
+			}
+		}
+		for _, issue := range mesh.Check(c.triangles, c.cfg.Progress) {
+			c.cfg.Log.Printf("Warning: mesh has %s", issue)
+		}
+		extent = measureMesh(slices.Values(c.triangles))
+	}
+	if c.toStdout {
+		fmt.Fprintf(c.cfg.Stdout, "Writing to stdout (%d triangles)...\n", extent.count)
+	} else {
+		fmt.Fprintf(c.cfg.Stdout, "Saving to %s (%d triangles)...\n", c.outputPath, extent.count)
+	}
+	name := strings.TrimSuffix(filepath.Base(c.outputPath), filepath.Ext(c.outputPath))
+	dpi := 0.0
+	if c.img != nil {
+		dpi = c.cfg.DPI
+	}
+	info := newMeshInfo(c.gerberPath, c.cfg, dpi)
+	if c.cfg.Scale != 0 && c.cfg.Scale != 1 && (c.cfg.Format == "3mf" || c.cfg.Format == "glb") {
+		c.cfg.Log.Printf("Warning: %s files carry their units, ignoring the mesh scale", c.cfg.Format)
+	}
+	if c.cfg.YUp && (c.cfg.Format == "3mf" || c.cfg.Format == "glb") {
+		c.cfg.Log.Printf("Warning: %s files have a fixed up axis, ignoring -y-up", c.cfg.Format)
+	}
+	walls := c.outlineImg != nil || (c.img == nil && c.outlinePath != "")
+	switch {
+	case c.toStdout:
+		err = stl.Write(c.cfg.MeshOut, fileMesh(c.triangles, c.cfg), info, c.cfg.Progress)
+	case c.meshSeq != nil:
+		err = writeMeshSeq(c.outputPath, c.meshSeq, shift, extent, c.cfg, info)
+	default:
+		err = writeMesh(c.outputPath, c.triangles, c.cfg, info, walls)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing mesh: %v", err)
+	}
+	c.res.Output, c.res.Triangles = c.outputPath, extent.count
+	if c.toStdout {
+		c.res.Output = "-"
+	} else {
+		c.res.wrote(c.outputPath)
+	}
+	for k, t := range c.tiles {
+		// Each tile from its own corner, to print on its own
+		tileCfg := c.cfg
+		tileCfg.Origin = ""
+		lo := t[0][0]
+		for _, tri := range t {
+			for _, p := range tri {
+				lo = Point{X: math.Min(lo.X, p.X), Y: math.Min(lo.Y, p.Y)}
+			}
+		}
+		for i := range t {
+			for j := range t[i] {
+				t[i][j].X, t[i][j].Y = t[i][j].X-lo.X, t[i][j].Y-lo.Y
+			}
+		}
+		placeMesh(t, tileCfg, Point{})
+		if c.cfg.Bed != (Bed{}) {
+			tileFit, err := fitBed(t, c.cfg.Bed, false, tileCfg)
+			if err != nil {
+				return fmt.Errorf("tile %d: %v", k+1, err)
+			}
+			for i := range t {
+				for j := range t[i] {
+					t[i][j] = tileFit.apply(t[i][j])
+				}
+			}
+		}
+		tilePath := fmt.Sprintf("%s_tile%d%s", strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)), k+1, filepath.Ext(c.outputPath))
+		fmt.Fprintf(c.cfg.Stdout, "Saving tile %d of %d to %s (%d triangles)...\n", k+1, len(c.tiles), tilePath, len(t))
+		if err := writeMesh(tilePath, t, c.cfg, info, walls); err != nil {
+			return fmt.Errorf("error writing mesh: %v", err)
+		}
+		c.res.wrote(tilePath)
+	}
+	if c.cfg.PreviewHTML {
+		htmlPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + ".html"
+		var apertures, outline [][]Point
+		if c.nonGerber {
+			c.cfg.Log.Printf("Warning: the HTML preview overlays gerbers, showing the mesh alone for %s input", c.ext)
+		} else {
+			gf, err := c.pasteLayer()
+			if err != nil {
+				return err
+			}
+			_, boardZ := boardFootprint(c.triangles, c.cfg, false)
+			apertures, outline, err = previewOverlay(gf, c.outlinePath, c.cfg, shift, boardZ)
+			if err != nil {
+				return err
+			}
+			if fit.angle != 0 {
+				for _, path := range append(apertures, outline...) {
+					for i := range path {
+						path[i] = fit.apply(path[i])
+					}
+				}
+			}
+		}
+		fmt.Fprintf(c.cfg.Stdout, "Saving 3D preview to %s...\n", htmlPath)
+		if err := WritePreviewHTML(htmlPath, c.triangles, name, apertures, outline); err != nil {
+			return fmt.Errorf("error writing HTML preview: %v", err)
+		}
+		c.res.wrote(htmlPath)
+	}
+	if c.cfg.Printer != "" {
+		slicedPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "." + c.printer.Format
+		if err := exportSlices(c.img, c.outlineImg, slicedPath, c.printer, c.cfg); err != nil {
+			return err
+		}
+		c.res.wrote(slicedPath)
+	}
+
+	if c.cfg.Jig {
+		jigPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_jig.stl"
+		if err := writeJig(c.outlinePath, jigPath, c.gerberPath, c.cfg); err != nil {
+			return err
+		}
+		c.res.wrote(jigPath)
+	}
+	if c.cfg.AlignPins {
+		pinsPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_pins.stl"
+		if err := writePins(pinsPath, c.gerberPath, c.cfg); err != nil {
+			return err
+		}
+		c.res.wrote(pinsPath)
+	}
+	if c.cfg.Squeegee {
+		gf, err := c.pasteLayer()
+		if err != nil {
+			return err
+		}
+		field, err := apertureField(gf, c.img, c.cfg)
+		if err != nil {
+			return err
+		}
+		squeegeePath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_squeegee.stl"
+		if err := writeSqueegee(squeegeePath, c.gerberPath, field, c.cfg.SqueegeeSize, c.cfg); err != nil {
+			return err
+		}
+		c.res.wrote(squeegeePath)
+	}
+
+	stats := meshStats(c.gerberPath, extent, c.openings, c.cfg)
+	if c.cfg.PasteVolume {
+		stats.PasteVolume, stats.PasteWeight = c.paste.Volume, c.paste.Volume*c.cfg.PasteDensity
+	}
+	stats.Print(c.cfg.Stdout)
+	if c.cfg.Stats {
+		statsPath := strings.TrimSuffix(c.outputPath, filepath.Ext(c.outputPath)) + "_stats.json"
+		fmt.Fprintf(c.cfg.Stdout, "Saving statistics to %s...\n", statsPath)
+		if err := stats.WriteJSON(statsPath); err != nil {
+			return fmt.Errorf("error writing statistics: %v", err)
+		}
+		c.res.wrote(statsPath)
+	}
+	c.res.Min, c.res.Max = stats.Min, stats.Max
+	c.res.Durations.Total = time.Since(c.start).Seconds()
+	c.res.Durations.Write = c.res.Durations.Total - c.res.Durations.Render - c.res.Durations.Mesh
+	return nil
+}
+
+// writeMeshSeq writes the STL of triangles, of extent e, to path as they
+// come, moved by shift.
+func writeMeshSeq(path string, triangles iter.Seq[[3]Point], shift Point, e meshExtent, cfg Config, info stl.Info) error {
+	s := cfg.Scale
+	if s == 0 {
+		s = 1
+	}
+	// Moving, scaling and turning keep the winding, so the volume's sign
+	// says whether to flip it like stl.Write
+	flip := e.volume < 0
+	return stl.WriteSeq(path, func(yield func([3]Point) bool) {
+		for t := range triangles {
+			for j, p := range t {
+				t[j] = Point{X: p.X + shift.X, Y: p.Y + shift.Y, Z: p.Z + shift.Z}
+			}
+			t = fileTriangle(t, s, cfg.YUp)
+			if flip {
+				t[1], t[2] = t[2], t[1]
+			}
+			if !yield(t) {
+				return
+			}
+		}
+	}, e.count, info, cfg.Progress)
+}
+
+// writeMesh writes triangles to path in the format of cfg. walls is whether
+// the stencil has them around the board, for the GLB's board footprint.
+func writeMesh(path string, triangles [][3]Point, cfg Config, info stl.Info, walls bool) error {
+	switch cfg.Format {
+	case "3mf":
+		return Write3MF(path, triangles, info, cfg.Progress)
+	case "obj":
+		return WriteOBJ(path, fileMesh(triangles, cfg), info, cfg.Progress)
+	case "ply":
+		return WritePLY(path, fileMesh(triangles, cfg), info, cfg.Progress)
+	case "glb":
+		board, boardZ := boardFootprint(triangles, cfg, walls)
+		return WriteGLB(path, triangles, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), board, boardZ, cfg.Progress)
+	}
+	return stl.WriteFile(path, fileMesh(triangles, cfg), info, cfg.Progress)
+}
@@ -0,0 +1,147 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+)
+
+// Dispenser G-code switches the paste valve with the part cooling fan's
+// output, which gantry dispenser add-ons are usually wired to
+const (
+	dispenseOn  = "M106 S255"
+	dispenseOff = "M107"
+)
+
+const (
+	dispenseLift = 2.0    // Nozzle height over the board between pads, mm
+	dispenseMove = 3000.0 // Travel feed rate, mm/min
+)
+
+// Dispenser describes a paste dispenser on a printer's gantry.
+type Dispenser struct {
+	Rate   float64 // Paste pushed out per second with the valve open, mm³
+	Dot    float64 // Diameter of a dot of paste, mm
+	Height float64 // Nozzle height over the board while dispensing, mm
+}
+
+// dispenseShot is the paste for one opening: a dot, or a fill along path,
+// of volume mm³.
+type dispenseShot struct {
+	path   []vec2 // Board mm; a single point for a dot
+	volume float64
+}
+
+// dispenseShots plans the paste for each opening of a rendered stencil: the
+// volume the stencil would print through it, as a dot for openings little
+// bigger than one, or else a serpentine of rows a dot apart along their long
+// side. at turns pixel positions into board coordinates.
+func dispenseShots(img image.Image, cfg Config, d Dispenser, at func(px, py float64) (float64, float64)) []dispenseShot {
+	pixelToMM := 25.4 / cfg.DPI
+	dot := d.Dot / pixelToMM
+	openings, boxes := findOpenings(openingBitmap(img))
+	shots := make([]dispenseShot, len(openings))
+	for i, runs := range openings {
+		_, volume := openingVolume(runs, cfg)
+		shots[i].volume = volume
+		box := boxes[i]
+		if float64(max(box.Dx(), box.Dy())) <= 1.5*dot {
+			x, y := at(float64(box.Min.X+box.Max.X)/2, float64(box.Min.Y+box.Max.Y)/2)
+			shots[i].path = []vec2{{X: x, Y: y}}
+			continue
+		}
+
+		// Extent of the opening along each pixel row and column
+		rowLo, rowHi := make([]int, box.Dy()), make([]int, box.Dy())
+		colLo, colHi := make([]int, box.Dx()), make([]int, box.Dx())
+		for j := range rowLo {
+			rowLo[j], rowHi[j] = math.MaxInt, math.MinInt
+		}
+		for j := range colLo {
+			colLo[j], colHi[j] = math.MaxInt, math.MinInt
+		}
+		for _, r := range runs {
+			j := r.y - box.Min.Y
+			rowLo[j], rowHi[j] = min(rowLo[j], r.x0), max(rowHi[j], r.x1)
+			for x := r.x0; x < r.x1; x++ {
+				k := x - box.Min.X
+				colLo[k], colHi[k] = min(colLo[k], r.y), max(colHi[k], r.y+1)
+			}
+		}
+		across, lo, hi, start := box.Dy(), rowLo, rowHi, box.Min.Y
+		if box.Dy() > box.Dx() {
+			across, lo, hi, start = box.Dx(), colLo, colHi, box.Min.X
+		}
+		rows := max(1, int(math.Round(float64(across)/dot)))
+		for k := 0; k < rows; k++ {
+			j := min(int((float64(k)+0.5)*float64(across)/float64(rows)), across-1)
+			if lo[j] > hi[j] {
+				continue // A gap across a notch of the opening
+			}
+			a, b := float64(lo[j])+dot/2, float64(hi[j])-dot/2
+			if a > b {
+				a, b = (a+b)/2, (a+b)/2
+			}
+			if k%2 == 1 {
+				a, b = b, a
+			}
+			c := float64(start+j) + 0.5
+			for _, p := range []float64{a, b} {
+				x, y := at(p, c)
+				if box.Dy() > box.Dx() {
+					x, y = at(c, p)
+				}
+				shots[i].path = append(shots[i].path, vec2{X: x, Y: y})
+			}
+		}
+	}
+	return shots
+}
+
+// writeDispenseGCode writes G-code dispensing shots: the valve is held open
+// over a dot as long as its paste takes to come out, and a fill is traced
+// at the speed that lays its paste along it. How much it dispenses is told
+// to out.
+func writeDispenseGCode(filename string, shots []dispenseShot, d Dispenser, out io.Writer) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	total := 0.0
+	for _, s := range shots {
+		total += s.volume
+	}
+	fmt.Fprintf(w, "; Solder paste dispensing, generated by pcb-to-stencil %s\n", toolVersion())
+	fmt.Fprintf(w, "; %d openings, %.3f mm³ of paste at %g mm³/s\n", len(shots), total, d.Rate)
+	fmt.Fprintf(w, "G21 ; mm\nG90 ; Absolute positions\n%s\nG0 Z%g F%g\n", dispenseOff, dispenseLift, dispenseMove)
+	dots, fills := 0, 0
+	for _, s := range shots {
+		seconds := s.volume / d.Rate
+		p := s.path[0]
+		fmt.Fprintf(w, "G0 X%.4f Y%.4f\nG0 Z%g\n%s\n", p.X, p.Y, d.Height, dispenseOn)
+		length := 0.0
+		for i := 1; i < len(s.path); i++ {
+			length += math.Hypot(s.path[i].X-s.path[i-1].X, s.path[i].Y-s.path[i-1].Y)
+		}
+		if length == 0 {
+			fmt.Fprintf(w, "G4 P%.0f\n", seconds*1000)
+			dots++
+		} else {
+			fmt.Fprintf(w, "G1 F%.1f\n", length/seconds*60)
+			for _, p := range s.path[1:] {
+				fmt.Fprintf(w, "G1 X%.4f Y%.4f\n", p.X, p.Y)
+			}
+			fills++
+		}
+		fmt.Fprintf(w, "%s\nG0 Z%g\n", dispenseOff, dispenseLift)
+	}
+	fmt.Fprintf(w, "M2\n")
+	fmt.Fprintf(out, "Dispensing: %d dots and %d fills, %.3f mm³ of paste in about %.0f s of dispensing\n", dots, fills, total, total/d.Rate)
+	return w.Flush()
+}
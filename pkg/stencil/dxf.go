@@ -0,0 +1,364 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/render"
+)
+
+// dxfShape is one closed entity from a DXF file, flattened to a polygon in mm.
+type dxfShape struct {
+	Layer string
+	Poly  []vec2
+}
+
+// dxfUnitScale maps $INSUNITS codes to mm.
+var dxfUnitScale = map[int]float64{
+	1: 25.4,    // Inches
+	2: 304.8,   // Feet
+	4: 1.0,     // Millimeters
+	5: 10.0,    // Centimeters
+	6: 1000.0,  // Meters
+	8: 25.4e-6, // Microinches
+	9: 0.0254,  // Mils
+}
+
+// isDXFOutlineLayer reports whether entities on a layer describe the board
+// (or stencil) outline rather than apertures.
+func isDXFOutlineLayer(layer string) bool {
+	l := strings.ToLower(layer)
+	for _, name := range []string{"outline", "edge", "board", "profile", "border"} {
+		if strings.Contains(l, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// bulgeArc flattens a polyline segment with a bulge (tan of a quarter of the
+// included angle) into points, excluding the start point.
+func bulgeArc(a, b vec2, bulge float64) []vec2 {
+	if bulge == 0 {
+		return []vec2{b}
+	}
+	theta := 4 * math.Atan(bulge)
+	chord := math.Hypot(b.X-a.X, b.Y-a.Y)
+	if chord == 0 {
+		return []vec2{b}
+	}
+	radius := chord / (2 * math.Sin(theta/2))
+	// Center lies on the perpendicular bisector of the chord
+	mx, my := (a.X+b.X)/2, (a.Y+b.Y)/2
+	d := radius * math.Cos(theta/2)
+	nx, ny := -(b.Y-a.Y)/chord, (b.X-a.X)/chord
+	cx, cy := mx+nx*d, my+ny*d
+
+	start := math.Atan2(a.Y-cy, a.X-cx)
+	steps := int(math.Ceil(math.Abs(theta) / (math.Pi / 32)))
+	pts := make([]vec2, 0, steps)
+	r := math.Abs(radius)
+	for s := 1; s < steps; s++ {
+		ang := start + theta*float64(s)/float64(steps)
+		pts = append(pts, vec2{X: cx + r*math.Cos(ang), Y: cy + r*math.Sin(ang)})
+	}
+	return append(pts, b)
+}
+
+// parseDXF reads the closed polylines, circles and full ellipses of an ASCII
+// DXF file. Open geometry is skipped and counted in the returned number.
+func parseDXF(filename string) ([]dxfShape, int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	// Read group code / value pairs
+	type pair struct {
+		code  int
+		value string
+	}
+	var pairs []pair
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		codeLine := strings.TrimSpace(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		code, err := strconv.Atoi(codeLine)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid DXF group code %q", codeLine)
+		}
+		pairs = append(pairs, pair{code, strings.TrimSpace(scanner.Text())})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	scale := 1.0
+	var shapes []dxfShape
+	skipped := 0
+
+	// Split into entities: each starts at a code 0 pair
+	type entity struct {
+		kind  string
+		pairs []pair
+	}
+	var entities []entity
+	for _, p := range pairs {
+		if p.code == 0 {
+			entities = append(entities, entity{kind: p.value})
+		} else if len(entities) > 0 {
+			e := &entities[len(entities)-1]
+			e.pairs = append(e.pairs, p)
+		}
+	}
+
+	// Header units
+	for _, e := range entities {
+		for i, p := range e.pairs {
+			if p.code == 9 && p.value == "$INSUNITS" && i+1 < len(e.pairs) {
+				if u, err := strconv.Atoi(e.pairs[i+1].value); err == nil {
+					if s, ok := dxfUnitScale[u]; ok {
+						scale = s
+					}
+				}
+			}
+		}
+	}
+
+	num := func(v string) float64 {
+		f, _ := strconv.ParseFloat(v, 64)
+		return f * scale
+	}
+
+	inEntities := false
+	var poly *dxfShape // POLYLINE being assembled from VERTEX entities
+	var polyClosed bool
+	var polyBulges []float64
+
+	finishPoly := func(s *dxfShape, closed bool, bulges []float64) {
+		if !closed || len(s.Poly) < 2 {
+			skipped++
+			return
+		}
+		var pts []vec2
+		for i, p := range s.Poly {
+			if i == 0 {
+				pts = append(pts, p)
+			}
+			next := s.Poly[(i+1)%len(s.Poly)]
+			seg := bulgeArc(p, next, bulges[i])
+			if i == len(s.Poly)-1 {
+				seg = seg[:len(seg)-1] // Don't repeat the first point
+			}
+			pts = append(pts, seg...)
+		}
+		if len(pts) >= 3 {
+			shapes = append(shapes, dxfShape{Layer: s.Layer, Poly: pts})
+		}
+	}
+
+	for _, e := range entities {
+		if e.kind == "SECTION" {
+			inEntities = len(e.pairs) > 0 && e.pairs[0].value == "ENTITIES"
+			continue
+		}
+		if e.kind == "ENDSEC" {
+			inEntities = false
+			continue
+		}
+		if !inEntities {
+			continue
+		}
+
+		layer := ""
+		for _, p := range e.pairs {
+			if p.code == 8 {
+				layer = p.value
+			}
+		}
+
+		switch e.kind {
+		case "LWPOLYLINE":
+			s := dxfShape{Layer: layer}
+			closed := false
+			var bulges []float64
+			var x float64
+			for _, p := range e.pairs {
+				switch p.code {
+				case 70:
+					flags, _ := strconv.Atoi(p.value)
+					closed = flags&1 != 0
+				case 10:
+					x = num(p.value)
+				case 20:
+					s.Poly = append(s.Poly, vec2{X: x, Y: num(p.value)})
+					bulges = append(bulges, 0)
+				case 42:
+					if len(bulges) > 0 {
+						bulges[len(bulges)-1], _ = strconv.ParseFloat(p.value, 64)
+					}
+				}
+			}
+			// A polyline that ends where it starts is closed too
+			if n := len(s.Poly); n > 2 && s.Poly[0] == s.Poly[n-1] {
+				s.Poly, bulges, closed = s.Poly[:n-1], bulges[:n-1], true
+			}
+			finishPoly(&s, closed, bulges)
+		case "POLYLINE":
+			poly = &dxfShape{Layer: layer}
+			polyBulges = nil
+			polyClosed = false
+			for _, p := range e.pairs {
+				if p.code == 70 {
+					flags, _ := strconv.Atoi(p.value)
+					polyClosed = flags&1 != 0
+				}
+			}
+		case "VERTEX":
+			if poly != nil {
+				var x, y, bulge float64
+				for _, p := range e.pairs {
+					switch p.code {
+					case 10:
+						x = num(p.value)
+					case 20:
+						y = num(p.value)
+					case 42:
+						bulge, _ = strconv.ParseFloat(p.value, 64)
+					}
+				}
+				poly.Poly = append(poly.Poly, vec2{X: x, Y: y})
+				polyBulges = append(polyBulges, bulge)
+			}
+		case "SEQEND":
+			if poly != nil {
+				if n := len(poly.Poly); n > 2 && poly.Poly[0] == poly.Poly[n-1] {
+					poly.Poly, polyBulges, polyClosed = poly.Poly[:n-1], polyBulges[:n-1], true
+				}
+				finishPoly(poly, polyClosed, polyBulges)
+				poly = nil
+			}
+		case "CIRCLE":
+			var cx, cy, r float64
+			for _, p := range e.pairs {
+				switch p.code {
+				case 10:
+					cx = num(p.value)
+				case 20:
+					cy = num(p.value)
+				case 40:
+					r = num(p.value)
+				}
+			}
+			shapes = append(shapes, dxfShape{Layer: layer, Poly: ellipsePoly(cx, cy, r, r)})
+		case "ELLIPSE":
+			var cx, cy, mx, my, ratio float64
+			startParam, endParam := 0.0, 2*math.Pi
+			for _, p := range e.pairs {
+				v, _ := strconv.ParseFloat(p.value, 64)
+				switch p.code {
+				case 10:
+					cx = v * scale
+				case 20:
+					cy = v * scale
+				case 11:
+					mx = v * scale
+				case 21:
+					my = v * scale
+				case 40:
+					ratio = v
+				case 41:
+					startParam = v
+				case 42:
+					endParam = v
+				}
+			}
+			if math.Abs(endParam-startParam-2*math.Pi) > 1e-6 {
+				skipped++ // Elliptical arc
+				continue
+			}
+			major := math.Hypot(mx, my)
+			rot := math.Atan2(my, mx)
+			var pts []vec2
+			for _, p := range ellipsePoly(0, 0, major, major*ratio) {
+				pts = append(pts, vec2{
+					X: cx + p.X*math.Cos(rot) - p.Y*math.Sin(rot),
+					Y: cy + p.X*math.Sin(rot) + p.Y*math.Cos(rot),
+				})
+			}
+			shapes = append(shapes, dxfShape{Layer: layer, Poly: pts})
+		case "LINE", "ARC", "SPLINE", "TEXT", "MTEXT", "INSERT":
+			skipped++
+		}
+	}
+
+	if len(shapes) == 0 {
+		return nil, skipped, fmt.Errorf("no closed polylines, circles or ellipses found in DXF")
+	}
+	return shapes, skipped, nil
+}
+
+// RenderDXF rasterizes the closed shapes of a DXF. Shapes on outline layers
+// are rendered into a separate filled outline image; all others become holes
+// in the stencil image. outlineImg is nil if the file has no outline layer.
+// Entities it skips are counted to out.
+func RenderDXF(filename string, dpi, margin float64, out io.Writer) (image.Image, image.Image, error) {
+	shapes, skipped, err := parseDXF(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(out, "Skipped %d open or unsupported DXF entities\n", skipped)
+	}
+
+	b := gerber.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	hasOutline := false
+	for _, s := range shapes {
+		for _, p := range s.Poly {
+			b = b.Union(gerber.Bounds{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+		}
+		if isDXFOutlineLayer(s.Layer) {
+			hasOutline = true
+		}
+	}
+
+	scale := dpi / 25.4
+	if err := render.CheckSize((b.MaxX-b.MinX+2*margin)*scale, (b.MaxY-b.MinY+2*margin)*scale); err != nil {
+		return nil, nil, err
+	}
+	imgWidth := int((b.MaxX - b.MinX + 2*margin) * scale)
+	imgHeight := int((b.MaxY - b.MinY + 2*margin) * scale)
+	img := render.NewBitmap(imgWidth, imgHeight)
+	var outlineImg *render.Bitmap
+	if hasOutline {
+		outlineImg = render.NewBitmap(imgWidth, imgHeight)
+	}
+
+	for _, s := range shapes {
+		// Flip Y for image coords
+		px := make([]vec2, len(s.Poly))
+		for i, p := range s.Poly {
+			px[i] = vec2{X: (p.X - b.MinX + margin) * scale, Y: (b.MaxY - p.Y + margin) * scale}
+		}
+		if isDXFOutlineLayer(s.Layer) {
+			render.FillPolygons(outlineImg, [][]vec2{px}, false)
+		} else {
+			render.FillPolygons(img, [][]vec2{px}, false)
+		}
+	}
+
+	if outlineImg == nil {
+		return img, nil, nil
+	}
+	return img, outlineImg, nil
+}
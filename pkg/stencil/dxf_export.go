@@ -0,0 +1,93 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Layers of the exported DXF. The outline layer's name is one parseDXF picks
+// up as an outline, so the file can be read back in.
+const (
+	dxfApertureLayer = "APERTURES"
+	dxfOutlineLayer  = "OUTLINE"
+)
+
+// WriteStencilDXF writes the stencil's cut lines as an R12 DXF in mm: the
+// boundary of each opening as a closed polyline on the APERTURES layer, and
+// the board outline (or the edge of frame when there is no outline) on the
+// OUTLINE layer. Coordinates are the gerber's, as seen from the top.
+func WriteStencilDXF(filename string, paste, outline *gerber.File, frame gerber.Bounds, cfg Config) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	pair := func(code int, value string) { fmt.Fprintf(w, "%d\n%s\n", code, value) }
+	num := func(code int, v float64) { pair(code, fmt.Sprintf("%.4f", v)) }
+
+	pair(0, "SECTION")
+	pair(2, "HEADER")
+	pair(9, "$ACADVER")
+	pair(1, "AC1009")
+	pair(9, "$INSUNITS")
+	pair(70, "4") // Millimeters
+	pair(0, "ENDSEC")
+
+	pair(0, "SECTION")
+	pair(2, "TABLES")
+	pair(0, "TABLE")
+	pair(2, "LAYER")
+	pair(70, "2")
+	for _, l := range []struct {
+		name  string
+		color int
+	}{{dxfApertureLayer, 1}, {dxfOutlineLayer, 5}} {
+		pair(0, "LAYER")
+		pair(2, l.name)
+		pair(70, "0")
+		pair(62, fmt.Sprint(l.color))
+		pair(6, "CONTINUOUS")
+	}
+	pair(0, "ENDTAB")
+	pair(0, "ENDSEC")
+
+	pair(0, "SECTION")
+	pair(2, "ENTITIES")
+	polyline := func(layer string, pts []vec2, closed bool) {
+		pair(0, "POLYLINE")
+		pair(8, layer)
+		pair(66, "1")
+		flags := "0"
+		if closed {
+			flags = "1"
+		}
+		pair(70, flags)
+		for _, p := range pts {
+			pair(0, "VERTEX")
+			pair(8, layer)
+			num(10, p.X)
+			num(20, p.Y)
+			num(30, 0)
+		}
+		pair(0, "SEQEND")
+		pair(8, layer)
+	}
+
+	paths, closed := cutOutline(outline, frame, cfg.Kerf)
+	for i, p := range paths {
+		polyline(dxfOutlineLayer, p, closed[i])
+	}
+	contours := cutApertures(paste, cfg.Kerf, cfg.Log)
+	for _, c := range contours {
+		polyline(dxfApertureLayer, c, true)
+	}
+	pair(0, "ENDSEC")
+	pair(0, "EOF")
+	fmt.Fprintf(cfg.Stdout, "DXF: %d aperture contours\n", len(contours))
+	return w.Flush()
+}
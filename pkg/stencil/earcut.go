@@ -0,0 +1,485 @@
+package stencil
+
+import (
+	"math"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Ear clipping triangulation of polygons with holes, after the approach of
+// mapbox/earcut: holes are bridged into the outer ring, then ears are cut off
+// the resulting ring. Large rings index their vertices along a z-order curve
+// so each ear test only looks at nearby vertices.
+
+type earNode struct {
+	x, y         float64
+	z            int32
+	seen         int // earGrid query stamp
+	prev, next   *earNode
+	prevZ, nextZ *earNode
+}
+
+// earArea is twice the signed area of a, b, c: positive when they turn left.
+func earArea(a, b, c *earNode) float64 {
+	return (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+}
+
+func earEquals(a, b *earNode) bool {
+	return a.x == b.x && a.y == b.y
+}
+
+// earInTriangle reports whether p lies in the counter-clockwise triangle a b c
+// or on its boundary.
+func earInTriangle(ax, ay, bx, by, cx, cy, px, py float64) bool {
+	return (bx-ax)*(py-ay)-(by-ay)*(px-ax) >= 0 &&
+		(cx-bx)*(py-by)-(cy-by)*(px-bx) >= 0 &&
+		(ax-cx)*(py-cy)-(ay-cy)*(px-cx) >= 0
+}
+
+// earRing links pts into a circular list, counter-clockwise for an outer
+// ring and clockwise for a hole, and returns its last node.
+func earRing(pts []vec2, ccw bool) *earNode {
+	var last *earNode
+	add := func(p vec2) {
+		n := &earNode{x: p.X, y: p.Y}
+		if last == nil {
+			n.prev, n.next = n, n
+		} else {
+			n.next, n.prev = last.next, last
+			last.next.prev = n
+			last.next = n
+		}
+		last = n
+	}
+	if (gerber.SignedArea(pts) > 0) == ccw {
+		for _, p := range pts {
+			add(p)
+		}
+	} else {
+		for i := len(pts) - 1; i >= 0; i-- {
+			add(pts[i])
+		}
+	}
+	if last != nil && earEquals(last, last.next) {
+		next := last.next
+		earRemove(last)
+		last = next
+	}
+	return last
+}
+
+func earRemove(n *earNode) {
+	n.next.prev = n.prev
+	n.prev.next = n.next
+	if n.prevZ != nil {
+		n.prevZ.nextZ = n.nextZ
+	}
+	if n.nextZ != nil {
+		n.nextZ.prevZ = n.prevZ
+	}
+}
+
+// earFilter removes duplicate and collinear points between start and end,
+// adding a flat triangle to tris for each collinear one so the edges along
+// it still meet the faces next to it.
+func earFilter(start, end *earNode, tris *[][3]vec2) *earNode {
+	if start == nil {
+		return nil
+	}
+	if end == nil {
+		end = start
+	}
+	p := start
+	for {
+		again := false
+		if earEquals(p, p.next) || earArea(p.prev, p, p.next) == 0 {
+			if !earEquals(p, p.next) && !earEquals(p, p.prev) {
+				*tris = append(*tris, [3]vec2{{X: p.prev.x, Y: p.prev.y}, {X: p.x, Y: p.y}, {X: p.next.x, Y: p.next.y}})
+			}
+			earRemove(p)
+			p, end = p.prev, p.prev
+			if p == p.next {
+				break
+			}
+			again = true
+		} else {
+			p = p.next
+		}
+		if !again && p == end {
+			break
+		}
+	}
+	return end
+}
+
+// earcut triangulates a polygon given by its outer ring and holes, returning
+// counter-clockwise triangles.
+func earcut(outer []vec2, holes [][]vec2) [][3]vec2 {
+	ring := earRing(outer, true)
+	if ring == nil || ring.next == ring.prev {
+		return nil
+	}
+	n := len(outer)
+	for _, h := range holes {
+		n += len(h)
+	}
+	var tris [][3]vec2
+	if len(holes) > 0 {
+		ring = earHoles(holes, ring, gerber.PolyBounds(outer), n, &tris)
+	}
+
+	// Hash the vertices along a z-order curve once the ring is big enough for
+	// brute force ear tests to hurt
+	var minX, minY, invSize float64
+	if n > 80 {
+		b := gerber.PolyBounds(outer)
+		minX, minY = b.MinX, b.MinY
+		if size := math.Max(b.MaxX-b.MinX, b.MaxY-b.MinY); size > 0 {
+			invSize = 32767 / size
+		}
+	}
+
+	earcutLinked(ring, &tris, minX, minY, invSize, 0)
+	return tris
+}
+
+func earcutLinked(ear *earNode, tris *[][3]vec2, minX, minY, invSize float64, pass int) {
+	if ear == nil {
+		return
+	}
+	if pass == 0 && invSize != 0 {
+		earIndexCurve(ear, minX, minY, invSize)
+	}
+
+	stop := ear
+	for ear.prev != ear.next {
+		prev, next := ear.prev, ear.next
+		isEar := false
+		switch {
+		case pass == 2:
+			isEar = earArea(prev, ear, next) > 0 // Last resort: any convex corner
+		case invSize != 0:
+			isEar = earIsEarHashed(ear, minX, minY, invSize)
+		default:
+			isEar = earIsEar(ear)
+		}
+		if isEar {
+			*tris = append(*tris, [3]vec2{{X: prev.x, Y: prev.y}, {X: ear.x, Y: ear.y}, {X: next.x, Y: next.y}})
+			earRemove(ear)
+			ear, stop = next.next, next.next
+			continue
+		}
+
+		ear = next
+		if ear == stop {
+			// No ear found in a whole lap: drop degenerate points and retry,
+			// then give up on exactness rather than leave a hole in the face
+			if pass < 2 {
+				earcutLinked(earFilter(ear, nil, tris), tris, minX, minY, invSize, pass+1)
+			}
+			return
+		}
+	}
+}
+
+func earIsEar(ear *earNode) bool {
+	a, b, c := ear.prev, ear, ear.next
+	if earArea(a, b, c) <= 0 {
+		return false // Reflex
+	}
+	for p := c.next; p != a; p = p.next {
+		if earBlocks(a, b, c, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// earBlocks reports whether p, a reflex vertex other than the corners, lies
+// in the candidate ear a b c.
+func earBlocks(a, b, c, p *earNode) bool {
+	return !earEquals(p, a) && !earEquals(p, b) && !earEquals(p, c) &&
+		earInTriangle(a.x, a.y, b.x, b.y, c.x, c.y, p.x, p.y) &&
+		earArea(p.prev, p, p.next) <= 0
+}
+
+func earIsEarHashed(ear *earNode, minX, minY, invSize float64) bool {
+	a, b, c := ear.prev, ear, ear.next
+	if earArea(a, b, c) <= 0 {
+		return false
+	}
+	x0, x1 := math.Min(a.x, math.Min(b.x, c.x)), math.Max(a.x, math.Max(b.x, c.x))
+	y0, y1 := math.Min(a.y, math.Min(b.y, c.y)), math.Max(a.y, math.Max(b.y, c.y))
+	minZ := earZOrder(x0, y0, minX, minY, invSize)
+	maxZ := earZOrder(x1, y1, minX, minY, invSize)
+
+	for p := ear.prevZ; p != nil && p.z >= minZ; p = p.prevZ {
+		if p != a && p != c && earBlocks(a, b, c, p) {
+			return false
+		}
+	}
+	for p := ear.nextZ; p != nil && p.z <= maxZ; p = p.nextZ {
+		if p != a && p != c && earBlocks(a, b, c, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// earZOrder interleaves the bits of a point's 15 bit grid coordinates.
+func earZOrder(x, y, minX, minY, invSize float64) int32 {
+	spread := func(v int32) int32 {
+		v = (v | v<<8) & 0x00FF00FF
+		v = (v | v<<4) & 0x0F0F0F0F
+		v = (v | v<<2) & 0x33333333
+		v = (v | v<<1) & 0x55555555
+		return v
+	}
+	ix := int32((x - minX) * invSize)
+	iy := int32((y - minY) * invSize)
+	return spread(ix) | spread(iy)<<1
+}
+
+// earIndexCurve sets every node's z-order value and links the nodes in z
+// order.
+func earIndexCurve(start *earNode, minX, minY, invSize float64) {
+	p := start
+	for {
+		p.z = earZOrder(p.x, p.y, minX, minY, invSize)
+		p.prevZ, p.nextZ = p.prev, p.next
+		p = p.next
+		if p == start {
+			break
+		}
+	}
+	p.prevZ.nextZ = nil
+	p.prevZ = nil
+	earSortZ(p)
+}
+
+// earSortZ sorts the z list starting at list with a bottom-up merge sort.
+func earSortZ(list *earNode) *earNode {
+	for inSize := 1; ; inSize *= 2 {
+		p := list
+		list = nil
+		var tail *earNode
+		merges := 0
+		for p != nil {
+			merges++
+			q := p
+			pSize := 0
+			for i := 0; i < inSize && q != nil; i++ {
+				pSize++
+				q = q.nextZ
+			}
+			qSize := inSize
+			for pSize > 0 || (qSize > 0 && q != nil) {
+				var e *earNode
+				if pSize != 0 && (qSize == 0 || q == nil || p.z <= q.z) {
+					e, p = p, p.nextZ
+					pSize--
+				} else {
+					e, q = q, q.nextZ
+					qSize--
+				}
+				if tail != nil {
+					tail.nextZ = e
+				} else {
+					list = e
+				}
+				e.prevZ = tail
+				tail = e
+			}
+			p = q
+		}
+		tail.nextZ = nil
+		if merges <= 1 {
+			return list
+		}
+	}
+}
+
+// earGrid buckets ring nodes by the cells covered by the edge to their next
+// node, so finding a hole's bridge only looks at nearby edges. Boards have
+// thousands of pads, and scanning the whole ring for each would be quadratic.
+type earGrid struct {
+	minX, minY, cell float64
+	nx, ny           int
+	cells            [][]*earNode
+	stamp            int
+}
+
+func newEarGrid(b gerber.Bounds, n int) *earGrid {
+	side := max(1, min(1024, int(math.Sqrt(float64(n)/2))))
+	cell := math.Max(b.MaxX-b.MinX, b.MaxY-b.MinY) / float64(side)
+	if cell <= 0 {
+		cell = 1
+	}
+	g := &earGrid{minX: b.MinX, minY: b.MinY, cell: cell}
+	g.nx = int((b.MaxX-b.MinX)/cell) + 1
+	g.ny = int((b.MaxY-b.MinY)/cell) + 1
+	g.cells = make([][]*earNode, g.nx*g.ny)
+	return g
+}
+
+func (g *earGrid) col(x float64) int {
+	return max(0, min(g.nx-1, int((x-g.minX)/g.cell)))
+}
+
+func (g *earGrid) row(y float64) int {
+	return max(0, min(g.ny-1, int((y-g.minY)/g.cell)))
+}
+
+// insert adds p under every cell its outgoing edge passes near. Nodes whose
+// edge changes later stay where they were, which only costs extra checks.
+func (g *earGrid) insert(p *earNode) {
+	q := p.next
+	for r := g.row(math.Min(p.y, q.y)); r <= g.row(math.Max(p.y, q.y)); r++ {
+		for c := g.col(math.Min(p.x, q.x)); c <= g.col(math.Max(p.x, q.x)); c++ {
+			g.cells[r*g.nx+c] = append(g.cells[r*g.nx+c], p)
+		}
+	}
+}
+
+func (g *earGrid) insertRing(start *earNode) {
+	p := start
+	for {
+		g.insert(p)
+		p = p.next
+		if p == start {
+			break
+		}
+	}
+}
+
+// earHoles bridges every hole into the outer ring, leftmost hole first.
+func earHoles(holes [][]vec2, outer *earNode, b gerber.Bounds, n int, tris *[][3]vec2) *earNode {
+	g := newEarGrid(b, n)
+	g.insertRing(outer)
+	var queue []*earNode
+	for _, h := range holes {
+		ring := earRing(h, false)
+		if ring == nil || ring.next == ring.prev {
+			continue
+		}
+		queue = append(queue, earLeftmost(ring))
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].x != queue[j].x {
+			return queue[i].x < queue[j].x
+		}
+		return queue[i].y < queue[j].y
+	})
+	for _, h := range queue {
+		bridge := g.findBridge(h)
+		if bridge == nil {
+			continue
+		}
+		g.insertRing(h)
+		reverse := earSplit(bridge, h)
+		g.insert(bridge)
+		g.insert(reverse.next) // The copy of bridge, with its old edge
+		g.insert(reverse)
+	}
+	return earFilter(outer, nil, tris)
+}
+
+func earLeftmost(start *earNode) *earNode {
+	left := start
+	for p := start.next; p != start; p = p.next {
+		if p.x < left.x || (p.x == left.x && p.y < left.y) {
+			left = p
+		}
+	}
+	return left
+}
+
+// findBridge finds a ring vertex visible from the hole's leftmost point, by
+// casting a ray to the left.
+func (g *earGrid) findBridge(hole *earNode) *earNode {
+	hx, hy := hole.x, hole.y
+	qx := math.Inf(-1)
+	var m *earNode
+
+	// The nearest edge crossed by the ray; its left end is a candidate. A
+	// crossing lies in a cell the edge was filed under, so cells to the
+	// left of one stop mattering.
+	r := g.row(hy)
+	for c := g.col(hx); c >= 0 && qx < g.minX+float64(c+1)*g.cell; c-- {
+		for _, p := range g.cells[r*g.nx+c] {
+			if hy <= p.y && hy >= p.next.y && p.next.y != p.y {
+				x := p.x + (hy-p.y)*(p.next.x-p.x)/(p.next.y-p.y)
+				if x <= hx && x > qx {
+					qx = x
+					m = p.next
+					if p.x < p.next.x {
+						m = p
+					}
+					if x == hx {
+						return m // The hole touches the edge
+					}
+				}
+			}
+		}
+	}
+	if m == nil {
+		return nil
+	}
+
+	// Vertices inside the triangle of the hole point, the crossing and the
+	// candidate would block it; take the one closest in angle to the ray
+	mx, my := m.x, m.y
+	ax, cx := qx, hx
+	if hy < my {
+		ax, cx = hx, qx
+	}
+	tanMin := math.Inf(1)
+	g.stamp++
+	for r := g.row(math.Min(hy, my)); r <= g.row(math.Max(hy, my)); r++ {
+		for c := g.col(mx); c <= g.col(hx); c++ {
+			for _, p := range g.cells[r*g.nx+c] {
+				if p.seen == g.stamp {
+					continue
+				}
+				p.seen = g.stamp
+				if hx >= p.x && p.x >= mx && hx != p.x && earInTriangle(ax, hy, mx, my, cx, hy, p.x, p.y) {
+					tan := math.Abs(hy-p.y) / (hx - p.x)
+					if earLocallyInside(p, hole) && (tan < tanMin || (tan == tanMin && (p.x > m.x || (p.x == m.x && earSectorContains(m, p))))) {
+						m = p
+						tanMin = tan
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// earSectorContains reports whether the angle at m contains the one at p.
+func earSectorContains(m, p *earNode) bool {
+	return earArea(m.prev, m, p.prev) > 0 && earArea(p.next, m, m.next) > 0
+}
+
+// earLocallyInside reports whether the diagonal a-b starts into the polygon
+// at a.
+func earLocallyInside(a, b *earNode) bool {
+	if earArea(a.prev, a, a.next) > 0 {
+		return earArea(a, b, a.next) <= 0 && earArea(a, a.prev, b) <= 0
+	}
+	return earArea(a, b, a.prev) > 0 || earArea(a, a.next, b) > 0
+}
+
+// earSplit joins a and b with a double diagonal, splitting or (for a hole)
+// merging rings, and returns the copy of b.
+func earSplit(a, b *earNode) *earNode {
+	a2 := &earNode{x: a.x, y: a.y}
+	b2 := &earNode{x: b.x, y: b.y}
+	an, bp := a.next, b.prev
+
+	a.next, b.prev = b, a
+	a2.next, an.prev = an, a2
+	b2.next, a2.prev = a2, b2
+	bp.next, b2.prev = b2, bp
+	return b2
+}
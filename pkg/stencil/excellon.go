@@ -0,0 +1,212 @@
+package stencil
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type DrillHole struct {
+	X, Y     float64 // Center in mm
+	Diameter float64 // mm
+	Plated   bool
+}
+
+type DrillFile struct {
+	Tools       map[int]float64 // Tool number -> diameter in mm
+	ToolsPlated map[int]bool
+	Holes       []DrillHole
+}
+
+// PlatedHoles returns the holes that are copper plated (vias, THT pads).
+func (df *DrillFile) PlatedHoles() []DrillHole {
+	var holes []DrillHole
+	for _, h := range df.Holes {
+		if h.Plated {
+			holes = append(holes, h)
+		}
+	}
+	return holes
+}
+
+// MountingHoles returns the non-plated holes, which are usually mounting or
+// tooling holes.
+func (df *DrillFile) MountingHoles() []DrillHole {
+	var holes []DrillHole
+	for _, h := range df.Holes {
+		if !h.Plated {
+			holes = append(holes, h)
+		}
+	}
+	return holes
+}
+
+// ParseExcellon parses an Excellon (NC drill) file. Coordinates and tool
+// diameters are converted to mm.
+func ParseExcellon(filename string) (*DrillFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	df := &DrillFile{Tools: make(map[int]float64), ToolsPlated: make(map[int]bool)}
+	scanner := bufio.NewScanner(file)
+
+	// Regex for tool definitions: T1C0.800 or T01F00S00C0.0310
+	reTool := regexp.MustCompile(`^T(\d+)(?:[FS][\d\.]+)*C([\d\.]+)`)
+	// Regex for coordinates: X12.5Y3.2 or X012500Y003200
+	reCoord := regexp.MustCompile(`([XY])([\d\.\-\+]+)`)
+	// Regex for explicit format comments: ;FILE_FORMAT=3:3
+	reFormat := regexp.MustCompile(`FILE_FORMAT=(\d):(\d)`)
+
+	unitScale := 1.0 // mm per file unit
+	integer, decimal := 3, 3
+	leadingZeros := true // LZ: leading zeros kept, trailing suppressed
+	plated := !strings.Contains(strings.ToUpper(filepath.Base(filename)), "NPTH")
+	// KiCad mixed-plating files annotate each tool with an attribute comment
+	toolPlated := plated
+	inHeader := false
+	curTool := 0
+	curX, curY := 0.0, 0.0
+
+	parseCoord := func(valStr string) float64 {
+		if strings.Contains(valStr, ".") {
+			val, _ := strconv.ParseFloat(valStr, 64)
+			return val * unitScale
+		}
+		neg := strings.HasPrefix(valStr, "-")
+		digits := strings.TrimLeft(valStr, "+-")
+		if leadingZeros {
+			// Trailing zeros were suppressed, pad back to full width
+			for len(digits) < integer+decimal {
+				digits += "0"
+			}
+		}
+		val, _ := strconv.ParseFloat(digits, 64)
+		val /= math.Pow(10, float64(decimal))
+		if neg {
+			val = -val
+		}
+		return val * unitScale
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, ";") {
+			upper := strings.ToUpper(line)
+			if strings.Contains(upper, "TYPE=NON_PLATED") {
+				plated, toolPlated = false, false
+			} else if strings.Contains(upper, "TYPE=PLATED") {
+				plated, toolPlated = true, true
+			} else if strings.Contains(upper, "APERFUNCTION,NONPLATED") {
+				toolPlated = false
+			} else if strings.Contains(upper, "APERFUNCTION,PLATED") {
+				toolPlated = true
+			}
+			if m := reFormat.FindStringSubmatch(line); len(m) == 3 {
+				integer, _ = strconv.Atoi(m[1])
+				decimal, _ = strconv.Atoi(m[2])
+			}
+			continue
+		}
+
+		switch {
+		case line == "M48":
+			inHeader = true
+			continue
+		case line == "%" || line == "M95":
+			inHeader = false
+			continue
+		case line == "M30" || line == "M00":
+			return df, nil
+		}
+
+		if strings.HasPrefix(line, "METRIC") || strings.HasPrefix(line, "INCH") {
+			if strings.HasPrefix(line, "INCH") {
+				unitScale = 25.4
+				integer, decimal = 2, 4
+			} else {
+				unitScale = 1.0
+				integer, decimal = 3, 3
+			}
+			// Optional zero mode and format: METRIC,LZ,000.000
+			parts := strings.Split(line, ",")
+			for _, p := range parts[1:] {
+				switch {
+				case p == "LZ":
+					leadingZeros = true
+				case p == "TZ":
+					leadingZeros = false
+				case strings.Contains(p, "."):
+					fmtParts := strings.SplitN(p, ".", 2)
+					integer, decimal = len(fmtParts[0]), len(fmtParts[1])
+				}
+			}
+			continue
+		}
+		if line == "M71" {
+			unitScale = 1.0
+			continue
+		}
+		if line == "M72" {
+			unitScale = 25.4
+			continue
+		}
+
+		if strings.HasPrefix(line, "T") {
+			if m := reTool.FindStringSubmatch(line); len(m) == 3 {
+				tool, _ := strconv.Atoi(m[1])
+				dia, _ := strconv.ParseFloat(m[2], 64)
+				df.Tools[tool] = dia * unitScale
+				df.ToolsPlated[tool] = toolPlated
+				toolPlated = plated
+				if !inHeader {
+					curTool = tool
+				}
+				continue
+			}
+			if tool, err := strconv.Atoi(line[1:]); err == nil {
+				curTool = tool
+			}
+			continue
+		}
+
+		if inHeader {
+			continue
+		}
+
+		// Ignore routing and mode G-codes for now
+		if strings.HasPrefix(line, "G") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "X") || strings.HasPrefix(line, "Y") {
+			if strings.Contains(line, "G85") {
+				// Drilled slot: X..Y..G85X..Y.. - record the start position only
+				line = line[:strings.Index(line, "G85")]
+			}
+			for _, m := range reCoord.FindAllStringSubmatch(line, -1) {
+				v := parseCoord(m[2])
+				if m[1] == "X" {
+					curX = v
+				} else {
+					curY = v
+				}
+			}
+			if dia, ok := df.Tools[curTool]; ok && dia > 0 {
+				df.Holes = append(df.Holes, DrillHole{X: curX, Y: curY, Diameter: dia, Plated: df.ToolsPlated[curTool]})
+			}
+		}
+	}
+
+	return df, scanner.Err()
+}
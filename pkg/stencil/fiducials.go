@@ -0,0 +1,80 @@
+package stencil
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// fiducialDiameter is the size in mm of the marks engraved for fiducials
+// from a centroid file, which doesn't say how large they are.
+const fiducialDiameter = 1.0
+
+// Fiducial is a fiducial mark on the board, mm.
+type Fiducial struct {
+	X, Y     float64
+	Diameter float64
+}
+
+// gerberFiducials returns the flashes of apertures with an X2 FiducialPad
+// function, with the aperture's size.
+func gerberFiducials(gf *gerber.File) []Fiducial {
+	var fids []Fiducial
+	var x, y float64
+	var ap gerber.Aperture
+	for _, cmd := range gf.Commands {
+		if cmd.X != nil {
+			x = *cmd.X
+		}
+		if cmd.Y != nil {
+			y = *cmd.Y
+		}
+		switch cmd.Type {
+		case "APERTURE":
+			ap = gf.State.Apertures[*cmd.D]
+		case "FLASH":
+			if strings.HasPrefix(ap.Function, "FiducialPad") && len(ap.Modifiers) > 0 {
+				fids = append(fids, Fiducial{x, y, ap.Modifiers[0]})
+			}
+		}
+	}
+	return fids
+}
+
+// loadFiducials reads the fiducials of the given side from a centroid file
+// (.pos, .csv or .txt), as the components whose references start with FID,
+// or from the FiducialPad flashes of a gerber, such as the copper layer.
+// They're mirrored across the axis like the paste layer.
+func loadFiducials(path, side, mirror string) ([]Fiducial, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pos", ".csv", ".txt":
+		places, err := loadPlacements(path, side, mirror)
+		if err != nil {
+			return nil, err
+		}
+		var fids []Fiducial
+		for _, p := range places {
+			if strings.HasPrefix(strings.ToUpper(p.Ref), "FID") {
+				fids = append(fids, Fiducial{p.X, p.Y, fiducialDiameter})
+			}
+		}
+		return fids, nil
+	}
+	gf, err := gerber.ParseMirrored(path, mirror)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing fiducial gerber: %v", err)
+	}
+	return gerberFiducials(gf), nil
+}
+
+// fiducialZone returns a step zone engraving the fiducials into the
+// squeegee side, half as deep as the plate.
+func fiducialZone(fids []Fiducial, cfg Config) StepZone {
+	var marks [][]vec2
+	for _, f := range fids {
+		marks = append(marks, gerber.CirclePoly(f.X, f.Y, f.Diameter/2))
+	}
+	return StepZone{Thickness: cfg.StencilHeight / 2, Shapes: polygonRegion(marks), Name: "the fiducial marks"}
+}
@@ -0,0 +1,95 @@
+package stencil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GerberJob is the subset of a Gerber job file (.gbrjob) used by the tool.
+type GerberJob struct {
+	Header struct {
+		GenerationSoftware struct {
+			Vendor      string
+			Application string
+			Version     string
+		}
+		CreationDate string
+	}
+	GeneralSpecs struct {
+		ProjectId struct {
+			Name     string
+			GUID     string
+			Revision string
+		}
+		Size struct {
+			X, Y float64 // mm
+		}
+		LayerNumber    int
+		BoardThickness float64 // mm
+	}
+	FilesAttributes []struct {
+		Path         string
+		FileFunction string
+		FilePolarity string
+	}
+
+	dir string // Directory the job file was read from
+}
+
+// ParseGerberJob reads a Gerber job file.
+func ParseGerberJob(filename string) (*GerberJob, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	job := &GerberJob{dir: filepath.Dir(filename)}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("invalid gerber job file: %v", err)
+	}
+	return job, nil
+}
+
+// Layers returns the files listed in the job with their roles.
+func (job *GerberJob) Layers() []LayerInfo {
+	var layers []LayerInfo
+	for _, fa := range job.FilesAttributes {
+		info := LayerInfo{
+			Path:   filepath.Join(job.dir, filepath.FromSlash(fa.Path)),
+			Source: "gbrjob " + fa.FileFunction,
+		}
+		parts := strings.Split(fa.FileFunction, ",")
+		switch strings.ToLower(parts[0]) {
+		case "solderpaste", "paste":
+			info.Role, info.Side = RolePaste, SideTop
+			if len(parts) > 1 && strings.EqualFold(parts[1], "Bot") {
+				info.Side = SideBottom
+			}
+		case "profile":
+			info.Role = RoleOutline
+		case "plated", "nonplated", "mixedplating":
+			info.Role = RoleDrill
+		}
+		layers = append(layers, info)
+	}
+	return layers
+}
+
+// Summary returns a one line description of the board for reports.
+func (job *GerberJob) Summary() string {
+	spec := job.GeneralSpecs
+	s := spec.ProjectId.Name
+	if spec.ProjectId.Revision != "" && spec.ProjectId.Revision != "rev?" {
+		s += " " + spec.ProjectId.Revision
+	}
+	s += fmt.Sprintf(": %.2f x %.2f mm", spec.Size.X, spec.Size.Y)
+	if spec.BoardThickness > 0 {
+		s += fmt.Sprintf(", %.2f mm thick", spec.BoardThickness)
+	}
+	if spec.LayerNumber > 0 {
+		s += fmt.Sprintf(", %d layers", spec.LayerNumber)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// gcodeMaxPower is the S value of full laser power, GRBL's default $30.
+const gcodeMaxPower = 1000
+
+// LaserJob holds the settings of a laser cut.
+type LaserJob struct {
+	Power  float64 // Percent of full power
+	Speed  float64 // Cutting feed rate, mm/min
+	Passes int     // Times each path is cut
+}
+
+// WriteStencilGCode writes G-code that cuts the stencil's cut lines with a
+// laser, compensated for cfg.Kerf: every pass over the apertures, then over the
+// outline, so the stencil stays in place until its openings are done.
+// Coordinates are mm from the bottom left of frame. The laser runs in GRBL's
+// dynamic power mode (M4), which scales power with speed so corners don't
+// burn through.
+func WriteStencilGCode(filename string, paste, outline *gerber.File, frame gerber.Bounds, cfg Config) error {
+	job := LaserJob{Power: cfg.LaserPower, Speed: cfg.LaserSpeed, Passes: cfg.LaserPasses}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	paths, closed := cutOutline(outline, frame, cfg.Kerf)
+	contours := cutApertures(paste, cfg.Kerf, cfg.Log)
+	passes := max(job.Passes, 1)
+	power := min(max(job.Power, 0), 100) / 100 * gcodeMaxPower
+
+	fmt.Fprintf(w, "; Solder paste stencil, generated by pcb-to-stencil %s\n", toolVersion())
+	fmt.Fprintf(w, "; %d apertures and %d outline paths, %d passes at %g%% power and %g mm/min\n", len(contours), len(paths), passes, job.Power, job.Speed)
+	fmt.Fprintf(w, "G21 ; mm\nG90 ; Absolute positions\nM5\n")
+	move := func(cmd string, p vec2) { fmt.Fprintf(w, "%s X%.4f Y%.4f\n", cmd, p.X-frame.MinX, p.Y-frame.MinY) }
+	cut := func(pts []vec2, closed bool) {
+		move("G0", pts[0])
+		fmt.Fprintf(w, "M4 S%.0f\nG1 F%g\n", power, job.Speed)
+		for _, p := range pts[1:] {
+			move("G1", p)
+		}
+		if closed {
+			move("G1", pts[0])
+		}
+		fmt.Fprintf(w, "M5\n")
+	}
+	for pass := 1; pass <= passes; pass++ {
+		fmt.Fprintf(w, "; Apertures, pass %d\n", pass)
+		for _, c := range contours {
+			cut(c, true)
+		}
+	}
+	for pass := 1; pass <= passes; pass++ {
+		fmt.Fprintf(w, "; Outline, pass %d\n", pass)
+		for i, p := range paths {
+			cut(p, closed[i])
+		}
+	}
+	fmt.Fprintf(w, "G0 X0 Y0\nM2\n")
+	fmt.Fprintf(cfg.Stdout, "G-code: %d aperture contours, %d passes\n", len(contours), passes)
+	return w.Flush()
+}
@@ -0,0 +1,159 @@
+package stencil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/mesh"
+	"pcb-to-stencil/pkg/progress"
+)
+
+// boardFootprint returns the rectangle the board covers and the height of
+// the board side of the plate. The mesh's walls, when it has them, stand
+// around the board cfg.Clearance away.
+func boardFootprint(triangles [][3]Point, cfg Config, walls bool) (gerber.Bounds, float64) {
+	b := gerber.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	low := math.Inf(1)
+	for _, t := range triangles {
+		for _, p := range t {
+			b = b.Union(gerber.Bounds{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+			low = math.Min(low, p.Z)
+		}
+	}
+	if walls {
+		inset := cfg.WallThickness + cfg.Clearance
+		b.MinX += inset
+		b.MinY += inset
+		b.MaxX -= inset
+		b.MaxY -= inset
+	}
+	board := cfg.StencilHeight
+	for _, z := range cfg.Steps {
+		board = math.Max(board, z.Thickness)
+	}
+	return b, low + board
+}
+
+// glbFootprintLift keeps the footprint plane off the plate it lies on, so
+// viewers don't z-fight them, mm.
+const glbFootprintLift = 0.01
+
+// WriteGLB writes the mesh as a binary glTF for web viewers: the stencil
+// with a steel colored material, and a translucent plane where the board
+// goes. The meshes are in mm, under a root node that scales them to glTF's
+// meters and turns Z up into its Y up.
+func WriteGLB(filename string, triangles [][3]Point, name string, board gerber.Bounds, boardZ float64, report progress.Func) error {
+	vertices, faces := mesh.Index(triangles)
+	report.Report("Writing GLB", 0, 1)
+
+	var bin []byte
+	lo := [3]float32{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1))}
+	hi := [3]float32{float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1))}
+	for _, v := range vertices {
+		for j, c := range v {
+			bin = binary.LittleEndian.AppendUint32(bin, c)
+			lo[j] = min(lo[j], math.Float32frombits(c))
+			hi[j] = max(hi[j], math.Float32frombits(c))
+		}
+	}
+	for _, t := range faces {
+		for _, n := range t {
+			bin = binary.LittleEndian.AppendUint32(bin, n)
+		}
+	}
+	z := float32(boardZ + glbFootprintLift)
+	plane := [4][3]float32{
+		{float32(board.MinX), float32(board.MinY), z},
+		{float32(board.MaxX), float32(board.MinY), z},
+		{float32(board.MaxX), float32(board.MaxY), z},
+		{float32(board.MinX), float32(board.MaxY), z},
+	}
+	for _, p := range plane {
+		for _, c := range p {
+			bin = binary.LittleEndian.AppendUint32(bin, math.Float32bits(c))
+		}
+	}
+	for _, n := range []uint32{0, 1, 2, 0, 2, 3} {
+		bin = binary.LittleEndian.AppendUint32(bin, n)
+	}
+
+	// Buffer views of the stencil's positions and indices, then the plane's
+	type view struct {
+		Buffer int `json:"buffer"`
+		Offset int `json:"byteOffset"`
+		Length int `json:"byteLength"`
+		Target int `json:"target"`
+	}
+	const arrayBuffer, elementBuffer = 34962, 34963
+	views := []view{
+		{0, 0, 12 * len(vertices), arrayBuffer},
+		{0, 12 * len(vertices), 12 * len(faces), elementBuffer},
+		{0, 12 * (len(vertices) + len(faces)), 48, arrayBuffer},
+		{0, 12*(len(vertices)+len(faces)) + 48, 24, elementBuffer},
+	}
+	const glFloat, glUint = 5126, 5125
+	accessors := []map[string]any{
+		{"bufferView": 0, "componentType": glFloat, "count": len(vertices), "type": "VEC3", "min": lo, "max": hi},
+		{"bufferView": 1, "componentType": glUint, "count": 3 * len(faces), "type": "SCALAR"},
+		{"bufferView": 2, "componentType": glFloat, "count": 4, "type": "VEC3", "min": plane[0], "max": plane[2]},
+		{"bufferView": 3, "componentType": glUint, "count": 6, "type": "SCALAR"},
+	}
+	primitive := func(positions, indices, material int) []map[string]any {
+		return []map[string]any{{"attributes": map[string]int{"POSITION": positions}, "indices": indices, "material": material}}
+	}
+	doc := map[string]any{
+		"asset":  map[string]string{"version": "2.0", "generator": "pcb-to-stencil " + toolVersion()},
+		"scene":  0,
+		"scenes": []map[string]any{{"nodes": []int{0}}},
+		"nodes": []map[string]any{
+			{"name": name, "children": []int{1, 2}, "scale": []float64{0.001, 0.001, 0.001}, "rotation": []float64{-math.Sqrt2 / 2, 0, 0, math.Sqrt2 / 2}},
+			{"name": "Stencil", "mesh": 0},
+			{"name": "Board footprint", "mesh": 1},
+		},
+		"meshes": []map[string]any{
+			{"name": "Stencil", "primitives": primitive(0, 1, 0)},
+			{"name": "Board footprint", "primitives": primitive(2, 3, 1)},
+		},
+		"materials": []map[string]any{
+			{"name": "Stencil", "pbrMetallicRoughness": map[string]any{"baseColorFactor": []float64{0.75, 0.77, 0.8, 1}, "metallicFactor": 0.6, "roughnessFactor": 0.4}},
+			{"name": "Board", "pbrMetallicRoughness": map[string]any{"baseColorFactor": []float64{0.1, 0.45, 0.2, 0.35}, "metallicFactor": 0, "roughnessFactor": 0.8}, "alphaMode": "BLEND", "doubleSided": true},
+		},
+		"buffers":     []map[string]int{{"byteLength": len(bin)}},
+		"bufferViews": views,
+		"accessors":   accessors,
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// Chunks are padded to 4 bytes, the JSON with spaces
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var out []byte
+	out = append(out, "glTF"...)
+	out = binary.LittleEndian.AppendUint32(out, 2)
+	out = binary.LittleEndian.AppendUint32(out, uint32(12+8+len(js)+8+len(bin)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(js)))
+	out = append(out, "JSON"...)
+	out = append(out, js...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(bin)))
+	out = append(out, "BIN\x00"...)
+	if _, err := f.Write(out); err != nil {
+		return err
+	}
+	if _, err := f.Write(bin); err != nil {
+		return err
+	}
+	report.Report("Writing GLB", 1, 1)
+	return f.Close()
+}
@@ -0,0 +1,34 @@
+package stencil
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// renderHeightmap returns the thickness of the stencil at each pixel as 16
+// bit gray, from black in the openings to white at its thickest, and the
+// thickness white stands for in mm.
+func renderHeightmap(stencilImg, outlineImg image.Image, cfg Config) (*image.Gray16, float64) {
+	bounds := stencilImg.Bounds()
+	width := bounds.Dx()
+	heightAt := pixelHeights(stencilImg, outlineImg, cfg)
+	thick := make([]float64, width*bounds.Dy())
+	full := 0.0
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < width; x++ {
+			floor, top := heightAt(x, y)
+			thick[y*width+x] = top - floor
+			full = math.Max(full, top-floor)
+		}
+	}
+
+	img := image.NewGray16(image.Rect(0, 0, width, bounds.Dy()))
+	if full == 0 {
+		return img, 0
+	}
+	for i, t := range thick {
+		img.SetGray16(i%width, i/width, color.Gray16{Y: uint16(math.Round(t / full * 0xffff))})
+	}
+	return img, full
+}
@@ -0,0 +1,186 @@
+package stencil
+
+import (
+	"math"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// homePlateTaper is how much of a pad's length the shaped end of a home plate
+// opening takes. Either shape then opens a tenth less than the pad.
+const homePlateTaper = 0.2
+
+// rectPad is a flashed rectangular pad: the index of its FLASH command, its
+// center, and its long and short sides, with u the unit vector along the
+// long one.
+type rectPad struct {
+	cmd         int
+	x, y        float64
+	long, short float64
+	ux, uy      float64
+	ref         string
+}
+
+// rectPads returns the flashes of rectangle apertures in gf, square ones and
+// ones turned off the axes aside.
+func rectPads(gf *gerber.File) []rectPad {
+	var pads []rectPad
+	var x, y, rotation float64
+	var ap gerber.Aperture
+	ref := ""
+	for i, cmd := range gf.Commands {
+		if cmd.X != nil {
+			x = *cmd.X
+		}
+		if cmd.Y != nil {
+			y = *cmd.Y
+		}
+		switch cmd.Type {
+		case "APERTURE":
+			ap = gf.State.Apertures[*cmd.D]
+		case "LR":
+			rotation = *cmd.R
+		case "COMPONENT":
+			ref = cmd.Name
+		case "FLASH":
+			if ap.Type != gerber.ApertureRect || len(ap.Modifiers) < 2 || ap.Modifiers[0] == ap.Modifiers[1] {
+				continue
+			}
+			quarter := math.Round(rotation / 90)
+			if math.Abs(rotation-quarter*90) > 1e-6 {
+				continue
+			}
+			p := rectPad{cmd: i, x: x, y: y, long: ap.Modifiers[0], short: ap.Modifiers[1], ux: 1, ref: ref}
+			if p.short > p.long {
+				p.long, p.short, p.ux, p.uy = p.short, p.long, 0, 1
+			}
+			if int(quarter)%2 != 0 {
+				p.ux, p.uy = p.uy, p.ux
+			}
+			pads = append(pads, p)
+		}
+	}
+	return pads
+}
+
+// padPitch returns the distance from pad i to the nearest pad of the same
+// size beside it in its row, across its short side, or 0 if there's none.
+func padPitch(pads []rectPad, i int) float64 {
+	p := pads[i]
+	pitch := 0.0
+	for j, q := range pads {
+		if j == i || math.Abs(q.long-p.long) > 1e-3 || math.Abs(q.short-p.short) > 1e-3 || q.ux != p.ux {
+			continue
+		}
+		dx, dy := q.x-p.x, q.y-p.y
+		if along := dx*p.ux + dy*p.uy; math.Abs(along) > p.short/2 {
+			continue
+		}
+		if d := math.Hypot(dx, dy); d > 1e-6 && (pitch == 0 || d < pitch) {
+			pitch = d
+		}
+	}
+	return pitch
+}
+
+// homePlates reshapes the rectangular pads of gf at pitch mm or finer into
+// home plate openings, their inner end facing the part's body narrowed to a
+// point, or with inverted into inverted home plates, that end notched with a
+// V instead. Either takes paste from under the body, where it squeezes out
+// and bridges neighbouring pins. The body is the middle of the pads of the
+// pad's component, from the X2 attributes, or without them the side the
+// opposite row of pads is on. It returns how many pads were reshaped, and how
+// many at the pitch were left as they are, with no way to tell where the
+// body is: without a component, or a row of pads across from them.
+func homePlates(gf *gerber.File, pitch float64, inverted bool) (shaped, unknown int) {
+	pads := rectPads(gf)
+	fine := make([]bool, len(pads))
+	for i := range pads {
+		d := padPitch(pads, i)
+		fine[i] = d > 0 && d <= pitch+1e-6
+	}
+	centers := make(map[string]vec2)
+	counts := make(map[string]int)
+	for _, p := range pads {
+		if p.ref != "" {
+			c := centers[p.ref]
+			centers[p.ref] = vec2{X: c.X + p.x, Y: c.Y + p.y}
+			counts[p.ref]++
+		}
+	}
+
+	shapes := make(map[int]int) // Pad index by the command flashing it
+	polys := make(map[int][]vec2)
+	for i, p := range pads {
+		if !fine[i] {
+			continue
+		}
+		// Which way along the long side the body lies
+		inward := 0.0
+		if n := counts[p.ref]; n > 1 {
+			c := centers[p.ref]
+			inward = (c.X/float64(n)-p.x)*p.ux + (c.Y/float64(n)-p.y)*p.uy
+		}
+		if math.Abs(inward) < p.long/2 {
+			inward = 0
+			nearest := math.Inf(1)
+			for j, q := range pads {
+				if j == i || !fine[j] {
+					continue
+				}
+				dx, dy := q.x-p.x, q.y-p.y
+				along := dx*p.ux + dy*p.uy
+				if across := math.Abs(dx*p.uy - dy*p.ux); across > p.short/2 || math.Abs(along) < p.long {
+					continue
+				}
+				if math.Abs(along) < nearest {
+					nearest, inward = math.Abs(along), along
+				}
+			}
+		}
+		if inward == 0 {
+			unknown++
+			continue
+		}
+		ux, uy := p.ux, p.uy
+		if inward < 0 {
+			ux, uy = -ux, -uy
+		}
+		// Corners along the pad from its outer end, left to right facing in
+		l, w, t := p.long/2, p.short/2, p.long*homePlateTaper
+		outline := [][2]float64{{-l, w}, {-l, -w}, {l - t, -w}, {l, 0}, {l - t, w}}
+		if inverted {
+			outline = [][2]float64{{-l, w}, {-l, -w}, {l, -w}, {l - t, 0}, {l, w}}
+		}
+		poly := make([]vec2, len(outline))
+		for k, c := range outline {
+			poly[k] = vec2{X: p.x + c[0]*ux - c[1]*uy, Y: p.y + c[0]*uy + c[1]*ux}
+		}
+		shapes[p.cmd], polys[i] = i, poly
+	}
+	if len(shapes) == 0 {
+		return 0, unknown
+	}
+
+	// Each reshaped flash becomes a region, in linear mode, and the pen goes
+	// back to the flash position for the commands after it
+	var out []gerber.Command
+	mode := "G01"
+	for i, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "G01", "G02", "G03":
+			mode = cmd.Type
+		}
+		pad, ok := shapes[i]
+		if !ok {
+			out = append(out, cmd)
+			continue
+		}
+		out = append(out, gerber.Command{Type: "G01"})
+		out = append(out, polygonRegion([][]vec2{polys[pad]}).Commands...)
+		x, y := pads[pad].x, pads[pad].y
+		out = append(out, gerber.Command{Type: "MOVE", X: &x, Y: &y}, gerber.Command{Type: mode})
+	}
+	gf.Commands = out
+	return len(shapes), unknown
+}
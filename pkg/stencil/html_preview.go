@@ -0,0 +1,336 @@
+package stencil
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/mesh"
+)
+
+// previewOverlay returns the aperture contours of the paste layer gf and the
+// board outline in the coordinates of the mesh, at height z: the mesh's frame
+// is the gerbers' bounds with the usual margin, its Y runs down from the top
+// of the frame, and placeMesh moved it by shift.
+func previewOverlay(gf *gerber.File, outlinePath string, cfg Config, shift Point, z float64) (apertures, outline [][]Point, err error) {
+	frame := gf.CalculateBounds()
+	var outlineGf *gerber.File
+	if outlinePath != "" {
+		outlineGf, err = gerber.ParseMirrored(outlinePath, cfg.Mirror)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+		frame = frame.Union(outlineGf.CalculateBounds())
+	}
+	margin := frameMargin(cfg)
+	toMesh := func(pts []vec2, closed bool) []Point {
+		var out []Point
+		for _, p := range pts {
+			out = append(out, Point{X: p.X - frame.MinX + margin + shift.X, Y: frame.MaxY + margin - p.Y + shift.Y, Z: z})
+		}
+		if closed {
+			out = append(out, out[0])
+		}
+		return out
+	}
+	for _, c := range cutApertures(gf, 0, cfg.Log) {
+		apertures = append(apertures, toMesh(c, true))
+	}
+	if outlineGf != nil {
+		paths, closed := cutOutline(outlineGf, frame, 0)
+		for i, p := range paths {
+			outline = append(outline, toMesh(p, closed[i]))
+		}
+	}
+	return apertures, outline, nil
+}
+
+// previewPage is the viewer page up to its data, which follows as base64 in
+// script elements.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - pcb-to-stencil</title>
+<style>
+html, body { margin: 0; height: 100%; overflow: hidden; background: #1e2126; color: #ddd; font: 13px sans-serif; }
+canvas { display: block; width: 100%; height: 100%; }
+#panel { position: absolute; top: 10px; left: 10px; padding: 8px 12px; background: rgba(0, 0, 0, 0.55); border-radius: 4px; line-height: 1.6; }
+.apertures { color: #ff5050; }
+.outline { color: #50a0ff; }
+</style>
+</head>
+<body>
+<canvas id="view"></canvas>
+<div id="panel">
+<b>{{.Name}}</b><br>
+{{.Triangles}} triangles, {{.Size}}<br>
+<label class="apertures"><input type="checkbox" id="show-apertures" checked> Gerber apertures</label><br>
+<label class="outline"><input type="checkbox" id="show-outline" checked> Board outline</label><br>
+Drag to turn, right drag to pan, scroll to zoom
+</div>
+`))
+
+// previewScript draws the mesh with WebGL 2, flat shaded from the screen
+// space derivatives of its positions, and the overlay lines on top of it.
+// Mesh Y runs down from the top of the board, so it is flipped back to look
+// like the gerber.
+const previewScript = `<script>
+"use strict";
+const canvas = document.getElementById("view");
+const gl = canvas.getContext("webgl2", { antialias: true });
+
+async function data(id) {
+  const text = document.getElementById(id).textContent.trim();
+  const response = await fetch("data:application/octet-stream;base64," + text);
+  return response.arrayBuffer();
+}
+
+function program(vertex, fragment) {
+  const p = gl.createProgram();
+  for (const [type, source] of [[gl.VERTEX_SHADER, vertex], [gl.FRAGMENT_SHADER, fragment]]) {
+    const s = gl.createShader(type);
+    gl.shaderSource(s, source);
+    gl.compileShader(s);
+    if (!gl.getShaderParameter(s, gl.COMPILE_STATUS)) throw new Error(gl.getShaderInfoLog(s));
+    gl.attachShader(p, s);
+  }
+  gl.linkProgram(p);
+  return p;
+}
+
+const vertexShader = "#version 300 es\n" +
+  "in vec3 position; uniform mat4 transform; out vec3 world;\n" +
+  "void main() { world = vec3(position.x, -position.y, position.z); gl_Position = transform * vec4(world, 1.0); }";
+const meshProgram = program(vertexShader, "#version 300 es\nprecision highp float;\n" +
+  "in vec3 world; uniform vec3 light; out vec4 color;\n" +
+  "void main() { vec3 n = normalize(cross(dFdx(world), dFdy(world)));\n" +
+  "  color = vec4(vec3(0.75, 0.77, 0.8) * (0.3 + 0.7 * abs(dot(n, light))), 1.0); }");
+const lineProgram = program(vertexShader, "#version 300 es\nprecision highp float;\n" +
+  "in vec3 world; uniform vec3 tint; out vec4 color;\n" +
+  "void main() { color = vec4(tint, 1.0); }");
+
+function buffer(target, bytes) {
+  const b = gl.createBuffer();
+  gl.bindBuffer(target, b);
+  gl.bufferData(target, bytes, gl.STATIC_DRAW);
+  return b;
+}
+
+function attribute(p, b) {
+  const vao = gl.createVertexArray();
+  gl.bindVertexArray(vao);
+  gl.bindBuffer(gl.ARRAY_BUFFER, b);
+  const loc = gl.getAttribLocation(p, "position");
+  gl.enableVertexAttribArray(loc);
+  gl.vertexAttribPointer(loc, 3, gl.FLOAT, false, 0, 0);
+  return vao;
+}
+
+function multiply(a, b) {
+  const out = new Float32Array(16);
+  for (let c = 0; c < 4; c++)
+    for (let r = 0; r < 4; r++)
+      for (let k = 0; k < 4; k++) out[c * 4 + r] += a[k * 4 + r] * b[c * 4 + k];
+  return out;
+}
+
+function sub(a, b) { return [a[0] - b[0], a[1] - b[1], a[2] - b[2]]; }
+function cross(a, b) { return [a[1] * b[2] - a[2] * b[1], a[2] * b[0] - a[0] * b[2], a[0] * b[1] - a[1] * b[0]]; }
+function normalize(a) { const l = Math.hypot(...a); return [a[0] / l, a[1] / l, a[2] / l]; }
+function dot(a, b) { return a[0] * b[0] + a[1] * b[1] + a[2] * b[2]; }
+
+async function main() {
+  const vertices = new Float32Array(await data("vertices"));
+  const indices = new Uint32Array(await data("indices"));
+  const lines = { apertures: new Float32Array(await data("apertures")), outline: new Float32Array(await data("outline")) };
+
+  const lo = [Infinity, Infinity, Infinity], hi = [-Infinity, -Infinity, -Infinity];
+  for (let i = 0; i < vertices.length; i += 3) {
+    const p = [vertices[i], -vertices[i + 1], vertices[i + 2]];
+    for (let j = 0; j < 3; j++) { lo[j] = Math.min(lo[j], p[j]); hi[j] = Math.max(hi[j], p[j]); }
+  }
+  const size = Math.hypot(...sub(hi, lo)) || 1;
+  let target = [(lo[0] + hi[0]) / 2, (lo[1] + hi[1]) / 2, (lo[2] + hi[2]) / 2];
+  let yaw = -Math.PI / 2, pitch = 1.1, distance = 1.4 * size;
+
+  const mesh = attribute(meshProgram, buffer(gl.ARRAY_BUFFER, vertices));
+  buffer(gl.ELEMENT_ARRAY_BUFFER, indices);
+  const overlays = [
+    { vao: attribute(lineProgram, buffer(gl.ARRAY_BUFFER, lines.apertures)), count: lines.apertures.length / 3, tint: [1, 0.31, 0.31], box: "show-apertures" },
+    { vao: attribute(lineProgram, buffer(gl.ARRAY_BUFFER, lines.outline)), count: lines.outline.length / 3, tint: [0.31, 0.63, 1], box: "show-outline" },
+  ];
+
+  function draw() {
+    const w = canvas.clientWidth * devicePixelRatio, h = canvas.clientHeight * devicePixelRatio;
+    if (canvas.width !== w || canvas.height !== h) { canvas.width = w; canvas.height = h; }
+    gl.viewport(0, 0, w, h);
+    gl.clearColor(0.12, 0.13, 0.15, 1);
+    gl.clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT);
+
+    const forward = [-Math.cos(pitch) * Math.cos(yaw), -Math.cos(pitch) * Math.sin(yaw), -Math.sin(pitch)];
+    const eye = sub(target, forward.map(v => v * distance));
+    const right = normalize(cross(forward, [0, 0, 1]));
+    const up = cross(right, forward);
+    const view = new Float32Array([
+      right[0], up[0], -forward[0], 0, right[1], up[1], -forward[1], 0, right[2], up[2], -forward[2], 0,
+      -dot(right, eye), -dot(up, eye), dot(forward, eye), 1]);
+    const near = distance / 100, far = distance * 10 + size, f = 1 / Math.tan(0.4);
+    const projection = new Float32Array([f * h / w, 0, 0, 0, 0, f, 0, 0, 0, 0, (far + near) / (near - far), -1, 0, 0, 2 * far * near / (near - far), 0]);
+    const transform = multiply(projection, view);
+
+    gl.enable(gl.DEPTH_TEST);
+    gl.useProgram(meshProgram);
+    gl.uniformMatrix4fv(gl.getUniformLocation(meshProgram, "transform"), false, transform);
+    gl.uniform3fv(gl.getUniformLocation(meshProgram, "light"), normalize([0.3, -0.5, 1]));
+    gl.bindVertexArray(mesh);
+    gl.drawElements(gl.TRIANGLES, indices.length, gl.UNSIGNED_INT, 0);
+
+    // The overlay shows through the stencil, to compare it with the openings
+    gl.disable(gl.DEPTH_TEST);
+    gl.useProgram(lineProgram);
+    gl.uniformMatrix4fv(gl.getUniformLocation(lineProgram, "transform"), false, transform);
+    for (const o of overlays) {
+      if (!document.getElementById(o.box).checked || o.count === 0) continue;
+      gl.uniform3fv(gl.getUniformLocation(lineProgram, "tint"), o.tint);
+      gl.bindVertexArray(o.vao);
+      gl.drawArrays(gl.LINES, 0, o.count);
+    }
+  }
+
+  let drag = null;
+  canvas.addEventListener("contextmenu", e => e.preventDefault());
+  canvas.addEventListener("mousedown", e => { drag = { x: e.clientX, y: e.clientY, pan: e.button !== 0 || e.shiftKey }; });
+  window.addEventListener("mouseup", () => { drag = null; });
+  window.addEventListener("mousemove", e => {
+    if (!drag) return;
+    const dx = e.clientX - drag.x, dy = e.clientY - drag.y;
+    drag.x = e.clientX; drag.y = e.clientY;
+    if (drag.pan) {
+      const forward = [-Math.cos(pitch) * Math.cos(yaw), -Math.cos(pitch) * Math.sin(yaw), -Math.sin(pitch)];
+      const right = normalize(cross(forward, [0, 0, 1])), up = cross(right, forward);
+      const s = distance * 0.0015;
+      target = target.map((v, i) => v - right[i] * dx * s + up[i] * dy * s);
+    } else {
+      yaw -= dx * 0.01;
+      pitch = Math.min(Math.max(pitch + dy * 0.01, -1.55), 1.55);
+    }
+    requestAnimationFrame(draw);
+  });
+  canvas.addEventListener("wheel", e => {
+    e.preventDefault();
+    distance *= Math.exp(e.deltaY * 0.001);
+    requestAnimationFrame(draw);
+  }, { passive: false });
+  for (const o of overlays) document.getElementById(o.box).addEventListener("change", () => requestAnimationFrame(draw));
+  window.addEventListener("resize", () => requestAnimationFrame(draw));
+  draw();
+}
+
+if (gl) {
+  main();
+} else {
+  document.getElementById("panel").append("WebGL 2 is not available in this browser.");
+}
+</script>
+</body>
+</html>
+`
+
+// writeBase64Block writes data as base64 in a script element with the id.
+func writeBase64Block(w io.Writer, id string, data []byte) error {
+	fmt.Fprintf(w, "<script type=\"application/octet-stream\" id=\"%s\">", id)
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := enc.Write(data); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "</script>\n")
+	return err
+}
+
+// WritePreviewHTML writes a self-contained web page showing the mesh in 3D,
+// with the aperture and outline lines drawn over it, to check the openings
+// against the gerber before printing. The page needs no network: the
+// viewer is plain WebGL and the mesh is embedded in it.
+func WritePreviewHTML(filename string, triangles [][3]Point, name string, apertures, outline [][]Point) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	vertices, faces := mesh.Index(triangles)
+	lo, hi := [3]float32{}, [3]float32{}
+	for i, v := range vertices {
+		for j, c := range v {
+			x := math.Float32frombits(c)
+			if i == 0 || x < lo[j] {
+				lo[j] = x
+			}
+			if i == 0 || x > hi[j] {
+				hi[j] = x
+			}
+		}
+	}
+	err = previewPage.Execute(w, map[string]any{
+		"Name":      name,
+		"Triangles": len(faces),
+		"Size":      fmt.Sprintf("%.2f x %.2f x %.2f mm", hi[0]-lo[0], hi[1]-lo[1], hi[2]-lo[2]),
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, v := range vertices {
+		for _, c := range v {
+			buf = binary.LittleEndian.AppendUint32(buf, c)
+		}
+	}
+	if err := writeBase64Block(w, "vertices", buf); err != nil {
+		return err
+	}
+	buf = buf[:0]
+	for _, t := range faces {
+		for _, n := range t {
+			buf = binary.LittleEndian.AppendUint32(buf, n)
+		}
+	}
+	if err := writeBase64Block(w, "indices", buf); err != nil {
+		return err
+	}
+	// Lines are pairs of points
+	for _, block := range []struct {
+		id    string
+		paths [][]Point
+	}{{"apertures", apertures}, {"outline", outline}} {
+		buf = buf[:0]
+		for _, p := range block.paths {
+			for i := 1; i < len(p); i++ {
+				for _, q := range []Point{p[i-1], p[i]} {
+					for _, c := range []float64{q.X, q.Y, q.Z} {
+						buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(c)))
+					}
+				}
+			}
+		}
+		if err := writeBase64Block(w, block.id, buf); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(w, previewScript)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,452 @@
+package stencil
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layer roles
+const (
+	RoleUnknown = ""
+	RolePaste   = "paste"
+	RoleOutline = "outline"
+	RoleDrill   = "drill"
+	RoleOther   = "other" // Recognized fab layer that isn't used for stencils
+)
+
+// protelLayers maps the Protel/Altium extension family to roles. Rank orders
+// candidates of the same role: lower wins.
+var protelLayers = map[string]struct {
+	Role, Side, Name string
+	Rank             int
+}{
+	".gtp": {RolePaste, SideTop, "top paste", 1},
+	".gbp": {RolePaste, SideBottom, "bottom paste", 1},
+	".gko": {RoleOutline, "", "keep-out", 1},
+	".gm1": {RoleOutline, "", "mechanical 1", 2},
+	".gml": {RoleOutline, "", "mill", 2},
+	".gm2": {RoleOther, "", "mechanical 2", 9},
+	".gm3": {RoleOther, "", "mechanical 3", 9},
+	".gm4": {RoleOther, "", "mechanical 4", 9},
+	".gtl": {RoleOther, "", "top copper", 9},
+	".gbl": {RoleOther, "", "bottom copper", 9},
+	".gto": {RoleOther, "", "top overlay", 9},
+	".gbo": {RoleOther, "", "bottom overlay", 9},
+	".gts": {RoleOther, "", "top solder mask", 9},
+	".gbs": {RoleOther, "", "bottom solder mask", 9},
+	".gd1": {RoleOther, "", "drill drawing", 9},
+	".gg1": {RoleOther, "", "drill guide", 9},
+	".drl": {RoleDrill, "", "NC drill", 1},
+	".xln": {RoleDrill, "", "NC drill", 1},
+	".exc": {RoleDrill, "", "NC drill", 1},
+	".txt": {RoleDrill, "", "NC drill", 2}, // Only if the content is Excellon
+}
+
+// Board sides
+const (
+	SideTop    = "top"
+	SideBottom = "bottom"
+	SideBoth   = "both" // Selects both paste layers, for a combined stencil
+)
+
+// LayerInfo describes what a fab output file was detected to be.
+type LayerInfo struct {
+	Path   string
+	Role   string
+	Side   string // SideTop or SideBottom for paste layers
+	Source string // How the role was detected, for reporting
+	Rank   int    // Preference among layers of the same role, lower wins
+}
+
+// LayerSelection controls how pickLayers chooses between candidate files.
+type LayerSelection struct {
+	Side    string // Paste side to use; top when empty
+	Paste   string // Explicit paste layer file name
+	Outline string // Explicit outline layer file name
+}
+
+// readFileFunction returns the X2 .FileFunction attribute value from the
+// header of a gerber file, e.g. "Paste,Top" or "Profile,NP".
+func readFileFunction(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 64 && scanner.Scan(); i++ {
+		line := scanner.Text()
+		idx := strings.Index(line, "TF.FileFunction,")
+		if idx == -1 {
+			continue
+		}
+		val := line[idx+len("TF.FileFunction,"):]
+		val = strings.TrimRight(val, "*%")
+		return val
+	}
+	return ""
+}
+
+// DetectLayer guesses the role of a fab output file from its X2 attributes,
+// its extension, or its name, in that order.
+func DetectLayer(path string) LayerInfo {
+	info := LayerInfo{Path: path}
+	base := strings.ToLower(filepath.Base(path))
+	ext := filepath.Ext(base)
+
+	// X2 attributes are authoritative when present
+	if fn := readFileFunction(path); fn != "" {
+		parts := strings.Split(fn, ",")
+		switch strings.ToLower(parts[0]) {
+		case "paste":
+			info.Role, info.Side = RolePaste, SideTop
+			if len(parts) > 1 && strings.EqualFold(parts[1], "Bot") {
+				info.Side = SideBottom
+			}
+		case "profile":
+			info.Role = RoleOutline
+		case "plated", "nonplated", "mixedplating":
+			info.Role = RoleDrill
+		}
+		if info.Role != RoleUnknown {
+			info.Source = "X2 .FileFunction " + fn
+			return info
+		}
+	}
+
+	if pl, ok := protelLayers[ext]; ok && (ext != ".txt" || looksLikeExcellon(path)) {
+		info.Role, info.Side, info.Rank = pl.Role, pl.Side, pl.Rank
+		info.Source = "extension " + ext + " (" + pl.Name + ")"
+		return info
+	}
+
+	// KiCad / EasyEDA / generic naming conventions
+	info.Source = "file name"
+	info.Rank = 3
+	switch {
+	case strings.Contains(base, "f_paste"), strings.Contains(base, "f.paste"),
+		strings.Contains(base, "paste_top"), strings.Contains(base, "toppaste"),
+		strings.Contains(base, "top_paste"), strings.Contains(base, "pastetop"):
+		info.Role, info.Side = RolePaste, SideTop
+	case strings.Contains(base, "b_paste"), strings.Contains(base, "b.paste"),
+		strings.Contains(base, "paste_bottom"), strings.Contains(base, "bottompaste"),
+		strings.Contains(base, "bottom_paste"), strings.Contains(base, "pastebottom"):
+		info.Role, info.Side = RolePaste, SideBottom
+	case strings.Contains(base, "edge_cuts"), strings.Contains(base, "edge.cuts"),
+		strings.Contains(base, "outline"), strings.Contains(base, "profile"):
+		info.Role = RoleOutline
+	default:
+		info.Source = ""
+	}
+	return info
+}
+
+// looksLikeExcellon reports whether a file starts like an NC drill file,
+// to tell Protel .TXT drill files apart from readmes.
+func looksLikeExcellon(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 16 && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "M48" || strings.HasPrefix(line, "METRIC") || strings.HasPrefix(line, "INCH") {
+			return true
+		}
+	}
+	return false
+}
+
+// pickLayers assigns input roles from a list of candidate files. Explicit
+// names in sel override detection by matching a file's base name
+// (case-insensitive). The chosen layers are returned for reporting.
+func pickLayers(files []string, sel LayerSelection) (Inputs, []LayerInfo, error) {
+	sort.Strings(files)
+	var layers []LayerInfo
+	for _, f := range files {
+		layers = append(layers, DetectLayer(f))
+	}
+	return chooseLayers(layers, sel)
+}
+
+// chooseLayers picks the first layer of each role from already classified
+// candidates.
+func chooseLayers(layers []LayerInfo, sel LayerSelection) (Inputs, []LayerInfo, error) {
+	var in Inputs
+	var chosen []LayerInfo
+
+	side := sel.Side
+	if side == "" || side == SideBoth {
+		side = SideTop
+	}
+
+	find := func(name string) string {
+		for _, l := range layers {
+			if strings.EqualFold(filepath.Base(l.Path), name) {
+				return l.Path
+			}
+		}
+		return ""
+	}
+
+	if sel.Paste != "" {
+		if in.Paste = find(sel.Paste); in.Paste == "" {
+			return in, nil, fmt.Errorf("paste layer %q not found", sel.Paste)
+		}
+		chosen = append(chosen, LayerInfo{Path: in.Paste, Role: RolePaste, Side: side, Source: "selected"})
+	}
+	if sel.Outline != "" {
+		if in.Outline = find(sel.Outline); in.Outline == "" {
+			return in, nil, fmt.Errorf("outline layer %q not found", sel.Outline)
+		}
+		chosen = append(chosen, LayerInfo{Path: in.Outline, Role: RoleOutline, Source: "selected"})
+	}
+
+	// Stable so that files of equal rank keep their order
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].Rank < layers[j].Rank })
+	in.Candidates = layers
+
+	for _, info := range layers {
+		switch info.Role {
+		case RolePaste:
+			if in.Paste == "" && info.Side == side {
+				in.Paste = info.Path
+				chosen = append(chosen, info)
+			} else if in.Bottom == "" && info.Side == SideBottom && sel.Side == SideBoth {
+				in.Bottom = info.Path
+				chosen = append(chosen, info)
+			}
+		case RoleOutline:
+			if in.Outline == "" {
+				in.Outline = info.Path
+				chosen = append(chosen, info)
+			}
+		case RoleDrill:
+			if in.Drill == "" {
+				in.Drill = info.Path
+				chosen = append(chosen, info)
+			}
+		}
+	}
+
+	if in.Paste == "" {
+		return in, nil, fmt.Errorf("no %s solder paste layer found (use -paste-layer to pick one)", side)
+	}
+	if sel.Side == SideBoth && in.Bottom == "" {
+		return in, nil, fmt.Errorf("no bottom solder paste layer found")
+	}
+	return in, chosen, nil
+}
+
+// ReportLayers writes to w which file was chosen for each role and why.
+func ReportLayers(chosen []LayerInfo, w io.Writer) {
+	for _, info := range chosen {
+		role := info.Role
+		if info.Side != "" {
+			role += " (" + info.Side + ")"
+		}
+		fmt.Fprintf(w, "Using %s as %s [%s]\n", filepath.Base(info.Path), role, info.Source)
+	}
+}
+
+// ConfirmLayers interactively asks the user to accept or change the chosen
+// file for each role. An empty answer keeps the current choice, "-" clears an
+// optional role, and anything else is matched against the candidate names.
+func ConfirmLayers(in Inputs, r io.Reader, w io.Writer) (Inputs, error) {
+	fmt.Fprintln(w, "Detected layers:")
+	for _, c := range in.Candidates {
+		role := c.Role
+		if role == RoleUnknown {
+			role = "?"
+		}
+		fmt.Fprintf(w, "  %-32s %-8s %s\n", filepath.Base(c.Path), role, c.Source)
+	}
+
+	reader := bufio.NewReader(r)
+	ask := func(label, current string, optional bool) (string, error) {
+		for {
+			cur := "none"
+			if current != "" {
+				cur = filepath.Base(current)
+			}
+			fmt.Fprintf(w, "%s layer [%s]: ", label, cur)
+			answer, err := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer == "" {
+				if err != nil && err != io.EOF {
+					return current, err
+				}
+				return current, nil
+			}
+			if answer == "-" && optional {
+				return "", nil
+			}
+			for _, c := range in.Candidates {
+				if strings.EqualFold(filepath.Base(c.Path), answer) {
+					return c.Path, nil
+				}
+			}
+			fmt.Fprintf(w, "No file named %q\n", answer)
+			if err != nil {
+				return current, err
+			}
+		}
+	}
+
+	var err error
+	if in.Paste, err = ask("Paste", in.Paste, false); err != nil {
+		return in, err
+	}
+	if in.Outline, err = ask("Outline", in.Outline, true); err != nil {
+		return in, err
+	}
+	if in.Drill, err = ask("Drill", in.Drill, true); err != nil {
+		return in, err
+	}
+	if in.Paste == "" {
+		return in, fmt.Errorf("no paste layer selected")
+	}
+	return in, nil
+}
+
+// resolveJobInputs picks the layers listed in a Gerber job file.
+func resolveJobInputs(jobPath string, sel LayerSelection) (Inputs, []LayerInfo, error) {
+	job, err := ParseGerberJob(jobPath)
+	if err != nil {
+		return Inputs{}, nil, err
+	}
+	in, chosen, err := chooseLayers(job.Layers(), sel)
+	in.Job = job
+	return in, chosen, err
+}
+
+// resolveDirInputs picks the layers of a directory of fab outputs. A Gerber
+// job file in the directory takes precedence over detection.
+func resolveDirInputs(dir string, sel LayerSelection) (Inputs, []LayerInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Inputs{}, nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if strings.EqualFold(filepath.Ext(path), ".gbrjob") {
+			return resolveJobInputs(path, sel)
+		}
+		files = append(files, path)
+	}
+	return pickLayers(files, sel)
+}
+
+// Limits on what extractZip unpacks, so an archive can't fill the disk.
+const (
+	maxZipFiles = 1000
+	maxZipBytes = 1 << 30
+)
+
+// extractZip unpacks the files of a zip archive into destDir, flattening any
+// directory structure, and returns the extracted paths. Two files of the
+// same name in different directories are an error, since one would
+// overwrite the other.
+func extractZip(zipPath, destDir string) ([]string, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var files []string
+	seen := make(map[string]string)
+	var total int64
+	for _, zf := range r.File {
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX") {
+			continue
+		}
+		if len(files) == maxZipFiles {
+			return nil, fmt.Errorf("more than %d files in the archive", maxZipFiles)
+		}
+		// Only keep the base name so entries can't escape destDir
+		name := filepath.Base(zf.Name)
+		if other, ok := seen[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("%s and %s have the same name", other, zf.Name)
+		}
+		seen[strings.ToLower(name)] = zf.Name
+		outPath := filepath.Join(destDir, name)
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		out, err := os.Create(outPath)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		// The sizes in the archive can lie, so count what comes out
+		n, err := io.Copy(out, io.LimitReader(rc, maxZipBytes-total+1))
+		rc.Close()
+		out.Close()
+		if err != nil {
+			return nil, err
+		}
+		if total += n; total > maxZipBytes {
+			return nil, fmt.Errorf("archive unpacks to more than %d MB", maxZipBytes>>20)
+		}
+		files = append(files, outPath)
+	}
+	return files, nil
+}
+
+// resolveZipInputs extracts a gerber archive into a temporary directory and
+// picks its layers. The caller must remove the returned directory.
+func resolveZipInputs(zipPath string, sel LayerSelection) (Inputs, []LayerInfo, string, error) {
+	tempDir, err := os.MkdirTemp("", "pcb-to-stencil-")
+	if err != nil {
+		return Inputs{}, nil, "", err
+	}
+
+	if _, err := extractZip(zipPath, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return Inputs{}, nil, "", fmt.Errorf("error reading zip: %v", err)
+	}
+
+	in, chosen, err := resolveDirInputs(tempDir, sel)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return Inputs{}, nil, "", err
+	}
+	in.Output = strings.TrimSuffix(zipPath, filepath.Ext(zipPath)) + ".stl"
+	return in, chosen, tempDir, nil
+}
+
+// ResolveInputs picks the layers of the archive, directory or job file at
+// path, with the files chosen for each role. Any other file gives empty
+// Inputs. The caller must remove the returned directory, where an archive was
+// extracted, if it isn't empty.
+func ResolveInputs(path string, sel LayerSelection) (Inputs, []LayerInfo, string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		in, chosen, err := resolveDirInputs(path, sel)
+		return in, chosen, "", err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gbrjob":
+		in, chosen, err := resolveJobInputs(path, sel)
+		return in, chosen, "", err
+	case ".zip":
+		return resolveZipInputs(path, sel)
+	}
+	return Inputs{}, nil, "", nil
+}
@@ -0,0 +1,147 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// Holder jig dimensions, mm
+const (
+	jigBase = 2.0  // Floor under the board pocket
+	jigRim  = 5.0  // Solid border around the stencil's footprint
+	jigFit  = 0.15 // Gap around the board and the stencil so they drop in
+)
+
+// boardLoop returns the outer loop of the board outline, turning clockwise.
+func boardLoop(outline *gerber.File) ([]vec2, error) {
+	paths, closed := cutOutline(outline, gerber.Bounds{}, 0)
+	var loop []vec2
+	for i, p := range paths {
+		if closed[i] && len(p) >= 3 && math.Abs(gerber.SignedArea(p)) > math.Abs(gerber.SignedArea(loop)) {
+			loop = p
+		}
+	}
+	if loop == nil {
+		return nil, fmt.Errorf("board outline has no closed paths")
+	}
+	if gerber.SignedArea(loop) > 0 {
+		loop = slices.Clone(loop)
+		slices.Reverse(loop)
+	}
+	return loop, nil
+}
+
+// GenerateJig builds a holder for the board to print the stencil on: a plate
+// with a pocket the shape of the board, cfg.BoardThickness deep so the board
+// sits flush with the top. Around the pocket, a groove takes the stencil's
+// wall, which reaches past the board's edge, and its outer side locates the
+// stencil; a stencil without walls drops into a rim around its plate instead.
+// The jig lies board side up, with its corner at the origin.
+func GenerateJig(outline *gerber.File, cfg Config) ([][3]Point, error) {
+	board, err := boardLoop(outline)
+	if err != nil {
+		return nil, err
+	}
+	groove := cfg.WallHeight - cfg.StencilHeight // How far the stencil's wall reaches down past the plate
+	reach := cfg.Clearance + cfg.WallThickness
+	if groove <= 0 {
+		groove, reach = 0, cfg.Clearance
+	}
+	pocket := offsetLoop(board, jigFit)
+	footprint := offsetLoop(board, reach+jigFit)
+	if pocket == nil || footprint == nil {
+		return nil, fmt.Errorf("board outline is too small for a jig")
+	}
+	frame := gerber.PolyBounds(footprint)
+	frame = gerber.Bounds{MinX: frame.MinX - jigRim, MinY: frame.MinY - jigRim, MaxX: frame.MaxX + jigRim, MaxY: frame.MaxY + jigRim}
+
+	// Heights the board, the stencil's footprint and the rest end at
+	top := jigBase + math.Max(cfg.BoardThickness, groove)
+	floors := [3]float64{top - cfg.BoardThickness, top - groove, top}
+	if groove == 0 {
+		floors[2] += cfg.StencilHeight
+	}
+
+	// Loops in units from the frame's top left like the vector mesher's,
+	// solid on their left
+	toUnits := func(pts []vec2, hole bool) []vec2 {
+		out := make([]vec2, len(pts))
+		for i, p := range pts {
+			out[i] = vec2{X: (p.X - frame.MinX) / vectorUnit, Y: (frame.MaxY - p.Y) / vectorUnit}
+		}
+		if hole {
+			slices.Reverse(out)
+		}
+		return out
+	}
+	width := int(math.Ceil((frame.MaxX - frame.MinX) / vectorUnit))
+	height := int(math.Ceil((frame.MaxY - frame.MinY) / vectorUnit))
+	outer := []vec2{{X: 0, Y: 0}, {X: float64(width), Y: 0}, {X: float64(width), Y: float64(height)}, {X: 0, Y: float64(height)}}
+
+	heights := []float64{0, floors[0], floors[1], floors[2]}
+	slices.Sort(heights)
+	heights = slices.Compact(heights)
+	var triangles [][3]Point
+	for i := 1; i < len(heights); i++ {
+		z0, z1 := heights[i-1], heights[i]
+		loops := [][]vec2{outer}
+		inPocket, inFootprint := z1 <= floors[0], z1 <= floors[1]
+		switch {
+		case inFootprint && !inPocket:
+			loops = append(loops, toUnits(pocket, true))
+		case !inFootprint && inPocket:
+			loops = append(loops, toUnits(footprint, true), toUnits(pocket, false))
+		case !inFootprint && !inPocket:
+			loops = append(loops, toUnits(footprint, true))
+		}
+		if inPocket {
+			// The alignment pins' holes, through the floor under the board;
+			// the circles turn clockwise in units already
+			for _, p := range pinPolygons(cfg.pins, cfg.PinFit) {
+				loops = append(loops, toUnits(p, false))
+			}
+		}
+		triangles = extrudeLoops(triangles, loops, []wallStep{{0, 0}, {z1 - z0, 0}}, z0, width, height, vectorUnit)
+	}
+
+	// Back from the frame's top left to its bottom left, board side up
+	h := float64(height) * vectorUnit
+	for i, t := range triangles {
+		for j := range t {
+			t[j].Y = h - t[j].Y
+		}
+		triangles[i] = [3]Point{t[0], t[2], t[1]}
+	}
+	fmt.Fprintf(cfg.Stdout, "Jig: %.1f x %.1f mm, %g mm board pocket", frame.MaxX-frame.MinX, frame.MaxY-frame.MinY, cfg.BoardThickness)
+	if groove > 0 {
+		fmt.Fprintf(cfg.Stdout, ", %.2f mm groove for the stencil's wall", groove)
+	}
+	if len(cfg.pins) > 0 {
+		fmt.Fprintf(cfg.Stdout, ", %d alignment pin holes", len(cfg.pins))
+	}
+	fmt.Fprintln(cfg.Stdout)
+	return triangles, nil
+}
+
+// writeJig writes the jig for the board outline at outlinePath as an STL.
+func writeJig(outlinePath, path, source string, cfg Config) error {
+	outline, err := gerber.ParseMirrored(outlinePath, cfg.Mirror)
+	if err != nil {
+		return fmt.Errorf("error parsing outline gerber: %v", err)
+	}
+	triangles, err := GenerateJig(outline, cfg)
+	if err != nil {
+		return fmt.Errorf("error building jig: %v", err)
+	}
+	fmt.Fprintf(cfg.Stdout, "Saving jig to %s (%d triangles)...\n", path, len(triangles))
+	info := newMeshInfo(source, cfg, 0)
+	info.Name += " jig"
+	if err := stl.WriteFile(path, fileMesh(triangles, cfg), info, cfg.Progress); err != nil {
+		return fmt.Errorf("error writing jig: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package stencil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// strokeGlyphs is a single stroke font for text on the stencil, drawn with a
+// round pen so it survives printing at sizes the bitmap font can't. Glyphs
+// sit on a grid 4 wide and 6 high with the origin at the bottom left. Each
+// space separated polyline is a run of x,y digit pairs. Lowercase letters
+// are drawn as uppercase, unknown runes as blanks.
+var strokeGlyphs = map[rune]string{
+	'A': "000316364340 0343",
+	'B': "00063645443303 3342413000",
+	'C': "4536160501103041",
+	'D': "00062644422000",
+	'E': "40000646 0333",
+	'F': "000646 0333",
+	'G': "45361605011030414323",
+	'H': "0006 4046 0343",
+	'I': "1636 2620 1030",
+	'J': "4641301001",
+	'K': "0006 4602 1340",
+	'L': "060040",
+	'M': "0006234640",
+	'N': "00064046",
+	'O': "163645413010010516",
+	'P': "00063645443303",
+	'Q': "163645413010010516 2240",
+	'R': "00063645443303 3340",
+	'S': "453616050413334241301001",
+	'T': "0646 2620",
+	'U': "060110304146",
+	'V': "062046",
+	'W': "0610233046",
+	'X': "0046 0640",
+	'Y': "0623 4623 2320",
+	'Z': "06460040",
+	'0': "163645413010010516 0145",
+	'1': "052620 1030",
+	'2': "05163645440040",
+	'3': "064623334241301001",
+	'4': "30360242",
+	'5': "460603334241301001",
+	'6': "4536160501103041423303",
+	'7': "064610",
+	'8': "130405163645443313 1302011030414233",
+	'9': "0110304145361605041343",
+	'.': "2021",
+	',': "2110",
+	'-': "0343",
+	'+': "0343 2125",
+	'=': "0242 0444",
+	':': "2122 2425",
+	'/': "0046",
+	'(': "36252130",
+	')': "16252110",
+	'_': "0040",
+}
+
+// Stroke font metrics in grid units
+const (
+	strokeHeight  = 6.0 // Cap height
+	strokeAdvance = 6.0 // Width of a glyph cell, with the space after it
+)
+
+// Label relief, mm
+const labelRaise = 0.4 // How far a raised label stands proud of the squeegee side
+
+// strokeTextWidth returns the width in mm of s at the given cap height,
+// without the space after the last glyph.
+func strokeTextWidth(s string, size float64) float64 {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (float64(n)*strokeAdvance - 2) * size / strokeHeight
+}
+
+// strokeText returns s drawn with the stroke font in a gerber file, size mm
+// high with the bottom left corner of the text at (x, y), in a pen a
+// seventh of that wide.
+func strokeText(s string, x, y, size float64) *gerber.File {
+	gf := gerber.New()
+	unit := size / strokeHeight
+	gf.State.Apertures[10] = gerber.Aperture{Type: gerber.ApertureCircle, Modifiers: []float64{size / 7}}
+	d := 10
+	gf.Commands = append(gf.Commands, gerber.Command{Type: "APERTURE", D: &d})
+	for _, ch := range strings.ToUpper(s) {
+		for _, line := range strings.Fields(strokeGlyphs[ch]) {
+			for i := 0; i+1 < len(line); i += 2 {
+				px := x + float64(line[i]-'0')*unit
+				py := y + float64(line[i+1]-'0')*unit
+				op := "DRAW"
+				if i == 0 {
+					op = "MOVE"
+				}
+				gf.Commands = append(gf.Commands, gerber.Command{Type: op, X: &px, Y: &py})
+			}
+		}
+		x += strokeAdvance * unit
+	}
+	return gf
+}
+
+// ParseLabelAt parses the -label-at position, "x,y" in mm.
+func ParseLabelAt(s string) (*Point, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("label position must be x,y in mm, not %q", s)
+	}
+	x, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label x %q", parts[0])
+	}
+	y, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label y %q", parts[1])
+	}
+	return &Point{X: x, Y: y}, nil
+}
+
+// labelZone returns a step zone with cfg.Label on it, engraved half through
+// the plate from the squeegee side or, with cfg.LabelRaised, standing
+// labelRaise proud of it. It goes at cfg.LabelAt, or centered in the frame
+// below the paste layer gf. The text itself is never mirrored, only where it
+// goes.
+func labelZone(gf *gerber.File, cfg Config) (StepZone, error) {
+	at := cfg.LabelAt
+	if at != nil && cfg.Mirror != "" {
+		b := gerber.MirrorBounds(gerber.Bounds{MinX: at.X, MinY: at.Y, MaxX: at.X + strokeTextWidth(cfg.Label, cfg.LabelSize), MaxY: at.Y + cfg.LabelSize}, cfg.Mirror)
+		at = &Point{X: b.MinX, Y: b.MinY}
+	}
+	if at == nil {
+		b := gf.CalculateBounds()
+		if w, frame := strokeTextWidth(cfg.Label, cfg.LabelSize), b.MaxX-b.MinX+2*frameMargin(cfg); w > frame {
+			cfg.Log.Printf("Warning: the label is %.1f mm long and the frame %.1f mm wide, it will be cut off", w, frame)
+		}
+		at = &Point{
+			X: (b.MinX+b.MaxX)/2 - strokeTextWidth(cfg.Label, cfg.LabelSize)/2,
+			Y: b.MinY - (frameMargin(cfg)+cfg.LabelSize)/2,
+		}
+	}
+	z := StepZone{
+		Thickness: cfg.StencilHeight / 2,
+		Shapes:    strokeText(cfg.Label, at.X, at.Y, cfg.LabelSize),
+		Name:      fmt.Sprintf("the label %q", cfg.Label),
+	}
+	if cfg.LabelRaised {
+		z.Thickness = cfg.StencilHeight + labelRaise
+	}
+	return z, nil
+}
@@ -0,0 +1,50 @@
+package stencil
+
+import "pcb-to-stencil/pkg/gerber"
+
+// Corner locators replace the wall around the board with two L-shaped blocks
+// at its bottom left and top right corners, which key the stencil onto the
+// board's corners with less to print and less to catch on parts at the edge.
+
+// cornerLocators returns the two L-shaped blocks around the plate's corners,
+// in the plate's coordinates, counter-clockwise: arm mm along each edge from
+// the corner, t thick.
+func cornerLocators(plate gerber.Bounds, t, arm float64) [][]vec2 {
+	x0, y0, x1, y1 := plate.MinX, plate.MinY, plate.MaxX, plate.MaxY
+	return [][]vec2{
+		{{X: x0 - t, Y: y0 - t}, {X: x0 + arm, Y: y0 - t}, {X: x0 + arm, Y: y0}, {X: x0, Y: y0}, {X: x0, Y: y0 + arm}, {X: x0 - t, Y: y0 + arm}},
+		{{X: x1 + t, Y: y1 + t}, {X: x1 - arm, Y: y1 + t}, {X: x1 - arm, Y: y1}, {X: x1, Y: y1}, {X: x1, Y: y1 - arm}, {X: x1 + t, Y: y1 - arm}},
+	}
+}
+
+// locatedPlate returns the outline of the plate with the corner locators
+// joined on, counter-clockwise.
+func locatedPlate(plate gerber.Bounds, t, arm float64) []vec2 {
+	x0, y0, x1, y1 := plate.MinX, plate.MinY, plate.MaxX, plate.MaxY
+	return []vec2{
+		{X: x0 - t, Y: y0 - t}, {X: x0 + arm, Y: y0 - t}, {X: x0 + arm, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1 - arm}, {X: x1 + t, Y: y1 - arm},
+		{X: x1 + t, Y: y1 + t}, {X: x1 - arm, Y: y1 + t}, {X: x1 - arm, Y: y1}, {X: x0, Y: y1}, {X: x0, Y: y0 + arm}, {X: x0 - t, Y: y0 + arm},
+	}
+}
+
+// keepCornerLocators clears the wall pixels of the mask except within arm
+// pixels of the bottom left and top right corners of the board's extent.
+// Rows run down from the top, like the rendered images'.
+func keepCornerLocators(wallMask, boardMask []bool, width int, arm int) {
+	x0, y0, x1, y1 := width, len(boardMask)/width, -1, -1
+	for i, in := range boardMask {
+		if in {
+			x, y := i%width, i/width
+			x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+		}
+	}
+	for i, wall := range wallMask {
+		if !wall {
+			continue
+		}
+		x, y := i%width, i/width
+		bottomLeft := x < x0+arm && y > y1-arm
+		topRight := x > x1-arm && y < y0+arm
+		wallMask[i] = bottomLeft || topRight
+	}
+}
@@ -0,0 +1,112 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Magnet pocket dimensions, mm
+const (
+	magnetFit  = 0.1 // Clearance around the magnet
+	magnetWall = 1.2 // Wall of the boss around the pocket
+	magnetSkin = 0.6 // Cap over the magnet on the squeegee side
+)
+
+// MagnetPockets are blind pockets in the underside of the frame for disc
+// magnets, each in a boss standing above the squeegee side deep enough to
+// hold it.
+type MagnetPockets struct {
+	Diameter float64 // Magnet diameter, mm; 0 for none
+	Depth    float64 // Magnet height, mm
+	Count    int     // One in each corner for 4; more go along the top and bottom edges
+}
+
+// ParseMagnetPockets reads a -magnet-pockets value: d=diameter, with
+// optional h=height and count=n, such as d=6,h=2,count=4.
+func ParseMagnetPockets(s string) (MagnetPockets, error) {
+	if s == "" {
+		return MagnetPockets{}, nil
+	}
+	m := MagnetPockets{Depth: 2, Count: 4}
+	for _, p := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil || f <= 0 {
+			return MagnetPockets{}, fmt.Errorf("invalid magnet pockets %q: want d=diameter,h=height,count=n in mm, such as d=6,h=2,count=4", s)
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "d":
+			m.Diameter = f
+		case "h":
+			m.Depth = f
+		case "count":
+			m.Count = int(f)
+			if float64(m.Count) != f || m.Count%2 != 0 {
+				return MagnetPockets{}, fmt.Errorf("invalid magnet pockets %q: the count must be even, half along each edge", s)
+			}
+		default:
+			return MagnetPockets{}, fmt.Errorf("invalid magnet pockets %q: unknown %q, want d, h or count", s, k)
+		}
+	}
+	if m.Diameter == 0 {
+		return MagnetPockets{}, fmt.Errorf("invalid magnet pockets %q: the magnet diameter d is missing", s)
+	}
+	return m, nil
+}
+
+func (m MagnetPockets) String() string {
+	return fmt.Sprintf("%d x %g x %g mm", m.Count, m.Diameter, m.Depth)
+}
+
+// bossRadius is the radius of the boss around each pocket, mm.
+func (m MagnetPockets) bossRadius() float64 {
+	return (m.Diameter+magnetFit)/2 + magnetWall
+}
+
+// margin is the width of frame the bosses need around the openings, mm.
+func (m MagnetPockets) margin() float64 {
+	return 2*m.bossRadius() + 2
+}
+
+// positions returns the pocket centers in a frame w x h mm, from its top
+// left: half along the top edge and half along the bottom one, spread from
+// corner to corner.
+func (m MagnetPockets) positions(w, h float64) []vec2 {
+	o := m.bossRadius() + 1
+	n := m.Count / 2
+	var pts []vec2
+	for _, y := range []float64{o, h - o} {
+		for i := 0; i < n; i++ {
+			x := w / 2
+			if n > 1 {
+				x = o + float64(i)*(w-2*o)/float64(n-1)
+			}
+			pts = append(pts, vec2{X: x, Y: y})
+		}
+	}
+	return pts
+}
+
+// magnetHeights returns a function telling where the solid at a pixel of a
+// w x h image with pixelToMM mm pixels starts and ends in a pocket's boss:
+// from the magnet up in the pocket, and from 0 around it, up to top at
+// least. ok is false outside the bosses.
+func magnetHeights(m MagnetPockets, w, h int, pixelToMM, top float64) func(x, y int) (floor, ceil float64, ok bool) {
+	pts := m.positions(float64(w)*pixelToMM, float64(h)*pixelToMM)
+	top = math.Max(top, m.Depth+magnetFit+magnetSkin)
+	r, boss := (m.Diameter+magnetFit)/2, m.bossRadius()
+	return func(x, y int) (float64, float64, bool) {
+		px, py := (float64(x)+0.5)*pixelToMM, (float64(y)+0.5)*pixelToMM
+		for _, p := range pts {
+			switch d := math.Hypot(px-p.X, py-p.Y); {
+			case d <= r:
+				return m.Depth + magnetFit, top, true
+			case d <= boss:
+				return 0, top, true
+			}
+		}
+		return 0, 0, false
+	}
+}
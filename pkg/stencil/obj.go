@@ -0,0 +1,60 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"pcb-to-stencil/pkg/mesh"
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// WriteOBJ writes the mesh as a Wavefront OBJ object with shared vertices,
+// for mesh editors that merge or repair by vertex, named after info and with
+// the rest of it in a comment.
+func WriteOBJ(filename string, triangles [][3]Point, info stl.Info, report progress.Func) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	vertices, faces := mesh.Index(triangles)
+	fmt.Fprintf(w, "# Solder paste stencil from %s, units %s\n", info.Summary(), info.Units)
+	fmt.Fprintf(w, "o %s\n", info.Name)
+	var buf []byte
+	for i, v := range vertices {
+		if i%65536 == 0 {
+			report.Report("Writing OBJ", i, len(vertices)+len(faces))
+		}
+		buf = append(buf[:0], 'v')
+		for _, c := range v {
+			buf = append(buf, ' ')
+			buf = strconv.AppendFloat(buf, float64(math.Float32frombits(c)), 'g', -1, 32)
+		}
+		buf = append(buf, '\n')
+		w.Write(buf)
+	}
+	// Face indices count from 1
+	for i, t := range faces {
+		if i%65536 == 0 {
+			report.Report("Writing OBJ", len(vertices)+i, len(vertices)+len(faces))
+		}
+		buf = append(buf[:0], 'f')
+		for _, n := range t {
+			buf = append(buf, ' ')
+			buf = strconv.AppendUint(buf, uint64(n)+1, 10)
+		}
+		buf = append(buf, '\n')
+		w.Write(buf)
+	}
+	report.Report("Writing OBJ", 1, 1)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,85 @@
+package stencil
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Panel lays copies of the board's paste layer out in a grid, as the boards
+// were panelized for reflow.
+type Panel struct {
+	Cols, Rows int
+	Spacing    float64 // Gap between neighbouring boards, mm
+	Rails      float64 // Width of the panel's rails, which the frame grows by, mm
+	StepX      float64 // Distance from one board to the next, set from the board's size
+	StepY      float64
+}
+
+// ParsePanel reads a -panel value, "colsxrows" such as 2x3.
+func ParsePanel(s string) (Panel, error) {
+	if s == "" {
+		return Panel{}, nil
+	}
+	cols, rows, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return Panel{}, fmt.Errorf("invalid panel %q: want columns x rows, such as 2x3", s)
+	}
+	c, err1 := strconv.Atoi(strings.TrimSpace(cols))
+	r, err2 := strconv.Atoi(strings.TrimSpace(rows))
+	if err1 != nil || err2 != nil || c < 1 || r < 1 {
+		return Panel{}, fmt.Errorf("invalid panel %q: want columns x rows, such as 2x3", s)
+	}
+	return Panel{Cols: c, Rows: r}, nil
+}
+
+// boards is how many boards the panel holds, 0 without one.
+func (p Panel) boards() int {
+	return p.Cols * p.Rows
+}
+
+// setStep sets the distance between boards from the board's extent: that of
+// the outline when there is one, or else of the paste layer gf.
+func (p *Panel) setStep(gf *gerber.File, outlinePath string, cfg Config) error {
+	if outlinePath != "" {
+		var err error
+		if gf, err = gerber.ParseMirrored(outlinePath, cfg.Mirror); err != nil {
+			return fmt.Errorf("error parsing outline gerber: %v", err)
+		}
+	}
+	b := gf.CalculateBounds()
+	const padding = 2.0 // CalculateBounds' own
+	p.StepX = b.MaxX - b.MinX - 2*padding + p.Spacing
+	p.StepY = b.MaxY - b.MinY - 2*padding + p.Spacing
+	return nil
+}
+
+// panelize repeats the commands of gf across the panel, the first board
+// where it is and the others to its right and above it. The references of
+// each copy's components get a suffix with its board number, so the copies
+// of a part stay apart.
+func panelize(gf *gerber.File, p Panel) {
+	board := &gerber.File{
+		Commands: gf.Commands,
+		State: gerber.State{
+			Apertures: maps.Clone(gf.State.Apertures),
+			Macros:    maps.Clone(gf.State.Macros),
+		},
+		Unsupported: map[string]int{},
+	}
+	for k := 1; k < p.boards(); k++ {
+		c := *board
+		c.Commands = make([]gerber.Command, len(board.Commands))
+		for i, cmd := range board.Commands {
+			if cmd.Type == "COMPONENT" && cmd.Name != "" {
+				cmd.Name = fmt.Sprintf("%s#%d", cmd.Name, k+1)
+			}
+			c.Commands[i] = cmd
+		}
+		col, row := k%p.Cols, k/p.Cols
+		appendShifted(gf, &c, float64(col)*p.StepX, float64(row)*p.StepY, fmt.Sprintf("PANEL%d_", k+1))
+	}
+}
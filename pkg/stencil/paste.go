@@ -0,0 +1,120 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// DefaultPasteDensity is the density of SAC305 paste at 88% metal by weight,
+// g/cm³: half alloy, half flux by volume.
+const DefaultPasteDensity = 4.2
+
+// pasteVolume is the paste a group of openings deposits: those of one
+// component, or a single opening.
+type pasteVolume struct {
+	Name     string
+	Openings int
+	Area     float64 // mm²
+	Volume   float64 // mm³
+}
+
+// pasteVolumes sums the paste each opening of a rendered stencil holds, its
+// area times the thickness of the plate around it, by the component whose
+// pads it's on. Openings with no component, or all of them when comps is
+// empty, are listed one by one. comps are the components' extents in the
+// coordinates at returns for pixel positions.
+func pasteVolumes(img image.Image, cfg Config, comps map[string]gerber.Bounds, at func(px, py float64) (float64, float64)) (groups []pasteVolume, total pasteVolume) {
+	openings, boxes := findOpenings(openingBitmap(img))
+	byRef := make(map[string]*pasteVolume)
+	var loose []pasteVolume
+	for i, runs := range openings {
+		area, volume := openingVolume(runs, cfg)
+		total.Openings++
+		total.Area += area
+		total.Volume += volume
+
+		// The smallest component around the middle of the opening
+		x, y := at(float64(boxes[i].Min.X+boxes[i].Max.X)/2, float64(boxes[i].Min.Y+boxes[i].Max.Y)/2)
+		ref, best := "", math.Inf(1)
+		for name, b := range comps {
+			if size := (b.MaxX - b.MinX) * (b.MaxY - b.MinY); x >= b.MinX && x <= b.MaxX && y >= b.MinY && y <= b.MaxY && size < best {
+				ref, best = name, size
+			}
+		}
+		if ref == "" {
+			loose = append(loose, pasteVolume{Name: fmt.Sprintf("opening at (%.2f, %.2f)", unsigned0(x), unsigned0(y)), Openings: 1, Area: area, Volume: volume})
+			continue
+		}
+		g, ok := byRef[ref]
+		if !ok {
+			g = &pasteVolume{Name: ref}
+			byRef[ref] = g
+		}
+		g.Openings++
+		g.Area += area
+		g.Volume += volume
+	}
+	for _, g := range byRef {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return naturalLess(groups[i].Name, groups[j].Name) })
+	return append(groups, loose...), total
+}
+
+// openingVolume returns the area of an opening in mm² and the paste it
+// holds in mm³, its area times the thickness of the plate around it.
+func openingVolume(runs []openingRun, cfg Config) (area, volume float64) {
+	pixelToMM := 25.4 / cfg.DPI
+	pixelArea := pixelToMM * pixelToMM
+	for _, r := range runs {
+		for x := r.x0; x < r.x1; x++ {
+			thick := cfg.StencilHeight
+			for _, z := range cfg.Steps {
+				if z.Mask.Get(x, r.y) {
+					thick = z.Thickness
+				}
+			}
+			area += pixelArea
+			volume += pixelArea * thick
+		}
+	}
+	return area, volume
+}
+
+// naturalLess orders component references by their letters, then by their
+// number, so R2 comes before R10.
+func naturalLess(a, b string) bool {
+	split := func(s string) (string, int) {
+		i := len(s)
+		for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+			i--
+		}
+		n := 0
+		fmt.Sscan(s[i:], &n)
+		return s[:i], n
+	}
+	pa, na := split(a)
+	pb, nb := split(b)
+	if pa != pb {
+		return pa < pb
+	}
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// printPasteVolumes lists the paste of each group and the total to w, with
+// its weight at density g/cm³.
+func printPasteVolumes(groups []pasteVolume, total pasteVolume, density float64, w io.Writer) {
+	fmt.Fprintf(w, "%-28s %8s %10s %10s %9s\n", "Paste", "Openings", "Area mm²", "Volume mm³", "Weight mg")
+	for _, g := range groups {
+		fmt.Fprintf(w, "%-28s %8d %10.3f %10.4f %9.2f\n", g.Name, g.Openings, g.Area, g.Volume, g.Volume*density)
+	}
+	fmt.Fprintf(w, "Paste volume: %.3f mm³ in %d openings, %.1f mg at %g g/cm³\n", total.Volume, total.Openings, total.Volume*density, density)
+}
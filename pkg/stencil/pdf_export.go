@@ -0,0 +1,133 @@
+package stencil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// Layout of the check print, mm
+const (
+	pdfMargin   = 15.0 // Around the page
+	pdfFooter   = 20.0 // Below the drawing, for the scale bar and title
+	pdfScaleBar = 50.0 // Length of the scale bar
+	pdfPoint    = 72 / 25.4
+)
+
+// pdfA4 is the paper the check print goes on when it fits, mm.
+var pdfA4 = [2]float64{210, 297}
+
+// pdfString quotes s as a PDF literal string.
+func pdfString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	return "(" + r.Replace(s) + ")"
+}
+
+// WriteStencilPDF writes the apertures filled in black and the board outline
+// (or the edge of frame) in blue at 1:1 scale, to print on paper and lay
+// over the board to check registration before printing the stencil. It goes
+// on an A4 page, turned if need be, or a page of its own size when it
+// doesn't fit, with a 50 mm scale bar to check the printer kept the scale.
+func WriteStencilPDF(filename string, paste, outline *gerber.File, frame gerber.Bounds, title string, cfg Config) error {
+	w, h := frame.MaxX-frame.MinX, frame.MaxY-frame.MinY
+	page := pdfA4
+	switch {
+	case w+2*pdfMargin <= page[0] && h+2*pdfMargin+pdfFooter <= page[1]:
+	case w+2*pdfMargin <= page[1] && h+2*pdfMargin+pdfFooter <= page[0]:
+		page = [2]float64{page[1], page[0]}
+	default:
+		page = [2]float64{w + 2*pdfMargin, h + 2*pdfMargin + pdfFooter}
+		fmt.Fprintf(cfg.Stdout, "Stencil doesn't fit on A4, making the page %.0f x %.0f mm\n", page[0], page[1])
+	}
+	// Bottom left of the frame on the page, centered above the footer
+	x0 := (page[0] - w) / 2
+	y0 := pdfMargin + pdfFooter + (page[1]-2*pdfMargin-pdfFooter-h)/2
+
+	var content bytes.Buffer
+	path := func(pts []vec2, closed bool) {
+		for i, p := range pts {
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(&content, "%.4f %.4f %s\n", p.X-frame.MinX+x0, p.Y-frame.MinY+y0, op)
+		}
+		if closed {
+			fmt.Fprintf(&content, "h\n")
+		}
+	}
+	// Draw in mm
+	fmt.Fprintf(&content, "q\n%.6f 0 0 %.6f 0 0 cm\n", pdfPoint, pdfPoint)
+	contours := cutApertures(paste, 0, cfg.Log)
+	fmt.Fprintf(&content, "0 g\n")
+	for _, c := range contours {
+		path(c, true)
+	}
+	if len(contours) > 0 {
+		fmt.Fprintf(&content, "f*\n")
+	}
+	fmt.Fprintf(&content, "0 0 0.8 RG 0.1 w\n")
+	paths, closed := cutOutline(outline, frame, 0)
+	for i, p := range paths {
+		path(p, closed[i])
+	}
+	fmt.Fprintf(&content, "S\n")
+	// The scale bar, with a tick every 10 mm
+	fmt.Fprintf(&content, "0 G 0.3 w\n%.4f %.4f m %.4f %.4f l\n", pdfMargin, pdfMargin, pdfMargin+pdfScaleBar, pdfMargin)
+	for x := 0.0; x <= pdfScaleBar; x += 10 {
+		fmt.Fprintf(&content, "%.4f %.4f m %.4f %.4f l\n", pdfMargin+x, pdfMargin, pdfMargin+x, pdfMargin+3)
+	}
+	fmt.Fprintf(&content, "S\nQ\n")
+	text := func(x, y, size float64, s string) {
+		fmt.Fprintf(&content, "BT /F1 %g Tf %.2f %.2f Td %s Tj ET\n", size, x*pdfPoint, y*pdfPoint, pdfString(s))
+	}
+	text(pdfMargin+pdfScaleBar+3, pdfMargin, 8, fmt.Sprintf("%g mm: print at 100%% (actual size) and measure this bar to check the scale", pdfScaleBar))
+	text(pdfMargin, pdfMargin+8, 10, title)
+
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write(content.Bytes())
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out := bufio.NewWriter(f)
+	offsets := []int{}
+	n := 0
+	write := func(format string, args ...any) {
+		k, _ := fmt.Fprintf(out, format, args...)
+		n += k
+	}
+	object := func(body string) {
+		offsets = append(offsets, n)
+		write("%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	write("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>", page[0]*pdfPoint, page[1]*pdfPoint))
+	object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	object(fmt.Sprintf("<< /Title %s /Producer %s >>", pdfString(title), pdfString("pcb-to-stencil "+toolVersion())))
+	xref := n
+	write("xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		write("%010d 00000 n \n", o)
+	}
+	write("trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), xref)
+	fmt.Fprintf(cfg.Stdout, "PDF: %d aperture contours on a %.0f x %.0f mm page\n", len(contours), page[0], page[1])
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
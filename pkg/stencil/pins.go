@@ -0,0 +1,88 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/render"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// pinReach is how far alignment pins stand above the stencil's plate, mm.
+const pinReach = 1.0
+
+// pinDiameter is the diameter of the pin for a tooling hole, fit mm under
+// the hole's so the board and stencil slide over it.
+func pinDiameter(h DrillHole, fit float64) float64 {
+	return h.Diameter - fit
+}
+
+// punchPinHoles opens the tooling holes pins, in gerber mm, through img,
+// the paste layer rendered over frame at dpi, and counts them to w.
+func punchPinHoles(img image.Image, frame gerber.Bounds, dpi float64, pins []DrillHole, w io.Writer) {
+	bm, ok := img.(*render.Bitmap)
+	if !ok {
+		return
+	}
+	scale := dpi / 25.4
+	for _, h := range pins {
+		render.DrawCircle(bm, (h.X-frame.MinX)*scale, (frame.MaxY-h.Y)*scale, h.Diameter/2*scale)
+	}
+	fmt.Fprintf(w, "Alignment pin holes: %d\n", len(pins))
+}
+
+// pinPolygons returns the tooling holes pins as polygons, like
+// gf.VectorPolygons, d mm narrower than the holes.
+func pinPolygons(pins []DrillHole, d float64) [][]vec2 {
+	var polys [][]vec2
+	for _, h := range pins {
+		polys = append(polys, gerber.CirclePoly(h.X, h.Y, (h.Diameter-d)/2))
+	}
+	return polys
+}
+
+// cylinderMesh returns a closed cylinder of radius r from z 0 to h, standing
+// on (cx, cy).
+func cylinderMesh(triangles [][3]Point, cx, cy, r, h float64) [][3]Point {
+	ring := gerber.CirclePoly(cx, cy, r)
+	mid0, mid1 := Point{X: cx, Y: cy, Z: 0}, Point{X: cx, Y: cy, Z: h}
+	for i, a := range ring {
+		b := ring[(i+1)%len(ring)]
+		a0, b0 := Point{X: a.X, Y: a.Y, Z: 0}, Point{X: b.X, Y: b.Y, Z: 0}
+		a1, b1 := Point{X: a.X, Y: a.Y, Z: h}, Point{X: b.X, Y: b.Y, Z: h}
+		triangles = append(triangles,
+			[3]Point{a0, b0, b1}, [3]Point{a0, b1, a1},
+			[3]Point{mid0, b0, a0}, [3]Point{mid1, a1, b1})
+	}
+	return triangles
+}
+
+// GeneratePins builds a pin for each tooling hole, long enough to reach
+// from the bottom of the jig through the board and the stencil's plate,
+// standing in a row to print.
+func GeneratePins(pins []DrillHole, cfg Config) [][3]Point {
+	length := jigBase + cfg.BoardThickness + cfg.StencilHeight + pinReach
+	var triangles [][3]Point
+	x := 0.0
+	for _, h := range pins {
+		d := pinDiameter(h, cfg.PinFit)
+		triangles = cylinderMesh(triangles, x+d/2, d/2, d/2, length)
+		x += d + math.Max(d, 2)
+	}
+	return triangles
+}
+
+// writePins writes the pins for the tooling holes of cfg as an STL.
+func writePins(path, source string, cfg Config) error {
+	triangles := GeneratePins(cfg.pins, cfg)
+	fmt.Fprintf(cfg.Stdout, "Saving %d alignment pins to %s (%d triangles)...\n", len(cfg.pins), path, len(triangles))
+	info := newMeshInfo(source, cfg, 0)
+	info.Name += " pins"
+	if err := stl.WriteFile(path, fileMesh(triangles, cfg), info, cfg.Progress); err != nil {
+		return fmt.Errorf("error writing pins: %v", err)
+	}
+	return nil
+}
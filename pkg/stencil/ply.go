@@ -0,0 +1,56 @@
+package stencil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"pcb-to-stencil/pkg/mesh"
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// WritePLY writes the mesh as a binary little endian PLY with shared
+// vertices, for MeshLab, Open3D and the like, with info in its comments.
+func WritePLY(filename string, triangles [][3]Point, info stl.Info, report progress.Func) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	vertices, faces := mesh.Index(triangles)
+	fmt.Fprintf(w, "ply\nformat binary_little_endian 1.0\n")
+	fmt.Fprintf(w, "comment %s\ncomment Solder paste stencil from %s, units %s\n", info.Name, info.Summary(), info.Units)
+	fmt.Fprintf(w, "element vertex %d\nproperty float x\nproperty float y\nproperty float z\n", len(vertices))
+	fmt.Fprintf(w, "element face %d\nproperty list uchar uint vertex_indices\nend_header\n", len(faces))
+
+	// Vertices are 3 floats, faces a count of 3 and 3 indices
+	buf := make([]byte, 13)
+	for i, v := range vertices {
+		if i%65536 == 0 {
+			report.Report("Writing PLY", i, len(vertices)+len(faces))
+		}
+		for j, c := range v {
+			binary.LittleEndian.PutUint32(buf[4*j:], c)
+		}
+		w.Write(buf[:12])
+	}
+	buf[0] = 3
+	for i, t := range faces {
+		if i%65536 == 0 {
+			report.Report("Writing PLY", len(vertices)+i, len(vertices)+len(faces))
+		}
+		for j, n := range t {
+			binary.LittleEndian.PutUint32(buf[1+4*j:], n)
+		}
+		w.Write(buf)
+	}
+	report.Report("Writing PLY", 1, 1)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
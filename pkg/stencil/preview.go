@@ -0,0 +1,162 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// Preview colors
+var (
+	previewMaterial = color.RGBA{70, 70, 70, 255}
+	previewOpening  = color.RGBA{255, 255, 255, 255}
+	previewOutline  = color.RGBA{230, 140, 30, 255}
+	previewInk      = color.RGBA{80, 200, 255, 255}
+	previewPoor     = color.RGBA{230, 50, 50, 255}
+	previewWeb      = color.RGBA{255, 220, 0, 255}
+)
+
+// openBounds returns the bounding box of the open pixels of img, and false
+// if it has none.
+func openBounds(img image.Image) (image.Rectangle, bool) {
+	b := img.Bounds()
+	r := image.Rectangle{}
+	found := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !render.IsOpen(img, x, y) {
+				continue
+			}
+			p := image.Rect(x, y, x+1, y+1)
+			if !found {
+				r, found = p, true
+			} else {
+				r = r.Union(p)
+			}
+		}
+	}
+	return r, found
+}
+
+// countOpenings returns the number of separate openings (4-connected regions
+// of open pixels) in img, by joining the open runs of adjacent rows.
+func countOpenings(img image.Image) int {
+	b := img.Bounds()
+	parent := []int{}
+	var find func(i int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	type run struct{ x0, x1, id int }
+	var prev []run
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var cur []run
+		for x := b.Min.X; x < b.Max.X; {
+			if !render.IsOpen(img, x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < b.Max.X && render.IsOpen(img, x, y) {
+				x++
+			}
+			id := len(parent)
+			parent = append(parent, id)
+			n++
+			for _, p := range prev {
+				if p.x0 < x && start < p.x1 {
+					if a, c := find(p.id), find(id); a != c {
+						parent[c] = a
+						n--
+					}
+				}
+			}
+			cur = append(cur, run{start, x, id})
+		}
+		prev = cur
+	}
+	return n
+}
+
+// renderPreview turns the rendered layers into an annotated image for
+// checking a stencil before printing: the board's bounding box with its size
+// in mm, a 10 mm scale bar, the number of openings and the stencil
+// thickness. The board is taken from the outline when there is one. The
+// openings of poor, if any, are colored as ones that won't release paste,
+// and the plate of webs as too thin.
+func renderPreview(img, outlineImg image.Image, poor, webs *render.Bitmap, cfg Config) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := previewMaterial
+			if poor != nil && poor.Get(x, y) {
+				c = previewPoor
+			} else if webs != nil && webs.Get(x, y) {
+				c = previewWeb
+			} else if render.IsOpen(img, x, y) {
+				c = previewOpening
+			} else if outlineImg != nil && render.IsOpen(outlineImg, x, y) {
+				c = previewOutline
+			}
+			out.SetRGBA(x, y, c)
+		}
+	}
+
+	pxPerMM := cfg.DPI / 25.4
+	scale := max(1, b.Dy()/300)
+	line := render.GlyphLine * scale
+	ink := image.NewUniform(previewInk)
+	stroke := max(1, scale/2)
+	hline := func(x0, x1, y int) {
+		draw.Draw(out, image.Rect(x0, y, x1, y+stroke), ink, image.Point{}, draw.Src)
+	}
+	vline := func(x, y0, y1 int) {
+		draw.Draw(out, image.Rect(x, y0, x+stroke, y1), ink, image.Point{}, draw.Src)
+	}
+
+	board, ok := image.Rectangle{}, false
+	if outlineImg != nil {
+		board, ok = openBounds(outlineImg)
+	}
+	if !ok {
+		board, ok = openBounds(img)
+	}
+	if ok {
+		hline(board.Min.X, board.Max.X, board.Min.Y)
+		hline(board.Min.X, board.Max.X, board.Max.Y)
+		vline(board.Min.X, board.Min.Y, board.Max.Y)
+		vline(board.Max.X, board.Min.Y, board.Max.Y+stroke)
+		w := fmt.Sprintf("%.2f mm", float64(board.Dx())/pxPerMM)
+		h := fmt.Sprintf("%.2f mm", float64(board.Dy())/pxPerMM)
+		render.DrawText(out, board.Min.X+(board.Dx()-render.TextWidth(w, scale))/2, board.Min.Y-line, w, scale, previewInk)
+		render.DrawText(out, board.Max.X+line/2, board.Min.Y+(board.Dy()-line)/2, h, scale, previewInk)
+	}
+
+	// 10 mm scale bar in the bottom left corner, with ticks at both ends
+	barLen := int(10 * pxPerMM)
+	x0, y0 := line, b.Max.Y-line
+	hline(x0, x0+barLen, y0)
+	vline(x0, y0-line/2, y0+stroke)
+	vline(x0+barLen, y0-line/2, y0+stroke)
+	render.DrawText(out, x0, y0-line-line/2, "10 mm", scale, previewInk)
+
+	info := []string{
+		fmt.Sprintf("%d openings", countOpenings(img)),
+		fmt.Sprintf("Thickness %.2f mm", cfg.StencilHeight),
+		fmt.Sprintf("%.0f DPI", cfg.DPI),
+	}
+	for i, s := range info {
+		render.DrawText(out, line, line/2+i*line, s, scale, previewInk)
+	}
+	return out
+}
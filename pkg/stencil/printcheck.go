@@ -0,0 +1,167 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// resinMinPixels is how many screen pixels across the smallest feature a
+// resin printer forms reliably is; a single pixel barely cures.
+const resinMinPixels = 2
+
+// minFeature returns the narrowest opening or web in mm the printer of cfg
+// can form, from its nozzle or pixel pitch, or 0 if neither is set.
+func minFeature(cfg Config) float64 {
+	return math.Max(cfg.Nozzle, resinMinPixels*cfg.ResinPitch)
+}
+
+// featureWidth turns the largest squared distance in pixels from a pixel of
+// a region to the pixels around it into the width in mm of the region there.
+func featureWidth(d, pixelToMM float64) float64 {
+	return (2*math.Sqrt(d) - 0.5) * pixelToMM
+}
+
+// narrowFeature is an opening or web narrower than a printer forms: where it
+// is, its pixels, and about how wide it is at its widest, in mm.
+type narrowFeature struct {
+	X, Y  float64
+	Width float64
+	runs  []openingRun
+}
+
+// narrowOpenings returns the openings of b narrower everywhere than width
+// mm, measured as the diameter of the largest circle inside them.
+func narrowOpenings(b *render.Bitmap, width, pixelToMM float64) []narrowFeature {
+	openings, boxes := findOpenings(b)
+	var narrow []narrowFeature
+	for i, runs := range openings {
+		box := boxes[i].Inset(-1)
+		w, h := box.Dx(), box.Dy()
+		in := make([]bool, w*h)
+		for _, r := range runs {
+			for x := r.x0; x < r.x1; x++ {
+				in[(r.y-box.Min.Y)*w+x-box.Min.X] = true
+			}
+		}
+		widest := 0.0
+		for j, d := range distanceField(w, h, func(x, y int) bool { return !in[y*w+x] }, 1, 1) {
+			if in[j] {
+				widest = math.Max(widest, d)
+			}
+		}
+		if mm := featureWidth(widest, pixelToMM); mm < width {
+			c := boxes[i].Min.Add(boxes[i].Max)
+			narrow = append(narrow, narrowFeature{X: float64(c.X) / 2, Y: float64(c.Y) / 2, Width: mm, runs: runs})
+		}
+	}
+	return narrow
+}
+
+// thinWebs returns the places where the plate between openings of b, or in
+// a notch of one, is narrower than width mm: the solid pixels a closing of
+// the openings with a disc that wide fills in.
+func thinWebs(b *render.Bitmap, width, pixelToMM float64) []narrowFeature {
+	bounds, ok := openBounds(b)
+	if !ok {
+		return nil
+	}
+	r := width / pixelToMM / 2
+	crop := bounds.Inset(-int(math.Ceil(r)) - 1).Intersect(image.Rect(0, 0, b.Width, b.Height))
+	w, h := crop.Dx(), crop.Dy()
+	open := func(x, y int) bool { return b.Get(crop.Min.X+x, crop.Min.Y+y) }
+
+	// Dilate, then erode what that covers: what's left beyond the openings
+	// is narrower than the disc
+	toOpen := distanceField(w, h, open, 1, 1)
+	covered := func(x, y int) bool { return toOpen[y*w+x] <= r*r }
+	toBare := distanceField(w, h, func(x, y int) bool { return !covered(x, y) }, 1, 1)
+	thin := render.NewBitmap(b.Width, b.Height)
+	for j, d := range toBare {
+		x, y := j%w, j/w
+		if d > r*r && !open(x, y) {
+			thin.SetBit(crop.Min.X+x, crop.Min.Y+y)
+		}
+	}
+
+	places, boxes := findOpenings(thin)
+	webs := make([]narrowFeature, len(places))
+	for i, runs := range places {
+		widest := 0.0
+		for _, run := range runs {
+			for x := run.x0; x < run.x1; x++ {
+				widest = math.Max(widest, toOpen[(run.y-crop.Min.Y)*w+x-crop.Min.X])
+			}
+		}
+		c := boxes[i].Min.Add(boxes[i].Max)
+		webs[i] = narrowFeature{X: float64(c.X) / 2, Y: float64(c.Y) / 2, Width: featureWidth(widest, pixelToMM), runs: runs}
+	}
+	return webs
+}
+
+// narrowest returns the narrowest of features.
+func narrowest(features []narrowFeature) narrowFeature {
+	n := features[0]
+	for _, f := range features[1:] {
+		if f.Width < n.Width {
+			n = f
+		}
+	}
+	return n
+}
+
+// checkPrintability warns about the openings and webs of a rendered stencil
+// narrower than the printer of cfg can form, with the narrowest of each at
+// the coordinates at returns for its pixel position.
+func checkPrintability(img image.Image, cfg Config, at func(px, py float64) (float64, float64)) {
+	width := minFeature(cfg)
+	pixelToMM := 25.4 / cfg.DPI
+	b := openingBitmap(img)
+	openings := narrowOpenings(b, width, pixelToMM)
+	webs := thinWebs(b, width, pixelToMM)
+	if len(openings) == 0 && len(webs) == 0 {
+		fmt.Fprintf(cfg.Stdout, "Printability: every opening and web is at least %g mm wide\n", width)
+		return
+	}
+	if len(openings) > 0 {
+		n := narrowest(openings)
+		x, y := at(n.X, n.Y)
+		cfg.Log.Printf("Warning: %d openings are narrower than %g mm, the smallest the printer forms; the narrowest is %.2f mm at (%.2f, %.2f)", len(openings), width, n.Width, x, y)
+	}
+	if len(webs) > 0 {
+		n := narrowest(webs)
+		x, y := at(n.X, n.Y)
+		cfg.Log.Printf("Warning: the plate is narrower than %g mm between openings in %d places, down to %.2f mm at (%.2f, %.2f)", width, len(webs), n.Width, x, y)
+	}
+}
+
+// printWebs lists the thin webs under cfg.MinWeb with where they are, in
+// the coordinates at returns for their pixel positions.
+func printWebs(webs []narrowFeature, at func(px, py float64) (float64, float64), cfg Config) {
+	width := cfg.MinWeb
+	if len(webs) == 0 {
+		fmt.Fprintf(cfg.Stdout, "Thin webs: none under %g mm\n", width)
+		return
+	}
+	cfg.Log.Printf("Warning: %d webs of plate between openings are under %g mm and may tear:", len(webs), width)
+	fmt.Fprintf(cfg.Stdout, "%5s %9s %9s %9s\n", "#", "X mm", "Y mm", "Width mm")
+	for i, w := range webs {
+		x, y := at(w.X, w.Y)
+		fmt.Fprintf(cfg.Stdout, "%5d %9.2f %9.2f %9.2f\n", i+1, x, y, w.Width)
+	}
+}
+
+// featureMask returns the pixels of features, for the preview to color.
+func featureMask(features []narrowFeature, width, height int) *render.Bitmap {
+	b := render.NewBitmap(width, height)
+	for _, f := range features {
+		for _, run := range f.runs {
+			for x := run.x0; x < run.x1; x++ {
+				b.SetBit(x, run.y)
+			}
+		}
+	}
+	return b
+}
@@ -0,0 +1,201 @@
+package stencil
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// Profile is a printer's fitted shrink compensation: openings drawn d mm
+// across come out Scale*d + Offset mm.
+type Profile struct {
+	Scale   float64
+	Offset  float64 // mm
+	Samples int     // Measured openings the fit is from
+	RMS     float64 // Root mean square error of the fit, mm
+	Fitted  string  // Date of the fit
+}
+
+// Drawn returns how wide to draw an opening to print size mm wide.
+func (p Profile) Drawn(size float64) float64 {
+	return (size - p.Offset) / p.Scale
+}
+
+func (p Profile) String() string {
+	return fmt.Sprintf("printed = %.4f x drawn %+.4f mm", p.Scale, p.Offset)
+}
+
+// profilesPath is the file the profiles are kept in, in the user's
+// configuration directory.
+func profilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "pcb-to-stencil", "profiles.json"), nil
+}
+
+// loadProfiles reads the saved profiles, by name; none if there's no file.
+func loadProfiles() (map[string]Profile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	profiles := map[string]Profile{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles: %v", err)
+	}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error reading profiles from %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+// FindProfile returns the saved profile name. With must unset, a missing
+// profile is nil rather than an error.
+func FindProfile(name string, must bool) (*Profile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for n, p := range profiles {
+		if strings.EqualFold(n, name) {
+			return &p, nil
+		}
+	}
+	if must {
+		return nil, fmt.Errorf("no profile %q; fit one from a test print with the calibrate subcommand", name)
+	}
+	return nil, nil
+}
+
+// SaveProfile stores p under name, replacing any profile of that name.
+func SaveProfile(name string, p Profile) (string, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return "", err
+	}
+	for n := range profiles {
+		if strings.EqualFold(n, name) {
+			delete(profiles, n)
+		}
+	}
+	profiles[name] = p
+	path, err := profilesPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("error creating configuration directory: %v", err)
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadMeasurements reads a CSV of test pattern measurements: the size and
+// shrink of each opening as labelled on the pattern, and its measured size
+// in mm. A header row is skipped, and so are openings that didn't open,
+// measured as 0 or left empty. It returns the drawn and measured sizes.
+func ReadMeasurements(r io.Reader) (drawn, measured []float64, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rec) < 3 {
+			return nil, nil, fmt.Errorf("line %d: want size, shrink and measured size", line)
+		}
+		size, err := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		if err != nil {
+			if line == 1 {
+				continue // Header
+			}
+			return nil, nil, fmt.Errorf("line %d: invalid size %q", line, rec[0])
+		}
+		s, _, err := ParseShrink(strings.TrimSpace(rec[1]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if strings.TrimSpace(rec[2]) == "" {
+			continue
+		}
+		m, err := strconv.ParseFloat(strings.TrimSpace(rec[2]), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid measured size %q", line, rec[2])
+		}
+		if m <= 0 {
+			continue
+		}
+		drawn = append(drawn, shrunk(size, s))
+		measured = append(measured, m)
+	}
+	return drawn, measured, nil
+}
+
+// FitProfile fits a straight line through the measured sizes of openings
+// against their drawn sizes, by least squares.
+func FitProfile(drawn, measured []float64) (Profile, error) {
+	n := float64(len(drawn))
+	var sx, sy, sxx, sxy float64
+	for i, x := range drawn {
+		y := measured[i]
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	den := n*sxx - sx*sx
+	if len(drawn) < 2 || den <= 1e-12*n*n {
+		return Profile{}, fmt.Errorf("need openings of at least two different drawn sizes to fit, got %d measurements", len(drawn))
+	}
+	p := Profile{Scale: (n*sxy - sx*sy) / den, Samples: len(drawn), Fitted: time.Now().Format("2006-01-02")}
+	p.Offset = (sy - p.Scale*sx) / n
+	if p.Scale <= 0 {
+		return Profile{}, fmt.Errorf("the measured sizes don't grow with the drawn ones (scale %.3f), check the measurements", p.Scale)
+	}
+	for i, x := range drawn {
+		e := p.Scale*x + p.Offset - measured[i]
+		p.RMS += e * e
+	}
+	p.RMS = math.Sqrt(p.RMS / n)
+	return p, nil
+}
+
+// ApplyProfile draws each opening of a rendered stencil at the size that
+// prints at the size it was rendered, by p: eroding the openings that print
+// large and dilating those that print small.
+func ApplyProfile(img image.Image, p Profile, pixelToMM float64) *render.Bitmap {
+	radii := func(sign float64) func(image.Rectangle, int) (float64, float64) {
+		return func(box image.Rectangle, _ int) (float64, float64) {
+			r := func(n int) float64 {
+				size := float64(n) * pixelToMM
+				return sign * (size - p.Drawn(size)) / 2 / pixelToMM
+			}
+			return r(box.Dx()), r(box.Dy())
+		}
+	}
+	b := morphOpenings(openingBitmap(img), radii(1), false)
+	return morphOpenings(b, radii(-1), true)
+}
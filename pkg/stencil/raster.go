@@ -0,0 +1,49 @@
+package stencil
+
+import "math"
+
+// Supersampling limits. Beyond MaxSupersample the render buffer grows faster
+// than the edges improve.
+const (
+	MaxSupersample = 4
+	// Pixels across the smallest aperture below which rendering is supersampled
+	minAperturePixels = 10.0
+)
+
+// Resolution range for automatic DPI selection
+const (
+	MinAutoDPI = 200.0
+	MaxAutoDPI = 3000.0
+)
+
+// autoDPI returns the resolution, rounded up to a multiple of 50, that puts
+// minPixels pixels across an aperture of smallestMM, within
+// [MinAutoDPI, MaxAutoDPI].
+func autoDPI(smallestMM, minPixels float64) float64 {
+	if smallestMM <= 0 {
+		return DefaultDPI
+	}
+	if minPixels <= 0 {
+		minPixels = DefaultMinPixels
+	}
+	dpi := math.Ceil(minPixels*25.4/smallestMM/50) * 50
+	return math.Max(MinAutoDPI, math.Min(MaxAutoDPI, dpi))
+}
+
+// autoSupersample picks a supersampling factor so that an aperture of
+// smallestMM spans at least minAperturePixels pixels, within
+// [1, MaxSupersample].
+func autoSupersample(smallestMM, dpi float64) int {
+	if smallestMM <= 0 {
+		return 1
+	}
+	px := smallestMM * dpi / 25.4
+	n := int(math.Ceil(minAperturePixels / px))
+	if n < 1 {
+		n = 1
+	}
+	if n > MaxSupersample {
+		n = MaxSupersample
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// Release limits from IPC-7525: below them, paste sticks to the aperture
+// walls rather than the pads
+const (
+	minAreaRatio   = 0.66 // Opening area over aperture wall area
+	minAspectRatio = 1.5  // Opening width over plate thickness
+)
+
+// apertureRatio is how well an opening of the stencil releases paste.
+type apertureRatio struct {
+	X, Y          float64 // Center, mm
+	Width, Height float64 // Bounding box, mm
+	Area          float64 // mm²
+	Perimeter     float64 // mm
+	AreaRatio     float64
+	AspectRatio   float64
+	runs          []openingRun
+}
+
+// poor reports whether the opening is below either release limit.
+func (r apertureRatio) poor() bool {
+	return r.AreaRatio < minAreaRatio || r.AspectRatio < minAspectRatio
+}
+
+// apertureRatios measures every opening of a rendered stencil at the given
+// plate thickness. The perimeter is that of the traced and straightened
+// outline, so round and diagonal edges aren't counted as pixel steps. at
+// turns image pixels into the coordinates the openings are reported in.
+func apertureRatios(img image.Image, thickness, pixelToMM float64, at func(px, py float64) (float64, float64)) []apertureRatio {
+	openings, boxes := findOpenings(openingBitmap(img))
+	ratios := make([]apertureRatio, len(openings))
+	for i, runs := range openings {
+		box := boxes[i].Inset(-1)
+		w, h := box.Dx(), box.Dy()
+		in := make([]bool, w*h)
+		area := 0
+		for _, r := range runs {
+			for x := r.x0; x < r.x1; x++ {
+				in[(r.y-box.Min.Y)*w+x-box.Min.X] = true
+			}
+			area += r.x1 - r.x0
+		}
+		perimeter := 0.0
+		for _, loop := range traceContours(w, h, func(x, y int) bool { return in[y*w+x] }, func(int) {}) {
+			loop = simplifyLoop(loop, contourTolerance)
+			for k := range loop {
+				a, b := loop[k], loop[(k+1)%len(loop)]
+				perimeter += math.Hypot(b.X-a.X, b.Y-a.Y)
+			}
+		}
+
+		r := apertureRatio{
+			Width:     float64(boxes[i].Dx()) * pixelToMM,
+			Height:    float64(boxes[i].Dy()) * pixelToMM,
+			Area:      float64(area) * pixelToMM * pixelToMM,
+			Perimeter: perimeter * pixelToMM,
+			runs:      runs,
+		}
+		r.X, r.Y = at(float64(boxes[i].Min.X+boxes[i].Max.X)/2, float64(boxes[i].Min.Y+boxes[i].Max.Y)/2)
+		if r.Perimeter > 0 {
+			r.AreaRatio = r.Area / (r.Perimeter * thickness)
+		}
+		r.AspectRatio = math.Min(r.Width, r.Height) / thickness
+		ratios[i] = r
+	}
+	return ratios
+}
+
+// printRatios lists the openings with their ratios to w, marking those below
+// the release limits, and returns how many are.
+func printRatios(ratios []apertureRatio, thickness float64, w io.Writer) int {
+	fmt.Fprintf(w, "Aperture ratios at %g mm thick (area ratio at least %g, aspect ratio at least %g):\n", thickness, minAreaRatio, minAspectRatio)
+	fmt.Fprintf(w, "%5s %9s %9s %15s %10s %6s %6s\n", "#", "X mm", "Y mm", "Size mm", "Area mm²", "Area", "Aspect")
+	poor := 0
+	for i, r := range ratios {
+		mark := ""
+		if r.AreaRatio < minAreaRatio {
+			mark += " area"
+		}
+		if r.AspectRatio < minAspectRatio {
+			mark += " aspect"
+		}
+		if mark != "" {
+			poor++
+			mark = "  won't release:" + mark
+		}
+		size := fmt.Sprintf("%.2f x %.2f", r.Width, r.Height)
+		fmt.Fprintf(w, "%5d %9.2f %9.2f %15s %10.3f %6.2f %6.2f%s\n", i+1, unsigned0(r.X), unsigned0(r.Y), size, r.Area, r.AreaRatio, r.AspectRatio, mark)
+	}
+	fmt.Fprintf(w, "Aperture ratios: %d of %d openings below the release limits\n", poor, len(ratios))
+	return poor
+}
+
+// unsigned0 returns v, or 0 if it prints as -0.00.
+func unsigned0(v float64) float64 {
+	if math.Abs(v) < 0.005 {
+		return 0
+	}
+	return v
+}
+
+// poorMask returns the pixels of the openings below the release limits, for
+// the preview to color.
+func poorMask(ratios []apertureRatio, width, height int) *render.Bitmap {
+	b := render.NewBitmap(width, height)
+	for _, r := range ratios {
+		if !r.poor() {
+			continue
+		}
+		for _, run := range r.runs {
+			for x := run.x0; x < run.x1; x++ {
+				b.SetBit(x, run.y)
+			}
+		}
+	}
+	return b
+}
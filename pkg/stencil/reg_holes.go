@@ -0,0 +1,153 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/render"
+)
+
+// RegHoles is a pattern of tooling holes through the frame around the
+// stencil, for the pins of a manual stencil printer.
+type RegHoles struct {
+	Diameter float64 // mm, 0 for none
+	Spacing  float64 // Between the holes of the rows along the top and bottom edges, mm; 0 for one hole in each corner
+	Offset   float64 // From the edges of the frame to the hole centers, mm
+	Slot     float64 // Length of the holes across the edges for slots, mm; 0 for round holes
+	Border   float64 // Least width of the frame around the openings, mm
+}
+
+// framePresets are the hole patterns -frame-preset knows, by name.
+var framePresets = map[string]RegHoles{
+	// 3.2 mm pins every 25 mm, as on the pin bars of manual screen printers
+	"pin-bar": {Diameter: 3.2, Spacing: 25, Offset: 6, Border: 15},
+	// 3 x 8 mm slots every 20 mm, for frames that tension the foil by pins
+	// pulling it outwards, so the slots give along the pull
+	"tension": {Diameter: 3, Spacing: 20, Offset: 8, Slot: 8, Border: 20},
+	// A 4 mm hole in each corner, for jig plates with corner pins
+	"jig-plate": {Diameter: 4, Offset: 6, Border: 12},
+}
+
+// FindFramePreset looks up a -frame-preset by name.
+func FindFramePreset(name string) (RegHoles, error) {
+	if h, ok := framePresets[strings.ToLower(name)]; ok {
+		return h, nil
+	}
+	names := slices.Sorted(maps.Keys(framePresets))
+	return RegHoles{}, fmt.Errorf("unknown frame preset %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// String describes the holes, as "3 mm" or "3 x 8 mm slots".
+func (h RegHoles) String() string {
+	if h.Slot > h.Diameter {
+		return fmt.Sprintf("%g x %g mm slots", h.Diameter, h.Slot)
+	}
+	return fmt.Sprintf("%g mm", h.Diameter)
+}
+
+// ParseRegHoles reads a -reg-holes value: diameter[,spacing[,offset]] in
+// mm. The offset defaults to the diameter.
+func ParseRegHoles(s string) (RegHoles, error) {
+	if s == "" {
+		return RegHoles{}, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return RegHoles{}, fmt.Errorf("invalid registration holes %q: want diameter[,spacing[,offset]]", s)
+	}
+	var v [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return RegHoles{}, fmt.Errorf("invalid registration holes %q: %v", s, err)
+		}
+		if f < 0 || (i == 0 && f == 0) {
+			return RegHoles{}, fmt.Errorf("invalid registration holes %q: sizes must be positive", s)
+		}
+		v[i] = f
+	}
+	h := RegHoles{Diameter: v[0], Spacing: v[1], Offset: v[2]}
+	if len(parts) < 3 {
+		h.Offset = h.Diameter
+	}
+	if h.Offset < h.Diameter/2 {
+		return RegHoles{}, fmt.Errorf("invalid registration holes %q: an offset under half the diameter cuts through the edge", s)
+	}
+	return h, nil
+}
+
+// frameMargin is how far the stencil's frame reaches past the paste and
+// outline layers, mm: room for the wall, or for the registration holes to
+// clear the openings, and a panel's rails.
+func frameMargin(cfg Config) float64 {
+	m := cfg.WallThickness + 5.0
+	if h := cfg.RegHoles; h.Diameter > 0 {
+		m = math.Max(m, h.Offset+math.Max(h.Diameter, h.Slot)/2+1)
+		m = math.Max(m, h.Border)
+	}
+	if cfg.Magnets.Diameter > 0 {
+		m = math.Max(m, cfg.Magnets.margin())
+	}
+	return m + cfg.Panel.Rails
+}
+
+// positions returns the hole centers in frame, in gerber mm: one in each
+// corner, or rows along the top and bottom edges h.Spacing apart, centered
+// and reaching as far as the corners.
+func (h RegHoles) positions(frame gerber.Bounds) []vec2 {
+	x0, x1 := frame.MinX+h.Offset, frame.MaxX-h.Offset
+	y0, y1 := frame.MinY+h.Offset, frame.MaxY-h.Offset
+	if h.Spacing == 0 {
+		return []vec2{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}}
+	}
+	n := int(math.Floor((x1-x0)/h.Spacing+1e-9)) + 1
+	start := (x0+x1)/2 - float64(n-1)*h.Spacing/2
+	var pts []vec2
+	for _, y := range []float64{y0, y1} {
+		for i := 0; i < n; i++ {
+			pts = append(pts, vec2{X: start + float64(i)*h.Spacing, Y: y})
+		}
+	}
+	return pts
+}
+
+// polygons returns the holes in frame as polygons, like gf.VectorPolygons.
+func (h RegHoles) polygons(frame gerber.Bounds) [][]vec2 {
+	var polys [][]vec2
+	d := h.slotReach()
+	for _, p := range h.positions(frame) {
+		polys = append(polys, gerber.ConvexHull(append(gerber.CirclePoly(p.X, p.Y-d, h.Diameter/2), gerber.CirclePoly(p.X, p.Y+d, h.Diameter/2)...)))
+	}
+	return polys
+}
+
+// punchRegHoles opens the holes in img, the paste layer rendered over frame
+// at dpi, and counts them to w.
+func punchRegHoles(img image.Image, frame gerber.Bounds, dpi float64, h RegHoles, w io.Writer) {
+	bm, ok := img.(*render.Bitmap)
+	if !ok {
+		return
+	}
+	scale := dpi / 25.4
+	r, d := h.Diameter/2*scale, h.slotReach()*scale
+	for _, p := range h.positions(frame) {
+		x, y := (p.X-frame.MinX)*scale, (frame.MaxY-p.Y)*scale
+		render.DrawCircle(bm, x, y-d, r)
+		render.DrawCircle(bm, x, y+d, r)
+		render.FillBox(bm, x-r, y-d, x+r, y+d)
+	}
+	fmt.Fprintf(w, "Registration holes: %d of %v\n", len(h.positions(frame)), h)
+}
+
+// slotReach is how far the centers of a slot's round ends are from its
+// middle, 0 for round holes.
+func (h RegHoles) slotReach() float64 {
+	return math.Max(h.Slot-h.Diameter, 0) / 2
+}
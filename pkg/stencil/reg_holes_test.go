@@ -0,0 +1,48 @@
+package stencil
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The frame holes and pockets go in is clipped away by an outline, so asking
+// for both fails rather than quietly leaving them out.
+func TestFrameWithOutline(t *testing.T) {
+	preset, err := FindFramePreset("pin-bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	holes, err := ParseRegHoles("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	magnets, err := ParseMagnetPockets("d=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		set  func(*Config)
+		want string
+	}{
+		{"reg-holes", func(c *Config) { c.RegHoles = holes }, "registration holes"},
+		{"frame-preset", func(c *Config) { c.RegHoles = preset }, "registration holes"},
+		{"magnet-pockets", func(c *Config) { c.Magnets = magnets }, "magnet pockets"},
+	} {
+		cfg := testConfig()
+		tc.set(&cfg)
+		in := Inputs{
+			Paste:   filepath.Join("..", "gerber", "testdata", "paste.gtp"),
+			Outline: filepath.Join("..", "gerber", "testdata", "outline.gko"),
+			Output:  filepath.Join(t.TempDir(), "paste.stl"),
+		}
+		if _, err := Convert(in, cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Convert with an outline = %v, want an error about the %s", tc.name, err, tc.want)
+		}
+		in.Outline = ""
+		if _, err := Convert(in, cfg); err != nil {
+			t.Errorf("%s: Convert without an outline: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,603 @@
+package stencil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strings"
+
+	"pcb-to-stencil/pkg/progress"
+)
+
+// ResinPrinter is the machine profile of an MSLA resin printer.
+type ResinPrinter struct {
+	Name           string  // Profile name for -printer
+	Model          string  // Printer make and model
+	Format         string  // Sliced file extension: photon, cbddlp, ctb, pwms, sl1 or sl1s
+	ResX, ResY     int     // Screen resolution, px
+	Pitch          float64 // Screen pixel size, mm
+	BuildHeight    float64 // mm
+	Exposure       float64 // Layer exposure, s
+	BottomExposure float64 // Exposure of the layers stuck to the build plate, s
+	BottomLayers   int
+}
+
+// resinPrinters are the printers -printer can slice for.
+var resinPrinters = []ResinPrinter{
+	{"photon", "Anycubic Photon", "photon", 1440, 2560, 0.04725, 155, 8, 60, 3},
+	{"photon-mono-se", "Anycubic Photon Mono SE", "pwms", 1620, 2560, 0.051, 160, 2, 40, 3},
+	{"mars", "Elegoo Mars", "cbddlp", 1440, 2560, 0.04725, 150, 8, 60, 3},
+	{"mars2pro", "Elegoo Mars 2 Pro", "ctb", 1620, 2560, 0.051, 160, 2.5, 40, 3},
+	{"saturn", "Elegoo Saturn", "ctb", 3840, 2400, 0.05, 200, 2.5, 40, 3},
+	{"sl1", "Prusa SL1", "sl1", 1440, 2560, 0.04725, 150, 8, 35, 3},
+	{"sl1s", "Prusa SL1S", "sl1s", 1620, 2560, 0.051, 150, 2, 25, 3},
+}
+
+// findResinPrinter looks up a printer profile by name.
+func findResinPrinter(name string) (ResinPrinter, error) {
+	var names []string
+	for _, p := range resinPrinters {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	return ResinPrinter{}, fmt.Errorf("unknown printer %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// Motion and material settings of the sliced files
+const (
+	resinLiftHeight   = 5.0   // mm
+	resinLiftSpeed    = 60.0  // mm/min
+	resinRetractSpeed = 150.0 // mm/min
+	resinLightOff     = 0.5   // s
+	resinDensity      = 1.1   // g/ml
+)
+
+// ResinJob holds the slicing settings of a resin print.
+type ResinJob struct {
+	LayerHeight    float64 // mm
+	Exposure       float64 // s
+	BottomExposure float64 // s
+	BottomLayers   int
+	Progress       progress.Func // Told how many layers are written; nil for no reports
+}
+
+// exposure returns the exposure time of layer k.
+func (j ResinJob) exposure(k int) float64 {
+	if k < j.BottomLayers {
+		return j.BottomExposure
+	}
+	return j.Exposure
+}
+
+// printTime estimates the seconds a print of n layers takes.
+func (j ResinJob) printTime(n int) float64 {
+	move := resinLiftHeight/resinLiftSpeed*60 + resinLiftHeight/resinRetractSpeed*60 + resinLightOff
+	t := float64(n) * move
+	for k := 0; k < n; k++ {
+		t += j.exposure(k)
+	}
+	return t
+}
+
+// resinSlices are the layers of a stencil on a printer's screen: each screen
+// pixel has a column of solid, lit from layer first[c] up to before end[c].
+type resinSlices struct {
+	width, height int
+	column        []uint8 // Column at each screen pixel, 0 for none
+	first, end    []int   // Layers of each column, by column-1
+	layers        int
+	lit           int // Lit pixels over all layers
+}
+
+// sliceStencil puts the stencil's solid onto the printer's screen, centered
+// and turned a quarter when that's the only way it fits, and cuts it into
+// layers. Heights round to whole layers.
+func sliceStencil(stencilImg, outlineImg image.Image, cfg Config, p ResinPrinter, layerHeight float64) (*resinSlices, error) {
+	l := heightLevels(stencilImg, outlineImg, cfg)
+	column, columns, heights := l.Column, l.Columns, l.Heights
+	// The lowest solid goes on the build plate
+	bottom := math.Inf(1)
+	for _, c := range columns {
+		bottom = math.Min(bottom, heights[c[0]])
+	}
+	for _, h := range heights {
+		h -= bottom
+		if n := math.Round(h / layerHeight); h > 0 && math.Abs(n*layerHeight-h) > 1e-6 {
+			cfg.Log.Printf("Warning: %.4g mm is printed as %.4g mm with %g mm layers", h, n*layerHeight, layerHeight)
+		}
+	}
+	s := &resinSlices{width: p.ResX, height: p.ResY}
+	for _, c := range columns {
+		s.first = append(s.first, int(math.Round((heights[c[0]]-bottom)/layerHeight)))
+		s.end = append(s.end, int(math.Round((heights[c[1]]-bottom)/layerHeight)))
+		s.layers = max(s.layers, s.end[len(s.end)-1])
+	}
+
+	// The solid's extent in image pixels
+	width := stencilImg.Bounds().Dx()
+	x0, y0, x1, y1 := width, len(column)/max(width, 1), 0, 0
+	for i, c := range column {
+		if c != 0 {
+			x, y := i%width, i/width
+			x0, y0 = min(x0, x), min(y0, y)
+			x1, y1 = max(x1, x+1), max(y1, y+1)
+		}
+	}
+	if x1 <= x0 {
+		return nil, fmt.Errorf("stencil has no solid to print")
+	}
+	pixelToMM := 25.4 / cfg.DPI
+	w, h := float64(x1-x0)*pixelToMM, float64(y1-y0)*pixelToMM
+	screenW, screenH := float64(p.ResX)*p.Pitch, float64(p.ResY)*p.Pitch
+	turn := false
+	if w > screenW || h > screenH {
+		if h > screenW || w > screenH {
+			return nil, fmt.Errorf("stencil is %.1f x %.1f mm, the %s's screen is %.1f x %.1f mm", w, h, p.Model, screenW, screenH)
+		}
+		fmt.Fprintln(cfg.Stdout, "Turning the stencil a quarter to fit the screen")
+		turn = true
+	}
+
+	// Each screen pixel takes the image pixel under its center
+	cx, cy := float64(x0+x1)/2, float64(y0+y1)/2
+	s.column = make([]uint8, p.ResX*p.ResY)
+	for v := 0; v < p.ResY; v++ {
+		dy := (float64(v) + 0.5 - float64(p.ResY)/2) * p.Pitch / pixelToMM
+		for u := 0; u < p.ResX; u++ {
+			dx := (float64(u) + 0.5 - float64(p.ResX)/2) * p.Pitch / pixelToMM
+			fx, fy := cx+dx, cy+dy
+			if turn {
+				fx, fy = cx+dy, cy-dx
+			}
+			x, y := int(math.Floor(fx)), int(math.Floor(fy))
+			if x < x0 || y < y0 || x >= x1 || y >= y1 {
+				continue
+			}
+			if c := column[y*width+x]; c != 0 {
+				s.column[v*p.ResX+u] = c
+				s.lit += s.end[c-1] - s.first[c-1]
+			}
+		}
+	}
+	return s, nil
+}
+
+// runs calls emit for each run of lit or dark pixels of layer k, row by row.
+func (s *resinSlices) runs(k int, emit func(lit bool, n int)) {
+	on := false
+	n := 0
+	for _, c := range s.column {
+		lit := c != 0 && s.first[c-1] <= k && k < s.end[c-1]
+		if lit != on && n > 0 {
+			emit(on, n)
+			n = 0
+		}
+		on = lit
+		n++
+	}
+	emit(on, n)
+}
+
+// preview returns a w x h gray thumbnail of the screen, brighter where the
+// solid is higher.
+func (s *resinSlices) preview(w, h int) []uint8 {
+	gray := make([]uint8, w*h)
+	scale := math.Max(float64(s.width)/float64(w), float64(s.height)/float64(h))
+	for y := 0; y < h; y++ {
+		v := int((float64(y)+0.5-float64(h)/2)*scale + float64(s.height)/2)
+		for x := 0; x < w; x++ {
+			u := int((float64(x)+0.5-float64(w)/2)*scale + float64(s.width)/2)
+			if u < 0 || v < 0 || u >= s.width || v >= s.height {
+				continue
+			}
+			if c := s.column[v*s.width+u]; c != 0 {
+				gray[y*w+x] = uint8(64 + 191*s.end[c-1]/s.layers)
+			}
+		}
+	}
+	return gray
+}
+
+// resinJob returns the slicing settings of cfg for p, its own exposures
+// where cfg leaves them 0.
+func resinJob(p ResinPrinter, cfg Config) ResinJob {
+	job := ResinJob{LayerHeight: cfg.LayerHeight, Exposure: cfg.Exposure, BottomExposure: cfg.BottomExposure, BottomLayers: p.BottomLayers, Progress: cfg.Progress}
+	if job.Exposure <= 0 {
+		job.Exposure = p.Exposure
+	}
+	if job.BottomExposure <= 0 {
+		job.BottomExposure = p.BottomExposure
+	}
+	return job
+}
+
+// exportSlices slices the stencil for cfg's printer and writes the sliced
+// file to path.
+func exportSlices(stencilImg, outlineImg image.Image, path string, p ResinPrinter, cfg Config) error {
+	job := resinJob(p, cfg)
+	if job.LayerHeight <= 0 {
+		return fmt.Errorf("layer height must be positive, got %g", job.LayerHeight)
+	}
+	fmt.Fprintf(cfg.Stdout, "Slicing for the %s at %g mm layers...\n", p.Model, job.LayerHeight)
+	s, err := sliceStencil(stencilImg, outlineImg, cfg, p, job.LayerHeight)
+	if err != nil {
+		return err
+	}
+	if height := float64(s.layers) * job.LayerHeight; height > p.BuildHeight {
+		return fmt.Errorf("stencil is %g mm high, the %s builds %g mm", height, p.Model, p.BuildHeight)
+	}
+	job.BottomLayers = min(job.BottomLayers, s.layers)
+	fmt.Fprintf(cfg.Stdout, "Saving %d layers to %s...\n", s.layers, path)
+	switch p.Format {
+	case "pwms":
+		err = writePhotonWorkshop(path, s, p, job)
+	case "sl1", "sl1s":
+		err = writeSL1(path, s, p, job)
+	default:
+		err = writeChitu(path, s, p, job)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing sliced file: %v", err)
+	}
+	return nil
+}
+
+// ChiTu layouts, shared by .photon, .cbddlp and version 2 .ctb files
+type chituHeader struct {
+	Magic, Version       uint32
+	BedX, BedY, BedZ     float32
+	_                    [2]uint32
+	Height, LayerHeight  float32
+	Exposure, BottomExp  float32
+	LightOff             float32
+	BottomLayers         uint32
+	ResX, ResY           uint32
+	LargePreview         uint32
+	LayerDefs, Layers    uint32
+	SmallPreview         uint32
+	PrintTime            uint32
+	ProjectorType        uint32
+	Params, ParamsSize   uint32
+	AntiAlias            uint32
+	LightPWM, BottomPWM  uint16
+	EncryptionKey        uint32
+	SlicerInfo, InfoSize uint32
+}
+
+type chituPreview struct {
+	ResX, ResY   uint32
+	Data, Length uint32
+	_            [4]uint32
+}
+
+type chituParams struct {
+	BottomLiftHeight, BottomLiftSpeed float32
+	LiftHeight, LiftSpeed             float32
+	RetractSpeed                      float32
+	Volume, Weight, Cost              float32
+	BottomLightOff, LightOff          float32
+	BottomLayers                      uint32
+	_                                 [4]uint32
+}
+
+type chituLayer struct {
+	Z, Exposure, LightOff float32
+	Data, Length          uint32
+	_                     [4]uint32
+}
+
+// Magic numbers of the ChiTu formats
+const (
+	chituMagic = 0x12fd0019 // .photon and .cbddlp
+	ctbMagic   = 0x12fd0086
+)
+
+// chituPreviewImage encodes a thumbnail as ChiTu's run length encoded 15 bit
+// color: a word per run, with a bit marking a second word holding its length.
+func chituPreviewImage(gray []uint8) []byte {
+	var buf []byte
+	word := func(w uint16) { buf = binary.LittleEndian.AppendUint16(buf, w) }
+	for i := 0; i < len(gray); {
+		n := 1
+		for i+n < len(gray) && gray[i+n] == gray[i] && n < 0x1000 {
+			n++
+		}
+		c := uint16(gray[i] >> 3)
+		color := c<<11 | c<<6 | c
+		if n == 1 {
+			word(color)
+		} else {
+			word(color | 0x20)
+			word(uint16(n-1) | 0x3000)
+		}
+		i += n
+	}
+	return buf
+}
+
+// chituLayerImage encodes layer k for .photon and .cbddlp: a byte per run of
+// up to 125 pixels, the top bit set for lit ones.
+func chituLayerImage(s *resinSlices, k int) []byte {
+	var buf []byte
+	s.runs(k, func(lit bool, n int) {
+		var bit byte
+		if lit {
+			bit = 0x80
+		}
+		for ; n > 0; n -= min(n, 125) {
+			buf = append(buf, bit|byte(min(n, 125)))
+		}
+	})
+	return buf
+}
+
+// ctbLayerImage encodes layer k for .ctb: a 7 bit gray level per run, with
+// the top bit set when a variable length pixel count follows.
+func ctbLayerImage(s *resinSlices, k int) []byte {
+	var buf []byte
+	s.runs(k, func(lit bool, n int) {
+		var gray byte
+		if lit {
+			gray = 0x7f
+		}
+		for n > 0 {
+			m := min(n, 0x0fffffff)
+			n -= m
+			if m == 1 {
+				buf = append(buf, gray)
+				continue
+			}
+			buf = append(buf, gray|0x80)
+			switch {
+			case m < 0x80:
+				buf = append(buf, byte(m))
+			case m < 0x4000:
+				buf = append(buf, byte(m>>8)|0x80, byte(m))
+			case m < 0x200000:
+				buf = append(buf, byte(m>>16)|0xc0, byte(m>>8), byte(m))
+			default:
+				buf = append(buf, byte(m>>24)|0xe0, byte(m>>16), byte(m>>8), byte(m))
+			}
+		}
+	})
+	return buf
+}
+
+// writeChitu writes a ChiTu sliced file: a header, large and small previews,
+// the print parameters, a table of layers and their run length encoded
+// images. .ctb files are written unencrypted.
+func writeChitu(filename string, s *resinSlices, p ResinPrinter, job ResinJob) error {
+	ctb := p.Format == "ctb"
+	encode := chituLayerImage
+	magic := uint32(chituMagic)
+	if ctb {
+		encode, magic = ctbLayerImage, ctbMagic
+	}
+
+	large := chituPreviewImage(s.preview(400, 300))
+	small := chituPreviewImage(s.preview(200, 125))
+	headerSize := uint32(binary.Size(chituHeader{}))
+	previewSize := uint32(binary.Size(chituPreview{}))
+	largeAt := headerSize
+	smallAt := largeAt + previewSize + uint32(len(large))
+	paramsAt := smallAt + previewSize + uint32(len(small))
+	layersAt := paramsAt + uint32(binary.Size(chituParams{}))
+	dataAt := layersAt + uint32(s.layers*binary.Size(chituLayer{}))
+
+	volume := float64(s.lit) * p.Pitch * p.Pitch * job.LayerHeight / 1000
+	header := chituHeader{
+		Magic: magic, Version: 2,
+		BedX: float32(float64(p.ResX) * p.Pitch), BedY: float32(float64(p.ResY) * p.Pitch), BedZ: float32(p.BuildHeight),
+		Height: float32(float64(s.layers) * job.LayerHeight), LayerHeight: float32(job.LayerHeight),
+		Exposure: float32(job.Exposure), BottomExp: float32(job.BottomExposure), LightOff: resinLightOff,
+		BottomLayers: uint32(job.BottomLayers),
+		ResX:         uint32(p.ResX), ResY: uint32(p.ResY),
+		LargePreview: largeAt, LayerDefs: layersAt, Layers: uint32(s.layers), SmallPreview: smallAt,
+		PrintTime:     uint32(job.printTime(s.layers)),
+		ProjectorType: 1, // LCD
+		Params:        paramsAt, ParamsSize: uint32(binary.Size(chituParams{})),
+		AntiAlias: 1,
+		LightPWM:  255, BottomPWM: 255,
+	}
+	params := chituParams{
+		BottomLiftHeight: resinLiftHeight, BottomLiftSpeed: resinLiftSpeed,
+		LiftHeight: resinLiftHeight, LiftSpeed: resinLiftSpeed,
+		RetractSpeed: resinRetractSpeed,
+		Volume:       float32(volume), Weight: float32(volume * resinDensity),
+		BottomLightOff: resinLightOff, LightOff: resinLightOff,
+		BottomLayers: uint32(job.BottomLayers),
+	}
+
+	images := make([][]byte, s.layers)
+	table := make([]chituLayer, s.layers)
+	for k := range images {
+		job.Progress.Report("Slicing", k, s.layers)
+		images[k] = encode(s, k)
+		table[k] = chituLayer{
+			Z:        float32(float64(k+1) * job.LayerHeight),
+			Exposure: float32(job.exposure(k)), LightOff: resinLightOff,
+			Data: dataAt, Length: uint32(len(images[k])),
+		}
+		dataAt += uint32(len(images[k]))
+	}
+	job.Progress.Report("Slicing", 1, 1)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, v := range []any{
+		header,
+		chituPreview{ResX: 400, ResY: 300, Data: largeAt + previewSize, Length: uint32(len(large))}, large,
+		chituPreview{ResX: 200, ResY: 125, Data: smallAt + previewSize, Length: uint32(len(small))}, small,
+		params, table,
+	} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	for _, b := range images {
+		w.Write(b)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Photon Workshop layouts, for .pwms. Each section after the file mark
+// starts with its name and length.
+type pwsFileMark struct {
+	Mark        [12]byte
+	Version     uint32
+	Areas       uint32
+	Header      uint32
+	_           uint32
+	Preview     uint32
+	_           uint32
+	LayerDefs   uint32
+	_           uint32
+	LayerImages uint32
+}
+
+type pwsSection struct {
+	Name   [12]byte
+	Length uint32
+}
+
+type pwsHeader struct {
+	PixelSize, LayerHeight        float32 // µm, mm
+	Exposure, LightOff            float32
+	BottomExposure, BottomLayers  float32
+	LiftHeight, LiftSpeed         float32 // mm, mm/s
+	RetractSpeed, Volume          float32
+	AntiAlias, ResX, ResY         uint32
+	Weight, Price                 float32
+	Currency, PerLayer, PrintTime uint32
+	TransitionLayers              uint32
+	_                             uint32
+}
+
+type pwsPreview struct {
+	ResX, Mark, ResY uint32
+}
+
+type pwsLayer struct {
+	Data, Length          uint32
+	LiftHeight, LiftSpeed float32
+	Exposure, Z           float32
+	Lit                   uint32
+	_                     uint32
+}
+
+// pwsName pads a section name to 12 bytes.
+func pwsName(name string) (b [12]byte) {
+	copy(b[:], name)
+	return b
+}
+
+// pwsLayerImage encodes layer k for .pwms: a 4 bit gray level per run, with
+// a 12 bit pixel count for black and white runs.
+func pwsLayerImage(s *resinSlices, k int) []byte {
+	var buf []byte
+	s.runs(k, func(lit bool, n int) {
+		var code byte
+		if lit {
+			code = 0xf0
+		}
+		for ; n > 0; n -= min(n, 0xfff) {
+			m := min(n, 0xfff)
+			buf = append(buf, code|byte(m>>8), byte(m))
+		}
+	})
+	return buf
+}
+
+// writePhotonWorkshop writes an Anycubic Photon Workshop sliced file: the
+// file mark pointing at the header, preview, layer table and layer image
+// sections.
+func writePhotonWorkshop(filename string, s *resinSlices, p ResinPrinter, job ResinJob) error {
+	const previewW, previewH = 224, 168
+	var preview []byte
+	for _, g := range s.preview(previewW, previewH) {
+		c := uint16(g)
+		preview = binary.LittleEndian.AppendUint16(preview, c>>3<<11|c>>2<<5|c>>3)
+	}
+
+	sectionSize := uint32(binary.Size(pwsSection{}))
+	headerSize := uint32(binary.Size(pwsHeader{}))
+	previewSize := uint32(binary.Size(pwsPreview{})) + uint32(len(preview))
+	layersSize := 4 + uint32(s.layers*binary.Size(pwsLayer{}))
+	headerAt := uint32(binary.Size(pwsFileMark{}))
+	previewAt := headerAt + sectionSize + headerSize
+	layersAt := previewAt + sectionSize + previewSize
+	dataAt := layersAt + sectionSize + layersSize
+
+	volume := float64(s.lit) * p.Pitch * p.Pitch * job.LayerHeight / 1000
+	mark := pwsFileMark{
+		Mark: pwsName("ANYCUBIC"), Version: 1, Areas: 4,
+		Header: headerAt, Preview: previewAt, LayerDefs: layersAt, LayerImages: dataAt,
+	}
+	header := pwsHeader{
+		PixelSize: float32(p.Pitch * 1000), LayerHeight: float32(job.LayerHeight),
+		Exposure: float32(job.Exposure), LightOff: resinLightOff,
+		BottomExposure: float32(job.BottomExposure), BottomLayers: float32(job.BottomLayers),
+		LiftHeight: resinLiftHeight, LiftSpeed: resinLiftSpeed / 60,
+		RetractSpeed: resinRetractSpeed / 60, Volume: float32(volume),
+		AntiAlias: 1, ResX: uint32(p.ResX), ResY: uint32(p.ResY),
+		Weight:   float32(volume * resinDensity),
+		Currency: '$', PrintTime: uint32(job.printTime(s.layers)),
+	}
+
+	images := make([][]byte, s.layers)
+	table := make([]pwsLayer, s.layers)
+	for k := range images {
+		job.Progress.Report("Slicing", k, s.layers)
+		images[k] = pwsLayerImage(s, k)
+		lit := 0
+		s.runs(k, func(on bool, n int) {
+			if on {
+				lit += n
+			}
+		})
+		table[k] = pwsLayer{
+			Data: dataAt, Length: uint32(len(images[k])),
+			LiftHeight: resinLiftHeight, LiftSpeed: resinLiftSpeed / 60,
+			Exposure: float32(job.exposure(k)), Z: float32(float64(k+1) * job.LayerHeight),
+			Lit: uint32(lit),
+		}
+		dataAt += uint32(len(images[k]))
+	}
+	job.Progress.Report("Slicing", 1, 1)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, v := range []any{
+		mark,
+		pwsSection{pwsName("HEADER"), headerSize}, header,
+		pwsSection{pwsName("PREVIEW"), previewSize}, pwsPreview{previewW, 'x', previewH}, preview,
+		pwsSection{pwsName("LAYERDEF"), layersSize}, uint32(s.layers), table,
+	} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	for _, b := range images {
+		w.Write(b)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,26 @@
+package stencil
+
+// Result is what a conversion made, as -json prints it.
+type Result struct {
+	Input     string     `json:"input"`
+	Output    string     `json:"output"`  // The mesh, or the dispensing G-code; - for stdout
+	Outputs   []string   `json:"outputs"` // Every file written, in order
+	Min       [3]float64 `json:"bbox_min_mm"`
+	Max       [3]float64 `json:"bbox_max_mm"`
+	Apertures int        `json:"apertures,omitempty"` // Of the paste layer, for gerber input
+	Triangles int        `json:"triangles"`
+	Warnings  []string   `json:"warnings"`
+	Error     string     `json:"error,omitempty"`
+
+	Durations struct {
+		Render float64 `json:"render_s"` // Parsing and rendering the layers, and vector meshing
+		Mesh   float64 `json:"mesh_s"`
+		Write  float64 `json:"write_s"` // The mesh and everything written after it
+		Total  float64 `json:"total_s"`
+	} `json:"durations"`
+}
+
+// wrote adds written files to the outputs.
+func (r *Result) wrote(paths ...string) {
+	r.Outputs = append(r.Outputs, paths...)
+}
@@ -0,0 +1,131 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// writeSCADPolygon writes one polygon() of the loops. OpenSCAD takes loops
+// inside others as holes, whichever way they run.
+func writeSCADPolygon(w io.Writer, loops [][]vec2) {
+	if len(loops) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  polygon(points = [")
+	n := 0
+	for _, l := range loops {
+		for _, p := range l {
+			if n > 0 {
+				fmt.Fprintf(w, ",")
+			}
+			if n%6 == 0 {
+				fmt.Fprintf(w, "\n    ")
+			} else {
+				fmt.Fprintf(w, " ")
+			}
+			fmt.Fprintf(w, "[%.4f, %.4f]", p.X, p.Y)
+			n++
+		}
+	}
+	fmt.Fprintf(w, "],\n  paths = [")
+	n = 0
+	for i, l := range loops {
+		if i > 0 {
+			fmt.Fprintf(w, ",")
+		}
+		fmt.Fprintf(w, "\n    [")
+		for j := range l {
+			if j > 0 {
+				fmt.Fprintf(w, ", ")
+			}
+			fmt.Fprintf(w, "%d", n)
+			n++
+		}
+		fmt.Fprintf(w, "]")
+	}
+	fmt.Fprintf(w, "]);\n")
+}
+
+// WriteStencilSCAD writes the stencil as an OpenSCAD model: the openings
+// and the board outline as polygons, extruded into the plate and the walls
+// around the board, with their sizes as variables to change or build frames
+// and fixtures on. Coordinates are the gerber's in mm, as seen from the top,
+// and z = 0 is the squeegee side like in the STL. Without an outline the
+// plate covers the same frame as the STL's.
+func WriteStencilSCAD(filename string, paste, outline *gerber.File, frame gerber.Bounds, cfg Config) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	var board [][]vec2
+	if outline == nil {
+		margin := frameMargin(cfg) // As for the mesh
+		frame.MinX -= margin
+		frame.MinY -= margin
+		frame.MaxX += margin
+		frame.MaxY += margin
+	}
+	paths, closed := cutOutline(outline, frame, 0)
+	for i, p := range paths {
+		if closed[i] {
+			board = append(board, p)
+		}
+	}
+	if len(board) == 0 {
+		return fmt.Errorf("board outline has no closed paths")
+	}
+	openings := cutApertures(paste, 0, cfg.Log)
+
+	fmt.Fprintf(w, "// Solder paste stencil, generated by pcb-to-stencil %s\n", toolVersion())
+	fmt.Fprintf(w, "// Units are mm, seen from the top of the board; z = 0 is the squeegee side.\n\n")
+	fmt.Fprintf(w, "thickness = %g;\n", cfg.StencilHeight)
+	if outline != nil {
+		fmt.Fprintf(w, "wall_height = %g;\nwall_thickness = %g;\nclearance = %g;\n", cfg.WallHeight, cfg.WallThickness, cfg.Clearance)
+		if cfg.Locators > 0 {
+			fmt.Fprintf(w, "locator = %g; // Arm length of the corner locators\n", cfg.Locators)
+		}
+	}
+	fmt.Fprintf(w, "\nmodule openings() {\n")
+	writeSCADPolygon(w, openings)
+	fmt.Fprintf(w, "}\n\nmodule board() {\n")
+	writeSCADPolygon(w, board)
+	fmt.Fprintf(w, "}\n\n")
+	plate := "board()"
+	if outline != nil {
+		plate = "offset(delta = clearance) board()"
+	}
+	fmt.Fprintf(w, "module plate() {\n  difference() {\n    linear_extrude(height = thickness) %s;\n", plate)
+	fmt.Fprintf(w, "    translate([0, 0, -1]) linear_extrude(height = thickness + 2) openings();\n  }\n}\n\n")
+	if outline != nil {
+		fmt.Fprintf(w, "module walls() {\n  linear_extrude(height = wall_height) ")
+		indent := "  "
+		if cfg.Locators > 0 {
+			// Only the corners of the wall, as far as the locators reach
+			b := gerber.PolyBounds(board[0])
+			for _, l := range board[1:] {
+				b = b.Union(gerber.PolyBounds(l))
+			}
+			fmt.Fprintf(w, "intersection() {\n    union() {\n")
+			fmt.Fprintf(w, "      translate([%.4f - clearance - wall_thickness, %.4f - clearance - wall_thickness]) square(wall_thickness + locator);\n", b.MinX, b.MinY)
+			fmt.Fprintf(w, "      translate([%.4f + clearance - locator, %.4f + clearance - locator]) square(wall_thickness + locator);\n    }\n    ", b.MaxX, b.MaxY)
+			indent = "    "
+		}
+		fmt.Fprintf(w, "difference() {\n%[1]s  offset(delta = clearance + wall_thickness) board();\n%[1]s  offset(delta = clearance) board();\n%[1]s}\n", indent)
+		if cfg.Locators > 0 {
+			fmt.Fprintf(w, "  }\n")
+		}
+		fmt.Fprintf(w, "}\n\n")
+		fmt.Fprintf(w, "plate();\nwalls();\n")
+	} else {
+		fmt.Fprintf(w, "plate();\n")
+	}
+	fmt.Fprintf(cfg.Stdout, "OpenSCAD: %d aperture contours\n", len(openings))
+	return w.Flush()
+}
@@ -0,0 +1,100 @@
+package stencil
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// layerImage returns layer k as a grayscale image, white where it is lit.
+func (s *resinSlices) layerImage(k int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, s.width, s.height))
+	i := 0
+	s.runs(k, func(lit bool, n int) {
+		if lit {
+			for j := i; j < i+n; j++ {
+				img.Pix[j] = 255
+			}
+		}
+		i += n
+	})
+	return img
+}
+
+// writeSL1 writes a PrusaSlicer SL1 or SL1S archive: a PNG per layer named
+// after the job, a thumbnail and the config.ini the printer reads its
+// exposure and layer settings from.
+func writeSL1(filename string, s *resinSlices, p ResinPrinter, job ResinJob) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pkg := zip.NewWriter(f)
+	create := func(name string) (io.Writer, error) {
+		return pkg.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	}
+
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	volume := float64(s.lit) * p.Pitch * p.Pitch * job.LayerHeight / 1000
+	w, err := create("config.ini")
+	if err != nil {
+		return err
+	}
+	for _, kv := range [][2]string{
+		{"action", "print"},
+		{"jobDir", name},
+		{"expTime", fmt.Sprint(job.Exposure)},
+		{"expTimeFirst", fmt.Sprint(job.BottomExposure)},
+		{"fileCreationTimestamp", time.Now().UTC().Format("2006-01-02 at 15:04:05 UTC")},
+		{"layerHeight", fmt.Sprint(job.LayerHeight)},
+		{"materialName", "Generic"},
+		{"numFade", fmt.Sprint(job.BottomLayers)},
+		{"numFast", fmt.Sprint(s.layers)},
+		{"numSlow", "0"},
+		{"printProfile", fmt.Sprintf("%g Stencil", job.LayerHeight)},
+		{"printTime", fmt.Sprintf("%.0f", job.printTime(s.layers))},
+		{"printerModel", strings.ToUpper(p.Format)},
+		{"printerProfile", "Original " + p.Model},
+		{"printerVariant", "default"},
+		{"prusaSlicerVersion", "pcb-to-stencil " + toolVersion()},
+		{"usedMaterial", fmt.Sprintf("%.3f", volume)},
+	} {
+		fmt.Fprintf(w, "%s = %s\n", kv[0], kv[1])
+	}
+
+	const thumb = 400
+	gray := s.preview(thumb, thumb)
+	preview := image.NewGray(image.Rect(0, 0, thumb, thumb))
+	copy(preview.Pix, gray)
+	if w, err = create(fmt.Sprintf("thumbnail/thumbnail%dx%d.png", thumb, thumb)); err != nil {
+		return err
+	}
+	if err := png.Encode(w, preview); err != nil {
+		return err
+	}
+
+	// Mostly black layers compress well even at the fastest setting
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	for k := 0; k < s.layers; k++ {
+		job.Progress.Report("Slicing", k, s.layers)
+		w, err := create(fmt.Sprintf("%s%05d.png", name, k))
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(w, s.layerImage(k)); err != nil {
+			return err
+		}
+	}
+	job.Progress.Report("Slicing", 1, 1)
+	if err := pkg.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
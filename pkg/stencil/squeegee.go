@@ -0,0 +1,93 @@
+package stencil
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// Squeegee dimensions, mm
+const (
+	squeegeeOverhang = 10.0 // Blade past each side of the aperture field
+	squeegeeBlade    = 15.0 // Blade from the handle to the edge
+	squeegeeBladeT   = 2.0  // Blade thickness, thin enough to flex a little
+	squeegeeHandleT  = 8.0  // Handle thickness
+)
+
+// Squeegee sizes the squeegee -squeegee writes.
+type Squeegee struct {
+	Length float64 // Blade length, mm; 0 to cover the aperture field
+	Handle float64 // Handle width from its back to the blade, mm
+	Angle  float64 // Angle of the bevel at the edge to the blade's flat side, degrees
+}
+
+// apertureField returns the extent of the openings of the paste layer gf in
+// mm, or with a nil gf, for other inputs, of those of the rendered img.
+func apertureField(gf *gerber.File, img image.Image, cfg Config) (gerber.Bounds, error) {
+	if gf == nil {
+		box, ok := openBounds(img)
+		if !ok {
+			return gerber.Bounds{}, fmt.Errorf("the stencil has no openings to size the squeegee by")
+		}
+		pixelToMM := 25.4 / cfg.DPI
+		return gerber.Bounds{MaxX: float64(box.Dx()) * pixelToMM, MaxY: float64(box.Dy()) * pixelToMM}, nil
+	}
+	const padding = 2.0 // CalculateBounds' own
+	b := gf.CalculateBounds()
+	return gerber.Bounds{MinX: b.MinX + padding, MinY: b.MinY + padding, MaxX: b.MaxX - padding, MaxY: b.MaxY - padding}, nil
+}
+
+// GenerateSqueegee builds a squeegee with a blade length mm long: a handle
+// with the blade along one side, beveled to an edge at s.Angle. It lies on
+// its flat side, the blade along X, with its corner at the origin.
+func GenerateSqueegee(s Squeegee, length float64) [][3]Point {
+	bevel := squeegeeBladeT / math.Tan(s.Angle*math.Pi/180)
+	end := s.Handle + squeegeeBlade
+	// Cross section across the blade, Y out to the edge and Z up
+	profile := []vec2{
+		{X: 0, Y: 0}, {X: end, Y: 0}, {X: end - bevel, Y: squeegeeBladeT},
+		{X: s.Handle, Y: squeegeeBladeT}, {X: s.Handle, Y: squeegeeHandleT}, {X: 0, Y: squeegeeHandleT},
+	}
+
+	var triangles [][3]Point
+	at := func(x float64, p vec2) Point { return Point{X: x, Y: p.X, Z: p.Y} }
+	for i, a := range profile {
+		b := profile[(i+1)%len(profile)]
+		triangles = append(triangles,
+			[3]Point{at(0, a), at(length, a), at(length, b)},
+			[3]Point{at(0, a), at(length, b), at(0, b)})
+	}
+	for _, t := range earcut(profile, nil) {
+		triangles = append(triangles,
+			[3]Point{at(0, t[0]), at(0, t[1]), at(0, t[2])},
+			[3]Point{at(length, t[0]), at(length, t[2]), at(length, t[1])})
+	}
+	if stl.SignedVolume(triangles) < 0 {
+		for i, t := range triangles {
+			triangles[i] = [3]Point{t[0], t[2], t[1]}
+		}
+	}
+	return triangles
+}
+
+// writeSqueegee writes a squeegee whose blade covers field as an STL, or
+// one s.Length long.
+func writeSqueegee(path, source string, field gerber.Bounds, s Squeegee, cfg Config) error {
+	length := s.Length
+	if length == 0 {
+		// Across the field's narrow side, to stroke along its long one
+		length = math.Min(field.MaxX-field.MinX, field.MaxY-field.MinY) + 2*squeegeeOverhang
+	}
+	triangles := GenerateSqueegee(s, length)
+	fmt.Fprintf(cfg.Stdout, "Squeegee: %.1f mm blade, %g mm handle, %g° edge\n", length, s.Handle, s.Angle)
+	fmt.Fprintf(cfg.Stdout, "Saving squeegee to %s (%d triangles)...\n", path, len(triangles))
+	info := newMeshInfo(source, cfg, 0)
+	info.Name += " squeegee"
+	if err := stl.WriteFile(path, fileMesh(triangles, cfg), info, cfg.Progress); err != nil {
+		return fmt.Errorf("error writing squeegee: %v", err)
+	}
+	return nil
+}
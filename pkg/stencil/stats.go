@@ -0,0 +1,181 @@
+package stencil
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"math"
+	"os"
+
+	"pcb-to-stencil/pkg/render"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// Filament assumed for the material estimate
+const (
+	filamentDiameter = 1.75 // mm
+	filamentDensity  = 1.24 // g/cm³, PLA
+)
+
+// Assumed for the print time estimate
+const (
+	estimatePrinter = "mars2pro" // Resin printer without -printer, a typical mono LCD one
+	fdmNozzle       = 0.4        // Nozzle without -nozzle, mm
+	fdmLayerHeight  = 0.1        // mm
+	fdmSpeed        = 40.0       // Extrusion speed, mm/s
+	fdmLayerChange  = 2.0        // Per layer, s
+)
+
+// openingStats is the number of openings of a stencil and their area in mm².
+type openingStats struct {
+	count int
+	area  float64
+}
+
+// imageOpenings counts the openings of a rendered paste layer.
+func imageOpenings(img image.Image, pixelToMM float64) openingStats {
+	b := img.Bounds()
+	open := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if render.IsOpen(img, x, y) {
+				open++
+			}
+		}
+	}
+	return openingStats{countOpenings(img), float64(open) * pixelToMM * pixelToMM}
+}
+
+// StencilStats are the numbers about a generated stencil that go into a fab
+// traveler.
+type StencilStats struct {
+	Source    string     `json:"source"`
+	Thickness float64    `json:"thickness_mm"`
+	Openings  int        `json:"openings"`
+	OpenArea  float64    `json:"open_area_mm2"`
+	Triangles int        `json:"triangles"`
+	Min       [3]float64 `json:"bbox_min_mm"`
+	Max       [3]float64 `json:"bbox_max_mm"`
+	Volume    float64    `json:"volume_mm3"`
+	Resin     float64    `json:"resin_ml"`
+	Filament  float64    `json:"filament_m"`
+	Weight    float64    `json:"filament_g"`
+
+	Printer     string  `json:"resin_printer"`
+	ResinLayers int     `json:"resin_layers"`
+	ResinTime   float64 `json:"resin_time_s"`
+	FDMTime     float64 `json:"fdm_time_s"`
+
+	PasteVolume float64 `json:"paste_volume_mm3,omitempty"`
+	PasteWeight float64 `json:"paste_weight_mg,omitempty"`
+}
+
+// meshExtent is how many triangles a mesh has, the volume they enclose,
+// signed as by stl.SignedVolume, and the corners of the box around them.
+type meshExtent struct {
+	count  int
+	volume float64
+	lo, hi Point
+}
+
+// measureMesh finds the extent of triangles in a single pass over them.
+func measureMesh(triangles iter.Seq[[3]Point]) meshExtent {
+	var e meshExtent
+	e.volume = stl.SeqVolume(func(yield func([3]Point) bool) {
+		for t := range triangles {
+			for j, p := range t {
+				if e.count == 0 && j == 0 {
+					e.lo, e.hi = p, p
+				}
+				e.lo = Point{X: math.Min(e.lo.X, p.X), Y: math.Min(e.lo.Y, p.Y), Z: math.Min(e.lo.Z, p.Z)}
+				e.hi = Point{X: math.Max(e.hi.X, p.X), Y: math.Max(e.hi.Y, p.Y), Z: math.Max(e.hi.Z, p.Z)}
+			}
+			e.count++
+			if !yield(t) {
+				return
+			}
+		}
+	})
+	return e
+}
+
+// moved is the extent of the mesh moved by d.
+func (e meshExtent) moved(d Point) meshExtent {
+	e.lo = Point{X: e.lo.X + d.X, Y: e.lo.Y + d.Y, Z: e.lo.Z + d.Z}
+	e.hi = Point{X: e.hi.X + d.X, Y: e.hi.Y + d.Y, Z: e.hi.Z + d.Z}
+	return e
+}
+
+// meshStats measures the mesh of a stencil of extent e with the given
+// openings.
+func meshStats(source string, e meshExtent, openings openingStats, cfg Config) StencilStats {
+	s := StencilStats{
+		Source:    source,
+		Thickness: cfg.StencilHeight,
+		Openings:  openings.count,
+		OpenArea:  openings.area,
+		Triangles: e.count,
+		Volume:    math.Abs(e.volume),
+		Min:       [3]float64{e.lo.X, e.lo.Y, e.lo.Z},
+		Max:       [3]float64{e.hi.X, e.hi.Y, e.hi.Z},
+	}
+	s.Resin = s.Volume / 1000
+	s.Filament = s.Volume / (math.Pi * filamentDiameter * filamentDiameter / 4) / 1000
+	s.Weight = s.Resin * filamentDensity
+
+	// A resin print takes as long for any area, a layer at a time; an FDM
+	// one lays down its volume at the nozzle's flow
+	name := cfg.Printer
+	if name == "" {
+		name = estimatePrinter
+	}
+	if p, err := findResinPrinter(name); err == nil && cfg.LayerHeight > 0 {
+		job := resinJob(p, cfg)
+		s.Printer = p.Model
+		s.ResinLayers = int(math.Ceil((s.Max[2]-s.Min[2])/job.LayerHeight - 1e-9))
+		job.BottomLayers = min(job.BottomLayers, s.ResinLayers)
+		s.ResinTime = job.printTime(s.ResinLayers)
+	}
+	nozzle := cfg.Nozzle
+	if nozzle <= 0 {
+		nozzle = fdmNozzle
+	}
+	layers := math.Ceil((s.Max[2]-s.Min[2])/fdmLayerHeight - 1e-9)
+	s.FDMTime = s.Volume/(nozzle*fdmLayerHeight*fdmSpeed) + layers*fdmLayerChange
+	return s
+}
+
+// duration formats seconds for a print time estimate.
+func duration(seconds float64) string {
+	m := int(math.Round(seconds / 60))
+	switch {
+	case seconds < 60:
+		return fmt.Sprintf("%.0f s", seconds)
+	case m < 60:
+		return fmt.Sprintf("%d min", m)
+	}
+	return fmt.Sprintf("%d h %02d min", m/60, m%60)
+}
+
+// Print writes the statistics in a human readable form to w.
+func (s StencilStats) Print(w io.Writer) {
+	fmt.Fprintf(w, "Openings: %d, %.2f mm² open\n", s.Openings, s.OpenArea)
+	fmt.Fprintf(w, "Size: %.2f x %.2f x %.2f mm\n", s.Max[0]-s.Min[0], s.Max[1]-s.Min[1], s.Max[2]-s.Min[2])
+	fmt.Fprintf(w, "Volume: %.1f mm³ (%.2f ml of resin, or %.2f m / %.1f g of %g mm PLA)\n", s.Volume, s.Resin, s.Filament, s.Weight, filamentDiameter)
+	if s.Printer != "" {
+		fmt.Fprintf(w, "Print time: about %s on the %s (%d layers), or %s on an FDM printer\n", duration(s.ResinTime), s.Printer, s.ResinLayers, duration(s.FDMTime))
+	} else {
+		fmt.Fprintf(w, "Print time: about %s on an FDM printer\n", duration(s.FDMTime))
+	}
+}
+
+// WriteJSON saves the statistics to path.
+func (s StencilStats) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
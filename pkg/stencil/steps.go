@@ -0,0 +1,151 @@
+package stencil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/render"
+)
+
+// stepZoneMargin is how far in mm a zone picked by component reference
+// reaches past the component's pads.
+const stepZoneMargin = 0.5
+
+// StepZone is an area of the plate with its own thickness: a rectangle in
+// gerber coordinates, the components with the given references, or the
+// shapes of a second gerber. The zone is recessed from the squeegee side, so
+// the board side stays flat against the PCB.
+type StepZone struct {
+	Thickness float64
+	Rect      *gerber.Bounds
+	Refs      []string
+	Gerber    string
+	Shapes    *gerber.File // Generated shapes, such as fiducial marks, described by Name
+	Name      string
+	Mask      *render.Bitmap // The zone rendered into the stencil's frame
+}
+
+func (z StepZone) String() string {
+	switch {
+	case z.Rect != nil:
+		return fmt.Sprintf("%g mm in %g,%g to %g,%g", z.Thickness, z.Rect.MinX, z.Rect.MinY, z.Rect.MaxX, z.Rect.MaxY)
+	case z.Gerber != "":
+		return fmt.Sprintf("%g mm under %s", z.Thickness, z.Gerber)
+	case z.Shapes != nil:
+		return fmt.Sprintf("%g mm under %s", z.Thickness, z.Name)
+	}
+	return fmt.Sprintf("%g mm under %s", z.Thickness, strings.Join(z.Refs, ", "))
+}
+
+// ParseStepZone reads a -step value: a thickness in mm, a colon, and either
+// x0,y0,x1,y1 in mm, the path of a gerber, or component references
+// separated by commas.
+func ParseStepZone(s string) (StepZone, error) {
+	thick, where, ok := strings.Cut(s, ":")
+	if !ok || where == "" {
+		return StepZone{}, fmt.Errorf("invalid step zone %q: want thickness:area", s)
+	}
+	var z StepZone
+	var err error
+	if z.Thickness, err = strconv.ParseFloat(thick, 64); err != nil || z.Thickness <= 0 {
+		return StepZone{}, fmt.Errorf("invalid step zone %q: bad thickness %q", s, thick)
+	}
+
+	if _, err := os.Stat(where); err == nil {
+		z.Gerber = where
+		return z, nil
+	}
+	parts := strings.Split(where, ",")
+	if len(parts) == 4 {
+		var v [4]float64
+		numbers := true
+		for i, p := range parts {
+			if v[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+				numbers = false
+				break
+			}
+		}
+		if numbers {
+			z.Rect = &gerber.Bounds{MinX: min(v[0], v[2]), MinY: min(v[1], v[3]), MaxX: max(v[0], v[2]), MaxY: max(v[1], v[3])}
+			if z.Rect.MinX == z.Rect.MaxX || z.Rect.MinY == z.Rect.MaxY {
+				return StepZone{}, fmt.Errorf("invalid step zone %q: empty rectangle", s)
+			}
+			return z, nil
+		}
+	}
+	z.Refs = SplitRefs(where)
+	if len(z.Refs) == 0 {
+		return StepZone{}, fmt.Errorf("invalid step zone %q: no area given", s)
+	}
+	return z, nil
+}
+
+// rectRegion returns a gerber file holding one filled rectangle per bounds.
+func rectRegion(rects []gerber.Bounds) *gerber.File {
+	gf := gerber.New()
+	at := func(x, y float64) gerber.Command { return gerber.Command{Type: "DRAW", X: &x, Y: &y} }
+	for _, b := range rects {
+		x0, y0 := b.MinX, b.MinY
+		gf.Commands = append(gf.Commands,
+			gerber.Command{Type: "G36"},
+			gerber.Command{Type: "MOVE", X: &x0, Y: &y0},
+			at(b.MaxX, b.MinY), at(b.MaxX, b.MaxY), at(b.MinX, b.MaxY), at(b.MinX, b.MinY),
+			gerber.Command{Type: "G37"})
+	}
+	return gf
+}
+
+// polygonRegion returns a gerber file holding one filled region per polygon.
+func polygonRegion(polys [][]vec2) *gerber.File {
+	gf := gerber.New()
+	at := func(p vec2, op string) gerber.Command { return gerber.Command{Type: op, X: &p.X, Y: &p.Y} }
+	for _, poly := range polys {
+		gf.Commands = append(gf.Commands, gerber.Command{Type: "G36"}, at(poly[0], "MOVE"))
+		for _, p := range poly[1:] {
+			gf.Commands = append(gf.Commands, at(p, "DRAW"))
+		}
+		gf.Commands = append(gf.Commands, at(poly[0], "DRAW"), gerber.Command{Type: "G37"})
+	}
+	return gf
+}
+
+// renderStepZones renders each zone of cfg into the frame of the paste layer
+// gf was parsed from.
+func renderStepZones(gf *gerber.File, bounds gerber.Bounds, cfg *Config) error {
+	var components map[string]gerber.Bounds
+	for i := range cfg.Steps {
+		z := &cfg.Steps[i]
+		var area *gerber.File
+		switch {
+		case z.Rect != nil:
+			area = rectRegion([]gerber.Bounds{*z.Rect})
+		case z.Shapes != nil:
+			area = z.Shapes
+		case z.Gerber != "":
+			var err error
+			if area, err = gerber.ParseMirrored(z.Gerber, cfg.Mirror); err != nil {
+				return fmt.Errorf("error parsing step zone gerber: %v", err)
+			}
+		default:
+			if components == nil {
+				components = gf.ComponentBounds()
+			}
+			var rects []gerber.Bounds
+			for _, ref := range z.Refs {
+				b, ok := components[ref]
+				if !ok {
+					return fmt.Errorf("component %s not found in the paste layer (step zones by reference need X2 component attributes, and don't work with -stream)", ref)
+				}
+				m := stepZoneMargin
+				rects = append(rects, gerber.Bounds{MinX: b.MinX - m, MinY: b.MinY - m, MaxX: b.MaxX + m, MaxY: b.MaxY + m})
+			}
+			area = rectRegion(rects)
+		}
+		fmt.Fprintf(cfg.Stdout, "Step zone: %v\n", z)
+		z.Mask = render.Gerber(area, cfg.DPI, &bounds).(*render.Bitmap)
+	}
+	return nil
+}
@@ -0,0 +1,531 @@
+package stencil
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// svgNode is a generic SVG element. Only geometry and fill attributes are
+// used; everything else is ignored.
+type svgNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []svgNode  `xml:",any"`
+}
+
+func (n *svgNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// svgStyle returns a presentation property, preferring the style attribute.
+func (n *svgNode) svgStyle(name string) string {
+	for _, decl := range strings.Split(n.attr("style"), ";") {
+		kv := strings.SplitN(decl, ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return n.attr(name)
+}
+
+// affine is a 2D transform: x' = A*x + C*y + E, y' = B*x + D*y + F
+type affine struct {
+	A, B, C, D, E, F float64
+}
+
+var identity = affine{A: 1, D: 1}
+
+func (m affine) mul(o affine) affine {
+	return affine{
+		A: m.A*o.A + m.C*o.B,
+		B: m.B*o.A + m.D*o.B,
+		C: m.A*o.C + m.C*o.D,
+		D: m.B*o.C + m.D*o.D,
+		E: m.A*o.E + m.C*o.F + m.E,
+		F: m.B*o.E + m.D*o.F + m.F,
+	}
+}
+
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m.A*x + m.C*y + m.E, m.B*x + m.D*y + m.F
+}
+
+// svgShape is one filled element, flattened to closed polygons in mm.
+type svgShape struct {
+	Polys   [][]vec2
+	EvenOdd bool
+}
+
+// svgNumbers splits a list of numbers separated by commas and/or whitespace.
+func svgNumbers(s string) []float64 {
+	var nums []float64
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		if v, err := strconv.ParseFloat(f, 64); err == nil {
+			nums = append(nums, v)
+		}
+	}
+	return nums
+}
+
+// parseSVGLength converts a length attribute (e.g. "50mm", "2in", "100") to
+// mm. Unitless values are CSS pixels at 96 per inch.
+func parseSVGLength(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	units := map[string]float64{
+		"mm": 1, "cm": 10, "in": 25.4, "pt": 25.4 / 72, "pc": 25.4 / 6, "px": 25.4 / 96,
+	}
+	scale := 25.4 / 96
+	for suffix, u := range units {
+		if strings.HasSuffix(s, suffix) {
+			s, scale = strings.TrimSuffix(s, suffix), u
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+func parseSVGTransform(s string) affine {
+	m := identity
+	for _, part := range strings.Split(s, ")") {
+		kv := strings.SplitN(part, "(", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(strings.Trim(kv[0], ", "))
+		args := svgNumbers(kv[1])
+		var t affine
+		switch {
+		case name == "matrix" && len(args) == 6:
+			t = affine{args[0], args[1], args[2], args[3], args[4], args[5]}
+		case name == "translate" && len(args) >= 1:
+			t = identity
+			t.E = args[0]
+			if len(args) > 1 {
+				t.F = args[1]
+			}
+		case name == "scale" && len(args) >= 1:
+			t = affine{A: args[0], D: args[0]}
+			if len(args) > 1 {
+				t.D = args[1]
+			}
+		case name == "rotate" && len(args) >= 1:
+			a := args[0] * math.Pi / 180
+			t = affine{A: math.Cos(a), B: math.Sin(a), C: -math.Sin(a), D: math.Cos(a)}
+			if len(args) == 3 {
+				pre := affine{A: 1, D: 1, E: args[1], F: args[2]}
+				post := affine{A: 1, D: 1, E: -args[1], F: -args[2]}
+				t = pre.mul(t).mul(post)
+			}
+		case name == "skewX" && len(args) == 1:
+			t = affine{A: 1, C: math.Tan(args[0] * math.Pi / 180), D: 1}
+		case name == "skewY" && len(args) == 1:
+			t = affine{A: 1, B: math.Tan(args[0] * math.Pi / 180), D: 1}
+		default:
+			continue
+		}
+		m = m.mul(t)
+	}
+	return m
+}
+
+// parseSVGPath flattens path data into polygons in user units.
+func parseSVGPath(d string) [][]vec2 {
+	var polys [][]vec2
+	var cur []vec2
+	var x, y, startX, startY float64
+	var lastCtrlX, lastCtrlY float64
+	var lastCmd byte
+
+	// Tokenize into commands and numbers
+	var tokens []string
+	i := 0
+	for i < len(d) {
+		c := d[i]
+		switch {
+		case strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			seenDot := c == '.'
+			for j < len(d) {
+				cj := d[j]
+				if cj >= '0' && cj <= '9' {
+					j++
+				} else if cj == '.' && !seenDot {
+					seenDot = true
+					j++
+				} else if (cj == 'e' || cj == 'E') && j+1 < len(d) {
+					j++
+					if d[j] == '-' || d[j] == '+' {
+						j++
+					}
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, d[i:j])
+			i = j
+		default:
+			i++
+		}
+	}
+
+	flush := func() {
+		if len(cur) >= 3 {
+			polys = append(polys, cur)
+		}
+		cur = nil
+	}
+	lineTo := func(nx, ny float64) {
+		if cur == nil {
+			cur = []vec2{{X: x, Y: y}}
+		}
+		cur = append(cur, vec2{X: nx, Y: ny})
+		x, y = nx, ny
+	}
+
+	var cmd byte
+	pos := 0
+	num := func() float64 {
+		if pos >= len(tokens) {
+			return 0
+		}
+		v, _ := strconv.ParseFloat(tokens[pos], 64)
+		pos++
+		return v
+	}
+	hasNum := func() bool {
+		if pos >= len(tokens) {
+			return false
+		}
+		_, err := strconv.ParseFloat(tokens[pos], 64)
+		return err == nil
+	}
+
+	for pos < len(tokens) {
+		if !hasNum() {
+			cmd = tokens[pos][0]
+			pos++
+		} else if cmd == 'M' {
+			cmd = 'L' // Implicit lineto after moveto
+		} else if cmd == 'm' {
+			cmd = 'l'
+		}
+		rel := cmd >= 'a'
+		ox, oy := 0.0, 0.0
+		if rel {
+			ox, oy = x, y
+		}
+
+		switch cmd {
+		case 'M', 'm':
+			flush()
+			x, y = ox+num(), oy+num()
+			startX, startY = x, y
+			cur = []vec2{{X: x, Y: y}}
+		case 'L', 'l':
+			lineTo(ox+num(), oy+num())
+		case 'H', 'h':
+			lineTo(ox+num(), y)
+		case 'V', 'v':
+			lineTo(x, oy+num())
+		case 'C', 'c', 'S', 's':
+			var x1, y1 float64
+			if cmd == 'C' || cmd == 'c' {
+				x1, y1 = ox+num(), oy+num()
+			} else if strings.IndexByte("CcSs", lastCmd) >= 0 {
+				x1, y1 = 2*x-lastCtrlX, 2*y-lastCtrlY
+			} else {
+				x1, y1 = x, y
+			}
+			x2, y2 := ox+num(), oy+num()
+			ex, ey := ox+num(), oy+num()
+			sx, sy := x, y
+			for s := 1; s <= 16; s++ {
+				t := float64(s) / 16
+				mt := 1 - t
+				px := mt*mt*mt*sx + 3*mt*mt*t*x1 + 3*mt*t*t*x2 + t*t*t*ex
+				py := mt*mt*mt*sy + 3*mt*mt*t*y1 + 3*mt*t*t*y2 + t*t*t*ey
+				lineTo(px, py)
+			}
+			lastCtrlX, lastCtrlY = x2, y2
+		case 'Q', 'q', 'T', 't':
+			var x1, y1 float64
+			if cmd == 'Q' || cmd == 'q' {
+				x1, y1 = ox+num(), oy+num()
+			} else if strings.IndexByte("QqTt", lastCmd) >= 0 {
+				x1, y1 = 2*x-lastCtrlX, 2*y-lastCtrlY
+			} else {
+				x1, y1 = x, y
+			}
+			ex, ey := ox+num(), oy+num()
+			sx, sy := x, y
+			for s := 1; s <= 12; s++ {
+				t := float64(s) / 12
+				mt := 1 - t
+				lineTo(mt*mt*sx+2*mt*t*x1+t*t*ex, mt*mt*sy+2*mt*t*y1+t*t*ey)
+			}
+			lastCtrlX, lastCtrlY = x1, y1
+		case 'A', 'a':
+			rx, ry := math.Abs(num()), math.Abs(num())
+			phi := num() * math.Pi / 180
+			largeArc, sweep := num() != 0, num() != 0
+			ex, ey := ox+num(), oy+num()
+			for _, p := range svgArc(x, y, rx, ry, phi, largeArc, sweep, ex, ey) {
+				lineTo(p.X, p.Y)
+			}
+		case 'Z', 'z':
+			flush()
+			x, y = startX, startY
+		default:
+			pos++ // Skip stray numbers
+		}
+		lastCmd = cmd
+	}
+	flush()
+	return polys
+}
+
+// svgArc flattens an endpoint-parameterized elliptical arc (SVG 1.1 F.6.5).
+func svgArc(x1, y1, rx, ry, phi float64, largeArc, sweep bool, x2, y2 float64) []vec2 {
+	if rx == 0 || ry == 0 {
+		return []vec2{{X: x2, Y: y2}}
+	}
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	dx, dy := (x1-x2)/2, (y1-y2)/2
+	x1p := cosPhi*dx + sinPhi*dy
+	y1p := -sinPhi*dx + cosPhi*dy
+
+	// Scale radii up if the endpoints can't be reached
+	lambda := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry)
+	if lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := 0.0
+	if den != 0 && num > 0 {
+		coef = math.Sqrt(num / den)
+	}
+	if largeArc == sweep {
+		coef = -coef
+	}
+	cxp := coef * rx * y1p / ry
+	cyp := -coef * ry * x1p / rx
+	cx := cosPhi*cxp - sinPhi*cyp + (x1+x2)/2
+	cy := sinPhi*cxp + cosPhi*cyp + (y1+y2)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta1 := angle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	dTheta := angle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !sweep && dTheta > 0 {
+		dTheta -= 2 * math.Pi
+	} else if sweep && dTheta < 0 {
+		dTheta += 2 * math.Pi
+	}
+
+	steps := int(math.Ceil(math.Abs(dTheta) / (math.Pi / 32)))
+	if steps < 1 {
+		steps = 1
+	}
+	pts := make([]vec2, 0, steps)
+	for s := 1; s <= steps; s++ {
+		t := theta1 + dTheta*float64(s)/float64(steps)
+		px := rx * math.Cos(t)
+		py := ry * math.Sin(t)
+		pts = append(pts, vec2{X: cosPhi*px - sinPhi*py + cx, Y: sinPhi*px + cosPhi*py + cy})
+	}
+	return pts
+}
+
+// ellipsePoly approximates an ellipse with a polygon.
+func ellipsePoly(cx, cy, rx, ry float64) []vec2 {
+	const steps = 64
+	pts := make([]vec2, steps)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / steps
+		pts[i] = vec2{X: cx + rx*math.Cos(a), Y: cy + ry*math.Sin(a)}
+	}
+	return pts
+}
+
+// svgElementPolys returns the polygons of a basic shape in user units.
+func svgElementPolys(n *svgNode) [][]vec2 {
+	num := func(name string) float64 {
+		v, _ := strconv.ParseFloat(strings.TrimSuffix(n.attr(name), "px"), 64)
+		return v
+	}
+	switch n.XMLName.Local {
+	case "path":
+		return parseSVGPath(n.attr("d"))
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		rx, ry := num("rx"), num("ry")
+		if rx == 0 {
+			rx = ry
+		}
+		if ry == 0 {
+			ry = rx
+		}
+		rx, ry = math.Min(rx, w/2), math.Min(ry, h/2)
+		if rx == 0 {
+			return [][]vec2{{{X: x, Y: y}, {X: x + w, Y: y}, {X: x + w, Y: y + h}, {X: x, Y: y + h}}}
+		}
+		// Rounded corners, one quarter ellipse per corner
+		var pts []vec2
+		corners := []struct{ cx, cy, start float64 }{
+			{x + w - rx, y + ry, -math.Pi / 2},
+			{x + w - rx, y + h - ry, 0},
+			{x + rx, y + h - ry, math.Pi / 2},
+			{x + rx, y + ry, math.Pi},
+		}
+		for _, c := range corners {
+			for s := 0; s <= 8; s++ {
+				a := c.start + float64(s)/8*math.Pi/2
+				pts = append(pts, vec2{X: c.cx + rx*math.Cos(a), Y: c.cy + ry*math.Sin(a)})
+			}
+		}
+		return [][]vec2{pts}
+	case "circle":
+		r := num("r")
+		return [][]vec2{ellipsePoly(num("cx"), num("cy"), r, r)}
+	case "ellipse":
+		return [][]vec2{ellipsePoly(num("cx"), num("cy"), num("rx"), num("ry"))}
+	case "polygon", "polyline":
+		nums := svgNumbers(n.attr("points"))
+		var pts []vec2
+		for i := 0; i+1 < len(nums); i += 2 {
+			pts = append(pts, vec2{X: nums[i], Y: nums[i+1]})
+		}
+		if len(pts) >= 3 {
+			return [][]vec2{pts}
+		}
+	}
+	return nil
+}
+
+// collectSVGShapes walks the element tree and flattens every filled shape.
+func collectSVGShapes(n *svgNode, m affine, fill, fillRule string, shapes *[]svgShape) {
+	switch n.XMLName.Local {
+	case "defs", "clipPath", "mask", "symbol", "metadata", "title", "desc", "style", "text":
+		return
+	}
+	if n.svgStyle("display") == "none" || n.svgStyle("visibility") == "hidden" {
+		return
+	}
+	if t := n.attr("transform"); t != "" {
+		m = m.mul(parseSVGTransform(t))
+	}
+	if f := n.svgStyle("fill"); f != "" {
+		fill = f
+	}
+	if r := n.svgStyle("fill-rule"); r != "" {
+		fillRule = r
+	}
+
+	if polys := svgElementPolys(n); polys != nil && fill != "none" && fill != "transparent" {
+		shape := svgShape{EvenOdd: fillRule == "evenodd"}
+		for _, poly := range polys {
+			out := make([]vec2, len(poly))
+			for i, p := range poly {
+				out[i].X, out[i].Y = m.apply(p.X, p.Y)
+			}
+			shape.Polys = append(shape.Polys, out)
+		}
+		*shapes = append(*shapes, shape)
+	}
+
+	for i := range n.Children {
+		collectSVGShapes(&n.Children[i], m, fill, fillRule, shapes)
+	}
+}
+
+// parseSVG reads an SVG file and returns its filled shapes in mm, with y
+// pointing down as in the SVG, plus the document size in mm.
+func parseSVG(filename string) ([]svgShape, float64, float64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var root svgNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid SVG: %v", err)
+	}
+	if root.XMLName.Local != "svg" {
+		return nil, 0, 0, fmt.Errorf("invalid SVG: root element is <%s>", root.XMLName.Local)
+	}
+
+	// Map user units to mm using width/height and the viewBox
+	widthMM, hasW := parseSVGLength(root.attr("width"))
+	heightMM, hasH := parseSVGLength(root.attr("height"))
+	m := affine{A: 25.4 / 96, D: 25.4 / 96}
+	if vb := svgNumbers(root.attr("viewBox")); len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+		if !hasW {
+			widthMM = vb[2] * 25.4 / 96
+		}
+		if !hasH {
+			heightMM = vb[3] * 25.4 / 96
+		}
+		m = affine{A: widthMM / vb[2], D: heightMM / vb[3], E: -vb[0] * widthMM / vb[2], F: -vb[1] * heightMM / vb[3]}
+	}
+
+	var shapes []svgShape
+	collectSVGShapes(&root, m, "black", "nonzero", &shapes)
+	if len(shapes) == 0 {
+		return nil, 0, 0, fmt.Errorf("no filled shapes found in SVG")
+	}
+	return shapes, widthMM, heightMM, nil
+}
+
+// RenderSVG rasterizes the filled shapes of an SVG as holes (white) on solid
+// stencil material (black), with margin mm of material around the document.
+func RenderSVG(filename string, dpi, margin float64) (image.Image, error) {
+	shapes, widthMM, heightMM, err := parseSVG(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := dpi / 25.4
+	if err := render.CheckSize((widthMM+2*margin)*scale, (heightMM+2*margin)*scale); err != nil {
+		return nil, err
+	}
+	imgWidth := int((widthMM + 2*margin) * scale)
+	imgHeight := int((heightMM + 2*margin) * scale)
+	img := render.NewBitmap(imgWidth, imgHeight)
+
+	for _, shape := range shapes {
+		var polys [][]vec2
+		for _, poly := range shape.Polys {
+			px := make([]vec2, len(poly))
+			for i, p := range poly {
+				px[i] = vec2{X: (p.X + margin) * scale, Y: (p.Y + margin) * scale}
+			}
+			polys = append(polys, px)
+		}
+		render.FillPolygons(img, polys, shape.EvenOdd)
+	}
+	return img, nil
+}
@@ -0,0 +1,181 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// outlinePaths returns the center lines of an outline layer's draws as
+// polylines in mm, starting a new one at every move.
+func outlinePaths(gf *gerber.File) [][]vec2 {
+	var paths [][]vec2
+	var cur []vec2
+	flush := func() {
+		if len(cur) >= 2 {
+			paths = append(paths, cur)
+		}
+		cur = nil
+	}
+
+	var curX, curY float64
+	mode := "G01"
+	for _, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "G01", "G02", "G03":
+			mode = cmd.Type
+			continue
+		case "MOVE", "FLASH", "DRAW":
+		default:
+			continue
+		}
+		prevX, prevY := curX, curY
+		if cmd.X != nil {
+			curX = *cmd.X
+		}
+		if cmd.Y != nil {
+			curY = *cmd.Y
+		}
+		if cmd.Type != "DRAW" {
+			flush()
+			continue
+		}
+
+		path := []vec2{{X: prevX, Y: prevY}, {X: curX, Y: curY}}
+		if mode != "G01" {
+			var i, j float64
+			if cmd.I != nil {
+				i = *cmd.I
+			}
+			if cmd.J != nil {
+				j = *cmd.J
+			}
+			path = gerber.ArcPath(prevX, prevY, curX, curY, i, j, mode)
+		}
+		if len(cur) == 0 {
+			cur = append(cur, path[0])
+		}
+		cur = append(cur, path[1:]...)
+	}
+	flush()
+	return paths
+}
+
+// cutOutline returns the paths to cut along the board outline, with the last
+// point of those that end where they start dropped and closed set, or the
+// edge of frame when there is no outline. Closed paths move out by half the
+// kerf so the stencil keeps its drawn size.
+func cutOutline(outline *gerber.File, frame gerber.Bounds, kerf float64) ([][]vec2, []bool) {
+	var paths [][]vec2
+	var closed []bool
+	if outline == nil {
+		paths = [][]vec2{{{X: frame.MinX, Y: frame.MinY}, {X: frame.MaxX, Y: frame.MinY}, {X: frame.MaxX, Y: frame.MaxY}, {X: frame.MinX, Y: frame.MaxY}}}
+		closed = []bool{true}
+	} else {
+		for _, p := range outlinePaths(outline) {
+			c := len(p) > 2 && p[0] == p[len(p)-1]
+			if c {
+				p = p[:len(p)-1]
+			}
+			paths = append(paths, p)
+			closed = append(closed, c)
+		}
+	}
+	for i, p := range paths {
+		if kerf <= 0 || !closed[i] {
+			continue
+		}
+		// Outwards is left of a clockwise loop
+		if gerber.SignedArea(p) > 0 {
+			p = slices.Clone(p)
+			slices.Reverse(p)
+		}
+		if q := offsetLoop(p, kerf/2); q != nil {
+			paths[i] = q
+		}
+	}
+	return paths, closed
+}
+
+// cutApertures returns the boundaries of the paste layer's openings, moved
+// into them by half the kerf so the cut openings come out at their drawn
+// size. Openings too small for the kerf are left as drawn, with a warning
+// to logger.
+func cutApertures(paste *gerber.File, kerf float64, logger *log.Logger) [][]vec2 {
+	contours := unionContours(paste.VectorPolygons())
+	if kerf <= 0 {
+		return contours
+	}
+	small := 0
+	for i, c := range contours {
+		// The opening is on the left of each contour
+		if q := offsetLoop(c, kerf/2); q != nil && gerber.SignedArea(q)*gerber.SignedArea(c) > 0 {
+			contours[i] = q
+		} else {
+			small++
+		}
+	}
+	if small > 0 {
+		logger.Printf("Warning: %d openings are too small for a %g mm kerf, cutting them as drawn", small, kerf)
+	}
+	return contours
+}
+
+// WriteStencilSVG writes the stencil's cut lines in mm: the boundary of the
+// union of the paste layer's openings, and the board outline's center line
+// (or the edge of frame when there is no outline), compensated for cfg.Kerf. The
+// two are separate Inkscape layers in different colors, so laser software
+// can give them their own settings. The drawing is in board orientation, as
+// seen from the top.
+func WriteStencilSVG(filename string, paste, outline *gerber.File, frame gerber.Bounds, cfg Config) error {
+	kerf := cfg.Kerf
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	paths, closed := cutOutline(outline, frame, kerf)
+	contours := cutApertures(paste, kerf, cfg.Log)
+
+	// Room for the outline moved out by the kerf
+	frame = gerber.Bounds{MinX: frame.MinX - kerf, MinY: frame.MinY - kerf, MaxX: frame.MaxX + kerf, MaxY: frame.MaxY + kerf}
+	width, height := frame.MaxX-frame.MinX, frame.MaxY-frame.MinY
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" width=\"%.4fmm\" height=\"%.4fmm\" viewBox=\"0 0 %.4f %.4f\">\n", width, height, width, height)
+
+	// SVG's Y axis points down
+	writePath := func(pts []vec2, closed bool) {
+		fmt.Fprint(w, "<path d=\"")
+		for i, p := range pts {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(w, "%s%.4f %.4f", cmd, p.X-frame.MinX, frame.MaxY-p.Y)
+		}
+		if closed {
+			fmt.Fprint(w, "Z")
+		}
+		fmt.Fprint(w, "\"/>\n")
+	}
+
+	fmt.Fprintf(w, "<g id=\"outline\" inkscape:groupmode=\"layer\" inkscape:label=\"Outline\" fill=\"none\" stroke=\"#0000ff\" stroke-width=\"0.05\">\n")
+	for i, p := range paths {
+		writePath(p, closed[i])
+	}
+	fmt.Fprintf(w, "</g>\n")
+
+	fmt.Fprintf(w, "<g id=\"apertures\" inkscape:groupmode=\"layer\" inkscape:label=\"Apertures\" fill=\"none\" stroke=\"#ff0000\" stroke-width=\"0.05\">\n")
+	for _, c := range contours {
+		writePath(c, true)
+	}
+	fmt.Fprintf(w, "</g>\n</svg>\n")
+	fmt.Fprintf(cfg.Stdout, "SVG: %d aperture contours\n", len(contours))
+	return w.Flush()
+}
@@ -0,0 +1,141 @@
+package stencil
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Test pattern layout, mm
+const (
+	patternText = 2.0 // Height of the size and shrink labels
+	patternGap  = 1.5 // Clearance between neighbouring openings
+)
+
+// TestPattern is a calibration stencil: for each shrink, a row of round
+// and a row of square openings of each size, shrunk by it.
+type TestPattern struct {
+	Sizes   []float64 // Opening sizes before shrinking, mm
+	Shrinks []Shrink
+}
+
+// ParseTestPattern reads the -pattern-sizes and -pattern-shrinks lists.
+func ParseTestPattern(sizes, shrinks string) (TestPattern, error) {
+	var t TestPattern
+	for _, p := range strings.Split(sizes, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v <= 0 {
+			return TestPattern{}, fmt.Errorf("invalid pattern size %q: want a diameter in mm", p)
+		}
+		t.Sizes = append(t.Sizes, v)
+	}
+	for _, p := range strings.Split(shrinks, ",") {
+		s, _, err := ParseShrink(strings.TrimSpace(p))
+		if err != nil {
+			return TestPattern{}, fmt.Errorf("invalid pattern shrink %q: %v", p, err)
+		}
+		t.Shrinks = append(t.Shrinks, s)
+	}
+	return t, nil
+}
+
+// shrinkLabel is how a row's shrink is written on the stencil.
+func shrinkLabel(s Shrink) string {
+	if s.Percent {
+		return fmt.Sprintf("%g%%", s.Amount)
+	}
+	return fmt.Sprintf("%g", s.Amount)
+}
+
+// shrunk returns an opening size mm across shrunk by s off each side.
+func shrunk(size float64, s Shrink) float64 {
+	if s.Percent {
+		return size * (1 - s.Amount/100)
+	}
+	return size - 2*s.Amount
+}
+
+// WriteTestPattern writes t as a paste layer gerber: the sizes labelled
+// along the top, and each shrink labelled left of its pair of rows. Openings
+// a shrink closes up entirely are left out.
+func WriteTestPattern(filename string, t TestPattern) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	largest, labelW, sizeW := 0.0, 0.0, 0.0
+	for _, d := range t.Sizes {
+		largest = math.Max(largest, d)
+		sizeW = math.Max(sizeW, strokeTextWidth(fmt.Sprintf("%g", d), patternText))
+	}
+	for _, s := range t.Shrinks {
+		labelW = math.Max(labelW, strokeTextWidth(shrinkLabel(s), patternText))
+	}
+	pitch := math.Max(largest, sizeW+patternGap) + patternGap
+	row := largest + patternGap
+	labelW += patternGap
+
+	fmt.Fprintf(w, "G04 Calibration test pattern, generated by pcb-to-stencil %s*\n", toolVersion())
+	fmt.Fprintf(w, "%%FSLAX46Y46*%%\n%%MOMM*%%\n%%LPD*%%\n")
+	coord := func(v float64) int64 { return int64(math.Round(v * 1e6)) }
+	apertures := map[string]int{}
+	aperture := func(shape string, d float64) {
+		key := fmt.Sprintf("%s,%.4f", shape, d)
+		if shape == "R" {
+			key = fmt.Sprintf("R,%.4fX%.4f", d, d)
+		}
+		code, ok := apertures[key]
+		if !ok {
+			code = 10 + len(apertures)
+			apertures[key] = code
+			fmt.Fprintf(w, "%%ADD%d%s*%%\n", code, key)
+		}
+		fmt.Fprintf(w, "D%d*\n", code)
+	}
+	text := func(s string, x, y float64) {
+		aperture("C", patternText/7)
+		unit := patternText / strokeHeight
+		for _, ch := range strings.ToUpper(s) {
+			for _, line := range strings.Fields(strokeGlyphs[ch]) {
+				for i := 0; i+1 < len(line); i += 2 {
+					op := 1
+					if i == 0 {
+						op = 2
+					}
+					fmt.Fprintf(w, "X%dY%dD%02d*\n", coord(x+float64(line[i]-'0')*unit), coord(y+float64(line[i+1]-'0')*unit), op)
+				}
+			}
+			x += strokeAdvance * unit
+		}
+	}
+
+	// Rows run down from the size labels at Y 0
+	for j, d := range t.Sizes {
+		s := fmt.Sprintf("%g", d)
+		text(s, labelW+(float64(j)+0.5)*pitch-strokeTextWidth(s, patternText)/2, 0)
+	}
+	y := -patternGap
+	for _, s := range t.Shrinks {
+		text(shrinkLabel(s), 0, y-row-patternText/2)
+		for _, shape := range []string{"C", "R"} {
+			y -= row / 2
+			for j, d := range t.Sizes {
+				if d = shrunk(d, s); d <= 0 {
+					continue
+				}
+				aperture(shape, d)
+				fmt.Fprintf(w, "X%dY%dD03*\n", coord(labelW+(float64(j)+0.5)*pitch), coord(y))
+			}
+			y -= row / 2
+		}
+		y -= patternGap
+	}
+	fmt.Fprintf(w, "M02*\n")
+	return w.Flush()
+}
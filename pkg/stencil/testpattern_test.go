@@ -0,0 +1,19 @@
+package stencil
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// The calibration stencil is meshed clean with the default pattern.
+func TestTestPatternMeshClean(t *testing.T) {
+	pattern, err := ParseTestPattern("0.2,0.3,0.4,0.5,0.6,0.8,1,1.2,1.5", "0,0.025,0.05,0.075,0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "testpattern.gbr")
+	if err := WriteTestPattern(path, pattern); err != nil {
+		t.Fatal(err)
+	}
+	checkVectorMesh(t, path)
+}
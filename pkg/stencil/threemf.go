@@ -0,0 +1,179 @@
+package stencil
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"pcb-to-stencil/pkg/mesh"
+	"pcb-to-stencil/pkg/progress"
+	"pcb-to-stencil/pkg/stl"
+)
+
+// toolVersion returns the module version of the binary, or its VCS revision
+// for development builds.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	return "devel"
+}
+
+// newMeshInfo describes the stencil made from source with cfg, rendered at
+// dpi or meshed from the geometry when it's 0.
+func newMeshInfo(source string, cfg Config, dpi float64) stl.Info {
+	info := stl.Info{
+		Name:      strings.TrimSuffix(filepath.Base(source), filepath.Ext(source)),
+		Source:    source,
+		Thickness: cfg.StencilHeight,
+		DPI:       dpi,
+		Units:     "mm",
+		Tool:      "pcb-to-stencil " + toolVersion(),
+	}
+	if cfg.ShrinkX == cfg.ShrinkY && cfg.ShrinkX != (Shrink{}) {
+		info.Compensation = fmt.Sprintf("shrunk by %v", cfg.ShrinkX)
+	} else if cfg.ShrinkX != cfg.ShrinkY {
+		info.Compensation = fmt.Sprintf("shrunk by %v along X and %v along Y", cfg.ShrinkX, cfg.ShrinkY)
+	}
+	if len(cfg.ShrinkByArea) > 0 {
+		byArea := "shrunk by area " + areaShrinksString(cfg.ShrinkByArea)
+		if info.Compensation != "" {
+			byArea += " then " + info.Compensation
+		}
+		info.Compensation = byArea
+	}
+	if cfg.Scale != 0 && cfg.Scale != 1 {
+		info.Units = fmt.Sprintf("%g per mm", cfg.Scale)
+		for name, s := range meshUnits {
+			if s == cfg.Scale {
+				info.Units = name
+			}
+		}
+	}
+	return info
+}
+
+// Write3MF writes the mesh as a 3MF package in millimeters, with a single
+// object named after the model and where it came from in the metadata.
+func Write3MF(filename string, triangles [][3]Point, model stl.Info, report progress.Func) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pkg := zip.NewWriter(f)
+	create := func(name string) (io.Writer, error) {
+		return pkg.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	}
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+ <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+ <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+ <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`},
+	}
+	for _, p := range parts {
+		w, err := create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(p.body)); err != nil {
+			return err
+		}
+	}
+
+	zw, err := create("3D/3dmodel.model")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(zw)
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<model unit=\"millimeter\" xml:lang=\"en-US\" xmlns=\"http://schemas.microsoft.com/3dmanufacturing/core/2015/02\" xmlns:p2s=\"https://github.com/kennycoder/pcb-to-stencil\">\n")
+	fmt.Fprintf(w, " <metadata name=\"Title\">%s</metadata>\n", esc(model.Name))
+	fmt.Fprintf(w, " <metadata name=\"Application\">pcb-to-stencil %s</metadata>\n", esc(toolVersion()))
+	fmt.Fprintf(w, " <metadata name=\"Description\">Solder paste stencil from %s</metadata>\n", esc(model.Summary()))
+	fmt.Fprintf(w, " <metadata name=\"CreationDate\">%s</metadata>\n", time.Now().Format("2006-01-02"))
+	fmt.Fprintf(w, " <metadata name=\"p2s:Source\">%s</metadata>\n", esc(model.Source))
+	fmt.Fprintf(w, " <metadata name=\"p2s:Thickness\">%g</metadata>\n", model.Thickness)
+	if model.DPI > 0 {
+		fmt.Fprintf(w, " <metadata name=\"p2s:DPI\">%g</metadata>\n", model.DPI)
+	}
+	if model.Compensation != "" {
+		fmt.Fprintf(w, " <metadata name=\"p2s:Compensation\">%s</metadata>\n", esc(model.Compensation))
+	}
+	fmt.Fprintf(w, " <resources>\n  <object id=\"1\" type=\"model\" name=\"%s\">\n   <mesh>\n    <vertices>\n", esc(model.Name))
+
+	vertices, faces := mesh.Index(triangles)
+	var buf []byte
+	coord := func(name string, c uint32) {
+		buf = append(buf, ' ')
+		buf = append(buf, name...)
+		buf = append(buf, '=', '"')
+		buf = strconv.AppendFloat(buf, float64(math.Float32frombits(c)), 'g', -1, 32)
+		buf = append(buf, '"')
+	}
+	for i, v := range vertices {
+		if i%65536 == 0 {
+			report.Report("Writing 3MF", i, len(vertices)+len(faces))
+		}
+		buf = append(buf[:0], "     <vertex"...)
+		coord("x", v[0])
+		coord("y", v[1])
+		coord("z", v[2])
+		buf = append(buf, "/>\n"...)
+		w.Write(buf)
+	}
+	fmt.Fprintf(w, "    </vertices>\n    <triangles>\n")
+	for i, t := range faces {
+		if i%65536 == 0 {
+			report.Report("Writing 3MF", len(vertices)+i, len(vertices)+len(faces))
+		}
+		buf = append(buf[:0], "     <triangle"...)
+		for j, name := range []string{" v1=\"", " v2=\"", " v3=\""} {
+			buf = append(buf, name...)
+			buf = strconv.AppendUint(buf, uint64(t[j]), 10)
+			buf = append(buf, '"')
+		}
+		buf = append(buf, "/>\n"...)
+		w.Write(buf)
+	}
+	report.Report("Writing 3MF", 1, 1)
+	fmt.Fprintf(w, "    </triangles>\n   </mesh>\n  </object>\n </resources>\n <build>\n  <item objectid=\"1\"/>\n </build>\n</model>\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := pkg.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,229 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// Tiling splits a stencil too large for the printer into tiles that key
+// into each other along their cuts with dovetail or puzzle joints.
+type Tiling struct {
+	Cols, Rows int     // 0 with -tiles auto, until chosen from the bed
+	Auto       bool    // Choose Cols and Rows to fit the bed
+	Joint      string  // dovetail or puzzle
+	JointSize  float64 // How far a joint's tab reaches across the cut, mm
+	JointGap   float64 // Clearance between neighbouring tiles, mm
+	Pins       float64 // Diameter of the alignment pin holes at the ends of each cut, mm; 0 for none
+}
+
+// ParseTiles reads a -tiles value: "colsxrows" such as 2x1, or auto.
+func ParseTiles(s string) (Tiling, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return Tiling{}, nil
+	case "auto":
+		return Tiling{Auto: true}, nil
+	}
+	cols, rows, ok := strings.Cut(strings.ToLower(s), "x")
+	c, err1 := strconv.Atoi(strings.TrimSpace(cols))
+	r, err2 := strconv.Atoi(strings.TrimSpace(rows))
+	if !ok || err1 != nil || err2 != nil || c < 1 || r < 1 {
+		return Tiling{}, fmt.Errorf("invalid tiles %q: want columns x rows, such as 2x1, or auto", s)
+	}
+	return Tiling{Cols: c, Rows: r}, nil
+}
+
+// enabled reports whether the stencil is to be tiled.
+func (t Tiling) enabled() bool {
+	return t.Auto || t.Cols*t.Rows > 1
+}
+
+// fitTiles chooses the fewest columns and rows of tiles of a w x h mm
+// stencil that fit bed with the joints' tabs, turned a quarter if that
+// takes fewer.
+func (t *Tiling) fitTiles(w, h float64, bed Bed) error {
+	count := func(size, room float64) int {
+		if size <= room {
+			return 1
+		}
+		if room <= t.JointSize {
+			return math.MaxInt32
+		}
+		return int(math.Ceil(size / (room - t.JointSize)))
+	}
+	t.Cols, t.Rows = count(w, bed.Width), count(h, bed.Depth)
+	if c, r := count(w, bed.Depth), count(h, bed.Width); c*r < t.Cols*t.Rows {
+		t.Cols, t.Rows = c, r
+	}
+	if t.Cols == math.MaxInt32 || t.Rows == math.MaxInt32 {
+		return fmt.Errorf("the %g mm joints don't fit the %g x %g mm bed", t.JointSize, bed.Width, bed.Depth)
+	}
+	return nil
+}
+
+// tiler finds which tile each pixel of a w x h image belongs to.
+type tiler struct {
+	Tiling
+	w, h   int
+	vcuts  []float64 // X of the cuts between columns, pixels
+	hcuts  []float64 // Y of the cuts between rows, pixels
+	depth  float64   // JointSize in pixels
+	gap    float64   // Half the JointGap in pixels
+	pins   []vec2
+	pinR   float64
+	margin float64 // Reach of the joints and pins from a cut, pixels
+}
+
+// newTiler lays the tiles of t over a w x h image with pixelToMM mm pixels
+// and a frame margin mm wide, where the pin holes go.
+func newTiler(t Tiling, w, h int, pixelToMM, margin float64) *tiler {
+	tl := &tiler{Tiling: t, w: w, h: h, depth: t.JointSize / pixelToMM, gap: t.JointGap / 2 / pixelToMM, pinR: t.Pins / 2 / pixelToMM}
+	for j := 1; j < t.Cols; j++ {
+		tl.vcuts = append(tl.vcuts, float64(j*w)/float64(t.Cols))
+	}
+	for i := 1; i < t.Rows; i++ {
+		tl.hcuts = append(tl.hcuts, float64(i*h)/float64(t.Rows))
+	}
+	if t.Pins > 0 {
+		// A hole either side of each end of each cut, in the middle of the
+		// frame's margin
+		m, off := margin/pixelToMM/2, 1.5*t.Pins/pixelToMM
+		for _, c := range tl.vcuts {
+			for _, y := range []float64{m, float64(h) - m} {
+				tl.pins = append(tl.pins, vec2{X: c - off, Y: y}, vec2{X: c + off, Y: y})
+			}
+		}
+		for _, c := range tl.hcuts {
+			for _, x := range []float64{m, float64(w) - m} {
+				tl.pins = append(tl.pins, vec2{X: x, Y: c - off}, vec2{X: x, Y: c + off})
+			}
+		}
+	}
+	tl.margin = tl.depth + 2*tl.gap + 1.5*t.Pins/pixelToMM + tl.pinR + 1
+	return tl
+}
+
+// inTab reports whether a point u pixels across a cut from it, v along it
+// from a tab's middle, is in the tab.
+func (tl *tiler) inTab(u, v float64) bool {
+	d := tl.depth
+	if u < 0 || u > d {
+		return false
+	}
+	v = math.Abs(v)
+	if tl.Joint == "puzzle" {
+		r := 0.4 * d
+		return (u <= d-r && v <= 0.25*d) || math.Hypot(u-(d-r), v) <= r
+	}
+	// Dovetail: narrow at the cut, wider at the tip
+	return v <= 0.3*d+0.2*u
+}
+
+// cross returns the index of the tile of position p along one axis, with
+// cuts across it at cuts, before the joints.
+func cross(cuts []float64, p float64) int {
+	n := 0
+	for _, c := range cuts {
+		if p >= c {
+			n++
+		}
+	}
+	return n
+}
+
+// jointOwner returns which side of the cuts at cuts a point a pixels along
+// them and b across belongs to, taking the tabs of the joints into account,
+// with the cuts' segments ending at ends. seed alternates the tabs.
+func (tl *tiler) jointOwner(cuts, ends []float64, length, a, b float64, seed int) int {
+	n := cross(cuts, a)
+	for j, c := range cuts {
+		if math.Abs(a-c) > tl.depth {
+			continue
+		}
+		// The stretch of the cut between crossing cuts the point is along
+		seg := cross(ends, b)
+		lo, hi := 0.0, length
+		if seg > 0 {
+			lo = ends[seg-1]
+		}
+		if seg < len(ends) {
+			hi = ends[seg]
+		}
+		tabs := max(1, int((hi-lo)/(4*tl.depth)))
+		pitch := (hi - lo) / float64(tabs)
+		k := min(int((b-lo)/pitch), tabs-1)
+		mid := lo + (float64(k)+0.5)*pitch
+		if (j+seg+k+seed)%2 == 0 {
+			// Tab of the tile before the cut, reaching past it
+			if tl.inTab(a-c, b-mid) {
+				n = j
+			}
+		} else if tl.inTab(c-a, b-mid) {
+			n = j + 1
+		}
+	}
+	return n
+}
+
+// owner returns the tile of the point (x, y) in pixels, numbered along the
+// rows from the top left, or -1 in a pin hole.
+func (tl *tiler) owner(x, y float64) int {
+	for _, p := range tl.pins {
+		if math.Hypot(x-p.X, y-p.Y) <= tl.pinR {
+			return -1
+		}
+	}
+	col := tl.jointOwner(tl.vcuts, tl.hcuts, float64(tl.h), x, y, 0)
+	row := tl.jointOwner(tl.hcuts, tl.vcuts, float64(tl.w), y, x, 1)
+	return row*tl.Cols + col
+}
+
+// nearCut reports whether the point (x, y) in pixels is close enough to a
+// cut for its joints or pins to matter.
+func (tl *tiler) nearCut(x, y float64) bool {
+	for _, c := range tl.vcuts {
+		if math.Abs(x-c) <= tl.margin {
+			return true
+		}
+	}
+	for _, c := range tl.hcuts {
+		if math.Abs(y-c) <= tl.margin {
+			return true
+		}
+	}
+	return false
+}
+
+// mask returns the pixels of tile k, less the clearance to its neighbours
+// and the pin holes.
+func (tl *tiler) mask(k int) *render.Bitmap {
+	b := render.NewBitmap(tl.w, tl.h)
+	const around = 8
+	for y := 0; y < tl.h; y++ {
+		for x := 0; x < tl.w; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			if !tl.nearCut(px, py) {
+				if cross(tl.hcuts, py)*tl.Cols+cross(tl.vcuts, px) == k {
+					b.SetBit(x, y)
+				}
+				continue
+			}
+			if tl.owner(px, py) != k {
+				continue
+			}
+			keep := true
+			for i := 0; i < around && keep && tl.gap > 0; i++ {
+				s, c := math.Sincos(2 * math.Pi * float64(i) / around)
+				keep = tl.owner(px+tl.gap*c, py+tl.gap*s) == k
+			}
+			if keep {
+				b.SetBit(x, y)
+			}
+		}
+	}
+	return b
+}
@@ -0,0 +1,124 @@
+package stencil
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+type ApertureUsage struct {
+	DCode     int
+	Aperture  gerber.Aperture
+	Flashes   int
+	Draws     int
+	Undefined bool
+}
+
+// ValidationReport summarizes a parsed gerber and lists everything that would
+// keep it from being converted faithfully.
+type ValidationReport struct {
+	File      string
+	Units     string
+	Apertures []ApertureUsage
+	Draws     int
+	Arcs      int
+	Flashes   int
+	Regions   int
+	Issues    []string
+}
+
+// OK reports whether the file can be converted without known problems.
+func (r *ValidationReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// ValidateGerber collects statistics and problems from a parsed file.
+func ValidateGerber(filename string, gf *gerber.File) *ValidationReport {
+	r := &ValidationReport{File: filename, Units: gf.State.Units}
+
+	usage := make(map[int]*ApertureUsage)
+	use := func(d int) *ApertureUsage {
+		u, ok := usage[d]
+		if !ok {
+			ap, defined := gf.State.Apertures[d]
+			u = &ApertureUsage{DCode: d, Aperture: ap, Undefined: !defined}
+			usage[d] = u
+		}
+		return u
+	}
+	for d := range gf.State.Apertures {
+		use(d)
+	}
+
+	curDCode := 0
+	interpolationMode := "G01"
+	inRegion := false
+	for _, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "APERTURE":
+			curDCode = *cmd.D
+		case "G01", "G02", "G03":
+			interpolationMode = cmd.Type
+		case "G36":
+			inRegion = true
+			r.Regions++
+		case "G37":
+			inRegion = false
+		case "FLASH":
+			r.Flashes++
+			use(curDCode).Flashes++
+		case "DRAW":
+			if interpolationMode != "G01" {
+				r.Arcs++
+			}
+			r.Draws++
+			if !inRegion {
+				use(curDCode).Draws++
+			}
+		}
+	}
+
+	for _, u := range usage {
+		r.Apertures = append(r.Apertures, *u)
+		if u.Undefined && u.Flashes+u.Draws > 0 {
+			r.Issues = append(r.Issues, fmt.Sprintf("D%d is used but never defined", u.DCode))
+		}
+	}
+	sort.Slice(r.Apertures, func(i, j int) bool { return r.Apertures[i].DCode < r.Apertures[j].DCode })
+
+	var unsupported []string
+	for what, n := range gf.Unsupported {
+		unsupported = append(unsupported, fmt.Sprintf("unsupported %s (%d×)", what, n))
+	}
+	sort.Strings(unsupported)
+	r.Issues = append(r.Issues, unsupported...)
+
+	if r.Flashes == 0 && r.Draws == 0 {
+		r.Issues = append(r.Issues, "no flashes or draws found")
+	}
+	return r
+}
+
+// Print writes a human readable version of the report.
+func (r *ValidationReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s (units %s)\n", r.File, r.Units)
+	fmt.Fprintf(w, "  %d flashes, %d draws (%d arcs), %d regions\n", r.Flashes, r.Draws, r.Arcs, r.Regions)
+	fmt.Fprintln(w, "  Apertures:")
+	for _, u := range r.Apertures {
+		desc := "undefined"
+		if !u.Undefined {
+			desc = u.Aperture.Describe()
+		}
+		fmt.Fprintf(w, "    D%-4d %-24s %6d flashes %6d draws\n", u.DCode, desc, u.Flashes, u.Draws)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "  OK")
+		return
+	}
+	fmt.Fprintln(w, "  Problems:")
+	for _, issue := range r.Issues {
+		fmt.Fprintf(w, "    - %s\n", issue)
+	}
+}
@@ -0,0 +1,566 @@
+package stencil
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"pcb-to-stencil/pkg/gerber"
+)
+
+// The vector backend turns flashes, draws and regions into polygons in mm,
+// traces the outline of their union with a sweep line and extrudes the
+// stencil plate around it directly, without an intermediate image.
+
+const (
+	// Clearance in mm around each group of overlapping openings. Groups whose
+	// padded boxes touch are swept together.
+	vectorClusterGap = 0.2
+	// Size in mm of the units the plate is tiled in, like the raster
+	// mesher's pixels. Points keep their full precision.
+	vectorUnit = 0.01
+	// Slabs a group of overlapping openings may take to merge before the
+	// raster mesher is quicker: each slab costs a pass over the edges it cuts
+	vectorMaxSlabs = 100000
+	// Vertices of an opening closer than this many mm are merged: they would
+	// round to the same float32 in the mesh file, leaving faces with two
+	// corners in one place. It is above float32's spacing up to a metre.
+	vectorMerge = 1e-4
+)
+
+// vectorCluster is a group of polygons whose padded box doesn't overlap any
+// other group's.
+type vectorCluster struct {
+	polys [][]vec2
+	box   gerber.Bounds
+}
+
+func clusterPolygons(polys [][]vec2, gap float64) []vectorCluster {
+	clusters := make([]vectorCluster, len(polys))
+	for i, p := range polys {
+		b := gerber.PolyBounds(p)
+		clusters[i] = vectorCluster{
+			polys: [][]vec2{p},
+			box:   gerber.Bounds{MinX: b.MinX - gap, MinY: b.MinY - gap, MaxX: b.MaxX + gap, MaxY: b.MaxY + gap},
+		}
+	}
+
+	// Merging grows boxes, which can make them overlap others: repeat until
+	// nothing changes
+	for changed := true; changed; {
+		changed = false
+		sort.Slice(clusters, func(i, j int) bool { return clusters[i].box.MinX < clusters[j].box.MinX })
+		merged := make([]bool, len(clusters))
+		for i := range clusters {
+			if merged[i] {
+				continue
+			}
+			for j := i + 1; j < len(clusters) && clusters[j].box.MinX < clusters[i].box.MaxX; j++ {
+				if merged[j] || !clusters[i].box.Overlaps(clusters[j].box) {
+					continue
+				}
+				clusters[i].polys = append(clusters[i].polys, clusters[j].polys...)
+				clusters[i].box = clusters[i].box.Union(clusters[j].box)
+				merged[j] = true
+				changed = true
+			}
+		}
+		kept := clusters[:0]
+		for i, c := range clusters {
+			if !merged[i] {
+				kept = append(kept, c)
+			}
+		}
+		clusters = kept
+	}
+	return clusters
+}
+
+type sweepEdge struct {
+	x0, y0, x1, y1 float64 // y0 < y1
+	dir            int
+}
+
+func (e sweepEdge) xAt(y float64) float64 {
+	return e.x0 + (y-e.y0)/(e.y1-e.y0)*(e.x1-e.x0)
+}
+
+// sweepSpan is one covered interval of a slab, bounded by two edges: from
+// l0 to r0 at the bottom of the slab and l1 to r1 at the top.
+type sweepSpan struct {
+	l0, r0, l1, r1 float64
+}
+
+type sweepSlab struct {
+	y0, y1 float64
+	spans  []sweepSpan
+}
+
+// segmentIntersectY returns the Y of the crossing of two edges, if any.
+func segmentIntersectY(a, b sweepEdge) (float64, bool) {
+	dax, day := a.x1-a.x0, a.y1-a.y0
+	dbx, dby := b.x1-b.x0, b.y1-b.y0
+	den := dax*dby - day*dbx
+	if math.Abs(den) < gerber.Epsilon {
+		return 0, false
+	}
+	t := ((b.x0-a.x0)*dby - (b.y0-a.y0)*dbx) / den
+	u := ((b.x0-a.x0)*day - (b.y0-a.y0)*dax) / den
+	if t <= 0 || t >= 1 || u <= 0 || u >= 1 {
+		return 0, false
+	}
+	return a.y0 + t*day, true
+}
+
+// sweepUnion decomposes the union of counter-clockwise polygons into
+// horizontal slabs within [minY, maxY], cut at every vertex and crossing so
+// that no two edges cross inside a slab. It gives up, returning false, when
+// that takes more than maxSlabs slabs, unless maxSlabs is 0.
+func sweepUnion(polys [][]vec2, minY, maxY float64, maxSlabs int) ([]sweepSlab, bool) {
+	var edges []sweepEdge
+	ys := []float64{minY, maxY}
+	for _, poly := range polys {
+		for i := range poly {
+			a, b := poly[i], poly[(i+1)%len(poly)]
+			ys = append(ys, a.Y)
+			if a.Y == b.Y {
+				continue
+			}
+			dir := 1
+			if a.Y > b.Y {
+				a, b = b, a
+				dir = -1
+			}
+			edges = append(edges, sweepEdge{a.X, a.Y, b.X, b.Y, dir})
+		}
+	}
+	// Sorted by their lower ends, each edge only needs checking against the
+	// edges that start before it ends
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+	for i := range edges {
+		for j := i + 1; j < len(edges) && edges[j].y0 < edges[i].y1; j++ {
+			a, b := edges[i], edges[j]
+			if math.Max(a.x0, a.x1) < math.Min(b.x0, b.x1) || math.Max(b.x0, b.x1) < math.Min(a.x0, a.x1) {
+				continue
+			}
+			if y, ok := segmentIntersectY(a, b); ok {
+				ys = append(ys, y)
+			}
+		}
+	}
+
+	sort.Float64s(ys)
+	uniq := ys[:0]
+	for _, y := range ys {
+		if y < minY || y > maxY {
+			continue
+		}
+		if len(uniq) == 0 || y-uniq[len(uniq)-1] > gerber.Epsilon {
+			uniq = append(uniq, y)
+		}
+	}
+	ys = uniq
+	if maxSlabs > 0 && len(ys) > maxSlabs {
+		return nil, false
+	}
+
+	type crossing struct {
+		x0, x1, mid float64
+		dir         int
+	}
+	var slabs []sweepSlab
+	var active []sweepEdge
+	next := 0
+	for k := 0; k+1 < len(ys); k++ {
+		ya, yb := ys[k], ys[k+1]
+		for next < len(edges) && edges[next].y0 < yb-gerber.Epsilon {
+			active = append(active, edges[next])
+			next++
+		}
+		kept := active[:0]
+		var xs []crossing
+		for _, e := range active {
+			if e.y1 <= ya+gerber.Epsilon {
+				continue
+			}
+			kept = append(kept, e)
+			if e.y0 <= ya+gerber.Epsilon && e.y1 >= yb-gerber.Epsilon {
+				x0, x1 := e.xAt(ya), e.xAt(yb)
+				xs = append(xs, crossing{x0, x1, (x0 + x1) / 2, e.dir})
+			}
+		}
+		active = kept
+
+		sort.Slice(xs, func(i, j int) bool { return xs[i].mid < xs[j].mid })
+		slab := sweepSlab{y0: ya, y1: yb}
+		winding := 0
+		var start crossing
+		for _, c := range xs {
+			if winding == 0 {
+				start = c
+			}
+			winding += c.dir
+			if winding == 0 {
+				slab.spans = append(slab.spans, sweepSpan{start.x0, c.x0, start.x1, c.x1})
+			}
+		}
+		slabs = append(slabs, slab)
+	}
+	return slabs, true
+}
+
+// unionContours traces the boundary of the union of counter-clockwise
+// polygons: counter-clockwise outer contours and clockwise holes.
+func unionContours(polys [][]vec2) [][]vec2 {
+	contours, _ := unionContoursLimit(polys, 0)
+	return contours
+}
+
+// unionContoursLimit is unionContours, giving up when a group of polygons
+// takes more than maxSlabs slabs to sweep.
+func unionContoursLimit(polys [][]vec2, maxSlabs int) ([][]vec2, bool) {
+	var contours [][]vec2
+	for _, c := range clusterPolygons(polys, vectorClusterGap) {
+		slabs, ok := sweepUnion(c.polys, c.box.MinY, c.box.MaxY, maxSlabs)
+		if !ok {
+			return nil, false
+		}
+		contours = append(contours, traceSlabs(slabs)...)
+	}
+	return contours, true
+}
+
+// traceSlabs links the sides of every span and the horizontal steps where
+// coverage changes between slabs into closed loops, inside on the left.
+func traceSlabs(slabs []sweepSlab) [][]vec2 {
+	type seg struct{ a, b vec2 }
+	var segs []seg
+	add := func(a, b vec2) {
+		if math.Hypot(b.X-a.X, b.Y-a.Y) > gerber.Epsilon {
+			segs = append(segs, seg{a, b})
+		}
+	}
+	var below [][2]float64
+	for k := 0; k <= len(slabs); k++ {
+		var above [][2]float64
+		var y float64
+		if k < len(slabs) {
+			s := slabs[k]
+			y = s.y0
+			for _, sp := range s.spans {
+				above = append(above, [2]float64{sp.l0, sp.r0})
+				add(vec2{X: sp.r0, Y: s.y0}, vec2{X: sp.r1, Y: s.y1}) // Right side goes up
+				add(vec2{X: sp.l1, Y: s.y1}, vec2{X: sp.l0, Y: s.y0}) // Left side goes down
+			}
+		} else if k > 0 {
+			y = slabs[k-1].y1
+		}
+		for _, iv := range intervalDiff(above, below) {
+			add(vec2{X: iv[0], Y: y}, vec2{X: iv[1], Y: y}) // Bottom edge, inside above
+		}
+		for _, iv := range intervalDiff(below, above) {
+			add(vec2{X: iv[1], Y: y}, vec2{X: iv[0], Y: y}) // Top edge, inside below
+		}
+		below = nil
+		if k < len(slabs) {
+			for _, sp := range slabs[k].spans {
+				below = append(below, [2]float64{sp.l1, sp.r1})
+			}
+		}
+	}
+
+	// Endpoints computed from different edges meeting at a vertex can differ
+	// by rounding, so match them to within snap
+	const snap = 1e-6
+	key := func(p vec2) [2]int64 {
+		return [2]int64{int64(math.Round(p.X / snap)), int64(math.Round(p.Y / snap))}
+	}
+	near := func(p, q vec2) bool { return math.Abs(p.X-q.X) <= snap && math.Abs(p.Y-q.Y) <= snap }
+	starts := make(map[[2]int64][]int)
+	for i, sg := range segs {
+		k := key(sg.a)
+		starts[k] = append(starts[k], i)
+	}
+	used := make([]bool, len(segs))
+	next := func(p vec2) int {
+		k := key(p)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for _, i := range starts[[2]int64{k[0] + dx, k[1] + dy}] {
+					if !used[i] && near(segs[i].a, p) {
+						return i
+					}
+				}
+			}
+		}
+		return -1
+	}
+
+	var loops [][]vec2
+	for i := range segs {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		loop := []vec2{segs[i].a}
+		end := segs[i].b
+		for !near(end, loop[0]) {
+			j := next(end)
+			if j < 0 {
+				break
+			}
+			used[j] = true
+			loop = append(loop, segs[j].a)
+			end = segs[j].b
+		}
+		if loop = dropCollinear(loop); len(loop) >= 3 {
+			loops = append(loops, loop)
+		}
+	}
+	return loops
+}
+
+// dropCollinear removes the vertices of a closed polygon that continue
+// straight on from the previous one, like the cuts between slabs, or turn
+// straight back on it at the tip of a spike.
+func dropCollinear(pts []vec2) []vec2 {
+	for changed := true; changed && len(pts) >= 3; {
+		changed = false
+		var out []vec2
+		n := len(pts)
+		for i, b := range pts {
+			a, c := pts[(i+n-1)%n], pts[(i+1)%n]
+			if len(out) > 0 {
+				a = out[len(out)-1]
+			}
+			abx, aby := b.X-a.X, b.Y-a.Y
+			bcx, bcy := c.X-b.X, c.Y-b.Y
+			cross := abx*bcy - aby*bcx
+			if math.Abs(cross) <= 1e-9*math.Hypot(abx, aby)*math.Hypot(bcx, bcy) {
+				changed = true
+				continue
+			}
+			out = append(out, b)
+		}
+		pts = out
+	}
+	return pts
+}
+
+// mergeClose drops the vertices of a closed polygon within tol of the last
+// one kept, and the last ones within tol of the first.
+func mergeClose(pts []vec2, tol float64) []vec2 {
+	near := func(p, q vec2) bool { return math.Abs(p.X-q.X) <= tol && math.Abs(p.Y-q.Y) <= tol }
+	var out []vec2
+	for _, p := range pts {
+		if len(out) == 0 || !near(p, out[len(out)-1]) {
+			out = append(out, p)
+		}
+	}
+	for len(out) > 1 && near(out[len(out)-1], out[0]) {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+// intervalDiff returns the parts of the sorted, disjoint intervals a that
+// are not covered by b.
+func intervalDiff(a, b [][2]float64) [][2]float64 {
+	var out [][2]float64
+	for _, iv := range a {
+		lo := iv[0]
+		for _, o := range b {
+			if o[1] <= lo || o[0] >= iv[1] {
+				continue
+			}
+			if o[0] > lo {
+				out = append(out, [2]float64{lo, o[0]})
+			}
+			lo = math.Max(lo, o[1])
+		}
+		if iv[1]-lo > gerber.Epsilon {
+			out = append(out, [2]float64{lo, iv[1]})
+		}
+	}
+	return out
+}
+
+// rectangularOutline returns the outline's extent if it consists only of
+// straight draws along the sides of its bounding box.
+func rectangularOutline(gf *gerber.File) (gerber.Bounds, bool) {
+	type seg struct{ a, b vec2 }
+	var segs []seg
+	b := gerber.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	var curX, curY float64
+	mode := "G01"
+	for _, cmd := range gf.Commands {
+		switch cmd.Type {
+		case "G01", "G02", "G03":
+			mode = cmd.Type
+			continue
+		case "FLASH":
+			return b, false
+		}
+		prevX, prevY := curX, curY
+		if cmd.X != nil {
+			curX = *cmd.X
+		}
+		if cmd.Y != nil {
+			curY = *cmd.Y
+		}
+		if cmd.Type == "DRAW" {
+			if mode != "G01" {
+				return b, false
+			}
+			s := seg{vec2{X: prevX, Y: prevY}, vec2{X: curX, Y: curY}}
+			segs = append(segs, s)
+			b = b.Union(gerber.PolyBounds([]vec2{s.a, s.b}))
+		}
+	}
+	if len(segs) == 0 {
+		return b, false
+	}
+
+	const tol = 0.01 // mm
+	near := func(v, w float64) bool { return math.Abs(v-w) < tol }
+	for _, s := range segs {
+		onSide := (near(s.a.X, b.MinX) && near(s.b.X, b.MinX)) ||
+			(near(s.a.X, b.MaxX) && near(s.b.X, b.MaxX)) ||
+			(near(s.a.Y, b.MinY) && near(s.b.Y, b.MinY)) ||
+			(near(s.a.Y, b.MaxY) && near(s.b.Y, b.MaxY))
+		if !onSide {
+			return b, false
+		}
+	}
+	return b, true
+}
+
+// generateVectorMesh extrudes the stencil plate with the file's openings cut
+// out. The plate covers frame, or board when an outline was given, in which
+// case a wall of cfg.WallThickness surrounds it cfg.Clearance away. The result is placed in the
+// same coordinates as the raster mesher's for frame. It returns nil when an
+// opening crosses the board's edge, which only the raster path can clip, or
+// the openings overlap too densely to merge in reasonable time.
+func generateVectorMesh(gf *gerber.File, frame gerber.Bounds, board *gerber.Bounds, cfg Config) ([][3]Point, openingStats) {
+	plate := frame
+	if board != nil {
+		c := cfg.Clearance
+		plate = gerber.Bounds{MinX: board.MinX - c, MinY: board.MinY - c, MaxX: board.MaxX + c, MaxY: board.MaxY + c}
+	}
+
+	// Openings in units of vectorUnit from the frame's top left, like the
+	// raster mesher's pixels. Flipping Y turns them clockwise, into holes.
+	toUnits := func(p vec2) vec2 {
+		return vec2{X: (p.X - frame.MinX) / vectorUnit, Y: (frame.MaxY - p.Y) / vectorUnit}
+	}
+	polys := gf.VectorPolygons()
+	if cfg.RegHoles.Diameter > 0 {
+		holes := cfg.RegHoles.polygons(frame)
+		fmt.Fprintf(cfg.Stdout, "Registration holes: %d of %v\n", len(holes), cfg.RegHoles)
+		polys = append(polys, holes...)
+	}
+	if len(cfg.pins) > 0 {
+		fmt.Fprintf(cfg.Stdout, "Alignment pin holes: %d\n", len(cfg.pins))
+		polys = append(polys, pinPolygons(cfg.pins, 0)...)
+	}
+	union, ok := unionContoursLimit(polys, vectorMaxSlabs)
+	if !ok {
+		fmt.Fprintln(cfg.Stdout, "Openings overlap too much to merge as polygons, using the raster mesher")
+		return nil, openingStats{}
+	}
+	var openings [][]vec2
+	for _, c := range union {
+		b := gerber.PolyBounds(c)
+		if b.MinX >= plate.MaxX || b.MaxX <= plate.MinX || b.MinY >= plate.MaxY || b.MaxY <= plate.MinY {
+			continue // Entirely off the board
+		}
+		if b.MinX < plate.MinX || b.MaxX > plate.MaxX || b.MinY < plate.MinY || b.MaxY > plate.MaxY {
+			fmt.Fprintln(cfg.Stdout, "Openings cross the board outline, using the raster mesher")
+			return nil, openingStats{}
+		}
+		l := make([]vec2, len(c))
+		for i, p := range c {
+			l[i] = toUnits(p)
+		}
+		if l = dropCollinear(mergeClose(l, vectorMerge/vectorUnit)); len(l) >= 3 && gerber.SignedArea(l) != 0 {
+			openings = append(openings, l)
+		}
+	}
+
+	// Rectangles turning counter-clockwise in units, with solid inside
+	rect := func(b gerber.Bounds) []vec2 {
+		lo, hi := toUnits(vec2{X: b.MinX, Y: b.MaxY}), toUnits(vec2{X: b.MaxX, Y: b.MinY})
+		return []vec2{lo, {X: hi.X, Y: lo.Y}, hi, {X: lo.X, Y: hi.Y}}
+	}
+	reversed := func(pts []vec2) []vec2 {
+		out := slices.Clone(pts)
+		slices.Reverse(out)
+		return out
+	}
+	width := int(math.Ceil((frame.MaxX - frame.MinX) / vectorUnit))
+	height := int(math.Ceil((frame.MaxY - frame.MinY) / vectorUnit))
+
+	// Layers from the bottom up, the same as heightLevels would find: the
+	// plate and wall together up to the lower of their heights, then
+	// whichever is taller on its own
+	type layer struct {
+		loops  [][]vec2
+		z0, z1 float64
+	}
+	plateLoops := append([][]vec2{rect(plate)}, openings...)
+	layers := []layer{{plateLoops, 0, cfg.StencilHeight}}
+	if board != nil {
+		t := cfg.WallThickness
+		outer := rect(gerber.Bounds{MinX: plate.MinX - t, MinY: plate.MinY - t, MaxX: plate.MaxX + t, MaxY: plate.MaxY + t})
+		wall := [][]vec2{outer, reversed(rect(plate))}
+		if cfg.Locators > 0 {
+			// Solid in the gerber's coordinates turns clockwise in units
+			units := func(pts []vec2) []vec2 {
+				out := make([]vec2, len(pts))
+				for i, p := range pts {
+					out[i] = toUnits(p)
+				}
+				return reversed(out)
+			}
+			outer = units(locatedPlate(plate, t, cfg.Locators))
+			wall = nil
+			for _, l := range cornerLocators(plate, t, cfg.Locators) {
+				wall = append(wall, units(l))
+			}
+		}
+		low := math.Min(cfg.StencilHeight, cfg.WallHeight)
+		layers = []layer{{append([][]vec2{outer}, openings...), 0, low}}
+		switch {
+		case cfg.WallHeight > cfg.StencilHeight:
+			layers = append(layers, layer{wall, low, cfg.WallHeight})
+		case cfg.WallHeight < cfg.StencilHeight:
+			layers = append(layers, layer{plateLoops, low, cfg.StencilHeight})
+		}
+	}
+
+	profile := openingProfile(cfg, layers[0].z1-layers[0].z0)
+	if profile != nil {
+		fmt.Fprintf(cfg.Stdout, "Shaping aperture walls, %.1f µm wider on the squeegee side\n", profile[0].d*1000)
+	}
+	var triangles [][3]Point
+	for k, l := range layers {
+		steps := []wallStep{{0, 0}, {l.z1 - l.z0, 0}}
+		if k == 0 && profile != nil {
+			steps = profile
+		}
+		triangles = extrudeLoops(triangles, l.loops, steps, l.z0, width, height, vectorUnit)
+	}
+	fmt.Fprintf(cfg.Stdout, "Vector mesh: %d shapes, %d openings\n", len(polys), len(openings))
+
+	// Openings run clockwise and islands in them counter-clockwise
+	var stats openingStats
+	for _, l := range openings {
+		a := gerber.SignedArea(l)
+		if a < 0 {
+			stats.count++
+		}
+		stats.area -= a * vectorUnit * vectorUnit
+	}
+	return triangles, stats
+}
@@ -0,0 +1,50 @@
+package stencil
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"pcb-to-stencil/pkg/gerber"
+	"pcb-to-stencil/pkg/mesh"
+)
+
+// testConfig returns the CLI's settings, with the messages thrown away.
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Stdout, cfg.Log = io.Discard, log.New(io.Discard, "", 0)
+	return cfg
+}
+
+// checkVectorMesh meshes the paste layer at path with the vector mesher,
+// the default for gerbers, and fails on anything mesh.Check finds.
+func checkVectorMesh(t *testing.T, path string) {
+	t.Helper()
+	gf, err := gerber.Parse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tris, _, err := vectorGerberMesh(gf, "", "", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tris) == 0 {
+		t.Fatal("no triangles")
+	}
+	if issues := mesh.Check(tris, nil); len(issues) != 0 {
+		t.Errorf("mesh has %q", issues)
+	}
+}
+
+func TestVectorMeshClean(t *testing.T) {
+	files, err := filepath.Glob("../gerber/testdata/*.g[bkt]?")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			checkVectorMesh(t, path)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package stencil
+
+import (
+	"image"
+	"math"
+
+	"pcb-to-stencil/pkg/render"
+)
+
+// WindowPanes splits every opening of a rendered stencil larger than maxArea
+// mm² into a grid of windows with webs web mm wide between them, each about
+// square and no larger than maxArea. A large pad such as a QFN's thermal pad
+// takes too much paste through one opening, and the part floats on it; the
+// webs also hold the plate up over the middle of the pad so it doesn't sag
+// into the opening. It returns the image and how many openings were split.
+func WindowPanes(img image.Image, maxArea, web, pixelToMM float64) (*render.Bitmap, int) {
+	b := openingBitmap(img)
+	out := &render.Bitmap{Width: b.Width, Height: b.Height, Stride: b.Stride, Bits: append([]uint64(nil), b.Bits...)}
+	pane := math.Sqrt(maxArea) / pixelToMM // Largest side of a window, pixels
+	half := math.Max(web/pixelToMM/2, 0.5)
+	openings, boxes := findOpenings(b)
+	split := 0
+	for i, runs := range openings {
+		area := 0
+		for _, r := range runs {
+			area += r.x1 - r.x0
+		}
+		if float64(area)*pixelToMM*pixelToMM <= maxArea {
+			continue
+		}
+		box := boxes[i]
+		cols := int(math.Ceil(float64(box.Dx()) / pane))
+		rows := int(math.Ceil(float64(box.Dy()) / pane))
+		if cols*rows < 2 {
+			continue
+		}
+		// Pixels whose centers are within half a web of a dividing line
+		onWeb := func(v, lo, size, n int) bool {
+			for k := 1; k < n; k++ {
+				at := float64(lo) + float64(k*size)/float64(n)
+				if math.Abs(float64(v)+0.5-at) < half {
+					return true
+				}
+			}
+			return false
+		}
+		for _, r := range runs {
+			rowWeb := onWeb(r.y, box.Min.Y, box.Dy(), rows)
+			for x := r.x0; x < r.x1; x++ {
+				if rowWeb || onWeb(x, box.Min.X, box.Dx(), cols) {
+					out.Bits[r.y*out.Stride+x/64] &^= 1 << uint(x%64)
+				}
+			}
+		}
+		split++
+	}
+	return out, split
+}
@@ -0,0 +1,5 @@
+// Package stencilpb is the gRPC service of proto/stencil/v1/stencil.proto,
+// generated by protoc-gen-go and protoc-gen-go-grpc.
+package stencilpb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=pcb-to-stencil --go-grpc_out=../.. --go-grpc_opt=module=pcb-to-stencil stencil/v1/stencil.proto
@@ -0,0 +1,1095 @@
+// Service for running pcb-to-stencil from factory systems (MES) over gRPC,
+// served beside the REST endpoints by serve -grpc-port. The messages mirror
+// the REST API and the CLI: ConvertOptions is the options JSON of
+// POST /convert, Result is the -json summary, and ValidationReport is what
+// the validate subcommand prints. pkg/stencilpb is generated from it.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: stencil/v1/stencil.proto
+
+package stencilpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InputFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // The extension picks how it's read: .gbr, .zip, .svg, ...
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InputFile) Reset() {
+	*x = InputFile{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InputFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InputFile) ProtoMessage() {}
+
+func (x *InputFile) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InputFile.ProtoReflect.Descriptor instead.
+func (*InputFile) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InputFile) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *InputFile) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ConvertOptions struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        *float64               `protobuf:"fixed64,1,opt,name=height,proto3,oneof" json:"height,omitempty"` // mm; unset for the default
+	WallHeight    *float64               `protobuf:"fixed64,2,opt,name=wall_height,json=wallHeight,proto3,oneof" json:"wall_height,omitempty"`
+	WallThickness *float64               `protobuf:"fixed64,3,opt,name=wall_thickness,json=wallThickness,proto3,oneof" json:"wall_thickness,omitempty"`
+	Dpi           *float64               `protobuf:"fixed64,4,opt,name=dpi,proto3,oneof" json:"dpi,omitempty"`
+	Shrink        string                 `protobuf:"bytes,5,opt,name=shrink,proto3" json:"shrink,omitempty"` // As -shrink takes it, such as 0.05 or 5%
+	Mirror        string                 `protobuf:"bytes,6,opt,name=mirror,proto3" json:"mirror,omitempty"` // x or y
+	Format        string                 `protobuf:"bytes,7,opt,name=format,proto3" json:"format,omitempty"` // stl or 3mf
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertOptions) Reset() {
+	*x = ConvertOptions{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertOptions) ProtoMessage() {}
+
+func (x *ConvertOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertOptions.ProtoReflect.Descriptor instead.
+func (*ConvertOptions) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ConvertOptions) GetHeight() float64 {
+	if x != nil && x.Height != nil {
+		return *x.Height
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetWallHeight() float64 {
+	if x != nil && x.WallHeight != nil {
+		return *x.WallHeight
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetWallThickness() float64 {
+	if x != nil && x.WallThickness != nil {
+		return *x.WallThickness
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetDpi() float64 {
+	if x != nil && x.Dpi != nil {
+		return *x.Dpi
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetShrink() string {
+	if x != nil {
+		return x.Shrink
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetMirror() string {
+	if x != nil {
+		return x.Mirror
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type ConvertRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Gerber        *InputFile             `protobuf:"bytes,1,opt,name=gerber,proto3" json:"gerber,omitempty"` // Paste layer or zip archive
+	Outline       *InputFile             `protobuf:"bytes,2,opt,name=outline,proto3" json:"outline,omitempty"`
+	Drill         *InputFile             `protobuf:"bytes,3,opt,name=drill,proto3" json:"drill,omitempty"`
+	Options       *ConvertOptions        `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertRequest) Reset() {
+	*x = ConvertRequest{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertRequest) ProtoMessage() {}
+
+func (x *ConvertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertRequest.ProtoReflect.Descriptor instead.
+func (*ConvertRequest) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ConvertRequest) GetGerber() *InputFile {
+	if x != nil {
+		return x.Gerber
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetOutline() *InputFile {
+	if x != nil {
+		return x.Outline
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetDrill() *InputFile {
+	if x != nil {
+		return x.Drill
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetOptions() *ConvertOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stage         string                 `protobuf:"bytes,1,opt,name=stage,proto3" json:"stage,omitempty"`
+	Done          int64                  `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+	Total         int64                  `protobuf:"varint,3,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Progress) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *Progress) GetDone() int64 {
+	if x != nil {
+		return x.Done
+	}
+	return 0
+}
+
+func (x *Progress) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type FileChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileChunk) Reset() {
+	*x = FileChunk{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileChunk) ProtoMessage() {}
+
+func (x *FileChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FileChunk) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileChunk) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ConvertEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*ConvertEvent_Progress
+	//	*ConvertEvent_Warning
+	//	*ConvertEvent_Mesh
+	//	*ConvertEvent_Result
+	Event         isConvertEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertEvent) Reset() {
+	*x = ConvertEvent{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertEvent) ProtoMessage() {}
+
+func (x *ConvertEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertEvent.ProtoReflect.Descriptor instead.
+func (*ConvertEvent) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ConvertEvent) GetEvent() isConvertEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *ConvertEvent) GetProgress() *Progress {
+	if x != nil {
+		if x, ok := x.Event.(*ConvertEvent_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *ConvertEvent) GetWarning() string {
+	if x != nil {
+		if x, ok := x.Event.(*ConvertEvent_Warning); ok {
+			return x.Warning
+		}
+	}
+	return ""
+}
+
+func (x *ConvertEvent) GetMesh() *FileChunk {
+	if x != nil {
+		if x, ok := x.Event.(*ConvertEvent_Mesh); ok {
+			return x.Mesh
+		}
+	}
+	return nil
+}
+
+func (x *ConvertEvent) GetResult() *Result {
+	if x != nil {
+		if x, ok := x.Event.(*ConvertEvent_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isConvertEvent_Event interface {
+	isConvertEvent_Event()
+}
+
+type ConvertEvent_Progress struct {
+	Progress *Progress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type ConvertEvent_Warning struct {
+	Warning string `protobuf:"bytes,2,opt,name=warning,proto3,oneof"`
+}
+
+type ConvertEvent_Mesh struct {
+	Mesh *FileChunk `protobuf:"bytes,3,opt,name=mesh,proto3,oneof"`
+}
+
+type ConvertEvent_Result struct {
+	Result *Result `protobuf:"bytes,4,opt,name=result,proto3,oneof"` // Always last
+}
+
+func (*ConvertEvent_Progress) isConvertEvent_Event() {}
+
+func (*ConvertEvent_Warning) isConvertEvent_Event() {}
+
+func (*ConvertEvent_Mesh) isConvertEvent_Event() {}
+
+func (*ConvertEvent_Result) isConvertEvent_Event() {}
+
+type Durations struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RenderS       float64                `protobuf:"fixed64,1,opt,name=render_s,json=renderS,proto3" json:"render_s,omitempty"`
+	MeshS         float64                `protobuf:"fixed64,2,opt,name=mesh_s,json=meshS,proto3" json:"mesh_s,omitempty"`
+	WriteS        float64                `protobuf:"fixed64,3,opt,name=write_s,json=writeS,proto3" json:"write_s,omitempty"`
+	TotalS        float64                `protobuf:"fixed64,4,opt,name=total_s,json=totalS,proto3" json:"total_s,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Durations) Reset() {
+	*x = Durations{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Durations) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Durations) ProtoMessage() {}
+
+func (x *Durations) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Durations.ProtoReflect.Descriptor instead.
+func (*Durations) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Durations) GetRenderS() float64 {
+	if x != nil {
+		return x.RenderS
+	}
+	return 0
+}
+
+func (x *Durations) GetMeshS() float64 {
+	if x != nil {
+		return x.MeshS
+	}
+	return 0
+}
+
+func (x *Durations) GetWriteS() float64 {
+	if x != nil {
+		return x.WriteS
+	}
+	return 0
+}
+
+func (x *Durations) GetTotalS() float64 {
+	if x != nil {
+		return x.TotalS
+	}
+	return 0
+}
+
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // For Report and GET /preview
+	Input         string                 `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`
+	Output        string                 `protobuf:"bytes,3,opt,name=output,proto3" json:"output,omitempty"`
+	Outputs       []string               `protobuf:"bytes,4,rep,name=outputs,proto3" json:"outputs,omitempty"`
+	BboxMinMm     []float64              `protobuf:"fixed64,5,rep,packed,name=bbox_min_mm,json=bboxMinMm,proto3" json:"bbox_min_mm,omitempty"`
+	BboxMaxMm     []float64              `protobuf:"fixed64,6,rep,packed,name=bbox_max_mm,json=bboxMaxMm,proto3" json:"bbox_max_mm,omitempty"`
+	Apertures     int32                  `protobuf:"varint,7,opt,name=apertures,proto3" json:"apertures,omitempty"`
+	Triangles     int32                  `protobuf:"varint,8,opt,name=triangles,proto3" json:"triangles,omitempty"`
+	Warnings      []string               `protobuf:"bytes,9,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	Durations     *Durations             `protobuf:"bytes,10,opt,name=durations,proto3" json:"durations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Result) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Result) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *Result) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *Result) GetOutputs() []string {
+	if x != nil {
+		return x.Outputs
+	}
+	return nil
+}
+
+func (x *Result) GetBboxMinMm() []float64 {
+	if x != nil {
+		return x.BboxMinMm
+	}
+	return nil
+}
+
+func (x *Result) GetBboxMaxMm() []float64 {
+	if x != nil {
+		return x.BboxMaxMm
+	}
+	return nil
+}
+
+func (x *Result) GetApertures() int32 {
+	if x != nil {
+		return x.Apertures
+	}
+	return 0
+}
+
+func (x *Result) GetTriangles() int32 {
+	if x != nil {
+		return x.Triangles
+	}
+	return 0
+}
+
+func (x *Result) GetWarnings() []string {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+func (x *Result) GetDurations() *Durations {
+	if x != nil {
+		return x.Durations
+	}
+	return nil
+}
+
+type ValidateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Gerbers       []*InputFile           `protobuf:"bytes,1,rep,name=gerbers,proto3" json:"gerbers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateRequest) Reset() {
+	*x = ValidateRequest{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateRequest) ProtoMessage() {}
+
+func (x *ValidateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateRequest.ProtoReflect.Descriptor instead.
+func (*ValidateRequest) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ValidateRequest) GetGerbers() []*InputFile {
+	if x != nil {
+		return x.Gerbers
+	}
+	return nil
+}
+
+type ApertureUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DCode         int32                  `protobuf:"varint,1,opt,name=d_code,json=dCode,proto3" json:"d_code,omitempty"`
+	Shape         string                 `protobuf:"bytes,2,opt,name=shape,proto3" json:"shape,omitempty"` // The aperture's type: C, R, O, P or a macro name
+	Flashes       int32                  `protobuf:"varint,3,opt,name=flashes,proto3" json:"flashes,omitempty"`
+	Draws         int32                  `protobuf:"varint,4,opt,name=draws,proto3" json:"draws,omitempty"`
+	Undefined     bool                   `protobuf:"varint,5,opt,name=undefined,proto3" json:"undefined,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApertureUsage) Reset() {
+	*x = ApertureUsage{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApertureUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApertureUsage) ProtoMessage() {}
+
+func (x *ApertureUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApertureUsage.ProtoReflect.Descriptor instead.
+func (*ApertureUsage) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ApertureUsage) GetDCode() int32 {
+	if x != nil {
+		return x.DCode
+	}
+	return 0
+}
+
+func (x *ApertureUsage) GetShape() string {
+	if x != nil {
+		return x.Shape
+	}
+	return ""
+}
+
+func (x *ApertureUsage) GetFlashes() int32 {
+	if x != nil {
+		return x.Flashes
+	}
+	return 0
+}
+
+func (x *ApertureUsage) GetDraws() int32 {
+	if x != nil {
+		return x.Draws
+	}
+	return 0
+}
+
+func (x *ApertureUsage) GetUndefined() bool {
+	if x != nil {
+		return x.Undefined
+	}
+	return false
+}
+
+type ValidationReport struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Units         string                 `protobuf:"bytes,2,opt,name=units,proto3" json:"units,omitempty"`
+	Apertures     []*ApertureUsage       `protobuf:"bytes,3,rep,name=apertures,proto3" json:"apertures,omitempty"`
+	Draws         int32                  `protobuf:"varint,4,opt,name=draws,proto3" json:"draws,omitempty"`
+	Arcs          int32                  `protobuf:"varint,5,opt,name=arcs,proto3" json:"arcs,omitempty"`
+	Flashes       int32                  `protobuf:"varint,6,opt,name=flashes,proto3" json:"flashes,omitempty"`
+	Regions       int32                  `protobuf:"varint,7,opt,name=regions,proto3" json:"regions,omitempty"`
+	Issues        []string               `protobuf:"bytes,8,rep,name=issues,proto3" json:"issues,omitempty"`
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"` // Why the file couldn't be parsed, with nothing else set
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidationReport) Reset() {
+	*x = ValidationReport{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidationReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidationReport) ProtoMessage() {}
+
+func (x *ValidationReport) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidationReport.ProtoReflect.Descriptor instead.
+func (*ValidationReport) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ValidationReport) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *ValidationReport) GetUnits() string {
+	if x != nil {
+		return x.Units
+	}
+	return ""
+}
+
+func (x *ValidationReport) GetApertures() []*ApertureUsage {
+	if x != nil {
+		return x.Apertures
+	}
+	return nil
+}
+
+func (x *ValidationReport) GetDraws() int32 {
+	if x != nil {
+		return x.Draws
+	}
+	return 0
+}
+
+func (x *ValidationReport) GetArcs() int32 {
+	if x != nil {
+		return x.Arcs
+	}
+	return 0
+}
+
+func (x *ValidationReport) GetFlashes() int32 {
+	if x != nil {
+		return x.Flashes
+	}
+	return 0
+}
+
+func (x *ValidationReport) GetRegions() int32 {
+	if x != nil {
+		return x.Regions
+	}
+	return 0
+}
+
+func (x *ValidationReport) GetIssues() []string {
+	if x != nil {
+		return x.Issues
+	}
+	return nil
+}
+
+func (x *ValidationReport) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportRequest) Reset() {
+	*x = ReportRequest{}
+	mi := &file_stencil_v1_stencil_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportRequest) ProtoMessage() {}
+
+func (x *ReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_stencil_v1_stencil_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportRequest.ProtoReflect.Descriptor instead.
+func (*ReportRequest) Descriptor() ([]byte, []int) {
+	return file_stencil_v1_stencil_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ReportRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+var File_stencil_v1_stencil_proto protoreflect.FileDescriptor
+
+const file_stencil_v1_stencil_proto_rawDesc = "" +
+	"\n" +
+	"\x18stencil/v1/stencil.proto\x12\n" +
+	"stencil.v1\"3\n" +
+	"\tInputFile\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"\x94\x02\n" +
+	"\x0eConvertOptions\x12\x1b\n" +
+	"\x06height\x18\x01 \x01(\x01H\x00R\x06height\x88\x01\x01\x12$\n" +
+	"\vwall_height\x18\x02 \x01(\x01H\x01R\n" +
+	"wallHeight\x88\x01\x01\x12*\n" +
+	"\x0ewall_thickness\x18\x03 \x01(\x01H\x02R\rwallThickness\x88\x01\x01\x12\x15\n" +
+	"\x03dpi\x18\x04 \x01(\x01H\x03R\x03dpi\x88\x01\x01\x12\x16\n" +
+	"\x06shrink\x18\x05 \x01(\tR\x06shrink\x12\x16\n" +
+	"\x06mirror\x18\x06 \x01(\tR\x06mirror\x12\x16\n" +
+	"\x06format\x18\a \x01(\tR\x06formatB\t\n" +
+	"\a_heightB\x0e\n" +
+	"\f_wall_heightB\x11\n" +
+	"\x0f_wall_thicknessB\x06\n" +
+	"\x04_dpi\"\xd3\x01\n" +
+	"\x0eConvertRequest\x12-\n" +
+	"\x06gerber\x18\x01 \x01(\v2\x15.stencil.v1.InputFileR\x06gerber\x12/\n" +
+	"\aoutline\x18\x02 \x01(\v2\x15.stencil.v1.InputFileR\aoutline\x12+\n" +
+	"\x05drill\x18\x03 \x01(\v2\x15.stencil.v1.InputFileR\x05drill\x124\n" +
+	"\aoptions\x18\x04 \x01(\v2\x1a.stencil.v1.ConvertOptionsR\aoptions\"J\n" +
+	"\bProgress\x12\x14\n" +
+	"\x05stage\x18\x01 \x01(\tR\x05stage\x12\x12\n" +
+	"\x04done\x18\x02 \x01(\x03R\x04done\x12\x14\n" +
+	"\x05total\x18\x03 \x01(\x03R\x05total\"K\n" +
+	"\tFileChunk\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"\xc2\x01\n" +
+	"\fConvertEvent\x122\n" +
+	"\bprogress\x18\x01 \x01(\v2\x14.stencil.v1.ProgressH\x00R\bprogress\x12\x1a\n" +
+	"\awarning\x18\x02 \x01(\tH\x00R\awarning\x12+\n" +
+	"\x04mesh\x18\x03 \x01(\v2\x15.stencil.v1.FileChunkH\x00R\x04mesh\x12,\n" +
+	"\x06result\x18\x04 \x01(\v2\x12.stencil.v1.ResultH\x00R\x06resultB\a\n" +
+	"\x05event\"o\n" +
+	"\tDurations\x12\x19\n" +
+	"\brender_s\x18\x01 \x01(\x01R\arenderS\x12\x15\n" +
+	"\x06mesh_s\x18\x02 \x01(\x01R\x05meshS\x12\x17\n" +
+	"\awrite_s\x18\x03 \x01(\x01R\x06writeS\x12\x17\n" +
+	"\atotal_s\x18\x04 \x01(\x01R\x06totalS\"\xad\x02\n" +
+	"\x06Result\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05input\x18\x02 \x01(\tR\x05input\x12\x16\n" +
+	"\x06output\x18\x03 \x01(\tR\x06output\x12\x18\n" +
+	"\aoutputs\x18\x04 \x03(\tR\aoutputs\x12\x1e\n" +
+	"\vbbox_min_mm\x18\x05 \x03(\x01R\tbboxMinMm\x12\x1e\n" +
+	"\vbbox_max_mm\x18\x06 \x03(\x01R\tbboxMaxMm\x12\x1c\n" +
+	"\tapertures\x18\a \x01(\x05R\tapertures\x12\x1c\n" +
+	"\ttriangles\x18\b \x01(\x05R\ttriangles\x12\x1a\n" +
+	"\bwarnings\x18\t \x03(\tR\bwarnings\x123\n" +
+	"\tdurations\x18\n" +
+	" \x01(\v2\x15.stencil.v1.DurationsR\tdurations\"B\n" +
+	"\x0fValidateRequest\x12/\n" +
+	"\agerbers\x18\x01 \x03(\v2\x15.stencil.v1.InputFileR\agerbers\"\x8a\x01\n" +
+	"\rApertureUsage\x12\x15\n" +
+	"\x06d_code\x18\x01 \x01(\x05R\x05dCode\x12\x14\n" +
+	"\x05shape\x18\x02 \x01(\tR\x05shape\x12\x18\n" +
+	"\aflashes\x18\x03 \x01(\x05R\aflashes\x12\x14\n" +
+	"\x05draws\x18\x04 \x01(\x05R\x05draws\x12\x1c\n" +
+	"\tundefined\x18\x05 \x01(\bR\tundefined\"\x81\x02\n" +
+	"\x10ValidationReport\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x14\n" +
+	"\x05units\x18\x02 \x01(\tR\x05units\x127\n" +
+	"\tapertures\x18\x03 \x03(\v2\x19.stencil.v1.ApertureUsageR\tapertures\x12\x14\n" +
+	"\x05draws\x18\x04 \x01(\x05R\x05draws\x12\x12\n" +
+	"\x04arcs\x18\x05 \x01(\x05R\x04arcs\x12\x18\n" +
+	"\aflashes\x18\x06 \x01(\x05R\aflashes\x12\x18\n" +
+	"\aregions\x18\a \x01(\x05R\aregions\x12\x16\n" +
+	"\x06issues\x18\b \x03(\tR\x06issues\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\"\x1f\n" +
+	"\rReportRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id2\xce\x01\n" +
+	"\aStencil\x12A\n" +
+	"\aConvert\x12\x1a.stencil.v1.ConvertRequest\x1a\x18.stencil.v1.ConvertEvent0\x01\x12G\n" +
+	"\bValidate\x12\x1b.stencil.v1.ValidateRequest\x1a\x1c.stencil.v1.ValidationReport0\x01\x127\n" +
+	"\x06Report\x12\x19.stencil.v1.ReportRequest\x1a\x12.stencil.v1.ResultB(Z&pcb-to-stencil/pkg/stencilpb;stencilpbb\x06proto3"
+
+var (
+	file_stencil_v1_stencil_proto_rawDescOnce sync.Once
+	file_stencil_v1_stencil_proto_rawDescData []byte
+)
+
+func file_stencil_v1_stencil_proto_rawDescGZIP() []byte {
+	file_stencil_v1_stencil_proto_rawDescOnce.Do(func() {
+		file_stencil_v1_stencil_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_stencil_v1_stencil_proto_rawDesc), len(file_stencil_v1_stencil_proto_rawDesc)))
+	})
+	return file_stencil_v1_stencil_proto_rawDescData
+}
+
+var file_stencil_v1_stencil_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_stencil_v1_stencil_proto_goTypes = []any{
+	(*InputFile)(nil),        // 0: stencil.v1.InputFile
+	(*ConvertOptions)(nil),   // 1: stencil.v1.ConvertOptions
+	(*ConvertRequest)(nil),   // 2: stencil.v1.ConvertRequest
+	(*Progress)(nil),         // 3: stencil.v1.Progress
+	(*FileChunk)(nil),        // 4: stencil.v1.FileChunk
+	(*ConvertEvent)(nil),     // 5: stencil.v1.ConvertEvent
+	(*Durations)(nil),        // 6: stencil.v1.Durations
+	(*Result)(nil),           // 7: stencil.v1.Result
+	(*ValidateRequest)(nil),  // 8: stencil.v1.ValidateRequest
+	(*ApertureUsage)(nil),    // 9: stencil.v1.ApertureUsage
+	(*ValidationReport)(nil), // 10: stencil.v1.ValidationReport
+	(*ReportRequest)(nil),    // 11: stencil.v1.ReportRequest
+}
+var file_stencil_v1_stencil_proto_depIdxs = []int32{
+	0,  // 0: stencil.v1.ConvertRequest.gerber:type_name -> stencil.v1.InputFile
+	0,  // 1: stencil.v1.ConvertRequest.outline:type_name -> stencil.v1.InputFile
+	0,  // 2: stencil.v1.ConvertRequest.drill:type_name -> stencil.v1.InputFile
+	1,  // 3: stencil.v1.ConvertRequest.options:type_name -> stencil.v1.ConvertOptions
+	3,  // 4: stencil.v1.ConvertEvent.progress:type_name -> stencil.v1.Progress
+	4,  // 5: stencil.v1.ConvertEvent.mesh:type_name -> stencil.v1.FileChunk
+	7,  // 6: stencil.v1.ConvertEvent.result:type_name -> stencil.v1.Result
+	6,  // 7: stencil.v1.Result.durations:type_name -> stencil.v1.Durations
+	0,  // 8: stencil.v1.ValidateRequest.gerbers:type_name -> stencil.v1.InputFile
+	9,  // 9: stencil.v1.ValidationReport.apertures:type_name -> stencil.v1.ApertureUsage
+	2,  // 10: stencil.v1.Stencil.Convert:input_type -> stencil.v1.ConvertRequest
+	8,  // 11: stencil.v1.Stencil.Validate:input_type -> stencil.v1.ValidateRequest
+	11, // 12: stencil.v1.Stencil.Report:input_type -> stencil.v1.ReportRequest
+	5,  // 13: stencil.v1.Stencil.Convert:output_type -> stencil.v1.ConvertEvent
+	10, // 14: stencil.v1.Stencil.Validate:output_type -> stencil.v1.ValidationReport
+	7,  // 15: stencil.v1.Stencil.Report:output_type -> stencil.v1.Result
+	13, // [13:16] is the sub-list for method output_type
+	10, // [10:13] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_stencil_v1_stencil_proto_init() }
+func file_stencil_v1_stencil_proto_init() {
+	if File_stencil_v1_stencil_proto != nil {
+		return
+	}
+	file_stencil_v1_stencil_proto_msgTypes[1].OneofWrappers = []any{}
+	file_stencil_v1_stencil_proto_msgTypes[5].OneofWrappers = []any{
+		(*ConvertEvent_Progress)(nil),
+		(*ConvertEvent_Warning)(nil),
+		(*ConvertEvent_Mesh)(nil),
+		(*ConvertEvent_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_stencil_v1_stencil_proto_rawDesc), len(file_stencil_v1_stencil_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_stencil_v1_stencil_proto_goTypes,
+		DependencyIndexes: file_stencil_v1_stencil_proto_depIdxs,
+		MessageInfos:      file_stencil_v1_stencil_proto_msgTypes,
+	}.Build()
+	File_stencil_v1_stencil_proto = out.File
+	file_stencil_v1_stencil_proto_goTypes = nil
+	file_stencil_v1_stencil_proto_depIdxs = nil
+}
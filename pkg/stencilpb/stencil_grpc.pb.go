@@ -0,0 +1,222 @@
+// Service for running pcb-to-stencil from factory systems (MES) over gRPC,
+// served beside the REST endpoints by serve -grpc-port. The messages mirror
+// the REST API and the CLI: ConvertOptions is the options JSON of
+// POST /convert, Result is the -json summary, and ValidationReport is what
+// the validate subcommand prints. pkg/stencilpb is generated from it.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: stencil/v1/stencil.proto
+
+package stencilpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Stencil_Convert_FullMethodName  = "/stencil.v1.Stencil/Convert"
+	Stencil_Validate_FullMethodName = "/stencil.v1.Stencil/Validate"
+	Stencil_Report_FullMethodName   = "/stencil.v1.Stencil/Report"
+)
+
+// StencilClient is the client API for Stencil service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StencilClient interface {
+	// Convert converts a paste layer or zip archive, streaming progress and
+	// warnings as it goes, then the mesh in chunks, then the result.
+	Convert(ctx context.Context, in *ConvertRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConvertEvent], error)
+	// Validate runs the pre-flight checks of the validate subcommand on each
+	// file, streaming a report per file in order.
+	Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ValidationReport], error)
+	// Report returns the result of a conversion of the last hour by its id,
+	// from Convert or the X-Stencil-Id of POST /convert.
+	Report(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*Result, error)
+}
+
+type stencilClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStencilClient(cc grpc.ClientConnInterface) StencilClient {
+	return &stencilClient{cc}
+}
+
+func (c *stencilClient) Convert(ctx context.Context, in *ConvertRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConvertEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Stencil_ServiceDesc.Streams[0], Stencil_Convert_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConvertRequest, ConvertEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stencil_ConvertClient = grpc.ServerStreamingClient[ConvertEvent]
+
+func (c *stencilClient) Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ValidationReport], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Stencil_ServiceDesc.Streams[1], Stencil_Validate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ValidateRequest, ValidationReport]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stencil_ValidateClient = grpc.ServerStreamingClient[ValidationReport]
+
+func (c *stencilClient) Report(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, Stencil_Report_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StencilServer is the server API for Stencil service.
+// All implementations must embed UnimplementedStencilServer
+// for forward compatibility.
+type StencilServer interface {
+	// Convert converts a paste layer or zip archive, streaming progress and
+	// warnings as it goes, then the mesh in chunks, then the result.
+	Convert(*ConvertRequest, grpc.ServerStreamingServer[ConvertEvent]) error
+	// Validate runs the pre-flight checks of the validate subcommand on each
+	// file, streaming a report per file in order.
+	Validate(*ValidateRequest, grpc.ServerStreamingServer[ValidationReport]) error
+	// Report returns the result of a conversion of the last hour by its id,
+	// from Convert or the X-Stencil-Id of POST /convert.
+	Report(context.Context, *ReportRequest) (*Result, error)
+	mustEmbedUnimplementedStencilServer()
+}
+
+// UnimplementedStencilServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedStencilServer struct{}
+
+func (UnimplementedStencilServer) Convert(*ConvertRequest, grpc.ServerStreamingServer[ConvertEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Convert not implemented")
+}
+func (UnimplementedStencilServer) Validate(*ValidateRequest, grpc.ServerStreamingServer[ValidationReport]) error {
+	return status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (UnimplementedStencilServer) Report(context.Context, *ReportRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Report not implemented")
+}
+func (UnimplementedStencilServer) mustEmbedUnimplementedStencilServer() {}
+func (UnimplementedStencilServer) testEmbeddedByValue()                 {}
+
+// UnsafeStencilServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StencilServer will
+// result in compilation errors.
+type UnsafeStencilServer interface {
+	mustEmbedUnimplementedStencilServer()
+}
+
+func RegisterStencilServer(s grpc.ServiceRegistrar, srv StencilServer) {
+	// If the following call pancis, it indicates UnimplementedStencilServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Stencil_ServiceDesc, srv)
+}
+
+func _Stencil_Convert_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConvertRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StencilServer).Convert(m, &grpc.GenericServerStream[ConvertRequest, ConvertEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stencil_ConvertServer = grpc.ServerStreamingServer[ConvertEvent]
+
+func _Stencil_Validate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ValidateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StencilServer).Validate(m, &grpc.GenericServerStream[ValidateRequest, ValidationReport]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stencil_ValidateServer = grpc.ServerStreamingServer[ValidationReport]
+
+func _Stencil_Report_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StencilServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stencil_Report_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StencilServer).Report(ctx, req.(*ReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Stencil_ServiceDesc is the grpc.ServiceDesc for Stencil service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Stencil_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "stencil.v1.Stencil",
+	HandlerType: (*StencilServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Report",
+			Handler:    _Stencil_Report_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Convert",
+			Handler:       _Stencil_Convert_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Validate",
+			Handler:       _Stencil_Validate_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "stencil/v1/stencil.proto",
+}
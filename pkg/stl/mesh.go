@@ -0,0 +1,71 @@
+package stl
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"path/filepath"
+	"slices"
+)
+
+// Point is a vertex of a mesh, in mm.
+type Point struct {
+	X, Y, Z float64
+}
+
+// FacetNormal returns the unit normal of a triangle, pointing to the side its
+// vertices are seen counter-clockwise from (zero for a degenerate triangle).
+func FacetNormal(t [3]Point) Point {
+	ux, uy, uz := t[1].X-t[0].X, t[1].Y-t[0].Y, t[1].Z-t[0].Z
+	vx, vy, vz := t[2].X-t[0].X, t[2].Y-t[0].Y, t[2].Z-t[0].Z
+	n := Point{uy*vz - uz*vy, uz*vx - ux*vz, ux*vy - uy*vx}
+	l := math.Sqrt(n.X*n.X + n.Y*n.Y + n.Z*n.Z)
+	if l == 0 {
+		return Point{}
+	}
+	return Point{n.X / l, n.Y / l, n.Z / l}
+}
+
+// SignedVolume returns the volume enclosed by a closed mesh, negative when
+// its triangles wind clockwise seen from outside.
+func SignedVolume(triangles [][3]Point) float64 {
+	return SeqVolume(slices.Values(triangles))
+}
+
+// SeqVolume is SignedVolume of a sequence of triangles.
+func SeqVolume(triangles iter.Seq[[3]Point]) float64 {
+	v := 0.0
+	for t := range triangles {
+		a, b, c := t[0], t[1], t[2]
+		v += a.X*(b.Y*c.Z-b.Z*c.Y) - a.Y*(b.X*c.Z-b.Z*c.X) + a.Z*(b.X*c.Y-b.Y*c.X)
+	}
+	return v / 6
+}
+
+// Info describes the stencil in the metadata of the mesh files, so a file
+// can be traced back to what it was made from.
+type Info struct {
+	Name         string  // Object name, from the paste layer's
+	Source       string  // Paste layer the stencil was made from
+	Thickness    float64 // Plate thickness, mm
+	DPI          float64 // Render resolution, 0 when meshed from the gerber geometry
+	Compensation string  // How the openings were resized, empty when they weren't
+	Units        string  // Of the coordinates, for formats without a unit field
+	Tool         string  // Name and version of the program that made it
+}
+
+// Summary is a line describing the stencil: its source, thickness, how it
+// was meshed and the tool version.
+func (m Info) Summary() string {
+	s := fmt.Sprintf("%s, %g mm", filepath.Base(m.Source), m.Thickness)
+	if m.DPI > 0 {
+		s += fmt.Sprintf(", %g DPI", m.DPI)
+	}
+	if m.Compensation != "" {
+		s += ", openings " + m.Compensation
+	}
+	if m.Tool != "" {
+		s += ", " + m.Tool
+	}
+	return s
+}
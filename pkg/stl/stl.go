@@ -0,0 +1,163 @@
+// Package stl writes triangle meshes as binary STL files, and holds the
+// mesh types the other packages build them from.
+package stl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+
+	"pcb-to-stencil/pkg/progress"
+)
+
+// Writer streams triangles to a binary STL through a buffer, so a mesh
+// doesn't have to be held in memory to be written.
+type Writer struct {
+	f     io.Writer
+	w     *bufio.Writer
+	want  int // Triangles announced in the header, -1 to patch in on Close
+	count int
+	buf   [50]byte
+}
+
+// NewWriter writes the header of a binary STL with info to f. The header
+// holds the number of triangles, count; when it isn't known yet, pass -1 and
+// f must be an io.WriteSeeker for Close to write it.
+func NewWriter(f io.Writer, info Info, count int) (*Writer, error) {
+	if _, ok := f.(io.WriteSeeker); count < 0 && !ok {
+		return nil, fmt.Errorf("STL triangle count is needed up front when writing to a stream")
+	}
+	if count > math.MaxUint32 {
+		return nil, fmt.Errorf("%d triangles is too many for an STL", count)
+	}
+	s := &Writer{f: f, w: bufio.NewWriterSize(f, 1<<16), want: count}
+
+	// The 80 byte header mustn't start with "solid" or readers take it for
+	// an ASCII STL, then the 4 byte triangle count
+	header := make([]byte, 84)
+	copy(header[:80], info.Name+", units "+info.Units+": "+info.Summary())
+	binary.LittleEndian.PutUint32(header[80:], uint32(max(count, 0)))
+	if _, err := s.w.Write(header); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write adds a triangle, wound as given, with the facet normal computed from
+// its winding.
+func (s *Writer) Write(t [3]Point) error {
+	// Each triangle is 50 bytes: the normal and 3 vertices of 3 floats, and
+	// an attribute byte count of 0
+	buf := s.buf[:]
+	n := FacetNormal(t)
+	for i, p := range [4]Point{n, t[0], t[1], t[2]} {
+		binary.LittleEndian.PutUint32(buf[12*i:], math.Float32bits(float32(p.X)))
+		binary.LittleEndian.PutUint32(buf[12*i+4:], math.Float32bits(float32(p.Y)))
+		binary.LittleEndian.PutUint32(buf[12*i+8:], math.Float32bits(float32(p.Z)))
+	}
+	binary.LittleEndian.PutUint16(buf[48:], 0)
+	s.count++
+	if s.count > math.MaxUint32 {
+		return fmt.Errorf("%d triangles is too many for an STL", s.count)
+	}
+	_, err := s.w.Write(buf)
+	return err
+}
+
+// Close flushes the buffer and, if it wasn't known up front, writes the
+// triangle count into the header. It doesn't close f.
+func (s *Writer) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.want >= 0 {
+		if s.count != s.want {
+			return fmt.Errorf("STL header announces %d triangles, %d were written", s.want, s.count)
+		}
+		return nil
+	}
+	ws := s.f.(io.WriteSeeker)
+	if _, err := ws.Seek(80, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(ws, binary.LittleEndian, uint32(s.count)); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// WriteFile writes a binary STL with counter-clockwise (outward) winding and
+// facet normals computed from it, and info in the header. A mesh wound inside
+// out is written flipped. How far it got is reported to report.
+func WriteFile(filename string, triangles [][3]Point, info Info, report progress.Func) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := Write(f, triangles, info, report); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the binary STL of WriteFile to f.
+func Write(f io.Writer, triangles [][3]Point, info Info, report progress.Func) error {
+	s, err := NewWriter(f, info, len(triangles))
+	if err != nil {
+		return err
+	}
+	flip := SignedVolume(triangles) < 0
+	for i, t := range triangles {
+		if i%65536 == 0 {
+			report.Report("Writing STL", i, len(triangles))
+		}
+		if flip {
+			t[1], t[2] = t[2], t[1]
+		}
+		if err := s.Write(t); err != nil {
+			return err
+		}
+	}
+	report.Report("Writing STL", len(triangles), len(triangles))
+	return s.Close()
+}
+
+// WriteSeq streams the triangles of seq to a binary STL as they come,
+// for meshes too large to collect first. count is how many there are, or -1
+// if that isn't known, and how far it got is reported to report when it is.
+// Unlike WriteFile it can't check the winding, so they must already be wound
+// counter-clockwise seen from outside.
+func WriteSeq(filename string, triangles iter.Seq[[3]Point], count int, info Info, report progress.Func) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := NewWriter(f, info, count)
+	if err != nil {
+		return err
+	}
+	i := 0
+	for t := range triangles {
+		if count > 0 && i%65536 == 0 {
+			report.Report("Writing STL", i, count)
+		}
+		if err := s.Write(t); err != nil {
+			return err
+		}
+		i++
+	}
+	if count >= 0 {
+		report.Report("Writing STL", count, count)
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBar draws one self-updating line per stage with the percentage
+// done and an estimate of the time left, and clears it when the stage ends.
+type progressBar struct {
+	w     io.Writer
+	mu    sync.Mutex
+	stage string
+	start time.Time
+	last  time.Time
+	drawn bool
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w}
+}
+
+const progressBarWidth = 30
+
+func (p *progressBar) update(stage string, done, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if stage != p.stage {
+		p.stage, p.start, p.last = stage, now, time.Time{}
+	}
+	if done >= total {
+		if p.drawn {
+			fmt.Fprint(p.w, "\r\033[K")
+			p.drawn = false
+		}
+		p.stage = "" // The next stage restarts the clock even if it has the same name
+		return
+	}
+	if now.Sub(p.last) < 100*time.Millisecond {
+		return // Redrawing faster than this only costs time
+	}
+	p.last = now
+
+	frac := float64(done) / float64(total)
+	n := int(frac * progressBarWidth)
+	eta := "?"
+	if done > 0 {
+		left := time.Duration(float64(now.Sub(p.start)) * (1 - frac) / frac)
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(p.w, "\r%-12s [%s%s] %3.0f%% %d/%d ETA %s\033[K", stage,
+		strings.Repeat("#", n), strings.Repeat(".", progressBarWidth-n), frac*100, done, total, eta)
+	p.drawn = true
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// projectFiles are the settings files picked up from the working directory
+// when -config isn't given.
+var projectFiles = []string{"stencil.yaml", "stencil.yml", "stencil.toml"}
+
+// projectPathKeys are the settings naming files, taken relative to the
+// settings file rather than the working directory.
+var projectPathKeys = map[string]bool{
+	"paste": true, "outline": true, "drill": true, "bottom": true,
+	"centroid": true, "o": true, "out-dir": true,
+}
+
+// projectRepeatable are the flags a list gives once per item; any other
+// list is joined with commas.
+var projectRepeatable = map[string]bool{"step": true}
+
+// ProjectSetting is one option from a settings file.
+type ProjectSetting struct {
+	Key    string
+	Values []string
+	Line   int
+}
+
+// parseProjectFile reads a settings file: one option per line, named as its
+// flag, as key: value in YAML or key = value in TOML. Values may be quoted,
+// lists are written [a, b] or as "- item" lines under the key, and # starts
+// a comment. This is the flat subset of YAML and TOML the options need, not
+// either in full.
+func parseProjectFile(path string) ([]ProjectSetting, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sep := ":"
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		sep = "="
+	}
+	var settings []ProjectSetting
+	list := false // The last key had no value, so "- item" lines may follow
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			if !list {
+				return nil, fmt.Errorf("%s:%d: list item without a key", path, n)
+			}
+			v, err := unquote(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			s := &settings[len(settings)-1]
+			s.Values = append(s.Values, v)
+			continue
+		}
+		if strings.HasPrefix(line, "[") && sep == "=" {
+			return nil, fmt.Errorf("%s:%d: tables aren't supported, give the options at the top level", path, n)
+		}
+		k, v, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want key%s value", path, n, sep)
+		}
+		s := ProjectSetting{Key: strings.Trim(strings.TrimSpace(k), `"'`), Line: n}
+		v = strings.TrimSpace(v)
+		list = v == ""
+		switch {
+		case list:
+		case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				item, err := unquote(item)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+				s.Values = append(s.Values, item)
+			}
+		default:
+			v, err := unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			s.Values = []string{v}
+		}
+		settings = append(settings, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// stripComment cuts a # comment off a line, leaving any # in quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return s[1 : len(s)-1], nil
+	}
+	return s, nil
+}
+
+// findProjectFile returns the settings file to use: path, or the first of
+// projectFiles in the working directory, or "" for none.
+func findProjectFile(path string) string {
+	if path != "" {
+		return path
+	}
+	for _, name := range projectFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// applyProjectFile sets the flags in the settings file at path that weren't
+// given on the command line, and returns the input files it names, paste
+// then outline, for when none are given.
+func applyProjectFile(path string) ([]string, error) {
+	settings, err := parseProjectFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no settings file %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading settings: %v", err)
+	}
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	dir := filepath.Dir(path)
+	var inputs [2]string
+	for _, s := range settings {
+		if projectPathKeys[s.Key] {
+			for i, v := range s.Values {
+				if v != "" && v != "-" && !filepath.IsAbs(v) {
+					s.Values[i] = filepath.Join(dir, v)
+				}
+			}
+		}
+		switch s.Key {
+		case "paste", "outline":
+			if len(s.Values) != 1 {
+				return nil, fmt.Errorf("%s:%d: %s takes one file", path, s.Line, s.Key)
+			}
+			if s.Key == "paste" {
+				inputs[0] = s.Values[0]
+			} else {
+				inputs[1] = s.Values[0]
+			}
+			continue
+		case "config":
+			return nil, fmt.Errorf("%s:%d: a settings file can't name another", path, s.Line)
+		}
+		if flag.Lookup(s.Key) == nil {
+			return nil, fmt.Errorf("%s:%d: unknown option %q", path, s.Line, s.Key)
+		}
+		if given[s.Key] {
+			continue
+		}
+		values := s.Values
+		if !projectRepeatable[s.Key] {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := flag.Set(s.Key, v); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid %s %q: %v", path, s.Line, s.Key, v, err)
+			}
+		}
+	}
+	if inputs[0] == "" {
+		if inputs[1] != "" {
+			return nil, fmt.Errorf("%s: outline is set without paste", path)
+		}
+		return nil, nil
+	}
+	if inputs[1] == "" {
+		return inputs[:1], nil
+	}
+	return inputs[:], nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pcb-to-stencil/pkg/stencil"
+)
+
+//go:embed static/*
+var staticFiles embed.FS
+
+// tempTTL is how long uploads and outputs are kept in temp, for the result
+// page's downloads and its conversions of the same files again.
+const tempTTL = time.Hour
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	// Read index.html from embedded FS
+	content, err := staticFiles.ReadFile("static/index.html")
+	if err != nil {
+		http.Error(w, "Could not load index page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(content)
+}
+
+// makeTempDir creates temp for a request's files, responding with an error
+// if it can't.
+func makeTempDir(w http.ResponseWriter) (string, bool) {
+	tempDir := filepath.Join(".", "temp")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("Error creating temp directory: %v", err)
+		http.Error(w, "Error creating temp directory", http.StatusInternalServerError)
+		return "", false
+	}
+	return tempDir, true
+}
+
+// cleanTemp removes the files in dir older than ttl, every ttl/4, until the
+// server stops.
+func cleanTemp(dir string, ttl time.Duration) {
+	for {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > ttl {
+				if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+					log.Printf("Warning: could not remove %s: %v", e.Name(), err)
+				}
+			}
+		}
+		time.Sleep(ttl / 4)
+	}
+}
+
+// savedFile returns the path in temp of a file an earlier upload saved, as
+// named by a result page's form, if it is one. Using it again keeps it
+// another tempTTL.
+func savedFile(name string) (string, bool) {
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+		return "", false
+	}
+	path := filepath.Join("temp", name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return path, true
+}
+
+// saveUpload saves the uploaded file field, if there is one, in temp as
+// uuid_role with its extension.
+func saveUpload(r *http.Request, field, tempDir, uuid, role string) (string, string, error) {
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	path, err := saveFile(file, header.Filename, tempDir, uuid, role)
+	return path, header.Filename, err
+}
+
+// saveFile saves r in temp as uuid_role with the extension of name,
+// returning its path even if writing it failed.
+func saveFile(r io.Reader, name, tempDir, uuid, role string) (string, error) {
+	path := filepath.Join(tempDir, uuid+"_"+role+filepath.Ext(name))
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return path, err
+}
+
+// uploadInputs picks the layers out of an uploaded zip archive, named name,
+// keeping any outline and drill file uploaded beside it. The extracted
+// files are in the returned directory, to remove when done.
+func uploadInputs(in stencil.Inputs, name string) (stencil.Inputs, string, error) {
+	if !strings.EqualFold(filepath.Ext(name), ".zip") {
+		return in, "", nil
+	}
+	zipIn, _, zipDir, err := stencil.ResolveInputs(in.Paste, stencil.LayerSelection{})
+	if err != nil {
+		return in, "", err
+	}
+	if in.Outline == "" {
+		in.Outline = zipIn.Outline
+	}
+	if in.Drill == "" {
+		in.Drill = zipIn.Drill
+	}
+	in.Paste, in.Output, in.Job = zipIn.Paste, zipIn.Output, zipIn.Job
+	return in, zipDir, nil
+}
+
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Create temp dir
+	tempDir, ok := makeTempDir(w)
+	if !ok {
+		return
+	}
+
+	uuid := randomID()
+
+	// Parse params
+	height, _ := strconv.ParseFloat(r.FormValue("height"), 64)
+	dpi, _ := strconv.ParseFloat(r.FormValue("dpi"), 64)
+	wallHeight, _ := strconv.ParseFloat(r.FormValue("wallHeight"), 64)
+	wallThickness, _ := strconv.ParseFloat(r.FormValue("wallThickness"), 64)
+	shrinkX, shrinkY, err := stencil.ParseShrink(r.FormValue("shrink"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid shrink: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Fields left empty keep the defaults
+	cfg := stencil.DefaultConfig()
+	for _, f := range []struct{ v, to *float64 }{
+		{&height, &cfg.StencilHeight},
+		{&dpi, &cfg.DPI},
+		{&wallHeight, &cfg.WallHeight},
+		{&wallThickness, &cfg.WallThickness},
+	} {
+		if *f.v != 0 {
+			*f.to = *f.v
+		}
+	}
+	cfg.ShrinkX, cfg.ShrinkY = shrinkX, shrinkY
+	cfg.PreviewHTML = true
+	if err := cfg.Check(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid settings: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Handle Gerber File, or the one saved by an earlier upload when the
+	// result page converts it again with other settings
+	var gerberPath, gerberName string
+	if saved, ok := savedFile(r.FormValue("savedGerber")); ok {
+		gerberPath, gerberName = saved, saved
+	} else if gerberPath, gerberName, err = saveUpload(r, "gerber", tempDir, uuid, "paste"); err != nil {
+		http.Error(w, "Error retrieving gerber file", http.StatusBadRequest)
+		return
+	}
+
+	// Handle Outline and Drill Files (Optional)
+	outlinePath, ok := savedFile(r.FormValue("savedOutline"))
+	if !ok {
+		outlinePath, _, _ = saveUpload(r, "outline", tempDir, uuid, "outline")
+	}
+	drillPath, ok := savedFile(r.FormValue("savedDrill"))
+	if !ok {
+		drillPath, _, _ = saveUpload(r, "drill", tempDir, uuid, "drill")
+	}
+
+	in, zipDir, err := uploadInputs(stencil.Inputs{Paste: gerberPath, Outline: outlinePath, Drill: drillPath}, gerberName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading archive: %v", err), http.StatusBadRequest)
+		return
+	}
+	if zipDir != "" {
+		defer os.RemoveAll(zipDir)
+	}
+
+	// Process
+	res, err := stencil.Convert(in, cfg)
+	if err != nil {
+		log.Printf("Error processing: %v", err)
+		http.Error(w, fmt.Sprintf("Error processing PCB: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Render Success
+	tmpl, err := template.ParseFS(staticFiles, "static/result.html")
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Filename, Preview                      string
+		SavedGerber, SavedOutline, SavedDrill  string
+		Height, DPI, WallHeight, WallThickness float64
+		Shrink                                 string
+		Triangles                              int
+	}{
+		Filename:      filepath.Base(res.Output),
+		Preview:       stencilID(res.Output),
+		SavedGerber:   filepath.Base(gerberPath),
+		Height:        height,
+		DPI:           dpi,
+		WallHeight:    wallHeight,
+		WallThickness: wallThickness,
+		Shrink:        r.FormValue("shrink"),
+		Triangles:     res.Triangles,
+	}
+	if outlinePath != "" {
+		data.SavedOutline = filepath.Base(outlinePath)
+	}
+	if drillPath != "" {
+		data.SavedDrill = filepath.Base(drillPath)
+	}
+	tmpl.Execute(w, data)
+}
+
+// previewHandler shows the 3D preview page of the conversion with the id a
+// result page or POST /convert gave.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	path, ok := savedFile(r.URL.Query().Get("id") + ".html")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	http.ServeFile(w, r, path)
+}
+
+// stencilID names a conversion by its mesh, for GET /preview.
+func stencilID(output string) string {
+	return strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+}
+
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	vars := strings.Split(r.URL.Path, "/")
+	if len(vars) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+	filename := vars[2]
+
+	// Security check: ensure no path traversal
+	if strings.Contains(filename, "/") || strings.Contains(filename, "\\") || strings.Contains(filename, "..") {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	path := filepath.Join("temp", filename)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeFile(w, r, path)
+}
+
+// runServer serves the web interface and REST API on port, and the gRPC
+// service on grpcPort as well if it's set.
+func runServer(port, grpcPort string) {
+	// Serve static files (CSS, etc.)
+	// This will serve files under /static/ from the embedded fs
+	http.Handle("/static/", http.FileServer(http.FS(staticFiles)))
+
+	http.HandleFunc("/", indexHandler)
+	http.HandleFunc("/upload", uploadHandler)
+	http.HandleFunc("/download/", downloadHandler)
+	http.HandleFunc("/preview", previewHandler)
+	http.HandleFunc("/convert", convertHandler)
+	go cleanTemp("temp", tempTTL)
+	if grpcPort != "" {
+		go serveGRPC(grpcPort)
+	}
+
+	fmt.Printf("Starting server on http://0.0.0.0:%s\n", port)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
+}